@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"errors"
+	"math"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+)
+
+// AdaptiveTimeoutExchanger wraps an [Exchanger] (e.g., a [*Transport]) and bounds
+// each exchange with a timeout derived from the latency percentile of its recent
+// successful exchanges, clamped between Floor and Ceiling.
+//
+// This way, slow but working servers do not time out spuriously, while
+// servers that stopped answering fail quickly.
+//
+// Construct using [NewAdaptiveTimeoutExchanger].
+type AdaptiveTimeoutExchanger struct {
+	// Exchanger is the wrapped [Exchanger].
+	//
+	// Set by [NewAdaptiveTimeoutExchanger] to the user-provided value.
+	Exchanger Exchanger
+
+	// Floor is the minimum timeout.
+	//
+	// Set by [NewAdaptiveTimeoutExchanger] to the user-provided value.
+	Floor time.Duration
+
+	// Ceiling is the maximum timeout, which we also use until we have
+	// collected at least MinSamples latency samples.
+	//
+	// Set by [NewAdaptiveTimeoutExchanger] to the user-provided value.
+	Ceiling time.Duration
+
+	// Percentile is the latency percentile in (0, 1] to use.
+	//
+	// Set by [NewAdaptiveTimeoutExchanger] to 0.95.
+	Percentile float64
+
+	// Multiplier scales the percentile latency to leave some headroom.
+	//
+	// Set by [NewAdaptiveTimeoutExchanger] to 2.
+	Multiplier float64
+
+	// MinSamples is the minimum number of samples for deriving the timeout.
+	//
+	// Set by [NewAdaptiveTimeoutExchanger] to 8.
+	MinSamples int
+
+	// Window is the maximum number of recent samples we keep.
+	//
+	// Set by [NewAdaptiveTimeoutExchanger] to 128.
+	Window int
+
+	// ObserveTimeout is an optional hook called before each exchange
+	// with the timeout we are about to use.
+	ObserveTimeout func(timeout time.Duration)
+
+	// mu protects samples and next.
+	mu sync.Mutex
+
+	// next is the index of the next sample to overwrite when samples is full.
+	next int
+
+	// samples contains the recent latency samples.
+	samples []time.Duration
+}
+
+var _ Exchanger = &AdaptiveTimeoutExchanger{}
+
+// NewAdaptiveTimeoutExchanger creates a new [*AdaptiveTimeoutExchanger].
+func NewAdaptiveTimeoutExchanger(exchanger Exchanger, floor, ceiling time.Duration) *AdaptiveTimeoutExchanger {
+	return &AdaptiveTimeoutExchanger{
+		Exchanger:  exchanger,
+		Floor:      floor,
+		Ceiling:    ceiling,
+		Percentile: 0.95,
+		Multiplier: 2,
+		MinSamples: 8,
+		Window:     128,
+	}
+}
+
+// Exchange implements [Exchanger].
+func (ax *AdaptiveTimeoutExchanger) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	// 1. bound the exchange using the current timeout
+	timeout := ax.Timeout()
+	if ax.ObserveTimeout != nil {
+		ax.ObserveTimeout(timeout)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// 2. learn from exchanges where the server answered
+	//
+	// Negative answers count since the server did answer, while we do not
+	// learn from failures because timeouts would bias the percentile.
+	t0 := time.Now()
+	resp, err := ax.Exchanger.Exchange(ctx, query)
+	if isAnswered(err) {
+		ax.record(time.Since(t0))
+	}
+	return resp, err
+}
+
+// isAnswered returns whether the server answered, i.e., whether the
+// exchange succeeded or failed with a negative answer.
+func isAnswered(err error) bool {
+	return err == nil || errors.Is(err, dnscodec.ErrNoName) || errors.Is(err, dnscodec.ErrNoData)
+}
+
+// record adds a latency sample, replacing the oldest one when the window is full.
+func (ax *AdaptiveTimeoutExchanger) record(latency time.Duration) {
+	ax.mu.Lock()
+	defer ax.mu.Unlock()
+	if len(ax.samples) < max(ax.Window, 1) {
+		ax.samples = append(ax.samples, latency)
+		return
+	}
+	ax.samples[ax.next%len(ax.samples)] = latency
+	ax.next = (ax.next + 1) % len(ax.samples)
+}
+
+// Timeout returns the timeout that the next exchange would use.
+//
+// This method is safe to call from multiple goroutines.
+func (ax *AdaptiveTimeoutExchanger) Timeout() time.Duration {
+	ax.mu.Lock()
+	samples := slices.Clone(ax.samples)
+	ax.mu.Unlock()
+	if len(samples) <= 0 || len(samples) < ax.MinSamples {
+		return ax.Ceiling
+	}
+	slices.Sort(samples)
+	timeout := time.Duration(float64(latencyPercentile(samples, ax.Percentile)) * ax.Multiplier)
+	return min(max(timeout, ax.Floor), ax.Ceiling)
+}
+
+// latencyPercentile returns the given percentile in (0, 1] of the
+// sorted non-empty samples using the nearest-rank method.
+func latencyPercentile(sorted []time.Duration, percentile float64) time.Duration {
+	idx := int(math.Ceil(percentile*float64(len(sorted)))) - 1
+	return sorted[min(max(idx, 0), len(sorted)-1)]
+}
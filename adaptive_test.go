@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdaptiveTimeoutExchanger(t *testing.T) {
+	const (
+		floor   = 50 * time.Millisecond
+		ceiling = time.Hour
+	)
+
+	// the server fails when failing is true and stops answering when dead is true
+	var dead, failing bool
+	mockedErr := errors.New("mocked error")
+	ax := dnsoverhttps.NewAdaptiveTimeoutExchanger(funcExchanger(
+		func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+			switch {
+			case dead:
+				<-ctx.Done()
+				return nil, ctx.Err()
+			case failing:
+				return nil, mockedErr
+			default:
+				return &dnscodec.Response{}, nil
+			}
+		}), floor, ceiling)
+	var timeouts []time.Duration
+	ax.ObserveTimeout = func(timeout time.Duration) {
+		timeouts = append(timeouts, timeout)
+	}
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+
+	// 1. failures do not count as samples
+	failing = true
+	for range ax.MinSamples {
+		_, err := ax.Exchange(context.Background(), query)
+		require.ErrorIs(t, err, mockedErr)
+	}
+	assert.Equal(t, ceiling, ax.Timeout())
+
+	// 2. until we have enough samples, we use the ceiling
+	failing = false
+	for range ax.MinSamples {
+		_, err := ax.Exchange(context.Background(), query)
+		require.NoError(t, err)
+	}
+	require.Len(t, timeouts, 2*ax.MinSamples)
+	for _, timeout := range timeouts {
+		assert.Equal(t, ceiling, timeout)
+	}
+
+	// 3. with enough fast samples, we clamp to the floor
+	assert.Equal(t, floor, ax.Timeout())
+
+	// 4. a dead server fails fast
+	dead = true
+	t0 := time.Now()
+	_, err := ax.Exchange(context.Background(), query)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(t0), time.Second)
+	assert.Equal(t, floor, timeouts[len(timeouts)-1])
+}
+
+func TestAdaptiveTimeoutExchangerWindow(t *testing.T) {
+	var latency time.Duration
+	ax := dnsoverhttps.NewAdaptiveTimeoutExchanger(funcExchanger(
+		func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+			time.Sleep(latency)
+			return nil, dnscodec.ErrNoData
+		}), 0, time.Hour)
+	ax.Window = 4
+	ax.MinSamples = 4
+	ax.Multiplier = 1
+	ax.Percentile = 1
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+
+	// negative answers count as samples and older samples leave the window
+	latency = 100 * time.Millisecond
+	_, _ = ax.Exchange(context.Background(), query)
+	latency = 0
+	for range ax.Window {
+		_, _ = ax.Exchange(context.Background(), query)
+	}
+	assert.Less(t, ax.Timeout(), 50*time.Millisecond)
+}
@@ -0,0 +1,158 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net/netip"
+	"slices"
+
+	"github.com/miekg/dns"
+)
+
+// AddrComparator compares two destination addresses like [cmp.Compare],
+// returning a negative number when a should come before b.
+type AddrComparator func(a, b netip.Addr) int
+
+// LookupAddrs queries the AAAA and A records of the given name using the
+// given [Exchanger] and returns the merged addresses.
+//
+// When compare is nil, we preserve the wire order and return the AAAA addresses
+// before the A addresses. Otherwise, we stable-sort the addresses using compare
+// (e.g., [CompareAddrsRFC6724]), since the order affects which address the
+// downstream code connects to first.
+//
+// We return an error joining both errors only when both queries fail.
+func LookupAddrs(ctx context.Context, exchanger Exchanger, name string, compare AddrComparator) ([]netip.Addr, error) {
+	// 1. perform both lookups
+	aaaas, errAAAA := Lookup[*dns.AAAA](ctx, exchanger, name)
+	as, errA := Lookup[*dns.A](ctx, exchanger, name)
+	if errAAAA != nil && errA != nil {
+		return nil, errors.Join(errAAAA, errA)
+	}
+
+	// 2. merge the addresses
+	var addrs []netip.Addr
+	for _, aaaa := range aaaas {
+		if addr, ok := rrAddr(aaaa); ok {
+			addrs = append(addrs, addr)
+		}
+	}
+	for _, a := range as {
+		if addr, ok := rrAddr(a); ok {
+			addrs = append(addrs, addr)
+		}
+	}
+
+	// 3. sort if needed
+	if compare != nil {
+		slices.SortStableFunc(addrs, compare)
+	}
+	return addrs, nil
+}
+
+// rrAddr returns the address of an A or AAAA record. We unmap IPv4-mapped
+// IPv6 addresses, such that they match IPv4 prefixes and format like IPv4
+// addresses, which is what [net.IP] String does.
+func rrAddr(rr dns.RR) (netip.Addr, bool) {
+	var (
+		addr netip.Addr
+		ok   bool
+	)
+	switch rr := rr.(type) {
+	case *dns.A:
+		addr, ok = netip.AddrFromSlice(rr.A)
+	case *dns.AAAA:
+		addr, ok = netip.AddrFromSlice(rr.AAAA)
+	}
+	return addr.Unmap(), ok
+}
+
+// answerAddrs returns the addresses of the A and AAAA records in order,
+// skipping the records with invalid addresses. See [rrAddr].
+func answerAddrs(rrs []dns.RR) []netip.Addr {
+	var out []netip.Addr
+	for _, rr := range rrs {
+		if addr, ok := rrAddr(rr); ok {
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+// rfc6724Policy is an entry of the RFC 6724 Section 2.1 default policy table.
+type rfc6724Policy struct {
+	// prefix is the entry prefix.
+	prefix netip.Prefix
+
+	// precedence is the entry precedence.
+	precedence int
+}
+
+// rfc6724PolicyTable is the RFC 6724 default policy table sorted
+// by decreasing prefix length, such that the first match wins.
+var rfc6724PolicyTable = []rfc6724Policy{
+	{prefix: netip.MustParsePrefix("::1/128"), precedence: 50},
+	{prefix: netip.MustParsePrefix("::ffff:0:0/96"), precedence: 35},
+	{prefix: netip.MustParsePrefix("::/96"), precedence: 1},
+	{prefix: netip.MustParsePrefix("2001::/32"), precedence: 5},
+	{prefix: netip.MustParsePrefix("2002::/16"), precedence: 30},
+	{prefix: netip.MustParsePrefix("3ffe::/16"), precedence: 1},
+	{prefix: netip.MustParsePrefix("fec0::/10"), precedence: 1},
+	{prefix: netip.MustParsePrefix("fc00::/7"), precedence: 3},
+	{prefix: netip.MustParsePrefix("::/0"), precedence: 40},
+}
+
+// CompareAddrsRFC6724 is an [AddrComparator] implementing the RFC 6724 Section 6
+// destination address selection rules that do not depend on the source addresses,
+// which we typically do not know when resolving names for measurements. That
+// is, we prefer higher precedence according to the default policy table (Rule 6)
+// and then smaller scope (Rule 8). Stable sorting implements Rule 10.
+//
+// With the default policy table, this means we prefer global IPv6 addresses
+// to IPv4 addresses, which we prefer to 6to4, Teredo, and ULA addresses.
+func CompareAddrsRFC6724(a, b netip.Addr) int {
+	// Rule 6: prefer higher precedence
+	if c := cmp.Compare(rfc6724Precedence(b), rfc6724Precedence(a)); c != 0 {
+		return c
+	}
+
+	// Rule 8: prefer smaller scope
+	return cmp.Compare(rfc6724Scope(a), rfc6724Scope(b))
+}
+
+// rfc6724Precedence returns the precedence of the address.
+func rfc6724Precedence(addr netip.Addr) int {
+	addr = netip.AddrFrom16(addr.As16())
+	for _, policy := range rfc6724PolicyTable {
+		if policy.prefix.Contains(addr) {
+			return policy.precedence
+		}
+	}
+	return 0
+}
+
+// siteLocalPrefix is the deprecated IPv6 site-local prefix (RFC 3879).
+var siteLocalPrefix = netip.MustParsePrefix("fec0::/10")
+
+// rfc6724Scope returns the scope of the address (RFC 6724 Section 3.1).
+func rfc6724Scope(addr netip.Addr) int {
+	const (
+		scopeLinkLocal = 0x2
+		scopeSiteLocal = 0x5
+		scopeGlobal    = 0xe
+	)
+	addr = addr.Unmap()
+	switch {
+	case addr.IsMulticast() && addr.Is6():
+		return int(addr.As16()[1] & 0x0f)
+	case addr.IsLoopback(), addr.IsLinkLocalUnicast(), addr.IsLinkLocalMulticast():
+		return scopeLinkLocal
+	case addr.Is6() && siteLocalPrefix.Contains(addr):
+		return scopeSiteLocal
+	default:
+		return scopeGlobal
+	}
+}
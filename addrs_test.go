@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addrsZoneFile is the zone file used by the [dnsoverhttps.LookupAddrs] tests.
+const addrsZoneFile = `
+$TTL 300
+@       IN SOA ns.example.com. admin.example.com. 1 7200 3600 1209600 300
+dual    IN A    192.0.2.1
+dual    IN AAAA 2002:c000:201::1
+dual    IN AAAA 2001:db8::1
+v4only  IN A    192.0.2.2
+`
+
+func TestLookupAddrs(t *testing.T) {
+	zone, err := dnsoverhttps.ParseStaticZone(strings.NewReader(addrsZoneFile), "example.com")
+	require.NoError(t, err)
+	srv := httptest.NewServer(dnsoverhttps.NewScriptedHandler(zone.Reply))
+	defer srv.Close()
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// qname is the query name.
+		qname string
+
+		// compare is the comparator to use.
+		compare dnsoverhttps.AddrComparator
+
+		// want contains the expected addresses.
+		want []string
+	}
+
+	testCases := []testCase{
+		{
+			name:  "wire order",
+			qname: "dual.example.com",
+			want:  []string{"2002:c000:201::1", "2001:db8::1", "192.0.2.1"},
+		},
+
+		{
+			name:    "RFC 6724",
+			qname:   "dual.example.com",
+			compare: dnsoverhttps.CompareAddrsRFC6724,
+			want:    []string{"2001:db8::1", "192.0.2.1", "2002:c000:201::1"},
+		},
+
+		{
+			name:    "custom comparator",
+			qname:   "dual.example.com",
+			compare: func(a, b netip.Addr) int { return a.Compare(b) },
+			want:    []string{"192.0.2.1", "2001:db8::1", "2002:c000:201::1"},
+		},
+
+		{
+			name:  "only A",
+			qname: "v4only.example.com",
+			want:  []string{"192.0.2.2"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			addrs, err := dnsoverhttps.LookupAddrs(context.Background(), dt, tt.qname, tt.compare)
+			require.NoError(t, err)
+			var got []string
+			for _, addr := range addrs {
+				got = append(got, addr.String())
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err = dnsoverhttps.LookupAddrs(context.Background(), dt, "nonexistent.example.com", nil)
+	require.ErrorIs(t, err, dnscodec.ErrNoName)
+}
+
+func TestCompareAddrsRFC6724(t *testing.T) {
+	input := []string{
+		"2001:0::1",   // Teredo
+		"fd00::1",     // ULA
+		"10.0.0.1",    // IPv4 private
+		"169.254.0.1", // IPv4 link-local
+		"fe80::1",     // IPv6 link-local
+		"2001:db8::1", // IPv6 global
+		"::1",         // IPv6 loopback
+	}
+	want := []string{
+		"::1",
+		"fe80::1",
+		"2001:db8::1",
+		"169.254.0.1",
+		"10.0.0.1",
+		"2001::1",
+		"fd00::1",
+	}
+	var addrs []netip.Addr
+	for _, s := range input {
+		addrs = append(addrs, netip.MustParseAddr(s))
+	}
+	slices.SortStableFunc(addrs, dnsoverhttps.CompareAddrsRFC6724)
+	var got []string
+	for _, addr := range addrs {
+		got = append(got, addr.String())
+	}
+	assert.Equal(t, want, got)
+}
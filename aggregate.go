@@ -0,0 +1,127 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EndpointSummary summarizes the exchanges with a server.
+type EndpointSummary struct {
+	// URL is the server URL.
+	URL string `json:"url"`
+
+	// Exchanges is the number of exchanges.
+	Exchanges int `json:"exchanges"`
+
+	// Answered is the number of exchanges where the server answered,
+	// including negative answers (i.e., NXDOMAIN and NODATA).
+	Answered int `json:"answered"`
+
+	// SuccessRate is the ratio between Answered and Exchanges.
+	SuccessRate float64 `json:"success_rate"`
+
+	// LatencyP50 is the median latency of the answered exchanges in seconds.
+	LatencyP50 float64 `json:"latency_p50"`
+
+	// LatencyP95 is the 95th percentile latency of the answered exchanges in seconds.
+	LatencyP95 float64 `json:"latency_p95"`
+
+	// LatencyP99 is the 99th percentile latency of the answered exchanges in seconds.
+	LatencyP99 float64 `json:"latency_p99"`
+}
+
+// Summary summarizes the exchanges observed by an [*Aggregator].
+type Summary struct {
+	// Endpoints contains the per-server summaries sorted by URL.
+	Endpoints []EndpointSummary `json:"endpoints"`
+
+	// Anomalies maps each anomaly (e.g., [AnomalyIDMismatch]) to the
+	// number of exchanges where we noticed it.
+	Anomalies map[string]int `json:"anomalies"`
+}
+
+// Aggregator consumes [*ExchangeEvent] and produces a [*Summary], which is
+// useful for end-of-run reports.
+//
+// Set [*Aggregator.ObserveExchange] as the [Transport.ObserveExchange] hook.
+//
+// Construct using [NewAggregator].
+type Aggregator struct {
+	// anomalies counts the anomalies.
+	anomalies map[string]int
+
+	// endpoints contains the per-server state.
+	endpoints map[string]*aggregatorEndpoint
+
+	// mu protects anomalies and endpoints.
+	mu sync.Mutex
+}
+
+// aggregatorEndpoint is the per-server state of an [*Aggregator].
+type aggregatorEndpoint struct {
+	exchanges int
+	latencies []time.Duration
+}
+
+// NewAggregator creates a new [*Aggregator].
+func NewAggregator() *Aggregator {
+	return &Aggregator{
+		anomalies: make(map[string]int),
+		endpoints: make(map[string]*aggregatorEndpoint),
+	}
+}
+
+// ObserveExchange aggregates the event.
+//
+// This method is safe to call from multiple goroutines.
+func (a *Aggregator) ObserveExchange(ev *ExchangeEvent) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	endpoint := a.endpoints[ev.URL]
+	if endpoint == nil {
+		endpoint = &aggregatorEndpoint{}
+		a.endpoints[ev.URL] = endpoint
+	}
+	endpoint.exchanges++
+	if isAnswered(ev.Err) {
+		endpoint.latencies = append(endpoint.latencies, ev.Duration)
+	}
+	for _, anomaly := range ev.Anomalies {
+		a.anomalies[anomaly]++
+	}
+}
+
+// Summary returns the [*Summary] of the exchanges observed so far.
+//
+// This method is safe to call from multiple goroutines.
+func (a *Aggregator) Summary() *Summary {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	summary := &Summary{Endpoints: []EndpointSummary{}, Anomalies: make(map[string]int)}
+	for URL, endpoint := range a.endpoints {
+		es := EndpointSummary{
+			URL:         URL,
+			Exchanges:   endpoint.exchanges,
+			Answered:    len(endpoint.latencies),
+			SuccessRate: float64(len(endpoint.latencies)) / float64(endpoint.exchanges),
+		}
+		if len(endpoint.latencies) > 0 {
+			sorted := slices.Clone(endpoint.latencies)
+			slices.Sort(sorted)
+			es.LatencyP50 = latencyPercentile(sorted, 0.50).Seconds()
+			es.LatencyP95 = latencyPercentile(sorted, 0.95).Seconds()
+			es.LatencyP99 = latencyPercentile(sorted, 0.99).Seconds()
+		}
+		summary.Endpoints = append(summary.Endpoints, es)
+	}
+	slices.SortFunc(summary.Endpoints, func(a, b EndpointSummary) int {
+		return strings.Compare(a.URL, b.URL)
+	})
+	maps.Copy(summary.Anomalies, a.anomalies)
+	return summary
+}
@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAggregator(t *testing.T) {
+	const (
+		first  = "https://first.example.com/dns-query"
+		second = "https://second.example.com/dns-query"
+	)
+	agg := dnsoverhttps.NewAggregator()
+
+	// the second endpoint answers in 1..100 ms and once with NXDOMAIN
+	for idx := 1; idx <= 100; idx++ {
+		ev := &dnsoverhttps.ExchangeEvent{URL: second, Duration: time.Duration(idx) * time.Millisecond}
+		if idx == 50 {
+			ev.Err = dnscodec.ErrNoName
+		}
+		agg.ObserveExchange(ev)
+	}
+
+	// the first endpoint fails once and answers once with anomalies
+	agg.ObserveExchange(&dnsoverhttps.ExchangeEvent{
+		URL:      first,
+		Duration: time.Second,
+		Err:      errors.New("mocked error"),
+	})
+	agg.ObserveExchange(&dnsoverhttps.ExchangeEvent{
+		URL:       first,
+		Duration:  10 * time.Millisecond,
+		Anomalies: []string{dnsoverhttps.AnomalyIDMismatch, dnsoverhttps.AnomalyTruncated},
+	})
+	agg.ObserveExchange(&dnsoverhttps.ExchangeEvent{
+		URL:       second,
+		Duration:  time.Millisecond,
+		Anomalies: []string{dnsoverhttps.AnomalyIDMismatch},
+	})
+
+	want := &dnsoverhttps.Summary{
+		Endpoints: []dnsoverhttps.EndpointSummary{{
+			URL:         first,
+			Exchanges:   2,
+			Answered:    1,
+			SuccessRate: 0.5,
+			LatencyP50:  0.010,
+			LatencyP95:  0.010,
+			LatencyP99:  0.010,
+		}, {
+			URL:         second,
+			Exchanges:   101,
+			Answered:    101,
+			SuccessRate: 1,
+			LatencyP50:  0.050,
+			LatencyP95:  0.095,
+			LatencyP99:  0.099,
+		}},
+		Anomalies: map[string]int{
+			dnsoverhttps.AnomalyIDMismatch: 2,
+			dnsoverhttps.AnomalyTruncated:  1,
+		},
+	}
+	summary := agg.Summary()
+	assert.Equal(t, want, summary)
+
+	data, err := json.Marshal(summary)
+	require.NoError(t, err)
+	var got dnsoverhttps.Summary
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, want, &got)
+}
+
+func TestAggregatorEmpty(t *testing.T) {
+	data, err := json.Marshal(dnsoverhttps.NewAggregator().Summary())
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"endpoints":[],"anomalies":{}}`, string(data))
+}
@@ -0,0 +1,203 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+)
+
+// AltSvcEntry is an alternative service advertised using Alt-Svc (RFC 7838).
+type AltSvcEntry struct {
+	// ProtocolID is the ALPN protocol ID (e.g., "h3").
+	ProtocolID string
+
+	// Host is the alternative host or an empty string for the same host.
+	Host string
+
+	// Port is the alternative port.
+	Port string
+
+	// MaxAge is for how long the entry is fresh.
+	MaxAge time.Duration
+}
+
+// ParseAltSvc parses the value of an Alt-Svc header and returns the
+// entries in order of preference, skipping malformed entries. The
+// "clear" value and empty values yield no entries.
+func ParseAltSvc(value string) []AltSvcEntry {
+	var out []AltSvcEntry
+	for _, alternative := range strings.Split(value, ",") {
+		// 1. parse the protocol ID and the quoted authority
+		params := strings.Split(alternative, ";")
+		protocolID, authority, found := strings.Cut(strings.TrimSpace(params[0]), "=")
+		if !found {
+			continue
+		}
+		authority, err := strconv.Unquote(authority)
+		if err != nil {
+			continue
+		}
+		host, port, err := net.SplitHostPort(authority)
+		if err != nil {
+			continue
+		}
+		entry := AltSvcEntry{ProtocolID: protocolID, Host: host, Port: port, MaxAge: 24 * time.Hour}
+
+		// 2. parse the max age parameter
+		for _, param := range params[1:] {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if key != "ma" {
+				continue
+			}
+			if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+				entry.MaxAge = time.Duration(seconds) * time.Second
+			}
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+// AltSvcDecision describes how an [*AltSvcUpgrader] performed an exchange.
+type AltSvcDecision struct {
+	// Upgraded is true when we used the learned HTTP/3 endpoint.
+	Upgraded bool
+
+	// URL is the URL we used for the exchange.
+	URL string
+
+	// Err is the exchange error or nil on success.
+	Err error
+}
+
+// AltSvcUpgrader learns HTTP/3 endpoints from the Alt-Svc headers of DoH
+// responses and, optionally, upgrades subsequent exchanges to HTTP/3, which
+// mirrors and allows to measure how browsers behave.
+//
+// When an upgraded exchange fails, we forget the learned endpoint and retry
+// using the base [*Transport], like browsers do.
+//
+// Construct using [NewAltSvcUpgrader].
+type AltSvcUpgrader struct {
+	// Transport is the base [*Transport] (typically using HTTP/2).
+	//
+	// Set by [NewAltSvcUpgrader] to the user-provided value.
+	Transport *Transport
+
+	// H3Client is the OPTIONAL [Client] using HTTP/3. When nil, we
+	// only learn endpoints without upgrading exchanges.
+	//
+	// Set by [NewAltSvcUpgrader] to the user-provided value.
+	H3Client Client
+
+	// ObserveDecision is an optional hook called after each exchange.
+	ObserveDecision func(*AltSvcDecision)
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// learned is the learned HTTP/3 endpoint or nil.
+	learned *AltSvcEntry
+
+	// expiry is when learned becomes stale.
+	expiry time.Time
+}
+
+var _ Exchanger = &AltSvcUpgrader{}
+
+// NewAltSvcUpgrader creates a new [*AltSvcUpgrader].
+func NewAltSvcUpgrader(dt *Transport, h3Client Client) *AltSvcUpgrader {
+	return &AltSvcUpgrader{Transport: dt, H3Client: h3Client}
+}
+
+// Learned returns the learned HTTP/3 endpoint, if any.
+func (u *AltSvcUpgrader) Learned() (AltSvcEntry, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.learned == nil || time.Now().After(u.expiry) {
+		return AltSvcEntry{}, false
+	}
+	return *u.learned, true
+}
+
+// Exchange implements [Exchanger].
+func (u *AltSvcUpgrader) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	// 1. attempt using the learned endpoint, if possible
+	if entry, ok := u.Learned(); ok && u.H3Client != nil {
+		if URL, err := u.upgradedURL(entry); err == nil {
+			child := *u.Transport
+			child.Client, child.URL = u.H3Client, URL
+			resp, err := child.Exchange(ctx, query)
+			u.observe(&AltSvcDecision{Upgraded: true, URL: URL, Err: err})
+			if err == nil || ctx.Err() != nil {
+				return resp, err
+			}
+			u.forget()
+		}
+	}
+
+	// 2. use the base transport and learn from the Alt-Svc header
+	child := *u.Transport
+	child.ObserveExchange = func(ev *ExchangeEvent) {
+		u.learn(ev.AltSvc)
+		if u.Transport.ObserveExchange != nil {
+			u.Transport.ObserveExchange(ev)
+		}
+	}
+	resp, err := child.Exchange(ctx, query)
+	u.observe(&AltSvcDecision{Upgraded: false, URL: u.Transport.URL, Err: err})
+	return resp, err
+}
+
+// upgradedURL returns the base URL modified to use the learned endpoint.
+func (u *AltSvcUpgrader) upgradedURL(entry AltSvcEntry) (string, error) {
+	URL, err := url.Parse(u.Transport.URL)
+	if err != nil {
+		return "", err
+	}
+	host := entry.Host
+	if host == "" {
+		host = URL.Hostname()
+	}
+	URL.Host = net.JoinHostPort(host, entry.Port)
+	return URL.String(), nil
+}
+
+// learn saves the first HTTP/3 entry of the Alt-Svc header value, if any, and
+// forgets the learned endpoint when the value is "clear" (RFC 7838 Section 3).
+func (u *AltSvcUpgrader) learn(value string) {
+	if strings.TrimSpace(value) == "clear" {
+		u.forget()
+		return
+	}
+	for _, entry := range ParseAltSvc(value) {
+		if entry.ProtocolID == "h3" {
+			u.mu.Lock()
+			u.learned, u.expiry = &entry, time.Now().Add(entry.MaxAge)
+			u.mu.Unlock()
+			return
+		}
+	}
+}
+
+// forget forgets the learned endpoint.
+func (u *AltSvcUpgrader) forget() {
+	u.mu.Lock()
+	u.learned = nil
+	u.mu.Unlock()
+}
+
+// observe calls ObserveDecision if it is not nil.
+func (u *AltSvcUpgrader) observe(decision *AltSvcDecision) {
+	if u.ObserveDecision != nil {
+		u.ObserveDecision(decision)
+	}
+}
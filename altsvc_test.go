@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/bassosimone/httptestx"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAltSvc(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// value is the Alt-Svc header value.
+		value string
+
+		// want is the expected result.
+		want []dnsoverhttps.AltSvcEntry
+	}
+
+	testCases := []testCase{
+		{name: "empty", value: "", want: nil},
+		{name: "clear", value: "clear", want: nil},
+		{
+			name:  "same host with max age",
+			value: `h3=":443"; ma=86400, h3-29=":8443"`,
+			want: []dnsoverhttps.AltSvcEntry{
+				{ProtocolID: "h3", Port: "443", MaxAge: 86400 * time.Second},
+				{ProtocolID: "h3-29", Port: "8443", MaxAge: 24 * time.Hour},
+			},
+		},
+		{
+			name:  "alternative host and malformed entries",
+			value: `h3=alt.example.com:443, h3="alt.example.com:443"; persist=1`,
+			want: []dnsoverhttps.AltSvcEntry{
+				{ProtocolID: "h3", Host: "alt.example.com", Port: "443", MaxAge: 24 * time.Hour},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, dnsoverhttps.ParseAltSvc(tc.value))
+		})
+	}
+}
+
+func TestAltSvcUpgrader(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parsed, err := url.Parse("https://" + r.Host)
+		require.NoError(t, err)
+		w.Header().Set("Alt-Svc", `h3=":`+parsed.Port()+`"; ma=3600`)
+		dnsHandler(t).ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	// the H3 client fails when asked to and otherwise delegates to the TLS client
+	var h3URLs []string
+	var h3Fail bool
+	h3Client := &httptestx.FuncClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		h3URLs = append(h3URLs, req.URL.String())
+		if h3Fail {
+			return nil, errors.New("mocked error")
+		}
+		return srv.Client().Do(req)
+	}}
+
+	var decisions []*dnsoverhttps.AltSvcDecision
+	var observed int
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	dt.ObserveExchange = func(*dnsoverhttps.ExchangeEvent) {
+		observed++
+	}
+	upgrader := dnsoverhttps.NewAltSvcUpgrader(dt, h3Client)
+	upgrader.ObserveDecision = func(d *dnsoverhttps.AltSvcDecision) {
+		decisions = append(decisions, d)
+	}
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+
+	// the first exchange uses the base transport and learns the endpoint
+	_, err := upgrader.Exchange(context.Background(), query)
+	require.NoError(t, err)
+	entry, ok := upgrader.Learned()
+	require.True(t, ok)
+	assert.Equal(t, "h3", entry.ProtocolID)
+	assert.Equal(t, time.Hour, entry.MaxAge)
+	assert.Equal(t, 1, observed)
+
+	// the second exchange upgrades
+	_, err = upgrader.Exchange(context.Background(), query)
+	require.NoError(t, err)
+	require.Len(t, h3URLs, 1)
+	assert.Equal(t, srv.URL, h3URLs[0])
+
+	// the third exchange fails using HTTP/3 and falls back
+	h3Fail = true
+	_, err = upgrader.Exchange(context.Background(), query)
+	require.NoError(t, err)
+
+	require.Len(t, decisions, 4)
+	assert.False(t, decisions[0].Upgraded)
+	assert.True(t, decisions[1].Upgraded)
+	assert.True(t, decisions[2].Upgraded)
+	assert.Error(t, decisions[2].Err)
+	assert.False(t, decisions[3].Upgraded)
+	assert.NoError(t, decisions[3].Err)
+}
+
+func TestAltSvcUpgraderLearnOnly(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Alt-Svc", `h3="alt.example.com:443"`)
+		dnsHandler(t).ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	var ev *dnsoverhttps.ExchangeEvent
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	dt.ObserveExchange = func(e *dnsoverhttps.ExchangeEvent) {
+		ev = e
+	}
+	upgrader := dnsoverhttps.NewAltSvcUpgrader(dt, nil)
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+	for range 2 {
+		_, err := upgrader.Exchange(context.Background(), query)
+		require.NoError(t, err)
+	}
+
+	require.NotNil(t, ev)
+	assert.Equal(t, `h3="alt.example.com:443"`, ev.AltSvc)
+	entry, ok := upgrader.Learned()
+	require.True(t, ok)
+	assert.Equal(t, "alt.example.com", entry.Host)
+}
+
+func TestAltSvcUpgraderClear(t *testing.T) {
+	altSvc := `h3="alt.example.com:443"`
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Alt-Svc", altSvc)
+		dnsHandler(t).ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	upgrader := dnsoverhttps.NewAltSvcUpgrader(dnsoverhttps.NewTransport(srv.Client(), srv.URL), nil)
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+	_, err := upgrader.Exchange(context.Background(), query)
+	require.NoError(t, err)
+	_, ok := upgrader.Learned()
+	require.True(t, ok)
+
+	// the server withdraws the alternative services
+	altSvc = "clear"
+	_, err = upgrader.Exchange(context.Background(), query)
+	require.NoError(t, err)
+	_, ok = upgrader.Learned()
+	assert.False(t, ok)
+}
@@ -0,0 +1,226 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ErrInvalidTrustAnchors indicates that we cannot parse trust anchors.
+var ErrInvalidTrustAnchors = errors.New("invalid trust anchors")
+
+// TrustAnchor is a DNSSEC trust anchor along with its validity period.
+type TrustAnchor struct {
+	// DS is the DS record of the anchored key.
+	DS *dns.DS
+
+	// ValidFrom is when the anchor becomes valid or the zero value.
+	ValidFrom time.Time
+
+	// ValidUntil is when the anchor stops being valid or the zero value.
+	ValidUntil time.Time
+}
+
+// Active returns whether the anchor is valid at the given time.
+func (ta *TrustAnchor) Active(now time.Time) bool {
+	return (ta.ValidFrom.IsZero() || !now.Before(ta.ValidFrom)) &&
+		(ta.ValidUntil.IsZero() || now.Before(ta.ValidUntil))
+}
+
+// ActiveTrustAnchors returns the DS records of the anchors valid at the given
+// time, which is suitable for the [Validator] TrustAnchors field.
+func ActiveTrustAnchors(anchors []*TrustAnchor, now time.Time) []*dns.DS {
+	var out []*dns.DS
+	for _, ta := range anchors {
+		if ta.Active(now) {
+			out = append(out, ta.DS)
+		}
+	}
+	return out
+}
+
+// xmlTrustAnchor is the IANA trust anchor XML document (RFC 9718).
+type xmlTrustAnchor struct {
+	// Zone is the zone name.
+	Zone string `xml:"Zone"`
+
+	// KeyDigests contains the key digests.
+	KeyDigests []xmlKeyDigest `xml:"KeyDigest"`
+}
+
+// xmlKeyDigest is a KeyDigest element of [xmlTrustAnchor].
+type xmlKeyDigest struct {
+	// ValidFrom is the start of the validity period.
+	ValidFrom string `xml:"validFrom,attr"`
+
+	// ValidUntil is the OPTIONAL end of the validity period.
+	ValidUntil string `xml:"validUntil,attr"`
+
+	// KeyTag is the DS key tag.
+	KeyTag uint16 `xml:"KeyTag"`
+
+	// Algorithm is the DS algorithm.
+	Algorithm uint8 `xml:"Algorithm"`
+
+	// DigestType is the DS digest type.
+	DigestType uint8 `xml:"DigestType"`
+
+	// Digest is the hex-encoded DS digest.
+	Digest string `xml:"Digest"`
+}
+
+// ParseTrustAnchorsXML parses trust anchors using the XML format published by
+// IANA at https://data.iana.org/root-anchors/root-anchors.xml (RFC 9718),
+// including the validity periods, such that expired and future anchors
+// can be filtered using [ActiveTrustAnchors].
+func ParseTrustAnchorsXML(r io.Reader) ([]*TrustAnchor, error) {
+	var doc xmlTrustAnchor
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTrustAnchors, err)
+	}
+	var anchors []*TrustAnchor
+	for _, kd := range doc.KeyDigests {
+		ta := &TrustAnchor{DS: &dns.DS{
+			Hdr:        dns.RR_Header{Name: dns.Fqdn(doc.Zone), Rrtype: dns.TypeDS, Class: dns.ClassINET},
+			KeyTag:     kd.KeyTag,
+			Algorithm:  kd.Algorithm,
+			DigestType: kd.DigestType,
+			Digest:     strings.ToUpper(strings.TrimSpace(kd.Digest)),
+		}}
+		var err error
+		if ta.ValidFrom, err = parseXMLTime(kd.ValidFrom); err != nil {
+			return nil, err
+		}
+		if ta.ValidUntil, err = parseXMLTime(kd.ValidUntil); err != nil {
+			return nil, err
+		}
+		anchors = append(anchors, ta)
+	}
+	if len(anchors) <= 0 {
+		return nil, fmt.Errorf("%w: no KeyDigest elements", ErrInvalidTrustAnchors)
+	}
+	return anchors, nil
+}
+
+// parseXMLTime parses an XML dateTime or returns the zero value when empty.
+func parseXMLTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %w", ErrInvalidTrustAnchors, err)
+	}
+	return t, nil
+}
+
+// ParseTrustAnchors parses trust anchors from DS or DNSKEY records in the RFC
+// 1035 master file format (e.g., the output of "dig . DNSKEY"). We convert
+// DNSKEY records to SHA-256 DS records and skip the DNSKEY records that are
+// not SEP keys or have the REVOKE bit set (RFC 5011). Other records are
+// ignored. The resulting anchors do not have a validity period.
+func ParseTrustAnchors(r io.Reader) ([]*TrustAnchor, error) {
+	var anchors []*TrustAnchor
+	zp := dns.NewZoneParser(r, ".", "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		switch rr := rr.(type) {
+		case *dns.DS:
+			anchors = append(anchors, &TrustAnchor{DS: rr})
+		case *dns.DNSKEY:
+			if rr.Flags&dns.SEP == 0 || rr.Flags&dns.REVOKE != 0 {
+				continue
+			}
+			if ds := rr.ToDS(dns.SHA256); ds != nil {
+				anchors = append(anchors, &TrustAnchor{DS: ds})
+			}
+		}
+	}
+	if err := zp.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTrustAnchors, err)
+	}
+	if len(anchors) <= 0 {
+		return nil, fmt.Errorf("%w: no DS or DNSKEY records", ErrInvalidTrustAnchors)
+	}
+	return anchors, nil
+}
+
+// LoadTrustAnchors reads trust anchors from the given file using
+// [ParseTrustAnchorsXML] when the file contains XML and
+// [ParseTrustAnchors] otherwise.
+func LoadTrustAnchors(path string) ([]*TrustAnchor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("<")) {
+		return ParseTrustAnchorsXML(bytes.NewReader(data))
+	}
+	return ParseTrustAnchors(bytes.NewReader(data))
+}
+
+// RolloverStatus is the result of [*Validator.CheckRollover].
+type RolloverStatus struct {
+	// Zone is the zone we checked.
+	Zone string
+
+	// TrustedKeyTags contains the tags of the SEP keys matching a trust anchor.
+	TrustedKeyTags []uint16
+
+	// NewKeyTags contains the tags of the SEP keys not matching any trust anchor,
+	// which are candidates for addition after the RFC 5011 hold-down time.
+	NewKeyTags []uint16
+
+	// RevokedKeyTags contains the tags, computed without the REVOKE bit, of
+	// the keys the zone revoked (RFC 5011), whose trust anchors, if any,
+	// should be removed.
+	RevokedKeyTags []uint16
+}
+
+// CheckRollover fetches the DNSKEY RRset of a zone having trust anchors,
+// validates it using the trust anchors, and reports the key changes, which allows
+// to notice RFC 5011 rollovers (e.g., of the root zone KSK) before the anchors
+// become stale. We do not persist any state, so enforcing the RFC 5011 hold-down
+// timers and updating the anchors is up to the caller.
+func (v *Validator) CheckRollover(ctx context.Context, zone string) (*RolloverStatus, error) {
+	// 1. fetch and validate the DNSKEY RRset
+	zone = strings.ToLower(dns.Fqdn(zone))
+	anchors := v.anchorsFor(zone)
+	if len(anchors) <= 0 {
+		return nil, fmt.Errorf("%w for %s", errNoTrustAnchor, zone)
+	}
+	val := &validation{ctx: ctx, now: time.Now(), v: v, zones: make(map[string]*zoneKeys)}
+	if _, err := val.zoneKeys(zone); err != nil {
+		return nil, err
+	}
+
+	// 2. classify the keys
+	status := &RolloverStatus{Zone: zone}
+	for _, rr := range val.zones[zone].rrs {
+		key, ok := rr.(*dns.DNSKEY)
+		if !ok || key.Flags&dns.SEP == 0 {
+			continue
+		}
+		if key.Flags&dns.REVOKE != 0 {
+			unrevoked := *key
+			unrevoked.Flags &^= dns.REVOKE
+			status.RevokedKeyTags = append(status.RevokedKeyTags, unrevoked.KeyTag())
+			continue
+		}
+		if matchesDS(key, anchors) {
+			status.TrustedKeyTags = append(status.TrustedKeyTags, key.KeyTag())
+			continue
+		}
+		status.NewKeyTags = append(status.NewKeyTags, key.KeyTag())
+	}
+	return status, nil
+}
@@ -0,0 +1,174 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rootAnchorsXML is the IANA root-anchors.xml document.
+const rootAnchorsXML = `<?xml version="1.0" encoding="UTF-8"?>
+<TrustAnchor id="E2C2A5D2-4C8F-4DB6-8B06-5D4E47F8E5E6" source="http://data.iana.org/root-anchors/root-anchors.xml">
+<Zone>.</Zone>
+<KeyDigest id="Kjqmt7v" validFrom="2010-07-15T00:00:00+00:00" validUntil="2019-01-11T00:00:00+00:00">
+<KeyTag>19036</KeyTag>
+<Algorithm>8</Algorithm>
+<DigestType>2</DigestType>
+<Digest>49AAC11D7B6F6446702E54A1607371607A1A41855200FD2CE1CDDE32F24E8FB5</Digest>
+</KeyDigest>
+<KeyDigest id="Klajeyz" validFrom="2017-02-02T00:00:00+00:00">
+<KeyTag>20326</KeyTag>
+<Algorithm>8</Algorithm>
+<DigestType>2</DigestType>
+<Digest>E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D</Digest>
+</KeyDigest>
+<KeyDigest id="Kmyv6jo" validFrom="2024-07-18T00:00:00+00:00">
+<KeyTag>38696</KeyTag>
+<Algorithm>8</Algorithm>
+<DigestType>2</DigestType>
+<Digest>683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16</Digest>
+</KeyDigest>
+</TrustAnchor>
+`
+
+func TestParseTrustAnchorsXML(t *testing.T) {
+	anchors, err := dnsoverhttps.ParseTrustAnchorsXML(strings.NewReader(rootAnchorsXML))
+	require.NoError(t, err)
+	require.Len(t, anchors, 3)
+	assert.Equal(t, ".", anchors[0].DS.Hdr.Name)
+	assert.Equal(t, time.Date(2019, 1, 11, 0, 0, 0, 0, time.UTC), anchors[0].ValidUntil.UTC())
+	assert.True(t, anchors[2].ValidUntil.IsZero())
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// now is the reference time.
+		now time.Time
+
+		// wantTags contains the expected tags of the active anchors.
+		wantTags []uint16
+	}
+
+	testCases := []testCase{
+		{name: "2015", now: time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC), wantTags: []uint16{19036}},
+		{name: "2018", now: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC), wantTags: []uint16{19036, 20326}},
+		{name: "2020", now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC), wantTags: []uint16{20326}},
+		{name: "2025", now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), wantTags: []uint16{20326, 38696}},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var tags []uint16
+			for _, ds := range dnsoverhttps.ActiveTrustAnchors(anchors, tt.now) {
+				tags = append(tags, ds.KeyTag)
+			}
+			assert.Equal(t, tt.wantTags, tags)
+		})
+	}
+
+	// the currently active anchors are the default ones
+	assert.Equal(t, dnsoverhttps.DefaultRootTrustAnchors(), dnsoverhttps.ActiveTrustAnchors(anchors, time.Now()))
+}
+
+func TestParseTrustAnchorsXMLErrors(t *testing.T) {
+	testCases := map[string]string{
+		"not XML":         "not XML",
+		"no KeyDigest":    "<TrustAnchor><Zone>.</Zone></TrustAnchor>",
+		"invalid instant": `<TrustAnchor><Zone>.</Zone><KeyDigest validFrom="yesterday"></KeyDigest></TrustAnchor>`,
+	}
+	for name, doc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := dnsoverhttps.ParseTrustAnchorsXML(strings.NewReader(doc))
+			require.ErrorIs(t, err, dnsoverhttps.ErrInvalidTrustAnchors)
+		})
+	}
+}
+
+func TestParseTrustAnchors(t *testing.T) {
+	ksk := newSignedZone(t, ".").key
+	zsk := *newSignedZone(t, ".").key
+	zsk.Flags = dns.ZONE
+	revoked := *newSignedZone(t, ".").key
+	revoked.Flags |= dns.REVOKE
+	ds := newSignedZone(t, "example.").ds()
+
+	input := strings.Join([]string{
+		ksk.String(), zsk.String(), revoked.String(), ds.String(),
+		"example. 300 IN A 192.0.2.1",
+	}, "\n")
+	anchors, err := dnsoverhttps.ParseTrustAnchors(strings.NewReader(input))
+	require.NoError(t, err)
+	require.Len(t, anchors, 2)
+	assert.Equal(t, ksk.ToDS(dns.SHA256).String(), anchors[0].DS.String())
+	assert.Equal(t, ds.String(), anchors[1].DS.String())
+	assert.True(t, anchors[0].Active(time.Now()))
+
+	_, err = dnsoverhttps.ParseTrustAnchors(strings.NewReader("example. 300 IN A 192.0.2.1\n"))
+	require.ErrorIs(t, err, dnsoverhttps.ErrInvalidTrustAnchors)
+
+	_, err = dnsoverhttps.ParseTrustAnchors(strings.NewReader(". IN DS not-a-key-tag\n"))
+	require.ErrorIs(t, err, dnsoverhttps.ErrInvalidTrustAnchors)
+}
+
+func TestLoadTrustAnchors(t *testing.T) {
+	dir := t.TempDir()
+	xmlPath := filepath.Join(dir, "root-anchors.xml")
+	require.NoError(t, os.WriteFile(xmlPath, []byte(rootAnchorsXML), 0600))
+	ds := newSignedZone(t, ".").ds()
+	zonePath := filepath.Join(dir, "root.key")
+	require.NoError(t, os.WriteFile(zonePath, []byte(ds.String()+"\n"), 0600))
+
+	anchors, err := dnsoverhttps.LoadTrustAnchors(xmlPath)
+	require.NoError(t, err)
+	assert.Len(t, anchors, 3)
+
+	anchors, err = dnsoverhttps.LoadTrustAnchors(zonePath)
+	require.NoError(t, err)
+	require.Len(t, anchors, 1)
+	assert.Equal(t, ds.String(), anchors[0].DS.String())
+
+	_, err = dnsoverhttps.LoadTrustAnchors(filepath.Join(dir, "nonexistent"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestValidatorCheckRollover(t *testing.T) {
+	// the root zone has the trusted key, a new key, and a revoked key
+	trusted := newSignedZone(t, ".")
+	added := newSignedZone(t, ".")
+	revoked := newSignedZone(t, ".")
+	oldAnchor := revoked.ds()
+	revoked.key.Flags |= dns.REVOKE
+	records := trusted.signNow(t, trusted.key, added.key, revoked.key)
+	srv := httptest.NewServer(dnsoverhttps.NewScriptedHandler(dnsoverhttps.NewStaticZone(records...).Reply))
+	defer srv.Close()
+
+	v := dnsoverhttps.NewValidator(dnsoverhttps.NewTransport(srv.Client(), srv.URL))
+	v.TrustAnchors = []*dns.DS{trusted.ds(), oldAnchor}
+	status, err := v.CheckRollover(context.Background(), ".")
+	require.NoError(t, err)
+	assert.Equal(t, ".", status.Zone)
+	assert.Equal(t, []uint16{trusted.key.KeyTag()}, status.TrustedKeyTags)
+	assert.Equal(t, []uint16{added.key.KeyTag()}, status.NewKeyTags)
+	assert.Equal(t, []uint16{oldAnchor.KeyTag}, status.RevokedKeyTags)
+
+	// we need an anchor for the zone
+	_, err = v.CheckRollover(context.Background(), "example")
+	require.Error(t, err)
+
+	// the DNSKEY RRset must validate
+	v.TrustAnchors = []*dns.DS{added.ds()}
+	_, err = v.CheckRollover(context.Background(), ".")
+	require.ErrorIs(t, err, dnsoverhttps.ErrDNSSECBogus)
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// AnyPolicy classifies how a server handles type ANY queries.
+type AnyPolicy uint8
+
+const (
+	// AnyPolicyFull indicates that the server returned the RRs it knows about.
+	AnyPolicyFull AnyPolicy = iota
+
+	// AnyPolicyMinimal indicates that the server returned a minimal synthesized
+	// HINFO RR as allowed by RFC 8482 instead of the RRs it knows about.
+	AnyPolicyMinimal
+
+	// AnyPolicyEmpty indicates that the server returned an empty answer.
+	AnyPolicyEmpty
+
+	// AnyPolicyRefused indicates that the server refused the query using
+	// the REFUSED or NOTIMP response codes.
+	AnyPolicyRefused
+)
+
+// String implements [fmt.Stringer].
+func (p AnyPolicy) String() string {
+	switch p {
+	case AnyPolicyFull:
+		return "full"
+	case AnyPolicyMinimal:
+		return "minimal"
+	case AnyPolicyEmpty:
+		return "empty"
+	case AnyPolicyRefused:
+		return "refused"
+	default:
+		return fmt.Sprintf("AnyPolicy(%d)", uint8(p))
+	}
+}
+
+// AnyResult is the result of [*Transport.ExchangeANY].
+type AnyResult struct {
+	// Policy is the server policy for ANY queries.
+	Policy AnyPolicy
+
+	// Response is the response or nil for [AnyPolicyEmpty] and [AnyPolicyRefused].
+	Response *dnscodec.Response
+}
+
+// ExchangeANY sends a type ANY query for the given name and classifies the
+// server policy for ANY queries, recognizing RFC 8482 minimal responses.
+//
+// Returns an error only when the exchange fails for other reasons (e.g.,
+// NXDOMAIN or network errors). Like [*Transport.Exchange], this method calls
+// the observation hooks configured in the [*Transport].
+func (dt *Transport) ExchangeANY(ctx context.Context, name string) (*AnyResult, error) {
+	// 1. Perform the exchange saving the raw response
+	resp, _, rawResp, err := dt.exchangeSavingRaw(ctx, dnscodec.NewQuery(name, dns.TypeANY))
+
+	// 2. Classify the result
+	switch {
+	case err == nil && isMinimalAnyResponse(resp.ValidRRs):
+		return &AnyResult{Policy: AnyPolicyMinimal, Response: resp}, nil
+
+	case err == nil:
+		return &AnyResult{Policy: AnyPolicyFull, Response: resp}, nil
+
+	case errors.Is(err, dnscodec.ErrNoData):
+		return &AnyResult{Policy: AnyPolicyEmpty}, nil
+
+	case isRefusedResponse(rawResp):
+		return &AnyResult{Policy: AnyPolicyRefused}, nil
+
+	default:
+		return nil, err
+	}
+}
+
+// isMinimalAnyResponse returns whether the RRs consist of the single HINFO
+// RR with "RFC8482" as the CPU suggested by RFC 8482 Section 4.2.
+func isMinimalAnyResponse(rrs []dns.RR) bool {
+	if len(rrs) != 1 {
+		return false
+	}
+	hinfo, ok := rrs[0].(*dns.HINFO)
+	return ok && hinfo.Cpu == "RFC8482"
+}
+
+// isRefusedResponse returns whether the raw response has the REFUSED or NOTIMP RCODE.
+func isRefusedResponse(rawResp []byte) bool {
+	msg := &dns.Msg{}
+	if err := msg.Unpack(rawResp); err != nil {
+		return false
+	}
+	return msg.Rcode == dns.RcodeRefused || msg.Rcode == dns.RcodeNotImplemented
+}
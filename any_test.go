@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExchangeANY(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// reply builds the response for the query.
+		reply func(query *dns.Msg) *dns.Msg
+
+		// wantPolicy is the expected policy.
+		wantPolicy dnsoverhttps.AnyPolicy
+
+		// wantRRs is the expected number of valid RRs.
+		wantRRs int
+
+		// wantErr is the expected error (nil on success).
+		wantErr error
+	}
+
+	// header returns the header for an RR answering the query.
+	header := func(query *dns.Msg, rrtype uint16) dns.RR_Header {
+		return dns.RR_Header{Name: query.Question[0].Name, Rrtype: rrtype, Class: dns.ClassINET, Ttl: 300}
+	}
+
+	testCases := []testCase{
+		{
+			name: "full",
+			reply: func(query *dns.Msg) *dns.Msg {
+				resp := &dns.Msg{}
+				resp.SetReply(query)
+				resp.RecursionAvailable = true
+				resp.Answer = append(resp.Answer,
+					&dns.A{Hdr: header(query, dns.TypeA), A: net.IPv4(93, 184, 215, 14)},
+					&dns.MX{Hdr: header(query, dns.TypeMX), Preference: 10, Mx: "mx.example.com."})
+				return resp
+			},
+			wantPolicy: dnsoverhttps.AnyPolicyFull,
+			wantRRs:    2,
+		},
+
+		{
+			name: "minimal",
+			reply: func(query *dns.Msg) *dns.Msg {
+				resp := &dns.Msg{}
+				resp.SetReply(query)
+				resp.RecursionAvailable = true
+				resp.Answer = append(resp.Answer,
+					&dns.HINFO{Hdr: header(query, dns.TypeHINFO), Cpu: "RFC8482"})
+				return resp
+			},
+			wantPolicy: dnsoverhttps.AnyPolicyMinimal,
+			wantRRs:    1,
+		},
+
+		{
+			name: "empty",
+			reply: func(query *dns.Msg) *dns.Msg {
+				resp := &dns.Msg{}
+				resp.SetReply(query)
+				resp.RecursionAvailable = true
+				return resp
+			},
+			wantPolicy: dnsoverhttps.AnyPolicyEmpty,
+		},
+
+		{
+			name: "refused",
+			reply: func(query *dns.Msg) *dns.Msg {
+				resp := &dns.Msg{}
+				resp.SetRcode(query, dns.RcodeNotImplemented)
+				return resp
+			},
+			wantPolicy: dnsoverhttps.AnyPolicyRefused,
+		},
+
+		{
+			name: "nxdomain",
+			reply: func(query *dns.Msg) *dns.Msg {
+				resp := &dns.Msg{}
+				resp.SetRcode(query, dns.RcodeNameError)
+				return resp
+			},
+			wantErr: dnscodec.ErrNoName,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newStaticServer(t, tc.reply)
+			defer srv.Close()
+
+			var observed int
+			dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+			dt.ObserveRawResponse = func([]byte) {
+				observed++
+			}
+
+			result, err := dt.ExchangeANY(context.Background(), "example.com")
+			assert.Equal(t, 1, observed)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+				require.Nil(t, result)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantPolicy, result.Policy)
+			if tc.wantRRs > 0 {
+				require.NotNil(t, result.Response)
+				assert.Len(t, result.Response.ValidRRs, tc.wantRRs)
+			}
+		})
+	}
+}
+
+func TestAnyPolicyString(t *testing.T) {
+	assert.Equal(t, "minimal", dnsoverhttps.AnyPolicyMinimal.String())
+	assert.Equal(t, "AnyPolicy(17)", dnsoverhttps.AnyPolicy(17).String())
+}
@@ -0,0 +1,161 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ArchiveFormat is the value of the [ArchiveHeader] Format field.
+const ArchiveFormat = "dnsoverhttps-archive"
+
+// ArchiveVersion is the current value of the [ArchiveHeader] Version field.
+const ArchiveVersion = 1
+
+// ErrInvalidArchive indicates that the archive is malformed.
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// ArchiveHeader is the first JSON Lines record of an archive.
+//
+// Construct using [NewArchiveHeader].
+type ArchiveHeader struct {
+	// Format is always [ArchiveFormat].
+	Format string `json:"format"`
+
+	// Version is the archive format version.
+	Version int `json:"version"`
+
+	// Annotations contains OPTIONAL session metadata (e.g., the tool
+	// name and version or the measurement location).
+	Annotations map[string]string `json:"annotations"`
+}
+
+// NewArchiveHeader creates a new [*ArchiveHeader] with the given annotations.
+func NewArchiveHeader(annotations map[string]string) *ArchiveHeader {
+	return &ArchiveHeader{Format: ArchiveFormat, Version: ArchiveVersion, Annotations: annotations}
+}
+
+// ArchiveWriter writes a measurement session as an archive, which allows to
+// store and exchange complete sessions between tools using this package.
+//
+// The archive is a JSON Lines file where the first line is an [*ArchiveHeader]
+// and each following line is an [*ExchangeRecord], which contains the raw query
+// and response, the HTTP and TLS metadata, and the timings of an exchange. We
+// write the header along with the first record.
+//
+// Set [*ArchiveWriter.ObserveExchange] as the [Transport.ObserveExchange] hook.
+//
+// Construct using [NewArchiveWriter].
+type ArchiveWriter struct {
+	obs *SinkObserver
+}
+
+// NewArchiveWriter creates a new [*ArchiveWriter] writing to w.
+func NewArchiveWriter(w io.Writer, header *ArchiveHeader) *ArchiveWriter {
+	sink := &archiveSink{sink: NewJSONSink(w), header: header}
+	return &ArchiveWriter{obs: NewSinkObserver(sink)}
+}
+
+// ObserveExchange writes the event as an archive record.
+//
+// This method is safe to call from multiple goroutines.
+func (w *ArchiveWriter) ObserveExchange(ev *ExchangeEvent) {
+	w.obs.ObserveExchange(ev)
+}
+
+// Err returns the first error that occurred writing records, if any.
+//
+// After a write error, the [*ArchiveWriter] stops writing records.
+func (w *ArchiveWriter) Err() error {
+	return w.obs.Err()
+}
+
+// archiveSink is a [Sink] emitting the header before the first event.
+type archiveSink struct {
+	// sink is the underlying sink.
+	sink Sink
+
+	// header is the header to emit first.
+	header *ArchiveHeader
+
+	// once ensures we emit the header once.
+	once sync.Once
+}
+
+// Emit implements [Sink].
+func (s *archiveSink) Emit(event any) (err error) {
+	s.once.Do(func() {
+		err = s.sink.Emit(s.header)
+	})
+	if err != nil {
+		return err
+	}
+	return s.sink.Emit(event)
+}
+
+// ArchiveReader reads an archive written by [*ArchiveWriter].
+//
+// Construct using [NewArchiveReader].
+type ArchiveReader struct {
+	// dec decodes the JSON Lines records.
+	dec *json.Decoder
+
+	// header is the header or nil if we have not read it yet.
+	header *ArchiveHeader
+}
+
+// NewArchiveReader creates a new [*ArchiveReader] reading from r.
+func NewArchiveReader(r io.Reader) *ArchiveReader {
+	return &ArchiveReader{dec: json.NewDecoder(r)}
+}
+
+// Header returns the [*ArchiveHeader], reading it if needed.
+//
+// Returns [io.EOF] on an empty archive and [ErrInvalidArchive] when
+// the first record is not a valid header.
+func (r *ArchiveReader) Header() (*ArchiveHeader, error) {
+	if r.header != nil {
+		return r.header, nil
+	}
+	header := &ArchiveHeader{}
+	if err := r.dec.Decode(header); err != nil {
+		return nil, archiveMapError(err)
+	}
+	if header.Format != ArchiveFormat || header.Version != ArchiveVersion {
+		return nil, ErrInvalidArchive
+	}
+	r.header = header
+	return header, nil
+}
+
+// Next returns the next [*ExchangeRecord], reading the header if needed.
+//
+// Returns [io.EOF] at the end of the archive and [ErrInvalidArchive]
+// when the archive is malformed.
+func (r *ArchiveReader) Next() (*ExchangeRecord, error) {
+	if _, err := r.Header(); err != nil {
+		return nil, err
+	}
+	rec := &ExchangeRecord{}
+	if err := r.dec.Decode(rec); err != nil {
+		return nil, archiveMapError(err)
+	}
+	return rec, nil
+}
+
+// archiveMapError maps JSON decoding errors to [ErrInvalidArchive].
+func archiveMapError(err error) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, io.EOF):
+		return io.EOF
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		return ErrInvalidArchive
+	default:
+		return err
+	}
+}
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/bassosimone/httptestx"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestArchiveRoundTrip(t *testing.T) {
+	// 1. write a session with a successful and a failed exchange
+	srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+		resp := &dns.Msg{}
+		require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+		return resp
+	})
+	defer srv.Close()
+
+	buff := &bytes.Buffer{}
+	aw := dnsoverhttps.NewArchiveWriter(buff, dnsoverhttps.NewArchiveHeader(map[string]string{"tool": "test"}))
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	dt.ObserveExchange = aw.ObserveExchange
+	_, err := dt.Exchange(context.Background(), query)
+	require.NoError(t, err)
+
+	failing := dnsoverhttps.NewTransport(&httptestx.FuncClient{DoFunc: func(*http.Request) (*http.Response, error) {
+		return nil, errors.New("mocked error")
+	}}, "https://example.com/dns-query")
+	failing.ObserveExchange = aw.ObserveExchange
+	_, err = failing.Exchange(context.Background(), query)
+	require.Error(t, err)
+	require.NoError(t, aw.Err())
+
+	// 2. read it back
+	ar := dnsoverhttps.NewArchiveReader(buff)
+	header, err := ar.Header()
+	require.NoError(t, err)
+	assert.Equal(t, dnsoverhttps.ArchiveFormat, header.Format)
+	assert.Equal(t, "test", header.Annotations["tool"])
+
+	first, err := ar.Next()
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL, first.URL)
+	assert.Equal(t, "A", first.QueryType)
+	assert.Equal(t, "HTTP/1.1", first.HTTPProtocol)
+	assert.NotEmpty(t, first.RawResponse)
+	assert.Nil(t, first.Failure)
+	assert.Nil(t, dnsoverhttps.Revalidate(first.RawQuery, first.RawResponse).Err)
+
+	second, err := ar.Next()
+	require.NoError(t, err)
+	require.NotNil(t, second.Failure)
+	assert.Contains(t, *second.Failure, "mocked error")
+
+	_, err = ar.Next()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestArchiveReaderErrors(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// input is the archive content.
+		input string
+
+		// wantErr is the expected error.
+		wantErr error
+	}
+
+	testCases := []testCase{
+		{name: "empty", input: "", wantErr: io.EOF},
+		{name: "not a header", input: `{"format":"other","version":1}` + "\n", wantErr: dnsoverhttps.ErrInvalidArchive},
+		{name: "malformed record", input: `{"format":"dnsoverhttps-archive","version":1}` + "\n{", wantErr: dnsoverhttps.ErrInvalidArchive},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := dnsoverhttps.NewArchiveReader(strings.NewReader(tc.input)).Next()
+			require.ErrorIs(t, err, tc.wantErr)
+		})
+	}
+}
@@ -0,0 +1,162 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+)
+
+// QueuePolicy controls what an [*AsyncObserver] does when its queue is full.
+type QueuePolicy uint8
+
+const (
+	// QueuePolicyDrop drops the event, so that a slow hook never adds
+	// latency to the exchange. Use [*AsyncObserver.Dropped] to know how
+	// many events we dropped.
+	QueuePolicyDrop QueuePolicy = iota
+
+	// QueuePolicyBlock blocks until there is room in the queue, so that
+	// we never lose events but a slow hook may slow down exchanges.
+	QueuePolicyBlock
+)
+
+// String implements [fmt.Stringer].
+func (p QueuePolicy) String() string {
+	switch p {
+	case QueuePolicyDrop:
+		return "drop"
+	case QueuePolicyBlock:
+		return "block"
+	default:
+		return fmt.Sprintf("QueuePolicy(%d)", uint8(p))
+	}
+}
+
+// AsyncObserver forwards each [*ExchangeEvent] to another [Transport.ObserveExchange]
+// hook through a bounded queue drained by a background goroutine, so that slow
+// hooks (e.g., writing to disk or to the network) run outside of the exchange.
+//
+// Set [*AsyncObserver.ObserveExchange] as the [Transport.ObserveExchange] hook
+// and call [*AsyncObserver.Close] when done to deliver the queued events.
+//
+// Construct using [NewAsyncObserver].
+type AsyncObserver struct {
+	// Policy is the policy to apply when the queue is full.
+	//
+	// Set by [NewAsyncObserver] to the user-provided value.
+	Policy QueuePolicy
+
+	// Observe is the hook to forward events to.
+	//
+	// Set by [NewAsyncObserver] to the user-provided value.
+	Observe func(*ExchangeEvent)
+
+	// ObserveHookPanic is the OPTIONAL hook called when Observe panics, with
+	// Hook set to "Observe". We recover from such panics and keep delivering,
+	// like [Transport.ObserveHookPanic]. Set it before the first event.
+	ObserveHookPanic func(*HookPanicError)
+
+	// closed is true after Close.
+	closed bool
+
+	// done is closed when the background goroutine terminates.
+	done chan struct{}
+
+	// dropped counts the dropped events.
+	dropped atomic.Uint64
+
+	// mu protects closed and makes sending and closing queue mutually exclusive.
+	mu sync.RWMutex
+
+	// panics counts the panics in Observe.
+	panics atomic.Uint64
+
+	// queue is the bounded events queue.
+	queue chan *ExchangeEvent
+}
+
+// NewAsyncObserver creates a new [*AsyncObserver] forwarding to observe
+// through a queue holding up to size events, using the given policy.
+//
+// This function starts a background goroutine; call [*AsyncObserver.Close]
+// to deliver the queued events and stop it.
+func NewAsyncObserver(observe func(*ExchangeEvent), size int, policy QueuePolicy) *AsyncObserver {
+	o := &AsyncObserver{
+		Policy:  policy,
+		Observe: observe,
+		done:    make(chan struct{}),
+		queue:   make(chan *ExchangeEvent, size),
+	}
+	go o.loop()
+	return o
+}
+
+// loop delivers the queued events until the queue is closed.
+func (o *AsyncObserver) loop() {
+	defer close(o.done)
+	for ev := range o.queue {
+		o.deliver(ev)
+	}
+}
+
+// deliver calls Observe, recovering from and reporting panics.
+func (o *AsyncObserver) deliver(ev *ExchangeEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			o.panics.Add(1)
+			if o.ObserveHookPanic != nil {
+				o.ObserveHookPanic(&HookPanicError{Hook: "Observe", Value: r, Stack: debug.Stack()})
+			}
+		}
+	}()
+	o.Observe(ev)
+}
+
+// ObserveExchange enqueues the event according to the [QueuePolicy]. After
+// [*AsyncObserver.Close], we drop all events.
+//
+// This method is safe to call from multiple goroutines.
+func (o *AsyncObserver) ObserveExchange(ev *ExchangeEvent) {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	if o.closed {
+		o.dropped.Add(1)
+		return
+	}
+	if o.Policy == QueuePolicyBlock {
+		o.queue <- ev
+		return
+	}
+	select {
+	case o.queue <- ev:
+	default:
+		o.dropped.Add(1)
+	}
+}
+
+// Dropped returns the number of events we dropped so far.
+func (o *AsyncObserver) Dropped() uint64 {
+	return o.dropped.Load()
+}
+
+// Panics returns the number of panics in Observe so far.
+func (o *AsyncObserver) Panics() uint64 {
+	return o.panics.Load()
+}
+
+// Close stops accepting events and waits for the queued events to be delivered.
+//
+// This method is idempotent and safe to call from multiple goroutines.
+func (o *AsyncObserver) Close() error {
+	o.mu.Lock()
+	if !o.closed {
+		o.closed = true
+		close(o.queue)
+	}
+	o.mu.Unlock()
+	<-o.done
+	return nil
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsyncObserver(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// policy is the queue policy.
+		policy dnsoverhttps.QueuePolicy
+
+		// wantDelivered is the number of events we expect to be delivered.
+		wantDelivered int
+
+		// wantDropped is the number of events we expect to be dropped.
+		wantDropped uint64
+	}
+
+	testCases := []testCase{
+		{
+			name:          "drop",
+			policy:        dnsoverhttps.QueuePolicyDrop,
+			wantDelivered: 3, // one blocked in the hook plus two queued
+			wantDropped:   2,
+		},
+
+		{
+			name:          "block",
+			policy:        dnsoverhttps.QueuePolicyBlock,
+			wantDelivered: 5,
+			wantDropped:   0,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			// the hook blocks on the first event until we release it
+			var (
+				delivered []*dnsoverhttps.ExchangeEvent
+				started   = make(chan struct{})
+				release   = make(chan struct{})
+				once      sync.Once
+			)
+			obs := dnsoverhttps.NewAsyncObserver(func(ev *dnsoverhttps.ExchangeEvent) {
+				once.Do(func() {
+					close(started)
+					<-release
+				})
+				delivered = append(delivered, ev)
+			}, 2, tt.policy)
+
+			obs.ObserveExchange(&dnsoverhttps.ExchangeEvent{})
+			<-started
+
+			// with the hook stuck, the queue holds two events
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 4 {
+					obs.ObserveExchange(&dnsoverhttps.ExchangeEvent{})
+				}
+			}()
+			if tt.policy == dnsoverhttps.QueuePolicyDrop {
+				wg.Wait()
+			}
+			close(release)
+			wg.Wait()
+
+			require.NoError(t, obs.Close())
+			require.NoError(t, obs.Close())
+			assert.Len(t, delivered, tt.wantDelivered)
+			assert.Equal(t, tt.wantDropped, obs.Dropped())
+
+			// after close we drop events
+			obs.ObserveExchange(&dnsoverhttps.ExchangeEvent{})
+			assert.Equal(t, tt.wantDropped+1, obs.Dropped())
+		})
+	}
+}
+
+func TestAsyncObserverHookPanic(t *testing.T) {
+	var delivered int
+	obs := dnsoverhttps.NewAsyncObserver(func(ev *dnsoverhttps.ExchangeEvent) {
+		if ev.URL == "panic" {
+			panic("observe")
+		}
+		delivered++
+	}, 4, dnsoverhttps.QueuePolicyBlock)
+	var panics []*dnsoverhttps.HookPanicError
+	obs.ObserveHookPanic = func(err *dnsoverhttps.HookPanicError) {
+		panics = append(panics, err)
+	}
+
+	for _, URL := range []string{"panic", "ok", "panic", "ok"} {
+		obs.ObserveExchange(&dnsoverhttps.ExchangeEvent{URL: URL})
+	}
+	require.NoError(t, obs.Close())
+
+	// the panics do not stop the delivery of the following events
+	assert.Equal(t, 2, delivered)
+	assert.Equal(t, uint64(2), obs.Panics())
+	require.Len(t, panics, 2)
+	assert.Equal(t, "Observe", panics[0].Hook)
+	assert.Equal(t, "observe", panics[0].Value)
+	assert.NotEmpty(t, panics[0].Stack)
+}
+
+func TestQueuePolicyString(t *testing.T) {
+	assert.Equal(t, "drop", dnsoverhttps.QueuePolicyDrop.String())
+	assert.Equal(t, "block", dnsoverhttps.QueuePolicyBlock.String())
+	assert.Equal(t, "QueuePolicy(7)", dnsoverhttps.QueuePolicy(7).String())
+}
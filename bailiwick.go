@@ -0,0 +1,24 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import "github.com/miekg/dns"
+
+// FindOutOfBailiwick returns the RRs in the authority section of the response
+// message whose owner name is neither the query name nor one of its ancestors.
+//
+// A server answering for the query name is authoritative (or caching) for a zone
+// containing such a name, so authority records for unrelated zones suggest a
+// misbehaving resolver or an attempt to poison downstream caches.
+func FindOutOfBailiwick(respMsg *dns.Msg) []dns.RR {
+	if len(respMsg.Question) != 1 {
+		return nil
+	}
+	var found []dns.RR
+	for _, rr := range respMsg.Ns {
+		if !dns.IsSubDomain(rr.Header().Name, respMsg.Question[0].Name) {
+			found = append(found, rr)
+		}
+	}
+	return found
+}
@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"testing"
+
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindOutOfBailiwick(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// authority contains the authority section RRs.
+		authority []string
+
+		// want contains the indexes of the expected out of bailiwick RRs.
+		want []int
+	}
+
+	testCases := []testCase{
+		{
+			name: "empty authority section",
+		},
+
+		{
+			name: "zone apex and query name",
+			authority: []string{
+				"example.com. 60 IN SOA ns.example.com. admin.example.com. 1 2 3 4 5",
+				"www.example.com. 60 IN NS ns.example.net.",
+			},
+		},
+
+		{
+			name: "unrelated zones",
+			authority: []string{
+				"example.com. 60 IN NS ns.example.com.",
+				"example.net. 60 IN NS ns.attacker.org.",
+				"other.www.example.com. 60 IN NS ns.example.com.",
+			},
+			want: []int{1, 2},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			msg := &dns.Msg{}
+			msg.SetQuestion("www.example.com.", dns.TypeA)
+			for _, s := range tc.authority {
+				msg.Ns = append(msg.Ns, mustNewRR(t, s))
+			}
+			var want []dns.RR
+			for _, idx := range tc.want {
+				want = append(want, msg.Ns[idx])
+			}
+			assert.Equal(t, want, dnsoverhttps.FindOutOfBailiwick(msg))
+		})
+	}
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// AddrMatcher matches addresses against a list (e.g., of known blockpage or
+// sinkhole addresses). See [Transport.BlockpageMatcher].
+//
+// Implementations MUST be safe to call from multiple goroutines.
+type AddrMatcher interface {
+	MatchAddr(addr netip.Addr) bool
+}
+
+// AddrList is an [AddrMatcher] matching exact addresses and prefixes.
+//
+// Construct using [NewAddrList] or [ParseAddrList].
+type AddrList struct {
+	// addrs contains the exact addresses.
+	addrs map[netip.Addr]struct{}
+
+	// prefixes contains the prefixes.
+	prefixes []netip.Prefix
+}
+
+var _ AddrMatcher = &AddrList{}
+
+// NewAddrList creates a new [*AddrList] matching the given prefixes, where
+// single-address prefixes (e.g., "10.10.34.35/32") match exact addresses. We
+// convert IPv4-mapped IPv6 prefixes to IPv4, since we match unmapped addresses.
+func NewAddrList(prefixes ...netip.Prefix) *AddrList {
+	list := &AddrList{addrs: make(map[netip.Addr]struct{})}
+	for _, prefix := range prefixes {
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		if prefix.IsSingleIP() {
+			list.addrs[prefix.Addr()] = struct{}{}
+			continue
+		}
+		list.prefixes = append(list.prefixes, prefix.Masked())
+	}
+	return list
+}
+
+// ParseAddrList is like [NewAddrList] but parses entries containing either an
+// address (e.g., "10.10.34.35") or a prefix in CIDR notation (e.g., "10.10.34.0/24").
+// We ignore empty entries and entries starting with "#", so that it is possible
+// to pass the lines of a user-provided list file.
+func ParseAddrList(entries ...string) (*AddrList, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address list entry %q: %w", entry, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid address list entry %q: %w", entry, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return NewAddrList(prefixes...), nil
+}
+
+// MatchAddr implements [AddrMatcher].
+func (l *AddrList) MatchAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if _, found := l.addrs[addr]; found {
+		return true
+	}
+	for _, prefix := range l.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// FindBlockpages returns the A and AAAA addresses in the answer section of
+// the response message matched by the given [AddrMatcher].
+func FindBlockpages(respMsg *dns.Msg, matcher AddrMatcher) []netip.Addr {
+	var matched []netip.Addr
+	for _, addr := range answerAddrs(respMsg.Answer) {
+		if matcher.MatchAddr(addr) {
+			matched = append(matched, addr)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddrList(t *testing.T) {
+	list, err := dnsoverhttps.ParseAddrList(
+		"# known blockpages",
+		"",
+		" 10.10.34.35 ",
+		"2001:db8::1",
+		"203.0.113.0/24",
+		"::ffff:198.51.100.0/120",
+	)
+	require.NoError(t, err)
+
+	type testCase struct {
+		// addr is the address to match.
+		addr string
+
+		// want is the expected result.
+		want bool
+	}
+
+	testCases := []testCase{
+		{addr: "10.10.34.35", want: true},
+		{addr: "10.10.34.36", want: false},
+		{addr: "::ffff:10.10.34.35", want: true},
+		{addr: "2001:db8::1", want: true},
+		{addr: "2001:db8::2", want: false},
+		{addr: "203.0.113.77", want: true},
+		{addr: "198.51.100.1", want: true},
+		{addr: "8.8.8.8", want: false},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.addr, func(t *testing.T) {
+			assert.Equal(t, tt.want, list.MatchAddr(netip.MustParseAddr(tt.addr)))
+		})
+	}
+}
+
+func TestParseAddrListErrors(t *testing.T) {
+	for _, entry := range []string{"10.10.34", "10.10.34.0/33"} {
+		t.Run(entry, func(t *testing.T) {
+			list, err := dnsoverhttps.ParseAddrList(entry)
+			require.ErrorContains(t, err, "invalid address list entry")
+			require.Nil(t, list)
+		})
+	}
+}
+
+func TestExchangeBlockpageAnswer(t *testing.T) {
+	srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+		resp := &dns.Msg{}
+		require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+		return resp
+	})
+	defer srv.Close()
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// matcher is the Transport BlockpageMatcher.
+		matcher dnsoverhttps.AddrMatcher
+
+		// want indicates whether we expect the anomaly.
+		want bool
+	}
+
+	testCases := []testCase{
+		{name: "without matcher", matcher: nil, want: false},
+		{name: "not matching", matcher: dnsoverhttps.NewAddrList(netip.MustParsePrefix("10.0.0.0/8")), want: false},
+		{name: "matching", matcher: dnsoverhttps.NewAddrList(netip.MustParsePrefix("8.8.8.8/32")), want: true},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var event *dnsoverhttps.ExchangeEvent
+			dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+			dt.BlockpageMatcher = tt.matcher
+			dt.ObserveExchange = func(ev *dnsoverhttps.ExchangeEvent) {
+				event = ev
+			}
+
+			_, err := dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+			require.NoError(t, err)
+			require.NotNil(t, event)
+			assert.Equal(t, tt.want, slices.Contains(event.Anomalies, dnsoverhttps.AnomalyBlockpageAnswer))
+		})
+	}
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// defaultBogonPrefixes contains the prefixes returned by [DefaultBogonPrefixes].
+var defaultBogonPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network" (RFC 1122)
+	netip.MustParsePrefix("10.0.0.0/8"),      // private (RFC 1918)
+	netip.MustParsePrefix("100.64.0.0/10"),   // shared address space (RFC 6598)
+	netip.MustParsePrefix("127.0.0.0/8"),     // loopback (RFC 1122)
+	netip.MustParsePrefix("169.254.0.0/16"),  // link local (RFC 3927)
+	netip.MustParsePrefix("172.16.0.0/12"),   // private (RFC 1918)
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments (RFC 6890)
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation (RFC 5737)
+	netip.MustParsePrefix("192.168.0.0/16"),  // private (RFC 1918)
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking (RFC 2544)
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation (RFC 5737)
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation (RFC 5737)
+	netip.MustParsePrefix("224.0.0.0/4"),     // multicast (RFC 5771)
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved and broadcast (RFC 1112)
+	netip.MustParsePrefix("::/128"),          // unspecified (RFC 4291)
+	netip.MustParsePrefix("::1/128"),         // loopback (RFC 4291)
+	netip.MustParsePrefix("100::/64"),        // discard only (RFC 6666)
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation (RFC 3849)
+	netip.MustParsePrefix("fc00::/7"),        // unique local (RFC 4193)
+	netip.MustParsePrefix("fe80::/10"),       // link local (RFC 4291)
+	netip.MustParsePrefix("ff00::/8"),        // multicast (RFC 4291)
+}
+
+// DefaultBogonPrefixes returns the private, loopback, link-local, documentation,
+// multicast, and otherwise reserved prefixes used by [FindBogons] by default.
+func DefaultBogonPrefixes() []netip.Prefix {
+	return append([]netip.Prefix{}, defaultBogonPrefixes...)
+}
+
+// privateNameSuffixes contains the special-use names (e.g., RFC 6761) for
+// which resolving to a private address is expected.
+var privateNameSuffixes = []string{
+	"localhost.",
+	"local.",
+	"home.arpa.",
+	"internal.",
+	"test.",
+	"invalid.",
+}
+
+// FindBogons returns the A and AAAA addresses in the answer section of the response
+// message that fall within the given prefixes (nil means [DefaultBogonPrefixes]).
+//
+// Public names resolving to such addresses strongly suggest DNS injection, so we
+// skip names for which private addresses are expected (e.g., "localhost").
+func FindBogons(respMsg *dns.Msg, prefixes []netip.Prefix) []netip.Addr {
+	// 1. skip special-use names
+	if len(respMsg.Question) != 1 || !isPublicName(respMsg.Question[0].Name) {
+		return nil
+	}
+	if prefixes == nil {
+		prefixes = defaultBogonPrefixes
+	}
+
+	// 2. check each address against the prefixes
+	var bogons []netip.Addr
+	for _, addr := range answerAddrs(respMsg.Answer) {
+		for _, prefix := range prefixes {
+			if prefix.Contains(addr) {
+				bogons = append(bogons, addr)
+				break
+			}
+		}
+	}
+	return bogons
+}
+
+// isPublicName returns whether the name is not a special-use name.
+func isPublicName(name string) bool {
+	name = dns.CanonicalName(name)
+	for _, suffix := range privateNameSuffixes {
+		if name == suffix || strings.HasSuffix(name, "."+suffix) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,129 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newBogonResponse returns a response for name containing the given addresses.
+func newBogonResponse(name string, addrs ...string) *dns.Msg {
+	msg := &dns.Msg{}
+	msg.SetQuestion(dns.Fqdn(name), dns.TypeA)
+	for _, addr := range addrs {
+		hdr := dns.RR_Header{Name: dns.Fqdn(name), Class: dns.ClassINET, Ttl: 60}
+		ip := net.ParseIP(addr)
+		if ip.To4() != nil {
+			hdr.Rrtype = dns.TypeA
+			msg.Answer = append(msg.Answer, &dns.A{Hdr: hdr, A: ip})
+			continue
+		}
+		hdr.Rrtype = dns.TypeAAAA
+		msg.Answer = append(msg.Answer, &dns.AAAA{Hdr: hdr, AAAA: ip})
+	}
+	return msg
+}
+
+func TestFindBogons(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// msg is the response message.
+		msg *dns.Msg
+
+		// prefixes are the prefixes to use (nil means default).
+		prefixes []netip.Prefix
+
+		// want contains the expected bogons.
+		want []netip.Addr
+	}
+
+	testCases := []testCase{
+		{
+			name: "public addresses",
+			msg:  newBogonResponse("dns.google", "8.8.8.8", "2001:4860:4860::8888"),
+		},
+
+		{
+			name: "private, loopback, and documentation addresses",
+			msg:  newBogonResponse("www.example.com", "10.10.34.35", "8.8.8.8", "127.0.0.1", "2001:db8::1"),
+			want: []netip.Addr{
+				netip.MustParseAddr("10.10.34.35"),
+				netip.MustParseAddr("127.0.0.1"),
+				netip.MustParseAddr("2001:db8::1"),
+			},
+		},
+
+		{
+			name: "IPv4-mapped IPv6 address",
+			msg:  newBogonResponse("www.example.com", "::ffff:192.168.1.1"),
+			want: []netip.Addr{netip.MustParseAddr("192.168.1.1")},
+		},
+
+		{
+			name: "special-use names",
+			msg:  newBogonResponse("printer.home.arpa", "192.168.1.1"),
+		},
+
+		{
+			name: "localhost",
+			msg:  newBogonResponse("localhost", "127.0.0.1"),
+		},
+
+		{
+			name:     "custom prefixes",
+			msg:      newBogonResponse("www.example.com", "10.10.34.35", "8.8.8.8"),
+			prefixes: []netip.Prefix{netip.MustParsePrefix("8.8.8.0/24")},
+			want:     []netip.Addr{netip.MustParseAddr("8.8.8.8")},
+		},
+
+		{
+			name:     "disabled",
+			msg:      newBogonResponse("www.example.com", "10.10.34.35"),
+			prefixes: []netip.Prefix{},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, dnsoverhttps.FindBogons(tt.msg, tt.prefixes))
+		})
+	}
+}
+
+func TestDefaultBogonPrefixesReturnsCopy(t *testing.T) {
+	prefixes := dnsoverhttps.DefaultBogonPrefixes()
+	require.NotEmpty(t, prefixes)
+	prefixes[0] = netip.MustParsePrefix("8.8.8.0/24")
+	assert.NotEqual(t, prefixes[0], dnsoverhttps.DefaultBogonPrefixes()[0])
+}
+
+func TestExchangeBogonAnswer(t *testing.T) {
+	srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+		resp := newBogonResponse("www.example.com", "10.10.34.35")
+		resp.SetReply(query)
+		return resp
+	})
+	defer srv.Close()
+
+	var event *dnsoverhttps.ExchangeEvent
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	dt.ObserveExchange = func(ev *dnsoverhttps.ExchangeEvent) {
+		event = ev
+	}
+
+	_, err := dt.Exchange(context.Background(), dnscodec.NewQuery("www.example.com", dns.TypeA))
+	require.NoError(t, err)
+	require.NotNil(t, event)
+	assert.Contains(t, event.Anomalies, dnsoverhttps.AnomalyBogonAnswer)
+}
@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"iter"
+	"sync"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// ResolveResult is a result yielded by [*BulkResolver.ResolveAll].
+type ResolveResult struct {
+	// Name is the name we resolved.
+	Name string
+
+	// Response is the response or nil on failure.
+	Response *dnscodec.Response
+}
+
+// BulkResolver resolves large sequences of names using an [Exchanger].
+//
+// Construct using [NewBulkResolver].
+type BulkResolver struct {
+	// Exchanger is the [Exchanger] to use.
+	//
+	// Set by [NewBulkResolver] to the user-provided value.
+	Exchanger Exchanger
+
+	// QueryType is the query type to use.
+	//
+	// Set by [NewBulkResolver] to dns.TypeA.
+	QueryType uint16
+
+	// Parallelism is the number of concurrent exchanges. Using
+	// values larger than one yields results out of order.
+	//
+	// Set by [NewBulkResolver] to 1.
+	Parallelism int
+}
+
+// NewBulkResolver creates a new [*BulkResolver].
+func NewBulkResolver(exchanger Exchanger) *BulkResolver {
+	return &BulkResolver{Exchanger: exchanger, QueryType: dns.TypeA, Parallelism: 1}
+}
+
+// resolveOutput is the output of a [*BulkResolver] worker.
+type resolveOutput struct {
+	result ResolveResult
+	err    error
+}
+
+// ResolveAll returns an iterator resolving the given names as the consumer
+// pulls results, without materializing intermediate slices, such that
+// million-name scans compose with other iterators.
+//
+// Stopping the iteration early cancels the pending exchanges and waits for
+// them to terminate, such that no exchange (and thus no hook) runs after the
+// iteration returns. However, we do not wait for the names iterator, which may
+// keep running in the background until it yields the next name (or returns),
+// since we cannot interrupt it. When the context is done, we stop resolving new
+// names and yield the pending results.
+func (br *BulkResolver) ResolveAll(ctx context.Context, names iter.Seq[string]) iter.Seq2[ResolveResult, error] {
+	return func(yield func(ResolveResult, error) bool) {
+		// 1. arrange for cancelling background goroutines and joining the workers
+		ctx, cancel := context.WithCancel(ctx)
+		output := make(chan resolveOutput)
+		defer func() {
+			cancel()
+			for range output {
+				// discard the results of the pending exchanges
+			}
+		}()
+
+		// 2. feed the names to the workers
+		input := make(chan string)
+		go func() {
+			defer close(input)
+			for name := range names {
+				select {
+				case input <- name:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		// 3. start the workers, which do not wait for the feeder when the context is done
+		wg := &sync.WaitGroup{}
+		for range max(br.Parallelism, 1) {
+			wg.Go(func() {
+				for {
+					var (
+						name  string
+						found bool
+					)
+					select {
+					case name, found = <-input:
+					case <-ctx.Done():
+					}
+					if !found {
+						return
+					}
+					resp, err := br.Exchanger.Exchange(ctx, dnscodec.NewQuery(name, br.QueryType))
+					output <- resolveOutput{ResolveResult{name, resp}, err}
+				}
+			})
+		}
+		go func() {
+			wg.Wait()
+			close(output)
+		}()
+
+		// 4. yield the results
+		for out := range output {
+			if !yield(out.result, out.err) {
+				return
+			}
+		}
+	}
+}
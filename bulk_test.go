@@ -0,0 +1,150 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBulkResolverResolveAll(t *testing.T) {
+	mockedErr := errors.New("mocked error")
+	exchanger := funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		assert.Equal(t, dns.TypeAAAA, query.Type)
+		if query.Name == "fail.example.com" {
+			return nil, mockedErr
+		}
+		return &dnscodec.Response{}, nil
+	})
+	names := []string{"a.example.com", "fail.example.com", "b.example.com"}
+
+	t.Run("sequential", func(t *testing.T) {
+		br := dnsoverhttps.NewBulkResolver(exchanger)
+		br.QueryType = dns.TypeAAAA
+
+		var got []string
+		for result, err := range br.ResolveAll(context.Background(), slices.Values(names)) {
+			got = append(got, result.Name)
+			if result.Name == "fail.example.com" {
+				assert.ErrorIs(t, err, mockedErr)
+				assert.Nil(t, result.Response)
+				continue
+			}
+			assert.NoError(t, err)
+			assert.NotNil(t, result.Response)
+		}
+		assert.Equal(t, names, got)
+	})
+
+	t.Run("parallel", func(t *testing.T) {
+		br := dnsoverhttps.NewBulkResolver(exchanger)
+		br.QueryType = dns.TypeAAAA
+		br.Parallelism = 4
+
+		var got []string
+		for result := range br.ResolveAll(context.Background(), slices.Values(names)) {
+			got = append(got, result.Name)
+		}
+		assert.ElementsMatch(t, names, got)
+	})
+}
+
+func TestBulkResolverResolveAllEarlyStop(t *testing.T) {
+	var count atomic.Int64
+	exchanger := funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		count.Add(1)
+		return &dnscodec.Response{}, nil
+	})
+
+	// an endless sequence of names
+	names := func(yield func(string) bool) {
+		for idx := 0; ; idx++ {
+			if !yield(fmt.Sprintf("%d.example.com", idx)) {
+				return
+			}
+		}
+	}
+
+	br := dnsoverhttps.NewBulkResolver(exchanger)
+	br.Parallelism = 2
+	var got int
+	for _, err := range br.ResolveAll(context.Background(), names) {
+		require.NoError(t, err)
+		if got++; got >= 10 {
+			break
+		}
+	}
+	assert.Equal(t, 10, got)
+	assert.True(t, count.Load() >= 10)
+}
+
+func TestBulkResolverResolveAllEarlyStopWaits(t *testing.T) {
+	var returned, lateExchange atomic.Bool
+	exchanger := funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		// make sure the exchanges are still pending when the consumer stops
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		if returned.Load() {
+			lateExchange.Store(true)
+		}
+		return nil, ctx.Err()
+	})
+
+	br := dnsoverhttps.NewBulkResolver(exchanger)
+	br.Parallelism = 4
+	names := slices.Values([]string{"a.example.com", "b.example.com", "c.example.com", "d.example.com"})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	for range br.ResolveAll(ctx, names) {
+		break
+	}
+	returned.Store(true)
+
+	// give any leaked exchange the time to complete
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, lateExchange.Load())
+}
+
+func TestBulkResolverResolveAllEarlyStopBlockingNames(t *testing.T) {
+	exchanger := funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		return &dnscodec.Response{}, nil
+	})
+
+	// the names iterator blocks after the first name until we release it
+	release := make(chan struct{})
+	defer close(release)
+	names := func(yield func(string) bool) {
+		if !yield("a.example.com") {
+			return
+		}
+		<-release
+		yield("b.example.com")
+	}
+
+	br := dnsoverhttps.NewBulkResolver(exchanger)
+	br.Parallelism = 2
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range br.ResolveAll(context.Background(), names) {
+			break
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stopping early waits for the names iterator")
+	}
+}
@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheStatusHeaders contains the headers CDNs and proxies use to say whether
+// they served the response from their cache, in order of preference.
+var cacheStatusHeaders = []string{
+	"Cache-Status", // RFC 9211
+	"CF-Cache-Status",
+	"X-Cache",
+	"X-Cache-Status",
+	"X-Proxy-Cache",
+}
+
+// recordCacheHeaders records the Date, Age, and cache-related response headers into ev.
+func recordCacheHeaders(ev *ExchangeEvent, header http.Header) {
+	// 1. parse the Date and Age headers, ignoring invalid values
+	if date, err := http.ParseTime(header.Get("Date")); err == nil {
+		ev.HTTPDate = date
+	}
+	if age, err := strconv.ParseUint(strings.TrimSpace(header.Get("Age")), 10, 32); err == nil {
+		ev.HTTPAge = time.Duration(age) * time.Second
+	}
+
+	// 2. save the cache-related headers
+	ev.HTTPCacheControl = header.Get("Cache-Control")
+	for _, name := range cacheStatusHeaders {
+		if value := header.Get(name); value != "" {
+			ev.HTTPCacheStatus = value
+			break
+		}
+	}
+
+	// 3. infer whether a cache served the response
+	ev.HTTPCacheHit = ev.HTTPAge > 0 || isCacheHitStatus(ev.HTTPCacheStatus)
+}
+
+// isCacheHitStatus returns whether the cache status header value indicates a hit,
+// e.g., "HIT" (Cloudflare), "Hit from cloudfront" (CloudFront), "TCP_HIT" (Squid),
+// or "ExampleCache; hit" (RFC 9211).
+func isCacheHitStatus(value string) bool {
+	for _, token := range strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return r == ' ' || r == ';' || r == ',' || r == '_'
+	}) {
+		if token == "hit" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportCacheHeaders(t *testing.T) {
+	date := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// headers contains the response headers to set.
+		headers map[string]string
+
+		// wantAge is the expected HTTPAge.
+		wantAge time.Duration
+
+		// wantCacheStatus is the expected HTTPCacheStatus.
+		wantCacheStatus string
+
+		// wantCacheHit is the expected HTTPCacheHit.
+		wantCacheHit bool
+	}
+
+	testCases := []testCase{
+		{
+			name:    "origin",
+			headers: map[string]string{"Cache-Control": "max-age=300"},
+		},
+
+		{
+			name:         "Age",
+			headers:      map[string]string{"Age": "42"},
+			wantAge:      42 * time.Second,
+			wantCacheHit: true,
+		},
+
+		{
+			name:    "invalid Age",
+			headers: map[string]string{"Age": "-1"},
+		},
+
+		{
+			name:            "Cloudflare hit",
+			headers:         map[string]string{"CF-Cache-Status": "HIT"},
+			wantCacheStatus: "HIT",
+			wantCacheHit:    true,
+		},
+
+		{
+			name:            "CloudFront miss",
+			headers:         map[string]string{"X-Cache": "Miss from cloudfront"},
+			wantCacheStatus: "Miss from cloudfront",
+		},
+
+		{
+			name: "RFC 9211 takes precedence",
+			headers: map[string]string{
+				"Cache-Status": "ExampleCache; hit",
+				"X-Cache":      "MISS",
+			},
+			wantCacheStatus: "ExampleCache; hit",
+			wantCacheHit:    true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := dnsHandler(t)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Date", date.Format(http.TimeFormat))
+				for key, value := range tt.headers {
+					w.Header().Set(key, value)
+				}
+				handler.ServeHTTP(w, r)
+			}))
+			defer srv.Close()
+
+			var ev *dnsoverhttps.ExchangeEvent
+			dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+			dt.ObserveExchange = func(e *dnsoverhttps.ExchangeEvent) { ev = e }
+			_, err := dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+			require.NoError(t, err)
+
+			require.NotNil(t, ev)
+			assert.True(t, date.Equal(ev.HTTPDate))
+			assert.Equal(t, tt.wantAge, ev.HTTPAge)
+			assert.Equal(t, tt.headers["Cache-Control"], ev.HTTPCacheControl)
+			assert.Equal(t, tt.wantCacheStatus, ev.HTTPCacheStatus)
+			assert.Equal(t, tt.wantCacheHit, ev.HTTPCacheHit)
+
+			rec := dnsoverhttps.NewExchangeRecord(ev)
+			require.NotNil(t, rec.HTTPDate)
+			assert.Equal(t, "2026-01-02T03:04:05Z", *rec.HTTPDate)
+			assert.Equal(t, tt.wantAge.Seconds(), rec.HTTPAge)
+		})
+	}
+}
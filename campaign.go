@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+)
+
+// CampaignTarget is a query to run against each [Campaign] transport.
+type CampaignTarget struct {
+	// Name is the name to resolve.
+	Name string
+
+	// QueryType is the query type (e.g., dns.TypeA).
+	QueryType uint16
+}
+
+// CampaignResult is the result of running a [CampaignTarget] against a [*Transport].
+type CampaignResult struct {
+	// URL is the URL of the [*Transport].
+	URL string
+
+	// Target is the target.
+	Target CampaignTarget
+
+	// Attempts is the number of exchanges we performed.
+	Attempts int
+
+	// Response is the response or nil on failure.
+	Response *dnscodec.Response
+
+	// Err is the error of the last attempt or nil on success.
+	Err error
+}
+
+// Campaign runs each [CampaignTarget] against each [*Transport], which is the
+// orchestration layer of most measurement scripts.
+//
+// Construct using [NewCampaign].
+type Campaign struct {
+	// Transports contains the transports to measure.
+	//
+	// Set by [NewCampaign] to the user-provided value.
+	Transports []*Transport
+
+	// Targets contains the targets to measure.
+	//
+	// Set by [NewCampaign] to the user-provided value.
+	Targets []CampaignTarget
+
+	// Parallelism is the number of concurrent measurements.
+	//
+	// Set by [NewCampaign] to 1.
+	Parallelism int
+
+	// Interval is the OPTIONAL minimum interval between starting two
+	// measurements, which allows to limit the query rate.
+	Interval time.Duration
+
+	// Retries is the number of times we retry a failed exchange when the
+	// ShouldRetry policy allows so.
+	Retries int
+
+	// RetryDelay is the OPTIONAL delay before each retry.
+	RetryDelay time.Duration
+
+	// ShouldRetry decides whether to retry given the exchange error.
+	//
+	// Set by [NewCampaign] to [ShouldRetrySafe].
+	ShouldRetry func(err error) bool
+
+	// Sink is the OPTIONAL [Sink] to emit an [*ExchangeRecord] to for each exchange,
+	// including retries. We call the Transport ObserveExchange hook as well.
+	Sink Sink
+
+	// ObserveResult is an OPTIONAL hook called with each [*CampaignResult].
+	//
+	// We call this hook from the goroutines performing the measurements.
+	ObserveResult func(*CampaignResult)
+}
+
+// NewCampaign creates a new [*Campaign].
+func NewCampaign(transports []*Transport, targets []CampaignTarget) *Campaign {
+	return &Campaign{
+		Transports:  transports,
+		Targets:     targets,
+		Parallelism: 1,
+		ShouldRetry: ShouldRetrySafe,
+	}
+}
+
+// campaignJob is a measurement performed by a [*Campaign] worker.
+type campaignJob struct {
+	dt     *Transport
+	target CampaignTarget
+}
+
+// Run runs the campaign until all measurements complete or the context is done.
+//
+// Returns the first [Sink] error or the context error, if any.
+func (c *Campaign) Run(ctx context.Context) error {
+	// 1. wrap the transports to emit to the sink
+	transports := c.Transports
+	var obs *SinkObserver
+	if c.Sink != nil {
+		obs = NewSinkObserver(c.Sink)
+		transports = make([]*Transport, 0, len(c.Transports))
+		for _, dt := range c.Transports {
+			child := *dt
+			child.ObserveExchange = func(ev *ExchangeEvent) {
+				obs.ObserveExchange(ev)
+				if dt.ObserveExchange != nil {
+					dt.ObserveExchange(ev)
+				}
+			}
+			transports = append(transports, &child)
+		}
+	}
+
+	// 2. feed the jobs to the workers honoring the interval
+	jobs := make(chan campaignJob)
+	go func() {
+		defer close(jobs)
+		for _, target := range c.Targets {
+			for _, dt := range transports {
+				select {
+				case jobs <- campaignJob{dt, target}:
+				case <-ctx.Done():
+					return
+				}
+				if c.Interval > 0 && !sleepContext(ctx, c.Interval) {
+					return
+				}
+			}
+		}
+	}()
+
+	// 3. run the workers
+	wg := &sync.WaitGroup{}
+	for range max(c.Parallelism, 1) {
+		wg.Go(func() {
+			for job := range jobs {
+				result := c.measure(ctx, job)
+				if c.ObserveResult != nil {
+					c.ObserveResult(result)
+				}
+			}
+		})
+	}
+	wg.Wait()
+
+	// 4. report errors
+	if obs != nil && obs.Err() != nil {
+		return obs.Err()
+	}
+	return ctx.Err()
+}
+
+// measure performs a measurement with retries.
+func (c *Campaign) measure(ctx context.Context, job campaignJob) *CampaignResult {
+	result := &CampaignResult{URL: job.dt.URL, Target: job.target}
+	for {
+		result.Attempts++
+		query := dnscodec.NewQuery(job.target.Name, job.target.QueryType)
+		result.Response, result.Err = job.dt.Exchange(ctx, query)
+		if result.Err == nil || result.Attempts > c.Retries || !c.ShouldRetry(result.Err) {
+			return result
+		}
+		if !sleepContext(ctx, c.RetryDelay) {
+			return result
+		}
+	}
+}
+
+// sleepContext sleeps for the given duration and returns false if the context is done.
+func sleepContext(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCampaign(t *testing.T) {
+	stable := httptest.NewServer(dnsHandler(t))
+	defer stable.Close()
+
+	targets := []dnsoverhttps.CampaignTarget{
+		{Name: "dns.google", QueryType: dns.TypeA},
+		{Name: "example.com", QueryType: dns.TypeA},
+	}
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// retries is the number of retries.
+		retries int
+
+		// shouldRetry is the OPTIONAL retry policy overriding the default.
+		shouldRetry func(err error) bool
+
+		// wantFlakyAttempts is the expected attempts against the flaky server.
+		wantFlakyAttempts int
+
+		// wantRecords is the expected number of records.
+		wantRecords int
+	}
+
+	testCases := []testCase{
+		{name: "without retries", retries: 0, wantFlakyAttempts: 1, wantRecords: 4},
+		{name: "with retries", retries: 2, shouldRetry: dnsoverhttps.ShouldFallbackDefault, wantFlakyAttempts: 2, wantRecords: 6},
+		{name: "with retries of safe errors only", retries: 2, wantFlakyAttempts: 1, wantRecords: 4},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			// the flaky server fails the first query for each name
+			scripted := dnsoverhttps.NewScriptedHandler(func(query *dns.Msg) *dns.Msg {
+				resp := &dns.Msg{}
+				require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+				return resp
+			})
+			for _, target := range targets {
+				scripted.Script(target.Name, dnsoverhttps.ScriptStep{StatusCode: http.StatusServiceUnavailable})
+			}
+			flaky := httptest.NewServer(scripted)
+			defer flaky.Close()
+
+			var (
+				mu       sync.Mutex
+				observed []*dnsoverhttps.ExchangeEvent
+				results  []*dnsoverhttps.CampaignResult
+			)
+			stableDT := dnsoverhttps.NewTransport(stable.Client(), stable.URL)
+			stableDT.ObserveExchange = func(ev *dnsoverhttps.ExchangeEvent) {
+				mu.Lock()
+				observed = append(observed, ev)
+				mu.Unlock()
+			}
+			transports := []*dnsoverhttps.Transport{
+				dnsoverhttps.NewTransport(flaky.Client(), flaky.URL),
+				stableDT,
+			}
+
+			buff := &bytes.Buffer{}
+			c := dnsoverhttps.NewCampaign(transports, targets)
+			c.Parallelism = 2
+			c.Retries = tt.retries
+			c.RetryDelay = time.Millisecond
+			if tt.shouldRetry != nil {
+				c.ShouldRetry = tt.shouldRetry
+			}
+			c.Sink = dnsoverhttps.NewJSONSink(buff)
+			c.ObserveResult = func(result *dnsoverhttps.CampaignResult) {
+				mu.Lock()
+				results = append(results, result)
+				mu.Unlock()
+			}
+
+			require.NoError(t, c.Run(context.Background()))
+			require.Len(t, results, 4)
+			for _, result := range results {
+				if result.URL == flaky.URL {
+					assert.Equal(t, tt.wantFlakyAttempts, result.Attempts)
+					assert.Equal(t, tt.wantFlakyAttempts > 1, result.Err == nil)
+					continue
+				}
+				assert.Equal(t, 1, result.Attempts)
+				require.NoError(t, result.Err)
+				assert.NotNil(t, result.Response)
+			}
+			assert.Len(t, strings.Split(strings.TrimSpace(buff.String()), "\n"), tt.wantRecords)
+			assert.Len(t, observed, 2)
+		})
+	}
+}
+
+// failingSink is a [dnsoverhttps.Sink] always failing.
+type failingSink struct{ err error }
+
+func (s *failingSink) Emit(event any) error {
+	return s.err
+}
+
+func TestCampaignErrors(t *testing.T) {
+	srv := httptest.NewServer(dnsHandler(t))
+	defer srv.Close()
+	transports := []*dnsoverhttps.Transport{dnsoverhttps.NewTransport(srv.Client(), srv.URL)}
+	targets := []dnsoverhttps.CampaignTarget{{Name: "dns.google", QueryType: dns.TypeA}}
+
+	t.Run("sink error", func(t *testing.T) {
+		mockedErr := errors.New("mocked error")
+		c := dnsoverhttps.NewCampaign(transports, targets)
+		c.Sink = &failingSink{mockedErr}
+		require.ErrorIs(t, c.Run(context.Background()), mockedErr)
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var count int
+		c := dnsoverhttps.NewCampaign(transports, append(targets, targets...))
+		c.Interval = time.Hour
+		c.ObserveResult = func(result *dnsoverhttps.CampaignResult) {
+			count++
+		}
+		require.ErrorIs(t, c.Run(ctx), context.Canceled)
+		assert.LessOrEqual(t, count, 1)
+	})
+}
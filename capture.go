@@ -0,0 +1,222 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// captureMagic is the magic string at the beginning of capture files.
+const captureMagic = "DOHCAP01"
+
+// ErrInvalidCapture indicates that a capture file is malformed.
+var ErrInvalidCapture = errors.New("invalid capture file")
+
+// CaptureDirection is the direction of a captured DNS message.
+type CaptureDirection uint8
+
+const (
+	// CaptureQuery indicates a DNS query sent to the server.
+	CaptureQuery CaptureDirection = iota
+
+	// CaptureResponse indicates a DNS response received from the server.
+	CaptureResponse
+)
+
+// String implements [fmt.Stringer].
+func (d CaptureDirection) String() string {
+	switch d {
+	case CaptureQuery:
+		return "query"
+	case CaptureResponse:
+		return "response"
+	default:
+		return fmt.Sprintf("CaptureDirection(%d)", uint8(d))
+	}
+}
+
+// CaptureRecord is a raw DNS message read from a capture file.
+type CaptureRecord struct {
+	// Time is when the message was sent or received.
+	Time time.Time
+
+	// Direction is the message direction.
+	Direction CaptureDirection
+
+	// RawMsg is the raw DNS message.
+	RawMsg []byte
+}
+
+// CaptureWriter appends raw DNS messages to a capture file.
+//
+// A capture file starts with the 8-byte magic string "DOHCAP01" and
+// contains a sequence of records. Each record consists of:
+//
+//  1. the timestamp as big-endian int64 nanoseconds since the Unix epoch;
+//  2. the [CaptureDirection] as a single byte;
+//  3. the message length as big-endian uint16;
+//  4. the raw DNS message.
+//
+// Set [*CaptureWriter.ObserveExchange] as the [Transport.ObserveExchange] hook.
+//
+// Construct using [NewCaptureWriter].
+type CaptureWriter struct {
+	// w is the underlying writer.
+	w io.Writer
+
+	// started indicates whether we have written the magic.
+	started bool
+
+	// err is the first write error.
+	err error
+
+	// mu protects w, started, and err.
+	mu sync.Mutex
+}
+
+// NewCaptureWriter creates a new [*CaptureWriter] writing to w.
+//
+// The magic is written along with the first record.
+func NewCaptureWriter(w io.Writer) *CaptureWriter {
+	return &CaptureWriter{w: w}
+}
+
+// ObserveExchange writes the raw query and the raw response, when available.
+//
+// The query timestamp is the event StartTime and the response timestamp is
+// StartTime plus Duration. Errors, including [ErrInvalidCapture] for oversized
+// messages, are available through [*CaptureWriter.Err].
+//
+// This method is safe to call from multiple goroutines.
+func (cw *CaptureWriter) ObserveExchange(ev *ExchangeEvent) {
+	if ev.RawQuery != nil {
+		cw.saveErr(cw.WriteRecord(&CaptureRecord{Time: ev.StartTime, Direction: CaptureQuery, RawMsg: ev.RawQuery}))
+	}
+	if ev.RawResponse != nil {
+		cw.saveErr(cw.WriteRecord(&CaptureRecord{
+			Time:      ev.StartTime.Add(ev.Duration),
+			Direction: CaptureResponse,
+			RawMsg:    ev.RawResponse,
+		}))
+	}
+}
+
+// saveErr saves the error, if any, unless we already saved an error, so that
+// [*CaptureWriter.Err] also reports the errors that [*CaptureWriter.WriteRecord]
+// returns without saving them (i.e., [ErrInvalidCapture] for oversized messages).
+func (cw *CaptureWriter) saveErr(err error) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	if cw.err == nil {
+		cw.err = err
+	}
+}
+
+// WriteRecord appends a record to the capture file.
+//
+// After a write error, the [*CaptureWriter] stops writing records and
+// returns the first error.
+//
+// This method is safe to call from multiple goroutines.
+func (cw *CaptureWriter) WriteRecord(rec *CaptureRecord) error {
+	if len(rec.RawMsg) > math.MaxUint16 {
+		return ErrInvalidCapture
+	}
+
+	buff := make([]byte, 0, len(captureMagic)+11+len(rec.RawMsg))
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	if cw.err != nil {
+		return cw.err
+	}
+	if !cw.started {
+		buff = append(buff, captureMagic...)
+	}
+	buff = binary.BigEndian.AppendUint64(buff, uint64(rec.Time.UnixNano()))
+	buff = append(buff, byte(rec.Direction))
+	buff = binary.BigEndian.AppendUint16(buff, uint16(len(rec.RawMsg)))
+	buff = append(buff, rec.RawMsg...)
+	if _, cw.err = cw.w.Write(buff); cw.err != nil {
+		return cw.err
+	}
+	cw.started = true
+	return nil
+}
+
+// Err returns the first error that occurred writing records, if any.
+func (cw *CaptureWriter) Err() error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	return cw.err
+}
+
+// CaptureReader reads records from a capture file.
+//
+// Construct using [NewCaptureReader].
+type CaptureReader struct {
+	// r is the buffered underlying reader.
+	r *bufio.Reader
+
+	// started indicates whether we have read the magic.
+	started bool
+}
+
+// NewCaptureReader creates a new [*CaptureReader] reading from r.
+func NewCaptureReader(r io.Reader) *CaptureReader {
+	return &CaptureReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next record or [io.EOF] at the end of the file.
+//
+// Truncated or otherwise malformed files cause [ErrInvalidCapture].
+func (cr *CaptureReader) Next() (*CaptureRecord, error) {
+	// 1. check the magic the first time we're called
+	if !cr.started {
+		magic := make([]byte, len(captureMagic))
+		if _, err := io.ReadFull(cr.r, magic); err != nil {
+			return nil, captureMapError(err, io.EOF)
+		}
+		if string(magic) != captureMagic {
+			return nil, ErrInvalidCapture
+		}
+		cr.started = true
+	}
+
+	// 2. read the fixed-size header
+	header := make([]byte, 11)
+	if _, err := io.ReadFull(cr.r, header); err != nil {
+		return nil, captureMapError(err, io.EOF)
+	}
+
+	// 3. read the raw message
+	rawMsg := make([]byte, binary.BigEndian.Uint16(header[9:]))
+	if _, err := io.ReadFull(cr.r, rawMsg); err != nil {
+		return nil, captureMapError(err, ErrInvalidCapture)
+	}
+
+	rec := &CaptureRecord{
+		Time:      time.Unix(0, int64(binary.BigEndian.Uint64(header[:8]))),
+		Direction: CaptureDirection(header[8]),
+		RawMsg:    rawMsg,
+	}
+	return rec, nil
+}
+
+// captureMapError maps [io.ReadFull] errors to the errors returned by [*CaptureReader.Next].
+func captureMapError(err, eof error) error {
+	switch {
+	case errors.Is(err, io.EOF):
+		return eof
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrInvalidCapture
+	default:
+		return err
+	}
+}
@@ -0,0 +1,131 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/bassosimone/iotest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCaptureRoundTrip(t *testing.T) {
+	buff := &bytes.Buffer{}
+	cw := dnsoverhttps.NewCaptureWriter(buff)
+
+	t0 := time.Unix(1700000000, 123456789)
+	cw.ObserveExchange(&dnsoverhttps.ExchangeEvent{
+		StartTime:   t0,
+		Duration:    time.Second,
+		RawQuery:    []byte{0x01, 0x02},
+		RawResponse: []byte{0x03, 0x04, 0x05},
+	})
+	cw.ObserveExchange(&dnsoverhttps.ExchangeEvent{
+		StartTime: t0,
+		RawQuery:  []byte{0x06},
+		Err:       errors.New("mocked error"),
+	})
+	require.NoError(t, cw.Err())
+
+	cr := dnsoverhttps.NewCaptureReader(buff)
+	var got []*dnsoverhttps.CaptureRecord
+	for {
+		rec, err := cr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(t, err)
+		got = append(got, rec)
+	}
+
+	require.Len(t, got, 3)
+	assert.True(t, t0.Equal(got[0].Time))
+	assert.Equal(t, dnsoverhttps.CaptureQuery, got[0].Direction)
+	assert.Equal(t, []byte{0x01, 0x02}, got[0].RawMsg)
+	assert.True(t, t0.Add(time.Second).Equal(got[1].Time))
+	assert.Equal(t, dnsoverhttps.CaptureResponse, got[1].Direction)
+	assert.Equal(t, []byte{0x03, 0x04, 0x05}, got[1].RawMsg)
+	assert.Equal(t, dnsoverhttps.CaptureQuery, got[2].Direction)
+	assert.Equal(t, []byte{0x06}, got[2].RawMsg)
+}
+
+func TestCaptureReaderErrors(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// input is the capture file content.
+		input string
+
+		// wantErr is the expected error.
+		wantErr error
+	}
+
+	testCases := []testCase{
+		{name: "empty file", input: "", wantErr: io.EOF},
+		{name: "truncated magic", input: "DOH", wantErr: dnsoverhttps.ErrInvalidCapture},
+		{name: "wrong magic", input: "NOTACAP!", wantErr: dnsoverhttps.ErrInvalidCapture},
+		{name: "no records", input: "DOHCAP01", wantErr: io.EOF},
+		{name: "truncated header", input: "DOHCAP01\x00\x00", wantErr: dnsoverhttps.ErrInvalidCapture},
+		{
+			name:    "truncated message",
+			input:   "DOHCAP01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x04\x01",
+			wantErr: dnsoverhttps.ErrInvalidCapture,
+		},
+		{
+			name:    "missing message",
+			input:   "DOHCAP01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x04",
+			wantErr: dnsoverhttps.ErrInvalidCapture,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			cr := dnsoverhttps.NewCaptureReader(bytes.NewReader([]byte(tt.input)))
+			rec, err := cr.Next()
+			require.ErrorIs(t, err, tt.wantErr)
+			require.Nil(t, rec)
+		})
+	}
+}
+
+func TestCaptureWriterErrors(t *testing.T) {
+	t.Run("oversized message", func(t *testing.T) {
+		cw := dnsoverhttps.NewCaptureWriter(&bytes.Buffer{})
+		err := cw.WriteRecord(&dnsoverhttps.CaptureRecord{RawMsg: make([]byte, 1<<16)})
+		require.ErrorIs(t, err, dnsoverhttps.ErrInvalidCapture)
+		require.NoError(t, cw.Err())
+	})
+
+	t.Run("oversized message using ObserveExchange", func(t *testing.T) {
+		cw := dnsoverhttps.NewCaptureWriter(&bytes.Buffer{})
+		cw.ObserveExchange(&dnsoverhttps.ExchangeEvent{RawQuery: []byte{0x01}, RawResponse: make([]byte, 1<<16)})
+		require.ErrorIs(t, cw.Err(), dnsoverhttps.ErrInvalidCapture)
+	})
+
+	t.Run("write error", func(t *testing.T) {
+		wantErr := errors.New("mocked error")
+		count := 0
+		cw := dnsoverhttps.NewCaptureWriter(&iotest.FuncWriter{WriteFunc: func(p []byte) (int, error) {
+			count++
+			return 0, wantErr
+		}})
+		rec := &dnsoverhttps.CaptureRecord{RawMsg: []byte{0x01}}
+		require.ErrorIs(t, cw.WriteRecord(rec), wantErr)
+		require.ErrorIs(t, cw.WriteRecord(rec), wantErr)
+		require.ErrorIs(t, cw.Err(), wantErr)
+		assert.Equal(t, 1, count)
+	})
+}
+
+func TestCaptureDirectionString(t *testing.T) {
+	assert.Equal(t, "query", dnsoverhttps.CaptureQuery.String())
+	assert.Equal(t, "response", dnsoverhttps.CaptureResponse.String())
+	assert.Equal(t, "CaptureDirection(7)", dnsoverhttps.CaptureDirection(7).String())
+}
@@ -0,0 +1,26 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// withContextCause annotates err with the cause of the context cancellation
+// (see [context.WithCancelCause]), so that logs explain why we abandoned the
+// exchange (e.g., "retry budget exhausted") rather than saying "context canceled".
+//
+// The returned error wraps both err and the cause. When err is nil, the context
+// is not done, or err already wraps the cause, we return err unchanged.
+func withContextCause(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil {
+		return err
+	}
+	cause := context.Cause(ctx)
+	if cause == nil || errors.Is(err, cause) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", cause, err)
+}
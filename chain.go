@@ -0,0 +1,86 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+)
+
+// ErrNoExchangers indicates that a [*ChainExchanger] has no exchangers.
+var ErrNoExchangers = errors.New("no exchangers")
+
+// ChainHopEvent describes an attempt made by a [*ChainExchanger].
+type ChainHopEvent struct {
+	// Index is the index of the [Exchanger] within the chain.
+	Index int
+
+	// StartTime is when the attempt started.
+	StartTime time.Time
+
+	// Duration is the duration of the attempt.
+	Duration time.Duration
+
+	// Err is the error that occurred or nil on success.
+	Err error
+}
+
+// ChainExchanger tries an ordered list of [Exchanger] until one of them
+// answers or fails with an error that should not cause a fallback.
+//
+// Construct using [NewChainExchanger].
+type ChainExchanger struct {
+	// Exchangers contains the exchangers to try in order.
+	//
+	// Set by [NewChainExchanger] to the user-provided value.
+	Exchangers []Exchanger
+
+	// ShouldFallback decides whether to try the next exchanger given an error.
+	//
+	// Set by [NewChainExchanger] to [ShouldFallbackDefault].
+	ShouldFallback func(err error) bool
+
+	// ObserveHop is an optional hook called after each attempt.
+	ObserveHop func(*ChainHopEvent)
+
+	// Scores OPTIONALLY tracks the score of each exchanger.
+	Scores *ScoreTracker
+}
+
+var _ Exchanger = &ChainExchanger{}
+
+// NewChainExchanger creates a new [*ChainExchanger].
+func NewChainExchanger(exchangers ...Exchanger) *ChainExchanger {
+	return &ChainExchanger{
+		Exchangers:     exchangers,
+		ShouldFallback: ShouldFallbackDefault,
+	}
+}
+
+// Exchange implements [Exchanger].
+//
+// On failure, it returns the error of the last attempt.
+func (cx *ChainExchanger) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	err := ErrNoExchangers
+	for idx, exchanger := range cx.Exchangers {
+		// 1. attempt the exchange and observe the attempt
+		t0 := time.Now()
+		var resp *dnscodec.Response
+		resp, err = exchanger.Exchange(ctx, query)
+		if ctx.Err() == nil {
+			cx.Scores.record(idx, t0, err)
+		}
+		if cx.ObserveHop != nil {
+			cx.ObserveHop(&ChainHopEvent{Index: idx, StartTime: t0, Duration: time.Since(t0), Err: err})
+		}
+
+		// 2. stop on success or when we should not fall back
+		if err == nil || ctx.Err() != nil || !cx.ShouldFallback(err) {
+			return resp, err
+		}
+	}
+	return nil, err
+}
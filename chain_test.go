@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainExchanger(t *testing.T) {
+	errFirst := errors.New("first failed")
+	errSecond := errors.New("second failed")
+	want := &dnscodec.Response{}
+	failing := func(err error) dnsoverhttps.Exchanger {
+		return funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+			return nil, err
+		})
+	}
+	succeeding := funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		return want, nil
+	})
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+
+	t.Run("the third hop answers", func(t *testing.T) {
+		cx := dnsoverhttps.NewChainExchanger(failing(errFirst), failing(errSecond), succeeding)
+		var hops []*dnsoverhttps.ChainHopEvent
+		cx.ObserveHop = func(ev *dnsoverhttps.ChainHopEvent) {
+			hops = append(hops, ev)
+		}
+
+		resp, err := cx.Exchange(context.Background(), query)
+		require.NoError(t, err)
+		assert.Same(t, want, resp)
+		require.Len(t, hops, 3)
+		for idx, hop := range hops {
+			assert.Equal(t, idx, hop.Index)
+			assert.False(t, hop.StartTime.IsZero())
+		}
+		assert.ErrorIs(t, hops[0].Err, errFirst)
+		assert.ErrorIs(t, hops[1].Err, errSecond)
+		assert.NoError(t, hops[2].Err)
+	})
+
+	t.Run("all hops fail", func(t *testing.T) {
+		cx := dnsoverhttps.NewChainExchanger(failing(errFirst), failing(errSecond))
+		_, err := cx.Exchange(context.Background(), query)
+		require.ErrorIs(t, err, errSecond)
+	})
+
+	t.Run("negative answers stop the chain", func(t *testing.T) {
+		cx := dnsoverhttps.NewChainExchanger(failing(dnscodec.ErrNoName), succeeding)
+		_, err := cx.Exchange(context.Background(), query)
+		require.ErrorIs(t, err, dnscodec.ErrNoName)
+	})
+
+	t.Run("empty chain", func(t *testing.T) {
+		cx := dnsoverhttps.NewChainExchanger()
+		_, err := cx.Exchange(context.Background(), query)
+		require.ErrorIs(t, err, dnsoverhttps.ErrNoExchangers)
+	})
+}
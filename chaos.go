@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"strings"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// Well-known CHAOS-class TXT names identifying the server instance.
+const (
+	// ChaosIDServer is the RFC 4892 name returning the server identity.
+	ChaosIDServer = "id.server."
+
+	// ChaosHostnameBind is the legacy BIND name returning the server hostname.
+	ChaosHostnameBind = "hostname.bind."
+
+	// ChaosVersionServer is the name returning the server software version.
+	ChaosVersionServer = "version.server."
+
+	// ChaosVersionBind is the legacy BIND name returning the server software version.
+	ChaosVersionBind = "version.bind."
+)
+
+// ExchangeChaosTXT sends a CHAOS-class TXT query for the given name (e.g.,
+// [ChaosIDServer]) and returns the TXT strings of the answer, concatenating
+// the character-strings of each RR. This is the standard way to identify the
+// anycast instance answering behind a public DoH service.
+//
+// Returns [dnscodec.ErrNoData] when the answer contains no TXT RRs.
+func (dt *Transport) ExchangeChaosTXT(ctx context.Context, name string) ([]string, error) {
+	// 1. Create the query message
+	query := &dns.Msg{}
+	query.SetQuestion(dns.Fqdn(name), dns.TypeTXT)
+	query.Question[0].Qclass = dns.ClassCHAOS
+
+	// 2. Perform the exchange and map the RCODE to an error
+	resp, err := dt.ExchangeMsg(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, dnscodec.ResponseErrorFromRCODE(resp)
+	}
+
+	// 3. Extract the TXT strings
+	var out []string
+	for _, rr := range resp.Answer {
+		if txt, ok := rr.(*dns.TXT); ok && txt.Hdr.Class == dns.ClassCHAOS {
+			out = append(out, strings.Join(txt.Txt, ""))
+		}
+	}
+	if len(out) <= 0 {
+		return nil, dnscodec.ErrNoData
+	}
+	return out, nil
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExchangeChaosTXT(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// reply builds the response for the query.
+		reply func(query *dns.Msg) *dns.Msg
+
+		// want is the expected result.
+		want []string
+
+		// wantErr is the expected error (nil on success).
+		wantErr error
+	}
+
+	testCases := []testCase{
+		{
+			name: "identity",
+			reply: func(query *dns.Msg) *dns.Msg {
+				resp := &dns.Msg{}
+				resp.SetReply(query)
+				resp.Answer = append(resp.Answer, &dns.TXT{
+					Hdr: dns.RR_Header{Name: query.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassCHAOS},
+					Txt: []string{"fra", "01"},
+				})
+				return resp
+			},
+			want: []string{"fra01"},
+		},
+
+		{
+			name: "refused",
+			reply: func(query *dns.Msg) *dns.Msg {
+				resp := &dns.Msg{}
+				resp.SetRcode(query, dns.RcodeRefused)
+				return resp
+			},
+			wantErr: dnscodec.ErrServerMisbehaving,
+		},
+
+		{
+			name: "empty answer",
+			reply: func(query *dns.Msg) *dns.Msg {
+				resp := &dns.Msg{}
+				resp.SetReply(query)
+				return resp
+			},
+			wantErr: dnscodec.ErrNoData,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotQuery *dns.Msg
+			srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+				gotQuery = query
+				return tc.reply(query)
+			})
+			defer srv.Close()
+
+			dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+			got, err := dt.ExchangeChaosTXT(context.Background(), dnsoverhttps.ChaosIDServer)
+			require.ErrorIs(t, err, tc.wantErr)
+			assert.Equal(t, tc.want, got)
+
+			require.NotNil(t, gotQuery)
+			require.Len(t, gotQuery.Question, 1)
+			assert.Equal(t, uint16(dns.ClassCHAOS), gotQuery.Question[0].Qclass)
+			assert.Equal(t, dns.TypeTXT, gotQuery.Question[0].Qtype)
+			assert.Equal(t, "id.server.", gotQuery.Question[0].Name)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"crypto/tls"
+	"net/http"
+	"slices"
+	"time"
+
+	"golang.org/x/net/http2"
+)
+
+// NewInsecureH2CClient creates an [*http.Client] that speaks cleartext HTTP/2
+// with prior knowledge (h2c) and cannot speak HTTP/1.1 or TLS.
+//
+// Use it with an http:// URL to reach DoH servers in lab environments where
+// TLS is terminated elsewhere. The resulting exchanges are NOT confidential
+// and NOT authenticated, which [ExchangeEvent] reports through its
+// Insecure field.
+func NewInsecureH2CClient() *http.Client {
+	protocols := &http.Protocols{}
+	protocols.SetUnencryptedHTTP2(true)
+	txp := http.DefaultTransport.(*http.Transport).Clone()
+	txp.Protocols = protocols
+	return &http.Client{Transport: txp}
+}
+
+// NewTLSClient creates an [*http.Client] using a clone of the given TLS
+// configuration, which allows to control the TLS versions (MinVersion and
+// MaxVersion), the cipher suites (CipherSuites, which only affects TLS 1.2),
+// the key exchange mechanisms (CurvePreferences), and ALPN (NextProtos).
+//
+// When NextProtos is empty, the client offers "h2" and "http/1.1". Otherwise,
+// the client offers exactly NextProtos and only enables HTTP/2 when "h2" is
+// part of NextProtos, which allows to measure ALPN sensitivity.
+//
+// A nil config is equivalent to the zero config.
+func NewTLSClient(config *tls.Config) *http.Client {
+	txp := http.DefaultTransport.(*http.Transport).Clone()
+	txp.TLSClientConfig = config.Clone()
+	if config != nil && len(config.NextProtos) > 0 {
+		protocols := &http.Protocols{}
+		protocols.SetHTTP1(!slices.Contains(config.NextProtos, "h2") || slices.Contains(config.NextProtos, "http/1.1"))
+		protocols.SetHTTP2(slices.Contains(config.NextProtos, "h2"))
+		txp.Protocols = protocols
+	}
+	return &http.Client{Transport: txp}
+}
+
+// HTTP2Options contains the HTTP/2 settings for [NewHTTP2Client].
+type HTTP2Options struct {
+	// StrictMaxConcurrentStreams, when true, causes queries exceeding the server
+	// limit on concurrent streams to wait for an available stream rather than
+	// opening a new connection, thus keeping all queries on the same connection.
+	//
+	// Note that the server controls the maximum number of concurrent streams.
+	StrictMaxConcurrentStreams bool
+
+	// ReadIdleTimeout is the OPTIONAL interval without receiving frames after
+	// which we send a PING frame to check the connection health, thus acting as
+	// a ping period. Zero disables health checks.
+	ReadIdleTimeout time.Duration
+
+	// PingTimeout is the OPTIONAL time to wait for the PING response before
+	// closing the connection. Zero means 15 seconds.
+	PingTimeout time.Duration
+}
+
+// NewHTTP2Client is like [NewTLSClient] but also configures the underlying
+// HTTP/2 transport using the given options, which allows to tune multiplexing
+// for DoH studies without reaching around the [Client] abstraction.
+//
+// Nil options are equivalent to the zero [HTTP2Options].
+//
+// Like [NewTLSClient], when NextProtos is not empty, the client offers exactly
+// NextProtos, so HTTP/2 is only possible when "h2" is part of NextProtos.
+//
+// Returns an error if we cannot configure HTTP/2 (which should not happen).
+func NewHTTP2Client(config *tls.Config, options *HTTP2Options) (*http.Client, error) {
+	if options == nil {
+		options = &HTTP2Options{}
+	}
+	client := NewTLSClient(config)
+	txp := client.Transport.(*http.Transport)
+	h2txp, err := http2.ConfigureTransports(txp)
+	if err != nil {
+		return nil, err
+	}
+
+	// ConfigureTransports adds "h2" and "http/1.1" to NextProtos, so we restore
+	// the user-provided NextProtos, if any, to offer exactly those protocols
+	if config != nil && len(config.NextProtos) > 0 {
+		txp.TLSClientConfig.NextProtos = slices.Clone(config.NextProtos)
+	}
+	h2txp.StrictMaxConcurrentStreams = options.StrictMaxConcurrentStreams
+	h2txp.ReadIdleTimeout = options.ReadIdleTimeout
+	h2txp.PingTimeout = options.PingTimeout
+	return client, nil
+}
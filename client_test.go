@@ -0,0 +1,265 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dnsHandler is an [http.Handler] replying with a single A record.
+func dnsHandler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawQuery, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		queryMsg := &dns.Msg{}
+		require.NoError(t, queryMsg.Unpack(rawQuery))
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, err = w.Write(buildDNSResponse(t, queryMsg))
+		require.NoError(t, err)
+	})
+}
+
+func TestNewInsecureH2CClient(t *testing.T) {
+	srv := httptest.NewUnstartedServer(dnsHandler(t))
+	srv.Config.Protocols = &http.Protocols{}
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	defer srv.Close()
+
+	var ev *dnsoverhttps.ExchangeEvent
+	dt := dnsoverhttps.NewTransport(dnsoverhttps.NewInsecureH2CClient(), srv.URL)
+	dt.ObserveExchange = func(e *dnsoverhttps.ExchangeEvent) {
+		ev = e
+	}
+
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+	resp, err := dt.Exchange(context.Background(), query)
+	require.NoError(t, err)
+	require.NotNil(t, resp)
+
+	require.NotNil(t, ev)
+	assert.Equal(t, "HTTP/2.0", ev.HTTPProtocol)
+	assert.True(t, ev.Insecure)
+}
+
+func TestExchangeEventSecureExchange(t *testing.T) {
+	srv := httptest.NewTLSServer(dnsHandler(t))
+	defer srv.Close()
+
+	var ev *dnsoverhttps.ExchangeEvent
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	dt.ObserveExchange = func(e *dnsoverhttps.ExchangeEvent) {
+		ev = e
+	}
+
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+	_, err := dt.Exchange(context.Background(), query)
+	require.NoError(t, err)
+
+	require.NotNil(t, ev)
+	assert.Equal(t, "HTTP/1.1", ev.HTTPProtocol)
+	assert.False(t, ev.Insecure)
+}
+
+func TestNewTLSClient(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// config is the client TLS config (RootCAs is set by the test).
+		config *tls.Config
+
+		// wantALPN is the ALPN the server should see.
+		wantALPN []string
+
+		// wantVersions are the TLS versions the server should see.
+		wantVersions []uint16
+
+		// wantCurves are the curves the server should see (nil to skip the check).
+		wantCurves []tls.CurveID
+
+		// wantProto is the expected HTTP protocol.
+		wantProto string
+	}
+
+	testCases := []testCase{
+		{
+			name:         "default ALPN",
+			config:       &tls.Config{},
+			wantALPN:     []string{"h2", "http/1.1"},
+			wantVersions: []uint16{tls.VersionTLS13, tls.VersionTLS12},
+			wantProto:    "HTTP/2.0",
+		},
+
+		{
+			name:         "TLS 1.3 minimum",
+			config:       &tls.Config{MinVersion: tls.VersionTLS13},
+			wantALPN:     []string{"h2", "http/1.1"},
+			wantVersions: []uint16{tls.VersionTLS13},
+			wantProto:    "HTTP/2.0",
+		},
+
+		{
+			name:         "HTTP/1.1 only ALPN",
+			config:       &tls.Config{NextProtos: []string{"http/1.1"}},
+			wantALPN:     []string{"http/1.1"},
+			wantVersions: []uint16{tls.VersionTLS13, tls.VersionTLS12},
+			wantProto:    "HTTP/1.1",
+		},
+
+		{
+			name:         "HTTP/2 only ALPN",
+			config:       &tls.Config{NextProtos: []string{"h2"}},
+			wantALPN:     []string{"h2"},
+			wantVersions: []uint16{tls.VersionTLS13, tls.VersionTLS12},
+			wantProto:    "HTTP/2.0",
+		},
+
+		{
+			name:         "curve preferences",
+			config:       &tls.Config{CurvePreferences: []tls.CurveID{tls.X25519}},
+			wantALPN:     []string{"h2", "http/1.1"},
+			wantVersions: []uint16{tls.VersionTLS13, tls.VersionTLS12},
+			wantCurves:   []tls.CurveID{tls.X25519},
+			wantProto:    "HTTP/2.0",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var hello *tls.ClientHelloInfo
+			srv := httptest.NewUnstartedServer(dnsHandler(t))
+			srv.EnableHTTP2 = true
+			srv.TLS = &tls.Config{GetConfigForClient: func(chi *tls.ClientHelloInfo) (*tls.Config, error) {
+				hello = chi
+				return nil, nil
+			}}
+			srv.StartTLS()
+			defer srv.Close()
+
+			config := tt.config.Clone()
+			config.RootCAs = srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+			client := dnsoverhttps.NewTLSClient(config)
+
+			var ev *dnsoverhttps.ExchangeEvent
+			dt := dnsoverhttps.NewTransport(client, srv.URL)
+			dt.ObserveExchange = func(e *dnsoverhttps.ExchangeEvent) {
+				ev = e
+			}
+
+			query := dnscodec.NewQuery("dns.google", dns.TypeA)
+			_, err := dt.Exchange(context.Background(), query)
+			require.NoError(t, err)
+
+			require.NotNil(t, hello)
+			assert.Equal(t, tt.wantALPN, hello.SupportedProtos)
+			assert.Equal(t, tt.wantVersions, hello.SupportedVersions)
+			if tt.wantCurves != nil {
+				assert.Equal(t, tt.wantCurves, hello.SupportedCurves)
+			}
+			require.NotNil(t, ev)
+			assert.Equal(t, tt.wantProto, ev.HTTPProtocol)
+		})
+	}
+}
+
+func TestNewTLSClientNilConfig(t *testing.T) {
+	client := dnsoverhttps.NewTLSClient(nil)
+	txp := client.Transport.(*http.Transport)
+	assert.Nil(t, txp.TLSClientConfig)
+	assert.Nil(t, txp.Protocols)
+}
+
+func TestNewHTTP2Client(t *testing.T) {
+	// the server records the client addresses
+	var (
+		mu    sync.Mutex
+		addrs = map[string]bool{}
+	)
+	handler := dnsHandler(t)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		addrs[r.RemoteAddr] = true
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		handler.ServeHTTP(w, r)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	config := &tls.Config{RootCAs: srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+	client, err := dnsoverhttps.NewHTTP2Client(config, &dnsoverhttps.HTTP2Options{
+		StrictMaxConcurrentStreams: true,
+		ReadIdleTimeout:            time.Minute,
+		PingTimeout:                time.Second,
+	})
+	require.NoError(t, err)
+
+	dt := dnsoverhttps.NewTransport(client, srv.URL)
+	var protocols sync.Map
+	dt.ObserveExchange = func(ev *dnsoverhttps.ExchangeEvent) {
+		protocols.Store(ev.HTTPProtocol, true)
+	}
+
+	// warm up the connection so that the queries share it
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+	_, err = dt.Exchange(context.Background(), query)
+	require.NoError(t, err)
+
+	wg := &sync.WaitGroup{}
+	for range 4 {
+		wg.Go(func() {
+			_, err := dt.Exchange(context.Background(), query)
+			assert.NoError(t, err)
+		})
+	}
+	wg.Wait()
+
+	assert.Len(t, addrs, 1)
+	_, found := protocols.Load("HTTP/2.0")
+	assert.True(t, found)
+}
+
+func TestNewHTTP2ClientKeepsNextProtos(t *testing.T) {
+	config := &tls.Config{NextProtos: []string{"http/1.1"}}
+	client, err := dnsoverhttps.NewHTTP2Client(config, nil)
+	require.NoError(t, err)
+	txp := client.Transport.(*http.Transport)
+	assert.Equal(t, []string{"http/1.1"}, txp.TLSClientConfig.NextProtos)
+	assert.Equal(t, []string{"http/1.1"}, config.NextProtos)
+}
+
+func TestNewHTTP2ClientNilOptions(t *testing.T) {
+	srv := httptest.NewUnstartedServer(dnsHandler(t))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	config := &tls.Config{RootCAs: srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs}
+	client, err := dnsoverhttps.NewHTTP2Client(config, nil)
+	require.NoError(t, err)
+
+	var ev *dnsoverhttps.ExchangeEvent
+	dt := dnsoverhttps.NewTransport(client, srv.URL)
+	dt.ObserveExchange = func(e *dnsoverhttps.ExchangeEvent) {
+		ev = e
+	}
+	_, err = dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+	require.NoError(t, err)
+	require.NotNil(t, ev)
+	assert.Equal(t, "HTTP/2.0", ev.HTTPProtocol)
+}
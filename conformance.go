@@ -0,0 +1,212 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// ConformanceResult is the outcome of a requirement checked by a [*ConformanceChecker].
+type ConformanceResult struct {
+	// Requirement is the short requirement name (e.g., "post-valid-query").
+	Requirement string
+
+	// Description describes the requirement and what we expect.
+	Description string
+
+	// Pass is true when the server satisfied the requirement.
+	Pass bool
+
+	// StatusCode is the HTTP status code or zero when the round trip failed.
+	StatusCode int
+
+	// Err is the round trip error, if any.
+	Err error
+}
+
+// ConformanceChecker checks whether a DoH server conforms to RFC 8484 by
+// sending a battery of valid and invalid requests. Use [ConformanceRequirements]
+// to obtain the documented list of requirements.
+//
+// Construct using [NewConformanceChecker].
+type ConformanceChecker struct {
+	// Client is the [Client] to use.
+	//
+	// Set by [NewConformanceChecker] to the user-provided value.
+	Client Client
+
+	// QueryName is the name to query in valid requests.
+	//
+	// Set by [NewConformanceChecker] to "example.com".
+	QueryName string
+}
+
+// NewConformanceChecker creates a new [*ConformanceChecker].
+func NewConformanceChecker(client Client) *ConformanceChecker {
+	return &ConformanceChecker{Client: client, QueryName: "example.com"}
+}
+
+// conformanceCheck is a requirement checked by [*ConformanceChecker].
+type conformanceCheck struct {
+	// requirement is the short requirement name.
+	requirement string
+
+	// description describes the requirement.
+	description string
+
+	// newRequest creates the request given the raw valid query and the URL.
+	newRequest func(ctx context.Context, URL string, rawQuery []byte) (*http.Request, error)
+
+	// pass returns whether the response satisfies the requirement.
+	pass func(httpResp *http.Response) bool
+}
+
+// conformanceChecks contains the battery of requirements.
+var conformanceChecks = []conformanceCheck{
+	{
+		requirement: "post-valid-query",
+		description: "a valid POST query yields 200 and an application/dns-message body (RFC 8484 Section 4.1)",
+		newRequest: func(ctx context.Context, URL string, rawQuery []byte) (*http.Request, error) {
+			return newPOSTRequest(ctx, URL, "application/dns-message", rawQuery)
+		},
+		pass: isDNSMessageResponse,
+	},
+
+	{
+		requirement: "get-valid-query",
+		description: "a valid GET query yields 200 and an application/dns-message body (RFC 8484 Section 4.1)",
+		newRequest: func(ctx context.Context, URL string, rawQuery []byte) (*http.Request, error) {
+			return newGETRequest(ctx, URL, base64.RawURLEncoding.EncodeToString(rawQuery))
+		},
+		pass: isDNSMessageResponse,
+	},
+
+	{
+		requirement: "post-wrong-content-type",
+		description: "a POST query with a wrong content type yields a 4xx status, ideally 415 (RFC 8484 Section 4.2.1)",
+		newRequest: func(ctx context.Context, URL string, rawQuery []byte) (*http.Request, error) {
+			return newPOSTRequest(ctx, URL, "text/plain", rawQuery)
+		},
+		pass: isClientErrorResponse,
+	},
+
+	{
+		requirement: "post-oversized-query",
+		description: "a POST query larger than the maximum DNS message size yields a 4xx status, ideally 413 (RFC 8484 Section 4.2.1)",
+		newRequest: func(ctx context.Context, URL string, rawQuery []byte) (*http.Request, error) {
+			return newPOSTRequest(ctx, URL, "application/dns-message", make([]byte, dns.MaxMsgSize+1))
+		},
+		pass: isClientErrorResponse,
+	},
+
+	{
+		requirement: "get-bad-base64",
+		description: "a GET query with an invalid base64url dns parameter yields a 4xx status, ideally 400 (RFC 8484 Section 4.1)",
+		newRequest: func(ctx context.Context, URL string, rawQuery []byte) (*http.Request, error) {
+			return newGETRequest(ctx, URL, "!!not-base64!!")
+		},
+		pass: isClientErrorResponse,
+	},
+
+	{
+		requirement: "head-request",
+		description: "a HEAD request does not cause a server error (RFC 9110 Section 9.3.2)",
+		newRequest: func(ctx context.Context, URL string, rawQuery []byte) (*http.Request, error) {
+			httpReq, err := newGETRequest(ctx, URL, base64.RawURLEncoding.EncodeToString(rawQuery))
+			if err != nil {
+				return nil, err
+			}
+			httpReq.Method = http.MethodHead
+			return httpReq, nil
+		},
+		pass: func(httpResp *http.Response) bool {
+			return httpResp.StatusCode < 500
+		},
+	},
+}
+
+// ConformanceRequirements returns the requirements checked by a [*ConformanceChecker]
+// as a list of [*ConformanceResult] with only the Requirement and Description fields set.
+func ConformanceRequirements() []*ConformanceResult {
+	var out []*ConformanceResult
+	for _, check := range conformanceChecks {
+		out = append(out, &ConformanceResult{Requirement: check.requirement, Description: check.description})
+	}
+	return out
+}
+
+// Run runs the battery of requirements against the server at the given URL and
+// returns a [*ConformanceResult] for each requirement, in the documented order.
+func (cc *ConformanceChecker) Run(ctx context.Context, URL string) []*ConformanceResult {
+	// 1. create the raw valid query
+	var out []*ConformanceResult
+	_, queryMsg, err := NewRequest(ctx, dnscodec.NewQuery(cc.QueryName, dns.TypeA), URL)
+	var rawQuery []byte
+	if err == nil {
+		rawQuery, err = queryMsg.Pack()
+	}
+
+	// 2. run each check in sequence
+	for _, check := range conformanceChecks {
+		result := &ConformanceResult{Requirement: check.requirement, Description: check.description}
+		out = append(out, result)
+		if err != nil {
+			result.Err = err
+			continue
+		}
+		result.Pass, result.StatusCode, result.Err = cc.run(ctx, URL, rawQuery, &check)
+	}
+	return out
+}
+
+// run runs a single check.
+func (cc *ConformanceChecker) run(ctx context.Context,
+	URL string, rawQuery []byte, check *conformanceCheck) (bool, int, error) {
+	httpReq, err := check.newRequest(ctx, URL, rawQuery)
+	if err != nil {
+		return false, 0, err
+	}
+	httpResp, err := cc.Client.Do(httpReq)
+	if err != nil {
+		return false, 0, err
+	}
+	defer httpResp.Body.Close()
+	return check.pass(httpResp), httpResp.StatusCode, nil
+}
+
+// newPOSTRequest creates a POST request using the given content type and body.
+func newPOSTRequest(ctx context.Context, URL, contentType string, body []byte) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", contentType)
+	httpReq.Header.Set("Accept", "application/dns-message")
+	return httpReq, nil
+}
+
+// isDNSMessageResponse returns whether the response is a 200 response containing a DNS message.
+func isDNSMessageResponse(httpResp *http.Response) bool {
+	mediaType, _, _ := mime.ParseMediaType(httpResp.Header.Get("Content-Type"))
+	if httpResp.StatusCode != 200 || mediaType != "application/dns-message" {
+		return false
+	}
+	rawResp, err := io.ReadAll(io.LimitReader(httpResp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return false
+	}
+	return (&dns.Msg{}).Unpack(rawResp) == nil
+}
+
+// isClientErrorResponse returns whether the response has a 4xx status code.
+func isClientErrorResponse(httpResp *http.Response) bool {
+	return httpResp.StatusCode >= 400 && httpResp.StatusCode < 500
+}
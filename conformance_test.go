@@ -0,0 +1,95 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// conformingHandler is a minimal RFC 8484 conforming handler.
+func conformingHandler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 1. obtain the raw query
+		var rawQuery []byte
+		switch r.Method {
+		case http.MethodPost:
+			if r.Header.Get("Content-Type") != "application/dns-message" {
+				w.WriteHeader(http.StatusUnsupportedMediaType)
+				return
+			}
+			body, err := io.ReadAll(io.LimitReader(r.Body, dns.MaxMsgSize+1))
+			require.NoError(t, err)
+			if len(body) > dns.MaxMsgSize {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				return
+			}
+			rawQuery = body
+		case http.MethodGet, http.MethodHead:
+			decoded, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			rawQuery = decoded
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+
+		// 2. reply to the query
+		query := &dns.Msg{}
+		if err := query.Unpack(rawQuery); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, err := w.Write(buildDNSResponse(t, query))
+		require.NoError(t, err)
+	})
+}
+
+func TestConformanceCheckerConformingServer(t *testing.T) {
+	srv := httptest.NewServer(conformingHandler(t))
+	defer srv.Close()
+
+	results := dnsoverhttps.NewConformanceChecker(srv.Client()).Run(context.Background(), srv.URL)
+	require.Len(t, results, len(dnsoverhttps.ConformanceRequirements()))
+	for _, result := range results {
+		assert.True(t, result.Pass, result.Requirement)
+		assert.NoError(t, result.Err, result.Requirement)
+		assert.NotZero(t, result.StatusCode, result.Requirement)
+	}
+}
+
+func TestConformanceCheckerBrokenServer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	results := dnsoverhttps.NewConformanceChecker(srv.Client()).Run(context.Background(), srv.URL)
+	for _, result := range results {
+		assert.False(t, result.Pass, result.Requirement)
+		assert.Equal(t, http.StatusInternalServerError, result.StatusCode, result.Requirement)
+	}
+}
+
+func TestConformanceRequirements(t *testing.T) {
+	requirements := dnsoverhttps.ConformanceRequirements()
+	require.NotEmpty(t, requirements)
+	for _, req := range requirements {
+		assert.NotEmpty(t, req.Requirement)
+		assert.NotEmpty(t, req.Description)
+		assert.False(t, req.Pass)
+	}
+}
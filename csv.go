@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// csvHeader is the header row written by [*CSVWriter].
+var csvHeader = []string{
+	"timestamp",
+	"endpoint",
+	"qname",
+	"qtype",
+	"rcode",
+	"addresses",
+	"latency",
+	"failure",
+	"anomalies",
+}
+
+// CSVWriter writes each [*ExchangeEvent] as a flat CSV row, which is
+// convenient for quick analysis using spreadsheets and notebooks.
+//
+// The first row is the header. The columns are:
+//
+//   - "timestamp": the start time using RFC 3339 with nanoseconds;
+//   - "endpoint": the server URL;
+//   - "qname": the name we were asked to resolve;
+//   - "qtype": the query type (e.g., "A");
+//   - "rcode": the response RCODE (e.g., "NOERROR") or empty without a response;
+//   - "addresses": the space-separated A and AAAA addresses in the answer;
+//   - "latency": the exchange duration in seconds;
+//   - "failure": the error string or empty on success;
+//   - "anomalies": the space-separated anomalies (e.g., "id_mismatch").
+//
+// Set [*CSVWriter.ObserveExchange] as the [Transport.ObserveExchange] hook.
+//
+// Construct using [NewCSVWriter].
+type CSVWriter struct {
+	// err is the first write error.
+	err error
+
+	// header is true after writing the header.
+	header bool
+
+	// mu protects err, header, and w.
+	mu sync.Mutex
+
+	// w is the CSV writer.
+	w *csv.Writer
+}
+
+// NewCSVWriter creates a new [*CSVWriter] writing to w.
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{w: csv.NewWriter(w)}
+}
+
+// ObserveExchange writes the event as a CSV row, preceded by the header
+// row when this is the first row.
+//
+// This method is safe to call from multiple goroutines.
+func (cw *CSVWriter) ObserveExchange(ev *ExchangeEvent) {
+	row := newCSVRow(ev)
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	if cw.err != nil {
+		return
+	}
+	if !cw.header {
+		cw.header = true
+		cw.err = cw.w.Write(csvHeader)
+	}
+	if cw.err == nil {
+		cw.err = cw.w.Write(row)
+	}
+	if cw.err == nil {
+		cw.w.Flush()
+		cw.err = cw.w.Error()
+	}
+}
+
+// Err returns the first error that occurred writing rows, if any.
+//
+// After a write error, the [*CSVWriter] stops writing rows.
+func (cw *CSVWriter) Err() error {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	return cw.err
+}
+
+// newCSVRow converts an [*ExchangeEvent] to a CSV row.
+func newCSVRow(ev *ExchangeEvent) []string {
+	var rcode, addrs string
+	respMsg := &dns.Msg{}
+	if ev.RawResponse != nil && respMsg.Unpack(ev.RawResponse) == nil {
+		rcode = dns.RcodeToString[respMsg.Rcode]
+		addrs = strings.Join(answerAddrStrings(respMsg.Answer), " ")
+	}
+	var failure string
+	if ev.Err != nil {
+		failure = ev.Err.Error()
+	}
+	return []string{
+		ev.StartTime.Format(time.RFC3339Nano),
+		ev.URL,
+		ev.QueryName,
+		dns.TypeToString[ev.QueryType],
+		rcode,
+		addrs,
+		strconv.FormatFloat(ev.Duration.Seconds(), 'f', -1, 64),
+		failure,
+		strings.Join(ev.Anomalies, " "),
+	}
+}
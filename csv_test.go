@@ -0,0 +1,75 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/bassosimone/iotest"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCSVWriter(t *testing.T) {
+	query := &dns.Msg{}
+	query.SetQuestion("dns.google.", dns.TypeA)
+	rawResp := buildDNSResponse(t, query)
+
+	buff := &bytes.Buffer{}
+	w := dnsoverhttps.NewCSVWriter(buff)
+
+	t0 := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+	w.ObserveExchange(&dnsoverhttps.ExchangeEvent{
+		URL:         "https://example.com/dns-query",
+		QueryName:   "dns.google",
+		QueryType:   dns.TypeA,
+		StartTime:   t0,
+		Duration:    1500 * time.Millisecond,
+		RawResponse: rawResp,
+		Anomalies:   []string{dnsoverhttps.AnomalyIDMismatch, dnsoverhttps.AnomalyTruncated},
+	})
+	w.ObserveExchange(&dnsoverhttps.ExchangeEvent{
+		URL:       "https://example.com/dns-query",
+		QueryName: "dns.google",
+		QueryType: dns.TypeAAAA,
+		StartTime: t0,
+		Err:       errors.New("mocked error, with a comma"),
+	})
+	require.NoError(t, w.Err())
+
+	rows, err := csv.NewReader(buff).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{
+		{"timestamp", "endpoint", "qname", "qtype", "rcode", "addresses", "latency", "failure", "anomalies"},
+		{
+			"2026-01-02T03:04:05.000000006Z", "https://example.com/dns-query", "dns.google", "A",
+			"NOERROR", "8.8.8.8", "1.5", "", "id_mismatch truncated",
+		},
+		{
+			"2026-01-02T03:04:05.000000006Z", "https://example.com/dns-query", "dns.google", "AAAA",
+			"", "", "0", "mocked error, with a comma", "",
+		},
+	}, rows)
+}
+
+func TestCSVWriterWriteError(t *testing.T) {
+	wantErr := errors.New("mocked error")
+	count := 0
+	w := dnsoverhttps.NewCSVWriter(&iotest.FuncWriter{WriteFunc: func(p []byte) (int, error) {
+		count++
+		return 0, wantErr
+	}})
+
+	ev := &dnsoverhttps.ExchangeEvent{QueryType: dns.TypeA}
+	w.ObserveExchange(ev)
+	w.ObserveExchange(ev)
+
+	require.ErrorIs(t, w.Err(), wantErr)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"slices"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// ResponseDiff describes how a second response differs from a first one.
+//
+// The zero value means that there is no difference. The struct marshals
+// to JSON, so that we can store and aggregate the differences.
+//
+// Construct using [DiffResponses].
+type ResponseDiff struct {
+	// AddedAddrs contains the A and AAAA addresses only in the second response.
+	AddedAddrs []string `json:"added_addrs,omitempty"`
+
+	// RemovedAddrs contains the A and AAAA addresses only in the first response.
+	RemovedAddrs []string `json:"removed_addrs,omitempty"`
+
+	// RcodeMismatch is true when the two responses have different RCODEs.
+	RcodeMismatch bool `json:"rcode_mismatch,omitempty"`
+
+	// FirstRcode is the first response RCODE (e.g., "NOERROR").
+	FirstRcode string `json:"first_rcode,omitempty"`
+
+	// SecondRcode is the second response RCODE (e.g., "NOERROR").
+	SecondRcode string `json:"second_rcode,omitempty"`
+
+	// TTLDelta is the minimum answer TTL of the second response minus the
+	// minimum answer TTL of the first response, in seconds.
+	TTLDelta int64 `json:"ttl_delta,omitempty"`
+
+	// CNAMEDivergence is true when the two responses contain different CNAME chains.
+	CNAMEDivergence bool `json:"cname_divergence,omitempty"`
+
+	// FirstCNAMEs contains the first response CNAME targets, in order.
+	FirstCNAMEs []string `json:"first_cnames,omitempty"`
+
+	// SecondCNAMEs contains the second response CNAME targets, in order.
+	SecondCNAMEs []string `json:"second_cnames,omitempty"`
+}
+
+// DiffResponses compares two successful responses to the same query.
+//
+// We compare the addresses as sets, since servers may shuffle them.
+func DiffResponses(first, second *dnscodec.Response) *ResponseDiff {
+	diff := &ResponseDiff{}
+	firstRRs, secondRRs := answerRRs(first), answerRRs(second)
+
+	// 1. compare the addresses
+	firstAddrs, secondAddrs := answerAddrStrings(firstRRs), answerAddrStrings(secondRRs)
+	for _, addr := range secondAddrs {
+		if !slices.Contains(firstAddrs, addr) {
+			diff.AddedAddrs = append(diff.AddedAddrs, addr)
+		}
+	}
+	for _, addr := range firstAddrs {
+		if !slices.Contains(secondAddrs, addr) {
+			diff.RemovedAddrs = append(diff.RemovedAddrs, addr)
+		}
+	}
+
+	// 2. compare the RCODEs
+	if first.Response != nil && second.Response != nil && first.Response.Rcode != second.Response.Rcode {
+		diff.RcodeMismatch = true
+		diff.FirstRcode = dns.RcodeToString[first.Response.Rcode]
+		diff.SecondRcode = dns.RcodeToString[second.Response.Rcode]
+	}
+
+	// 3. compare the TTLs
+	if len(firstRRs) > 0 && len(secondRRs) > 0 {
+		diff.TTLDelta = int64(minTTL(secondRRs)) - int64(minTTL(firstRRs))
+	}
+
+	// 4. compare the CNAME chains
+	firstCNAMEs, secondCNAMEs := answerCNAMEs(firstRRs), answerCNAMEs(secondRRs)
+	if !slices.Equal(firstCNAMEs, secondCNAMEs) {
+		diff.CNAMEDivergence = true
+		diff.FirstCNAMEs = firstCNAMEs
+		diff.SecondCNAMEs = secondCNAMEs
+	}
+	return diff
+}
+
+// Equal returns whether the two responses did not differ.
+func (d *ResponseDiff) Equal() bool {
+	return len(d.AddedAddrs) <= 0 && len(d.RemovedAddrs) <= 0 &&
+		!d.RcodeMismatch && d.TTLDelta == 0 && !d.CNAMEDivergence
+}
+
+// answerRRs returns the answer section, if available, or the valid RRs.
+func answerRRs(resp *dnscodec.Response) []dns.RR {
+	if resp.Response != nil {
+		return resp.Response.Answer
+	}
+	return resp.ValidRRs
+}
+
+// answerAddrStrings returns the sorted and deduplicated A and AAAA addresses.
+func answerAddrStrings(rrs []dns.RR) []string {
+	var out []string
+	for _, addr := range answerAddrs(rrs) {
+		out = append(out, addr.String())
+	}
+	slices.Sort(out)
+	return slices.Compact(out)
+}
+
+// answerCNAMEs returns the canonical CNAME targets in order.
+func answerCNAMEs(rrs []dns.RR) []string {
+	var out []string
+	for _, rr := range rrs {
+		if cname, ok := rr.(*dns.CNAME); ok {
+			out = append(out, dns.CanonicalName(cname.Target))
+		}
+	}
+	return out
+}
+
+// minTTL returns the minimum TTL of the given non-empty RRs.
+func minTTL(rrs []dns.RR) uint32 {
+	ttl := rrs[0].Header().Ttl
+	for _, rr := range rrs[1:] {
+		ttl = min(ttl, rr.Header().Ttl)
+	}
+	return ttl
+}
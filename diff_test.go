@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDiffResponse returns a response with the given RCODE and answer RRs.
+func newDiffResponse(rcode int, answer ...dns.RR) *dnscodec.Response {
+	msg := &dns.Msg{}
+	msg.Rcode = rcode
+	msg.Answer = answer
+	return &dnscodec.Response{Response: msg, ValidRRs: answer}
+}
+
+func TestDiffResponses(t *testing.T) {
+	hdr := func(rrtype uint16, ttl uint32) dns.RR_Header {
+		return dns.RR_Header{Name: "www.example.com.", Rrtype: rrtype, Class: dns.ClassINET, Ttl: ttl}
+	}
+	a := func(addr string, ttl uint32) dns.RR {
+		return &dns.A{Hdr: hdr(dns.TypeA, ttl), A: net.ParseIP(addr)}
+	}
+	aaaa := func(addr string, ttl uint32) dns.RR {
+		return &dns.AAAA{Hdr: hdr(dns.TypeAAAA, ttl), AAAA: net.ParseIP(addr)}
+	}
+	cname := func(target string, ttl uint32) dns.RR {
+		return &dns.CNAME{Hdr: hdr(dns.TypeCNAME, ttl), Target: target}
+	}
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// first is the first response.
+		first *dnscodec.Response
+
+		// second is the second response.
+		second *dnscodec.Response
+
+		// want is the expected diff.
+		want *dnsoverhttps.ResponseDiff
+
+		// wantJSON is the expected JSON serialization.
+		wantJSON string
+	}
+
+	testCases := []testCase{
+		{
+			name:     "identical responses",
+			first:    newDiffResponse(dns.RcodeSuccess, a("192.0.2.1", 60), a("192.0.2.2", 60)),
+			second:   newDiffResponse(dns.RcodeSuccess, a("192.0.2.2", 60), a("192.0.2.1", 60)),
+			want:     &dnsoverhttps.ResponseDiff{},
+			wantJSON: `{}`,
+		},
+
+		{
+			name:   "added and removed addresses",
+			first:  newDiffResponse(dns.RcodeSuccess, a("192.0.2.1", 60), aaaa("2001:db8::1", 60)),
+			second: newDiffResponse(dns.RcodeSuccess, a("192.0.2.1", 60), a("10.10.34.35", 60)),
+			want: &dnsoverhttps.ResponseDiff{
+				AddedAddrs:   []string{"10.10.34.35"},
+				RemovedAddrs: []string{"2001:db8::1"},
+			},
+			wantJSON: `{"added_addrs":["10.10.34.35"],"removed_addrs":["2001:db8::1"]}`,
+		},
+
+		{
+			name:   "rcode mismatch",
+			first:  newDiffResponse(dns.RcodeSuccess),
+			second: newDiffResponse(dns.RcodeNameError),
+			want: &dnsoverhttps.ResponseDiff{
+				RcodeMismatch: true,
+				FirstRcode:    "NOERROR",
+				SecondRcode:   "NXDOMAIN",
+			},
+			wantJSON: `{"rcode_mismatch":true,"first_rcode":"NOERROR","second_rcode":"NXDOMAIN"}`,
+		},
+
+		{
+			name:     "TTL delta",
+			first:    newDiffResponse(dns.RcodeSuccess, a("192.0.2.1", 300), a("192.0.2.2", 200)),
+			second:   newDiffResponse(dns.RcodeSuccess, a("192.0.2.1", 50), a("192.0.2.2", 3600)),
+			want:     &dnsoverhttps.ResponseDiff{TTLDelta: -150},
+			wantJSON: `{"ttl_delta":-150}`,
+		},
+
+		{
+			name:   "CNAME divergence",
+			first:  newDiffResponse(dns.RcodeSuccess, cname("cdn.example.net.", 60), a("192.0.2.1", 60)),
+			second: newDiffResponse(dns.RcodeSuccess, cname("CDN.example.org.", 60), a("192.0.2.1", 60)),
+			want: &dnsoverhttps.ResponseDiff{
+				CNAMEDivergence: true,
+				FirstCNAMEs:     []string{"cdn.example.net."},
+				SecondCNAMEs:    []string{"cdn.example.org."},
+			},
+			wantJSON: `{"cname_divergence":true,"first_cnames":["cdn.example.net."],"second_cnames":["cdn.example.org."]}`,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := dnsoverhttps.DiffResponses(tt.first, tt.second)
+			assert.Equal(t, tt.want, diff)
+			assert.Equal(t, tt.wantJSON == `{}`, diff.Equal())
+			data, err := json.Marshal(diff)
+			require.NoError(t, err)
+			assert.JSONEq(t, tt.wantJSON, string(data))
+		})
+	}
+}
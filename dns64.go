@@ -0,0 +1,231 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// ErrInvalidNAT64Prefix indicates that the NAT64 prefix length is not
+// one of the lengths allowed by RFC 6052 Section 2.2.
+var ErrInvalidNAT64Prefix = errors.New("invalid NAT64 prefix")
+
+// WellKnownNAT64Prefix is the RFC 6052 well-known prefix.
+var WellKnownNAT64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+
+// EmbedIPv4 returns the IPv4-embedded IPv6 address of the given IPv4 address
+// using the given NAT64 prefix, according to RFC 6052 Section 2.2.
+func EmbedIPv4(prefix netip.Prefix, addr netip.Addr) (netip.Addr, error) {
+	// 1. make sure the inputs are valid
+	if !prefix.Addr().Is6() || !isNAT64PrefixLen(prefix.Bits()) {
+		return netip.Addr{}, fmt.Errorf("%w: %s", ErrInvalidNAT64Prefix, prefix)
+	}
+	if !addr.Is4() {
+		return netip.Addr{}, fmt.Errorf("not an IPv4 address: %s", addr)
+	}
+
+	// 2. copy the IPv4 address after the prefix, skipping the u octet
+	out := prefix.Masked().Addr().As16()
+	pos := prefix.Bits() / 8
+	for _, octet := range addr.As4() {
+		if pos == 8 {
+			pos++
+		}
+		out[pos] = octet
+		pos++
+	}
+	return netip.AddrFrom16(out), nil
+}
+
+// isNAT64PrefixLen returns whether the length is allowed by RFC 6052.
+func isNAT64PrefixLen(bits int) bool {
+	switch bits {
+	case 32, 40, 48, 56, 64, 96:
+		return true
+	default:
+		return false
+	}
+}
+
+// DNS64Synthesizer is an [Exchanger] performing local DNS64 synthesis (RFC 6147)
+// of AAAA answers from A answers, which allows IPv6-only probes behind a NAT64
+// to resolve IPv4-only names when the resolver does not perform DNS64.
+//
+// When an AAAA query returns no AAAA records, we issue an A query and, on success,
+// return a response where we replace each A record with an AAAA record
+// embedding its address into the Prefix. We never set the AD bit on the
+// synthesized responses, since they would not validate. We do not
+// alter any other query or response.
+//
+// Construct using [NewDNS64Synthesizer].
+type DNS64Synthesizer struct {
+	// Exchanger is the [Exchanger] to use.
+	//
+	// Set by [NewDNS64Synthesizer] to the user-provided value.
+	Exchanger Exchanger
+
+	// Prefix is the NAT64 prefix to use, whose length must be 32, 40, 48,
+	// 56, 64, or 96 bits (e.g., a prefix discovered via RFC 7050).
+	//
+	// Set by [NewDNS64Synthesizer] to [WellKnownNAT64Prefix].
+	Prefix netip.Prefix
+}
+
+var _ Exchanger = &DNS64Synthesizer{}
+
+// NewDNS64Synthesizer creates a new [*DNS64Synthesizer].
+func NewDNS64Synthesizer(exchanger Exchanger) *DNS64Synthesizer {
+	return &DNS64Synthesizer{Exchanger: exchanger, Prefix: WellKnownNAT64Prefix}
+}
+
+// Exchange implements [Exchanger].
+func (ds *DNS64Synthesizer) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	// 1. pass through everything but AAAA queries without AAAA records, which
+	// includes both NODATA answers and answers only containing CNAME records
+	resp, err := ds.Exchanger.Exchange(ctx, query)
+	if query.Type != dns.TypeAAAA {
+		return resp, err
+	}
+	if err == nil {
+		if _, err = resp.RecordsAAAA(); err == nil {
+			return resp, nil
+		}
+	}
+	if !errors.Is(err, dnscodec.ErrNoData) {
+		return resp, err
+	}
+
+	// 2. issue the A query, returning the original result on failure
+	aQuery := query.Clone()
+	aQuery.Type = dns.TypeA
+	aResp, aErr := ds.Exchanger.Exchange(ctx, aQuery)
+	if aErr != nil && resp != nil {
+		return resp, nil
+	}
+	if aErr != nil {
+		return nil, err
+	}
+
+	// 3. synthesize the AAAA response
+	return ds.synthesize(aResp)
+}
+
+// synthesize converts a response to an A query into a response to an AAAA query.
+func (ds *DNS64Synthesizer) synthesize(aResp *dnscodec.Response) (*dnscodec.Response, error) {
+	// 1. copy the messages and rewrite the question
+	queryMsg := aResp.Query.Copy()
+	queryMsg.Question[0].Qtype = dns.TypeAAAA
+	respMsg := aResp.Response.Copy()
+	respMsg.Question[0].Qtype = dns.TypeAAAA
+	respMsg.AuthenticatedData = false
+
+	// 2. replace the A records both in the message and in the valid RRs
+	var err error
+	if respMsg.Answer, err = ds.synthesizeRRs(respMsg.Answer); err != nil {
+		return nil, err
+	}
+	validRRs, err := ds.synthesizeRRs(aResp.ValidRRs)
+	if err != nil {
+		return nil, err
+	}
+	return &dnscodec.Response{Query: queryMsg, Response: respMsg, ValidRRs: validRRs}, nil
+}
+
+// synthesizeRRs returns a copy of the records where AAAA records replace A
+// records, omitting the RRSIG records covering the A records.
+func (ds *DNS64Synthesizer) synthesizeRRs(rrs []dns.RR) ([]dns.RR, error) {
+	out := make([]dns.RR, 0, len(rrs))
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RRSIG); ok && sig.TypeCovered == dns.TypeA {
+			continue
+		}
+		a, ok := rr.(*dns.A)
+		if !ok {
+			out = append(out, rr)
+			continue
+		}
+		v4, ok := netip.AddrFromSlice(a.A.To4())
+		if !ok {
+			continue
+		}
+		v6, err := EmbedIPv4(ds.Prefix, v4)
+		if err != nil {
+			return nil, err
+		}
+		hdr := a.Hdr
+		hdr.Rrtype = dns.TypeAAAA
+		out = append(out, &dns.AAAA{Hdr: hdr, AAAA: v6.AsSlice()})
+	}
+	return out, nil
+}
+
+// ipv4OnlyArpaAddrs contains the well-known IPv4 addresses of the
+// "ipv4only.arpa" name (RFC 7050 Section 2.2).
+var ipv4OnlyArpaAddrs = []netip.Addr{
+	netip.MustParseAddr("192.0.0.170"),
+	netip.MustParseAddr("192.0.0.171"),
+}
+
+// NAT64Discovery is the result of [DiscoverNAT64Prefix].
+type NAT64Discovery struct {
+	// ResolverDNS64 indicates whether the resolver performs DNS64, which
+	// we infer from it returning AAAA records for "ipv4only.arpa".
+	ResolverDNS64 bool
+
+	// Prefixes contains the discovered NAT64 prefixes, which is empty when the
+	// resolver does not perform DNS64 or we cannot find the well-known IPv4
+	// addresses in the AAAA records. Use the first prefix to configure a
+	// [*DNS64Synthesizer] unless you know better.
+	Prefixes []netip.Prefix
+}
+
+// DiscoverNAT64Prefix discovers the NAT64 prefixes (RFC 7050) by querying the
+// AAAA records of "ipv4only.arpa" using the given [Exchanger] and by searching
+// the well-known IPv4 addresses in the returned addresses.
+//
+// A NODATA answer is not an error and means the resolver does not perform DNS64.
+func DiscoverNAT64Prefix(ctx context.Context, exchanger Exchanger) (*NAT64Discovery, error) {
+	// 1. query the AAAA records
+	aaaas, err := Lookup[*dns.AAAA](ctx, exchanger, "ipv4only.arpa")
+	if errors.Is(err, dnscodec.ErrNoData) {
+		return &NAT64Discovery{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. extract the unique prefixes
+	result := &NAT64Discovery{ResolverDNS64: true}
+	for _, aaaa := range aaaas {
+		addr, ok := netip.AddrFromSlice(aaaa.AAAA)
+		if !ok {
+			continue
+		}
+		prefix, found := nat64PrefixOf(addr)
+		if found && !slices.Contains(result.Prefixes, prefix) {
+			result.Prefixes = append(result.Prefixes, prefix)
+		}
+	}
+	return result, nil
+}
+
+// nat64PrefixOf returns the NAT64 prefix of an address embedding one of the
+// well-known IPv4 addresses, trying the prefix lengths from the longest one.
+func nat64PrefixOf(addr netip.Addr) (netip.Prefix, bool) {
+	for _, bits := range []int{96, 64, 56, 48, 40, 32} {
+		prefix := netip.PrefixFrom(addr, bits).Masked()
+		for _, v4 := range ipv4OnlyArpaAddrs {
+			if embedded, err := EmbedIPv4(prefix, v4); err == nil && embedded == addr {
+				return prefix, true
+			}
+		}
+	}
+	return netip.Prefix{}, false
+}
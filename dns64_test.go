@@ -0,0 +1,247 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbedIPv4(t *testing.T) {
+	// See RFC 6052 Section 2.4
+	addr := netip.MustParseAddr("192.0.2.33")
+
+	type testCase struct {
+		// prefix is the NAT64 prefix.
+		prefix string
+
+		// want is the expected address.
+		want string
+	}
+
+	testCases := []testCase{
+		{prefix: "2001:db8::/32", want: "2001:db8:c000:221::"},
+		{prefix: "2001:db8:100::/40", want: "2001:db8:1c0:2:21::"},
+		{prefix: "2001:db8:122::/48", want: "2001:db8:122:c000:2:2100::"},
+		{prefix: "2001:db8:122:300::/56", want: "2001:db8:122:3c0:0:221::"},
+		{prefix: "2001:db8:122:344::/64", want: "2001:db8:122:344:c0:2:2100:0"},
+		{prefix: "2001:db8:122:344::/96", want: "2001:db8:122:344::c000:221"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.prefix, func(t *testing.T) {
+			got, err := dnsoverhttps.EmbedIPv4(netip.MustParsePrefix(tt.prefix), addr)
+			require.NoError(t, err)
+			assert.Equal(t, netip.MustParseAddr(tt.want), got)
+		})
+	}
+
+	_, err := dnsoverhttps.EmbedIPv4(netip.MustParsePrefix("2001:db8::/80"), addr)
+	require.ErrorIs(t, err, dnsoverhttps.ErrInvalidNAT64Prefix)
+	_, err = dnsoverhttps.EmbedIPv4(netip.MustParsePrefix("10.0.0.0/32"), addr)
+	require.ErrorIs(t, err, dnsoverhttps.ErrInvalidNAT64Prefix)
+	_, err = dnsoverhttps.EmbedIPv4(dnsoverhttps.WellKnownNAT64Prefix, netip.MustParseAddr("2001:db8::1"))
+	require.Error(t, err)
+}
+
+// dns64ZoneFile is the zone file used by the [*dnsoverhttps.DNS64Synthesizer] tests.
+const dns64ZoneFile = `
+$TTL 300
+@       IN SOA ns.example.com. admin.example.com. 1 7200 3600 1209600 300
+v4only  IN A    192.0.2.1
+v4only  IN A    192.0.2.2
+dual    IN A    192.0.2.3
+dual    IN AAAA 2001:db8::3
+alias   IN CNAME v4only
+`
+
+func TestDNS64Synthesizer(t *testing.T) {
+	zone, err := dnsoverhttps.ParseStaticZone(strings.NewReader(dns64ZoneFile), "example.com")
+	require.NoError(t, err)
+	srv := httptest.NewServer(dnsoverhttps.NewScriptedHandler(zone.Reply))
+	defer srv.Close()
+	ds := dnsoverhttps.NewDNS64Synthesizer(dnsoverhttps.NewTransport(srv.Client(), srv.URL))
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// qname is the query name.
+		qname string
+
+		// qtype is the query type.
+		qtype uint16
+
+		// wantAddrs contains the expected addresses.
+		wantAddrs []string
+
+		// wantErr is the expected error or nil.
+		wantErr error
+	}
+
+	testCases := []testCase{
+		{
+			name:      "synthesized",
+			qname:     "v4only.example.com",
+			qtype:     dns.TypeAAAA,
+			wantAddrs: []string{"64:ff9b::c000:201", "64:ff9b::c000:202"},
+		},
+
+		{
+			name:      "synthesized after CNAME",
+			qname:     "alias.example.com",
+			qtype:     dns.TypeAAAA,
+			wantAddrs: []string{"64:ff9b::c000:201", "64:ff9b::c000:202"},
+		},
+
+		{
+			name:      "native AAAA",
+			qname:     "dual.example.com",
+			qtype:     dns.TypeAAAA,
+			wantAddrs: []string{"2001:db8::3"},
+		},
+
+		{
+			name:      "A query",
+			qname:     "v4only.example.com",
+			qtype:     dns.TypeA,
+			wantAddrs: []string{"192.0.2.1", "192.0.2.2"},
+		},
+
+		{
+			name:    "NXDOMAIN",
+			qname:   "nonexistent.example.com",
+			qtype:   dns.TypeAAAA,
+			wantErr: dnscodec.ErrNoName,
+		},
+
+		{
+			name:    "NODATA for both types",
+			qname:   "example.com",
+			qtype:   dns.TypeAAAA,
+			wantErr: dnscodec.ErrNoData,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := ds.Exchange(context.Background(), dnscodec.NewQuery(tt.qname, tt.qtype))
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			var addrs []string
+			for _, rr := range resp.ValidRRs {
+				switch rr := rr.(type) {
+				case *dns.A:
+					addrs = append(addrs, rr.A.String())
+				case *dns.AAAA:
+					addrs = append(addrs, rr.AAAA.String())
+				}
+			}
+			assert.Equal(t, tt.wantAddrs, addrs)
+			assert.Equal(t, tt.qtype, resp.Query.Question[0].Qtype)
+			assert.Equal(t, tt.qtype, resp.Response.Question[0].Qtype)
+		})
+	}
+}
+
+func TestDNS64SynthesizerInvalidPrefix(t *testing.T) {
+	zone, err := dnsoverhttps.ParseStaticZone(strings.NewReader(dns64ZoneFile), "example.com")
+	require.NoError(t, err)
+	srv := httptest.NewServer(dnsoverhttps.NewScriptedHandler(zone.Reply))
+	defer srv.Close()
+
+	ds := dnsoverhttps.NewDNS64Synthesizer(dnsoverhttps.NewTransport(srv.Client(), srv.URL))
+	ds.Prefix = netip.MustParsePrefix("2001:db8::/80")
+	_, err = ds.Exchange(context.Background(), dnscodec.NewQuery("v4only.example.com", dns.TypeAAAA))
+	require.ErrorIs(t, err, dnsoverhttps.ErrInvalidNAT64Prefix)
+}
+
+func TestDiscoverNAT64Prefix(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// records contains the records of the "ipv4only.arpa" zone.
+		records []string
+
+		// wantDNS64 is the expected ResolverDNS64 value.
+		wantDNS64 bool
+
+		// wantPrefixes contains the expected prefixes.
+		wantPrefixes []netip.Prefix
+	}
+
+	testCases := []testCase{
+		{
+			name: "well-known prefix",
+			records: []string{
+				"ipv4only.arpa. 300 IN AAAA 64:ff9b::192.0.0.170",
+				"ipv4only.arpa. 300 IN AAAA 64:ff9b::192.0.0.171",
+			},
+			wantDNS64:    true,
+			wantPrefixes: []netip.Prefix{dnsoverhttps.WellKnownNAT64Prefix},
+		},
+
+		{
+			name: "network-specific prefixes",
+			records: []string{
+				"ipv4only.arpa. 300 IN AAAA 2001:db8:122:344:c0:0:aa00:0",
+				"ipv4only.arpa. 300 IN AAAA 2001:db8:c000:aa::",
+			},
+			wantDNS64: true,
+			wantPrefixes: []netip.Prefix{
+				netip.MustParsePrefix("2001:db8:122:344::/64"),
+				netip.MustParsePrefix("2001:db8::/32"),
+			},
+		},
+
+		{
+			name:      "unrelated address",
+			records:   []string{"ipv4only.arpa. 300 IN AAAA 2001:db8::1"},
+			wantDNS64: true,
+		},
+
+		{
+			name:    "no DNS64",
+			records: []string{"ipv4only.arpa. 300 IN A 192.0.0.170"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var rrs []dns.RR
+			for _, record := range tt.records {
+				rrs = append(rrs, mustNewRR(t, record))
+			}
+			srv := httptest.NewServer(dnsoverhttps.NewScriptedHandler(dnsoverhttps.NewStaticZone(rrs...).Reply))
+			defer srv.Close()
+
+			dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+			result, err := dnsoverhttps.DiscoverNAT64Prefix(context.Background(), dt)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantDNS64, result.ResolverDNS64)
+			assert.Equal(t, tt.wantPrefixes, result.Prefixes)
+		})
+	}
+}
+
+func TestDiscoverNAT64PrefixError(t *testing.T) {
+	srv := httptest.NewServer(dnsoverhttps.NewScriptedHandler(dnsoverhttps.NewStaticZone().Reply))
+	defer srv.Close()
+
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	_, err := dnsoverhttps.DiscoverNAT64Prefix(context.Background(), dt)
+	require.ErrorIs(t, err, dnscodec.ErrNoName)
+}
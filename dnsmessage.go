@@ -0,0 +1,39 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+
+	"github.com/bassosimone/dnscodec"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// ExchangeDNSMessage is like [*Transport.ExchangeMsg] but takes and returns a
+// [*dnsmessage.Message], for code using [dnsmessage] rather than [dns].
+//
+// Use [*Transport.ExchangeRaw] with [dnsmessage.Builder] and [dnsmessage.Parser]
+// to avoid allocating messages.
+func (dt *Transport) ExchangeDNSMessage(ctx context.Context, query *dnsmessage.Message) (*dnsmessage.Message, error) {
+	// 1. Serialize the query
+	rawQuery, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Perform the exchange
+	rawResp, err := dt.ExchangeRaw(ctx, rawQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Parse and validate the response like ExchangeMsg does
+	resp := &dnsmessage.Message{}
+	if err := resp.Unpack(rawResp); err != nil {
+		return nil, dnscodec.ErrServerMisbehaving
+	}
+	if !resp.Response || resp.ID != query.ID || resp.OpCode != query.OpCode {
+		return nil, dnscodec.ErrInvalidResponse
+	}
+	return resp, nil
+}
@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newDNSMessageQuery returns a dnsmessage query for dns.google A.
+func newDNSMessageQuery() *dnsmessage.Message {
+	return &dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 0x1234, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  dnsmessage.MustNewName("dns.google."),
+			Type:  dnsmessage.TypeA,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+}
+
+func TestExchangeDNSMessage(t *testing.T) {
+	srv := httptest.NewServer(dnsoverhttps.NewScriptedHandler(func(query *dns.Msg) *dns.Msg {
+		resp := &dns.Msg{}
+		require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+		return resp
+	}))
+	defer srv.Close()
+
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	resp, err := dt.ExchangeDNSMessage(context.Background(), newDNSMessageQuery())
+	require.NoError(t, err)
+	assert.Equal(t, uint16(0x1234), resp.ID)
+	require.NotEmpty(t, resp.Answers)
+	assert.Equal(t, dnsmessage.TypeA, resp.Answers[0].Header.Type)
+}
+
+func TestExchangeDNSMessageWrongID(t *testing.T) {
+	handler := dnsoverhttps.NewScriptedHandler(nil)
+	handler.Script("dns.google", dnsoverhttps.ScriptStep{WrongID: true})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	_, err := dt.ExchangeDNSMessage(context.Background(), newDNSMessageQuery())
+	require.ErrorIs(t, err, dnscodec.ErrInvalidResponse)
+}
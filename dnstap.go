@@ -0,0 +1,609 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// DnstapMessageType is the type of a dnstap Message.
+//
+// See https://github.com/dnstap/dnstap.pb/blob/master/dnstap.proto.
+type DnstapMessageType uint32
+
+const (
+	// DnstapClientQuery is the CLIENT_QUERY message type.
+	DnstapClientQuery = DnstapMessageType(5)
+
+	// DnstapClientResponse is the CLIENT_RESPONSE message type.
+	DnstapClientResponse = DnstapMessageType(6)
+
+	// DnstapToolQuery is the TOOL_QUERY message type.
+	DnstapToolQuery = DnstapMessageType(11)
+
+	// DnstapToolResponse is the TOOL_RESPONSE message type.
+	DnstapToolResponse = DnstapMessageType(12)
+)
+
+// dnstapContentType is the Frame Streams content type for dnstap.
+const dnstapContentType = "protobuf:dnstap.Dnstap"
+
+// Frame Streams control frame types.
+const (
+	fstrmControlAccept = 1
+	fstrmControlStart  = 2
+	fstrmControlStop   = 3
+	fstrmControlReady  = 4
+	fstrmControlFinish = 5
+)
+
+// fstrmFieldContentType is the Frame Streams content type field.
+const fstrmFieldContentType = 1
+
+// ErrInvalidDnstap indicates malformed Frame Streams or dnstap data.
+var ErrInvalidDnstap = errors.New("invalid dnstap data")
+
+// DnstapWriter writes exchanges as dnstap frames using Frame Streams.
+//
+// For each [*ExchangeEvent] with a raw query, the writer emits a query
+// frame and, when the raw response is available, a response frame that
+// also carries the raw query. Frames use the DOH socket protocol.
+//
+// Set [*DnstapWriter.ObserveExchange] as the [Transport.ObserveExchange] hook
+// and call [*DnstapWriter.Close] when done to terminate the stream.
+//
+// Construct using [NewDnstapWriter] or [NewDnstapSocketWriter].
+type DnstapWriter struct {
+	// Identity is the OPTIONAL dnstap identity of the writer.
+	Identity []byte
+
+	// Version is the OPTIONAL dnstap version of the writer.
+	Version []byte
+
+	// QueryType is the type of query messages.
+	//
+	// Set by the constructors to [DnstapClientQuery].
+	QueryType DnstapMessageType
+
+	// ResponseType is the type of response messages.
+	//
+	// Set by the constructors to [DnstapClientResponse].
+	ResponseType DnstapMessageType
+
+	// rw is the underlying stream.
+	rw io.ReadWriter
+
+	// bidirectional indicates whether to perform the READY/ACCEPT handshake.
+	bidirectional bool
+
+	// started indicates whether we have started the stream.
+	started bool
+
+	// err is the first write error.
+	err error
+
+	// mu protects rw, started, and err.
+	mu sync.Mutex
+}
+
+// NewDnstapWriter creates a new [*DnstapWriter] writing a unidirectional
+// Frame Stream to w, which is suitable for writing to files.
+//
+// The START control frame is written along with the first frame.
+func NewDnstapWriter(w io.Writer) *DnstapWriter {
+	return &DnstapWriter{
+		QueryType:    DnstapClientQuery,
+		ResponseType: DnstapClientResponse,
+		rw:           &dnstapWriteOnly{w},
+	}
+}
+
+// NewDnstapSocketWriter creates a new [*DnstapWriter] writing a bidirectional
+// Frame Stream to conn, which is what dnstap collectors listening on unix
+// sockets expect. The handshake happens along with the first frame.
+func NewDnstapSocketWriter(conn io.ReadWriter) *DnstapWriter {
+	return &DnstapWriter{
+		QueryType:     DnstapClientQuery,
+		ResponseType:  DnstapClientResponse,
+		rw:            conn,
+		bidirectional: true,
+	}
+}
+
+// dnstapWriteOnly adapts an [io.Writer] to an [io.ReadWriter] that fails reads.
+type dnstapWriteOnly struct {
+	io.Writer
+}
+
+// Read implements [io.Reader].
+func (*dnstapWriteOnly) Read([]byte) (int, error) {
+	return 0, ErrInvalidDnstap
+}
+
+// ObserveExchange writes dnstap frames for the event.
+//
+// Errors are available through [*DnstapWriter.Err].
+//
+// This method is safe to call from multiple goroutines.
+func (dw *DnstapWriter) ObserveExchange(ev *ExchangeEvent) {
+	if ev.RawQuery == nil {
+		return
+	}
+	msg := &DnstapMessage{
+		Type:         dw.QueryType,
+		QueryTime:    ev.StartTime,
+		QueryMessage: ev.RawQuery,
+	}
+	dw.WriteMessage(msg)
+	if ev.RawResponse != nil {
+		msg.Type = dw.ResponseType
+		msg.ResponseTime = ev.StartTime.Add(ev.Duration)
+		msg.ResponseMessage = ev.RawResponse
+		dw.WriteMessage(msg)
+	}
+}
+
+// WriteMessage writes msg as a dnstap frame.
+//
+// After a write error, the [*DnstapWriter] stops writing frames and
+// returns the first error.
+//
+// This method is safe to call from multiple goroutines.
+func (dw *DnstapWriter) WriteMessage(msg *DnstapMessage) error {
+	frame := dnstapAppendFrame(nil, dw.Identity, dw.Version, msg)
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	if dw.err != nil {
+		return dw.err
+	}
+	if !dw.started {
+		if dw.err = dw.start(); dw.err != nil {
+			return dw.err
+		}
+		dw.started = true
+	}
+	dw.err = fstrmWriteDataFrame(dw.rw, frame)
+	return dw.err
+}
+
+// start starts the Frame Stream.
+func (dw *DnstapWriter) start() error {
+	if dw.bidirectional {
+		if err := fstrmWriteControlFrame(dw.rw, fstrmControlReady); err != nil {
+			return err
+		}
+		ctrl, err := fstrmReadControlFrame(dw.rw)
+		if err != nil {
+			return err
+		}
+		if ctrl != fstrmControlAccept {
+			return ErrInvalidDnstap
+		}
+	}
+	return fstrmWriteControlFrame(dw.rw, fstrmControlStart)
+}
+
+// Close terminates the Frame Stream, if started, and returns the first error.
+//
+// Close does not close the underlying writer or connection.
+func (dw *DnstapWriter) Close() error {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	if dw.err != nil || !dw.started {
+		return dw.err
+	}
+	dw.started = false
+	if dw.err = fstrmWriteControlFrame(dw.rw, fstrmControlStop); dw.err != nil {
+		return dw.err
+	}
+	if dw.bidirectional {
+		ctrl, err := fstrmReadControlFrame(dw.rw)
+		if err == nil && ctrl != fstrmControlFinish {
+			err = ErrInvalidDnstap
+		}
+		dw.err = err
+	}
+	return dw.err
+}
+
+// Err returns the first error that occurred writing frames, if any.
+func (dw *DnstapWriter) Err() error {
+	dw.mu.Lock()
+	defer dw.mu.Unlock()
+	return dw.err
+}
+
+// DnstapMessage is the subset of the dnstap Message we read and write.
+type DnstapMessage struct {
+	// Type is the message type.
+	Type DnstapMessageType
+
+	// QueryTime is when the query was sent or the zero value.
+	QueryTime time.Time
+
+	// QueryMessage is the raw query or nil.
+	QueryMessage []byte
+
+	// ResponseTime is when the response was received or the zero value.
+	ResponseTime time.Time
+
+	// ResponseMessage is the raw response or nil.
+	ResponseMessage []byte
+}
+
+// Protocol Buffers field numbers from dnstap.proto.
+const (
+	dnstapFieldIdentity = 1
+	dnstapFieldVersion  = 2
+	dnstapFieldMessage  = 14
+	dnstapFieldType     = 15
+
+	dnstapMessageFieldType             = 1
+	dnstapMessageFieldSocketProtocol   = 3
+	dnstapMessageFieldQueryTimeSec     = 8
+	dnstapMessageFieldQueryTimeNsec    = 9
+	dnstapMessageFieldQueryMessage     = 10
+	dnstapMessageFieldResponseTimeSec  = 12
+	dnstapMessageFieldResponseTimeNsec = 13
+	dnstapMessageFieldResponseMessage  = 14
+)
+
+// Protocol Buffers enumeration values from dnstap.proto.
+const (
+	dnstapTypeMessage       = 1
+	dnstapSocketProtocolDOH = 4
+)
+
+// Protocol Buffers wire types.
+const (
+	protoWireVarint  = 0
+	protoWireFixed64 = 1
+	protoWireBytes   = 2
+	protoWireFixed32 = 5
+)
+
+// dnstapAppendFrame appends the serialized Dnstap message to buff.
+func dnstapAppendFrame(buff, identity, version []byte, msg *DnstapMessage) []byte {
+	var inner []byte
+	inner = protoAppendVarintField(inner, dnstapMessageFieldType, uint64(msg.Type))
+	inner = protoAppendVarintField(inner, dnstapMessageFieldSocketProtocol, dnstapSocketProtocolDOH)
+	if !msg.QueryTime.IsZero() {
+		inner = protoAppendVarintField(inner, dnstapMessageFieldQueryTimeSec, uint64(msg.QueryTime.Unix()))
+		inner = protoAppendFixed32Field(inner, dnstapMessageFieldQueryTimeNsec, uint32(msg.QueryTime.Nanosecond()))
+	}
+	if msg.QueryMessage != nil {
+		inner = protoAppendBytesField(inner, dnstapMessageFieldQueryMessage, msg.QueryMessage)
+	}
+	if !msg.ResponseTime.IsZero() {
+		inner = protoAppendVarintField(inner, dnstapMessageFieldResponseTimeSec, uint64(msg.ResponseTime.Unix()))
+		inner = protoAppendFixed32Field(inner, dnstapMessageFieldResponseTimeNsec, uint32(msg.ResponseTime.Nanosecond()))
+	}
+	if msg.ResponseMessage != nil {
+		inner = protoAppendBytesField(inner, dnstapMessageFieldResponseMessage, msg.ResponseMessage)
+	}
+
+	if identity != nil {
+		buff = protoAppendBytesField(buff, dnstapFieldIdentity, identity)
+	}
+	if version != nil {
+		buff = protoAppendBytesField(buff, dnstapFieldVersion, version)
+	}
+	buff = protoAppendBytesField(buff, dnstapFieldMessage, inner)
+	return protoAppendVarintField(buff, dnstapFieldType, dnstapTypeMessage)
+}
+
+// protoAppendVarintField appends a varint field.
+func protoAppendVarintField(buff []byte, field int, value uint64) []byte {
+	buff = binary.AppendUvarint(buff, uint64(field)<<3|protoWireVarint)
+	return binary.AppendUvarint(buff, value)
+}
+
+// protoAppendFixed32Field appends a fixed32 field.
+func protoAppendFixed32Field(buff []byte, field int, value uint32) []byte {
+	buff = binary.AppendUvarint(buff, uint64(field)<<3|protoWireFixed32)
+	return binary.LittleEndian.AppendUint32(buff, value)
+}
+
+// protoAppendBytesField appends a length-delimited field.
+func protoAppendBytesField(buff []byte, field int, value []byte) []byte {
+	buff = binary.AppendUvarint(buff, uint64(field)<<3|protoWireBytes)
+	buff = binary.AppendUvarint(buff, uint64(len(value)))
+	return append(buff, value...)
+}
+
+// fstrmWriteDataFrame writes a Frame Streams data frame.
+func fstrmWriteDataFrame(w io.Writer, frame []byte) error {
+	buff := binary.BigEndian.AppendUint32(nil, uint32(len(frame)))
+	_, err := w.Write(append(buff, frame...))
+	return err
+}
+
+// fstrmWriteControlFrame writes a Frame Streams control frame.
+//
+// All control frames but STOP and FINISH carry the dnstap content type.
+func fstrmWriteControlFrame(w io.Writer, ctrl uint32) error {
+	payload := binary.BigEndian.AppendUint32(nil, ctrl)
+	if ctrl != fstrmControlStop && ctrl != fstrmControlFinish {
+		payload = binary.BigEndian.AppendUint32(payload, fstrmFieldContentType)
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(dnstapContentType)))
+		payload = append(payload, dnstapContentType...)
+	}
+	buff := binary.BigEndian.AppendUint32(nil, 0) // escape
+	buff = binary.BigEndian.AppendUint32(buff, uint32(len(payload)))
+	_, err := w.Write(append(buff, payload...))
+	return err
+}
+
+// fstrmReadControlFrame reads a Frame Streams control frame and returns its type.
+func fstrmReadControlFrame(r io.Reader) (uint32, error) {
+	var header [8]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, err
+	}
+	if binary.BigEndian.Uint32(header[:4]) != 0 {
+		return 0, ErrInvalidDnstap
+	}
+	return fstrmReadControlPayload(r, binary.BigEndian.Uint32(header[4:]))
+}
+
+// fstrmMaxControlFrameSize is the maximum control frame size we accept.
+const fstrmMaxControlFrameSize = 512
+
+// fstrmReadControlPayload reads the payload of a control frame and returns its type.
+func fstrmReadControlPayload(r io.Reader, size uint32) (uint32, error) {
+	if size < 4 || size > fstrmMaxControlFrameSize {
+		return 0, ErrInvalidDnstap
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, err
+	}
+	return binary.BigEndian.Uint32(payload[:4]), nil
+}
+
+// DnstapReader reads dnstap messages from a unidirectional Frame Stream.
+//
+// Construct using [NewDnstapReader].
+type DnstapReader struct {
+	// r is the buffered underlying reader.
+	r *bufio.Reader
+
+	// started indicates whether we have read the START control frame.
+	started bool
+}
+
+// NewDnstapReader creates a new [*DnstapReader] reading from r.
+func NewDnstapReader(r io.Reader) *DnstapReader {
+	return &DnstapReader{r: bufio.NewReader(r)}
+}
+
+// fstrmMaxDataFrameSize is the maximum data frame size we accept.
+const fstrmMaxDataFrameSize = 1 << 20
+
+// Next returns the next dnstap message or [io.EOF] at the end of the stream.
+//
+// Frames whose Dnstap type is not MESSAGE are skipped. Malformed streams
+// cause [ErrInvalidDnstap].
+func (dr *DnstapReader) Next() (*DnstapMessage, error) {
+	for {
+		// 1. read the frame length or the control frame escape
+		var header [4]byte
+		if _, err := io.ReadFull(dr.r, header[:]); err != nil {
+			return nil, dnstapMapError(err, io.EOF)
+		}
+		length := binary.BigEndian.Uint32(header[:])
+
+		// 2. handle control frames
+		if length == 0 {
+			if _, err := io.ReadFull(dr.r, header[:]); err != nil {
+				return nil, dnstapMapError(err, ErrInvalidDnstap)
+			}
+			ctrl, err := fstrmReadControlPayload(dr.r, binary.BigEndian.Uint32(header[:]))
+			if err != nil {
+				return nil, dnstapMapError(err, ErrInvalidDnstap)
+			}
+			switch {
+			case ctrl == fstrmControlStart && !dr.started:
+				dr.started = true
+				continue
+			case ctrl == fstrmControlStop && dr.started:
+				return nil, io.EOF
+			default:
+				return nil, ErrInvalidDnstap
+			}
+		}
+
+		// 3. read and decode data frames
+		if !dr.started || length > fstrmMaxDataFrameSize {
+			return nil, ErrInvalidDnstap
+		}
+		frame := make([]byte, length)
+		if _, err := io.ReadFull(dr.r, frame); err != nil {
+			return nil, dnstapMapError(err, ErrInvalidDnstap)
+		}
+		msg, err := dnstapParseFrame(frame)
+		if err != nil {
+			return nil, err
+		}
+		if msg == nil {
+			continue
+		}
+		return msg, nil
+	}
+}
+
+// dnstapMapError maps [io.ReadFull] errors to the errors returned by [*DnstapReader.Next].
+func dnstapMapError(err, eof error) error {
+	switch {
+	case errors.Is(err, io.EOF):
+		return eof
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return ErrInvalidDnstap
+	default:
+		return err
+	}
+}
+
+// dnstapParseFrame parses a serialized Dnstap message and returns nil
+// when the Dnstap type is not MESSAGE.
+func dnstapParseFrame(frame []byte) (*DnstapMessage, error) {
+	var (
+		inner   []byte
+		typeval uint64
+	)
+	err := protoParseFields(frame, func(field int, wire int, value uint64, data []byte) {
+		switch {
+		case field == dnstapFieldMessage && wire == protoWireBytes:
+			inner = data
+		case field == dnstapFieldType && wire == protoWireVarint:
+			typeval = value
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if typeval != dnstapTypeMessage || inner == nil {
+		return nil, nil
+	}
+
+	msg := &DnstapMessage{}
+	var qsec, qnsec, rsec, rnsec uint64
+	err = protoParseFields(inner, func(field int, wire int, value uint64, data []byte) {
+		switch {
+		case field == dnstapMessageFieldType && wire == protoWireVarint:
+			msg.Type = DnstapMessageType(value)
+		case field == dnstapMessageFieldQueryTimeSec && wire == protoWireVarint:
+			qsec = value
+		case field == dnstapMessageFieldQueryTimeNsec && wire == protoWireFixed32:
+			qnsec = value
+		case field == dnstapMessageFieldQueryMessage && wire == protoWireBytes:
+			msg.QueryMessage = data
+		case field == dnstapMessageFieldResponseTimeSec && wire == protoWireVarint:
+			rsec = value
+		case field == dnstapMessageFieldResponseTimeNsec && wire == protoWireFixed32:
+			rnsec = value
+		case field == dnstapMessageFieldResponseMessage && wire == protoWireBytes:
+			msg.ResponseMessage = data
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	if qsec != 0 || qnsec != 0 {
+		msg.QueryTime = time.Unix(int64(qsec), int64(qnsec))
+	}
+	if rsec != 0 || rnsec != 0 {
+		msg.ResponseTime = time.Unix(int64(rsec), int64(rnsec))
+	}
+	return msg, nil
+}
+
+// protoParseFields calls fn for each field in buff. For varint and fixed
+// fields, value contains the value. For length-delimited fields, data
+// contains the bytes, which alias buff.
+func protoParseFields(buff []byte, fn func(field int, wire int, value uint64, data []byte)) error {
+	for len(buff) > 0 {
+		tag, n := binary.Uvarint(buff)
+		if n <= 0 {
+			return ErrInvalidDnstap
+		}
+		buff = buff[n:]
+		field, wire := int(tag>>3), int(tag&7)
+
+		switch wire {
+		case protoWireVarint:
+			value, n := binary.Uvarint(buff)
+			if n <= 0 {
+				return ErrInvalidDnstap
+			}
+			buff = buff[n:]
+			fn(field, wire, value, nil)
+
+		case protoWireFixed64:
+			if len(buff) < 8 {
+				return ErrInvalidDnstap
+			}
+			fn(field, wire, binary.LittleEndian.Uint64(buff), nil)
+			buff = buff[8:]
+
+		case protoWireBytes:
+			length, n := binary.Uvarint(buff)
+			if n <= 0 || length > uint64(len(buff)-n) {
+				return ErrInvalidDnstap
+			}
+			buff = buff[n:]
+			fn(field, wire, 0, buff[:length:length])
+			buff = buff[length:]
+
+		case protoWireFixed32:
+			if len(buff) < 4 {
+				return ErrInvalidDnstap
+			}
+			fn(field, wire, uint64(binary.LittleEndian.Uint32(buff)), nil)
+			buff = buff[4:]
+
+		default:
+			return ErrInvalidDnstap
+		}
+	}
+	return nil
+}
+
+// DnstapReplayResult is the result of replaying a dnstap message.
+type DnstapReplayResult struct {
+	// Message is the replayed dnstap message.
+	Message *DnstapMessage
+
+	// Response is the parsed response or nil on failure.
+	Response *dnscodec.Response
+
+	// Anomalies contains the anomalies we noticed (e.g., [AnomalyIDMismatch]).
+	Anomalies []string
+
+	// Err is the validation error or nil on success.
+	Err error
+}
+
+// ReplayDnstap reads dnstap messages from a unidirectional Frame Stream and
+// replays each message carrying both the raw query and the raw response
+// through the same parsing and validation pipeline used by [*Transport],
+// calling fn with each result. Messages lacking either raw message are skipped.
+//
+// Like [Revalidate], we annotate anomalies even when the validation fails and we
+// check for bogons using [DefaultBogonPrefixes]. We cannot check for blockpages
+// and TTL anomalies, which depend on user-provided settings, so use [FindBlockpages]
+// and [*TTLAnalyzer] with the result Message for that.
+//
+// Returns nil on success or the first error reading the stream.
+func ReplayDnstap(r io.Reader, fn func(*DnstapReplayResult)) error {
+	dr := NewDnstapReader(r)
+	for {
+		msg, err := dr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if msg.QueryMessage == nil || msg.ResponseMessage == nil {
+			continue
+		}
+		result := &DnstapReplayResult{Message: msg}
+		queryMsg := &dns.Msg{}
+		if err := queryMsg.Unpack(msg.QueryMessage); err != nil {
+			result.Err = dnscodec.ErrInvalidQuery
+		} else {
+			result.Response, result.Err = parseRawResponse(queryMsg, msg.ResponseMessage, nil)
+			result.Anomalies = rawAnomalies(msg.QueryMessage, msg.ResponseMessage, result.Response, &anomalyConfig{})
+		}
+		fn(result)
+	}
+}
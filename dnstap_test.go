@@ -0,0 +1,261 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readFstrmFrame reads a Frame Streams frame and returns whether it is a
+// control frame along with its payload.
+func readFstrmFrame(t *testing.T, r io.Reader) (bool, []byte) {
+	t.Helper()
+	var length uint32
+	require.NoError(t, binary.Read(r, binary.BigEndian, &length))
+	control := length == 0
+	if control {
+		require.NoError(t, binary.Read(r, binary.BigEndian, &length))
+	}
+	payload := make([]byte, length)
+	_, err := io.ReadFull(r, payload)
+	require.NoError(t, err)
+	return control, payload
+}
+
+// writeFstrmControl writes a Frame Streams control frame without fields.
+func writeFstrmControl(t *testing.T, w io.Writer, ctrl uint32) {
+	t.Helper()
+	buff := binary.BigEndian.AppendUint32(nil, 0)
+	buff = binary.BigEndian.AppendUint32(buff, 4)
+	buff = binary.BigEndian.AppendUint32(buff, ctrl)
+	_, err := w.Write(buff)
+	require.NoError(t, err)
+}
+
+// requireFstrmControl reads a control frame and checks its type.
+func requireFstrmControl(t *testing.T, r io.Reader, ctrl uint32) []byte {
+	t.Helper()
+	control, payload := readFstrmFrame(t, r)
+	require.True(t, control)
+	require.Equal(t, ctrl, binary.BigEndian.Uint32(payload[:4]))
+	return payload
+}
+
+func TestDnstapWriterFile(t *testing.T) {
+	buff := &bytes.Buffer{}
+	dw := dnsoverhttps.NewDnstapWriter(buff)
+	dw.Identity = []byte("probe")
+
+	// closing before writing anything must not write anything
+	require.NoError(t, dw.Close())
+	assert.Equal(t, 0, buff.Len())
+
+	dw.ObserveExchange(&dnsoverhttps.ExchangeEvent{
+		StartTime:   time.Unix(1700000000, 500),
+		Duration:    time.Second,
+		RawQuery:    []byte("raw-query"),
+		RawResponse: []byte("raw-response"),
+	})
+	dw.ObserveExchange(&dnsoverhttps.ExchangeEvent{Err: errors.New("mocked error")})
+	require.NoError(t, dw.Close())
+	require.NoError(t, dw.Err())
+
+	start := requireFstrmControl(t, buff, 2)
+	assert.Contains(t, string(start), "protobuf:dnstap.Dnstap")
+
+	control, query := readFstrmFrame(t, buff)
+	require.False(t, control)
+	assert.True(t, bytes.Contains(query, []byte("probe")))
+	assert.True(t, bytes.Contains(query, []byte("raw-query")))
+	assert.False(t, bytes.Contains(query, []byte("raw-response")))
+
+	control, response := readFstrmFrame(t, buff)
+	require.False(t, control)
+	assert.True(t, bytes.Contains(response, []byte("raw-query")))
+	assert.True(t, bytes.Contains(response, []byte("raw-response")))
+
+	requireFstrmControl(t, buff, 3)
+	assert.Equal(t, 0, buff.Len())
+}
+
+func TestDnstapWriterSocket(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	collected := make(chan [][]byte, 1)
+	go func() {
+		var frames [][]byte
+		requireFstrmControl(t, server, 4)
+		writeFstrmControl(t, server, 1)
+		requireFstrmControl(t, server, 2)
+		for {
+			control, payload := readFstrmFrame(t, server)
+			if control {
+				break // STOP
+			}
+			frames = append(frames, payload)
+		}
+		writeFstrmControl(t, server, 5)
+		collected <- frames
+	}()
+
+	dw := dnsoverhttps.NewDnstapSocketWriter(client)
+	dw.QueryType = dnsoverhttps.DnstapToolQuery
+	dw.ResponseType = dnsoverhttps.DnstapToolResponse
+	dw.ObserveExchange(&dnsoverhttps.ExchangeEvent{
+		StartTime: time.Unix(1700000000, 0),
+		RawQuery:  []byte("raw-query"),
+	})
+	require.NoError(t, dw.Close())
+
+	frames := <-collected
+	require.Len(t, frames, 1)
+	assert.True(t, bytes.Contains(frames[0], []byte("raw-query")))
+}
+
+func TestDnstapWriterSocketRejected(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		requireFstrmControl(t, server, 4)
+		writeFstrmControl(t, server, 3) // not ACCEPT
+	}()
+
+	dw := dnsoverhttps.NewDnstapSocketWriter(client)
+	err := dw.WriteMessage(&dnsoverhttps.DnstapMessage{Type: dnsoverhttps.DnstapClientQuery})
+	require.ErrorIs(t, err, dnsoverhttps.ErrInvalidDnstap)
+	require.ErrorIs(t, dw.Err(), dnsoverhttps.ErrInvalidDnstap)
+	require.ErrorIs(t, dw.Close(), dnsoverhttps.ErrInvalidDnstap)
+}
+
+func TestDnstapReaderRoundTrip(t *testing.T) {
+	buff := &bytes.Buffer{}
+	dw := dnsoverhttps.NewDnstapWriter(buff)
+	t0 := time.Unix(1700000000, 500)
+	dw.ObserveExchange(&dnsoverhttps.ExchangeEvent{
+		StartTime:   t0,
+		Duration:    time.Second,
+		RawQuery:    []byte("raw-query"),
+		RawResponse: []byte("raw-response"),
+	})
+	require.NoError(t, dw.Close())
+
+	dr := dnsoverhttps.NewDnstapReader(buff)
+	query, err := dr.Next()
+	require.NoError(t, err)
+	assert.Equal(t, &dnsoverhttps.DnstapMessage{
+		Type:         dnsoverhttps.DnstapClientQuery,
+		QueryTime:    t0,
+		QueryMessage: []byte("raw-query"),
+	}, query)
+
+	response, err := dr.Next()
+	require.NoError(t, err)
+	assert.Equal(t, &dnsoverhttps.DnstapMessage{
+		Type:            dnsoverhttps.DnstapClientResponse,
+		QueryTime:       t0,
+		QueryMessage:    []byte("raw-query"),
+		ResponseTime:    t0.Add(time.Second),
+		ResponseMessage: []byte("raw-response"),
+	}, response)
+
+	_, err = dr.Next()
+	require.ErrorIs(t, err, io.EOF)
+}
+
+func TestDnstapReaderErrors(t *testing.T) {
+	start := "\x00\x00\x00\x00\x00\x00\x00\x04\x00\x00\x00\x02"
+	stop := "\x00\x00\x00\x00\x00\x00\x00\x04\x00\x00\x00\x03"
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// input is the Frame Stream content.
+		input string
+
+		// wantErr is the expected error.
+		wantErr error
+	}
+
+	testCases := []testCase{
+		{name: "empty stream", input: "", wantErr: io.EOF},
+		{name: "data before START", input: "\x00\x00\x00\x01\x00", wantErr: dnsoverhttps.ErrInvalidDnstap},
+		{name: "STOP before START", input: stop, wantErr: dnsoverhttps.ErrInvalidDnstap},
+		{name: "truncated control frame", input: "\x00\x00\x00\x00\x00", wantErr: dnsoverhttps.ErrInvalidDnstap},
+		{name: "short control frame", input: "\x00\x00\x00\x00\x00\x00\x00\x02\x00\x00", wantErr: dnsoverhttps.ErrInvalidDnstap},
+		{name: "missing STOP", input: start, wantErr: io.EOF},
+		{name: "truncated data frame", input: start + "\x00\x00\x00\x04\x00", wantErr: dnsoverhttps.ErrInvalidDnstap},
+		{name: "malformed protobuf", input: start + "\x00\x00\x00\x01\xff", wantErr: dnsoverhttps.ErrInvalidDnstap},
+		{name: "unsupported wire type", input: start + "\x00\x00\x00\x01\x0b", wantErr: dnsoverhttps.ErrInvalidDnstap},
+		{name: "non-MESSAGE frames are skipped", input: start + "\x00\x00\x00\x02\x78\x02" + stop, wantErr: io.EOF},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			dr := dnsoverhttps.NewDnstapReader(bytes.NewReader([]byte(tt.input)))
+			msg, err := dr.Next()
+			require.ErrorIs(t, err, tt.wantErr)
+			require.Nil(t, msg)
+		})
+	}
+}
+
+func TestReplayDnstap(t *testing.T) {
+	query := &dns.Msg{}
+	query.SetQuestion("dns.google.", dns.TypeA)
+	rawQuery, err := query.Pack()
+	require.NoError(t, err)
+	rawResp := buildDNSResponse(t, query)
+
+	buff := &bytes.Buffer{}
+	dw := dnsoverhttps.NewDnstapWriter(buff)
+	dw.ObserveExchange(&dnsoverhttps.ExchangeEvent{RawQuery: rawQuery, RawResponse: rawResp})
+	dw.ObserveExchange(&dnsoverhttps.ExchangeEvent{RawQuery: rawQuery, RawResponse: []byte("garbage")})
+	dw.ObserveExchange(&dnsoverhttps.ExchangeEvent{RawQuery: []byte("garbage"), RawResponse: rawResp})
+	bogonResp := newBogonResponse("dns.google", "10.0.0.1")
+	bogonResp.Id, bogonResp.Response = query.Id+1, true
+	rawBogonResp, err := bogonResp.Pack()
+	require.NoError(t, err)
+	dw.ObserveExchange(&dnsoverhttps.ExchangeEvent{RawQuery: rawQuery, RawResponse: rawBogonResp})
+	require.NoError(t, dw.Close())
+
+	var results []*dnsoverhttps.DnstapReplayResult
+	err = dnsoverhttps.ReplayDnstap(buff, func(result *dnsoverhttps.DnstapReplayResult) {
+		results = append(results, result)
+	})
+	require.NoError(t, err)
+
+	require.Len(t, results, 4)
+	require.NoError(t, results[0].Err)
+	assert.Empty(t, results[0].Anomalies)
+	addrs, err := results[0].Response.RecordsA()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"8.8.8.8"}, addrs)
+	assert.ErrorIs(t, results[1].Err, dnscodec.ErrServerMisbehaving)
+	assert.ErrorIs(t, results[2].Err, dnscodec.ErrInvalidQuery)
+	assert.Error(t, results[3].Err)
+	assert.Equal(t, []string{dnsoverhttps.AnomalyIDMismatch, dnsoverhttps.AnomalyBogonAnswer}, results[3].Anomalies)
+}
+
+func TestReplayDnstapReadError(t *testing.T) {
+	err := dnsoverhttps.ReplayDnstap(bytes.NewReader([]byte("\x00\x00\x00\x01")), func(*dnsoverhttps.DnstapReplayResult) {
+		t.Fatal("should not be called")
+	})
+	require.ErrorIs(t, err, dnsoverhttps.ErrInvalidDnstap)
+}
@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"syscall"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// DuplicateResult describes the two exchanges performed by a [*DuplicateExchanger].
+type DuplicateResult struct {
+	// First is the first response or nil on failure.
+	First *dnscodec.Response
+
+	// FirstErr is the first error or nil on success.
+	FirstErr error
+
+	// Second is the second response or nil on failure.
+	Second *dnscodec.Response
+
+	// SecondErr is the second error or nil on success.
+	SecondErr error
+
+	// Consistent is true when both exchanges either returned the same
+	// valid RRs (ignoring order and TTLs) or failed with errors of the
+	// same class, i.e., wrapping the same known sentinel error (e.g.,
+	// [dnscodec.ErrNoName]) or being the same error otherwise.
+	//
+	// When false, the answers are nondeterministic, which may be caused
+	// by load balancing but also by injected answers.
+	Consistent bool
+
+	// Diff describes how the second response differs from the first
+	// one, or is nil unless both exchanges succeeded.
+	Diff *ResponseDiff
+}
+
+// DuplicateExchanger sends the same query twice and compares the two results,
+// which is a classic technique for detecting DNS interference.
+//
+// Construct using [NewDuplicateExchanger].
+type DuplicateExchanger struct {
+	// First is the [Exchanger] used for the first exchange.
+	//
+	// Set by [NewDuplicateExchanger] to the user-provided value.
+	First Exchanger
+
+	// Second is the [Exchanger] used for the second exchange. Using
+	// a [*Transport] with its own [Client] forces the second exchange
+	// to use fresh connections.
+	//
+	// Set by [NewDuplicateExchanger] to the user-provided value.
+	Second Exchanger
+
+	// ObserveDuplicate is an optional hook called with the [*DuplicateResult].
+	ObserveDuplicate func(*DuplicateResult)
+}
+
+var _ Exchanger = &DuplicateExchanger{}
+
+// NewDuplicateExchanger creates a new [*DuplicateExchanger].
+//
+// Pass the same [Exchanger] twice to reuse connections.
+func NewDuplicateExchanger(first, second Exchanger) *DuplicateExchanger {
+	return &DuplicateExchanger{First: first, Second: second}
+}
+
+// Exchange implements [Exchanger].
+//
+// It returns the result of the first exchange.
+func (dx *DuplicateExchanger) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	result := dx.Verify(ctx, query)
+	if dx.ObserveDuplicate != nil {
+		dx.ObserveDuplicate(result)
+	}
+	return result.First, result.FirstErr
+}
+
+// Verify performs the two exchanges in sequence and compares the results.
+func (dx *DuplicateExchanger) Verify(ctx context.Context, query *dnscodec.Query) *DuplicateResult {
+	// 1. perform the two exchanges
+	result := &DuplicateResult{}
+	result.First, result.FirstErr = dx.First.Exchange(ctx, query)
+	result.Second, result.SecondErr = dx.Second.Exchange(ctx, query)
+
+	// 2. compare the results
+	switch {
+	case result.FirstErr != nil || result.SecondErr != nil:
+		result.Consistent = result.FirstErr != nil && result.SecondErr != nil &&
+			sameErrorClass(result.FirstErr, result.SecondErr)
+	default:
+		result.Consistent = slices.Equal(
+			normalizedRRs(result.First.ValidRRs), normalizedRRs(result.Second.ValidRRs))
+		result.Diff = DiffResponses(result.First, result.Second)
+	}
+	return result
+}
+
+// errorClasses contains the sentinel errors classifying exchange errors, which
+// we compare using [errors.Is] since error strings contain varying details
+// (e.g., addresses) and distinct sentinels may share the same string.
+var errorClasses = []error{
+	dnscodec.ErrNoName,
+	dnscodec.ErrNoData,
+	dnscodec.ErrServerTemporarilyMisbehaving,
+	dnscodec.ErrServerMisbehaving,
+	dnscodec.ErrInvalidResponse,
+	dnscodec.ErrCannotUnmarshalMessage,
+	context.DeadlineExceeded,
+	context.Canceled,
+	syscall.ECONNREFUSED,
+	syscall.ECONNRESET,
+	syscall.EHOSTUNREACH,
+	syscall.ENETUNREACH,
+}
+
+// sameErrorClass returns whether both errors wrap the same sentinel error
+// of the [errorClasses] or, otherwise, whether they are the same error.
+func sameErrorClass(first, second error) bool {
+	for _, class := range errorClasses {
+		if isFirst, isSecond := errors.Is(first, class), errors.Is(second, class); isFirst || isSecond {
+			return isFirst && isSecond
+		}
+	}
+	return errors.Is(first, second) || errors.Is(second, first)
+}
+
+// normalizedRRs returns the sorted string representation of the
+// given RRs with zero TTL, such that we can compare RR sets.
+func normalizedRRs(rrs []dns.RR) []string {
+	out := make([]string, 0, len(rrs))
+	for _, rr := range rrs {
+		rr = dns.Copy(rr)
+		rr.Header().Ttl = 0
+		out = append(out, rr.String())
+	}
+	slices.Sort(out)
+	return out
+}
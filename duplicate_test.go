@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newStaticExchanger returns an exchanger returning the given A records or error.
+func newStaticExchanger(err error, ttl uint32, addrs ...string) dnsoverhttps.Exchanger {
+	return funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		if err != nil {
+			return nil, err
+		}
+		resp := &dnscodec.Response{}
+		for _, addr := range addrs {
+			resp.ValidRRs = append(resp.ValidRRs, &dns.A{
+				Hdr: dns.RR_Header{Name: dns.Fqdn(query.Name), Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+				A:   net.ParseIP(addr),
+			})
+		}
+		return resp, nil
+	})
+}
+
+func TestDuplicateExchanger(t *testing.T) {
+	type testCase struct {
+		// name is the name of the test case.
+		name string
+
+		// first is the first exchanger.
+		first dnsoverhttps.Exchanger
+
+		// second is the second exchanger.
+		second dnsoverhttps.Exchanger
+
+		// wantConsistent is the expected Consistent value.
+		wantConsistent bool
+
+		// wantDiff is the expected Diff value.
+		wantDiff *dnsoverhttps.ResponseDiff
+	}
+
+	mockedErr := errors.New("mocked error")
+	cases := []testCase{{
+		name:           "same answers in different order and with different TTLs",
+		first:          newStaticExchanger(nil, 300, "8.8.8.8", "8.8.4.4"),
+		second:         newStaticExchanger(nil, 299, "8.8.4.4", "8.8.8.8"),
+		wantConsistent: true,
+		wantDiff:       &dnsoverhttps.ResponseDiff{TTLDelta: -1},
+	}, {
+		name:           "different answers",
+		first:          newStaticExchanger(nil, 300, "8.8.8.8"),
+		second:         newStaticExchanger(nil, 300, "10.10.34.35"),
+		wantConsistent: false,
+		wantDiff: &dnsoverhttps.ResponseDiff{
+			AddedAddrs:   []string{"10.10.34.35"},
+			RemovedAddrs: []string{"8.8.8.8"},
+		},
+	}, {
+		name:           "same error",
+		first:          newStaticExchanger(mockedErr, 0),
+		second:         newStaticExchanger(mockedErr, 0),
+		wantConsistent: true,
+	}, {
+		name:           "errors of the same class",
+		first:          newStaticExchanger(fmt.Errorf("%w: first", dnscodec.ErrNoName), 0),
+		second:         newStaticExchanger(fmt.Errorf("%w: second", dnscodec.ErrNoName), 0),
+		wantConsistent: true,
+	}, {
+		name:           "errors of different classes with the same string",
+		first:          newStaticExchanger(dnscodec.ErrServerMisbehaving, 0),
+		second:         newStaticExchanger(dnscodec.ErrServerTemporarilyMisbehaving, 0),
+		wantConsistent: false,
+	}, {
+		name:           "different unclassified errors with the same string",
+		first:          newStaticExchanger(mockedErr, 0),
+		second:         newStaticExchanger(errors.New("mocked error"), 0),
+		wantConsistent: false,
+	}, {
+		name:           "only one failure",
+		first:          newStaticExchanger(nil, 300, "8.8.8.8"),
+		second:         newStaticExchanger(mockedErr, 0),
+		wantConsistent: false,
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			dx := dnsoverhttps.NewDuplicateExchanger(tc.first, tc.second)
+			var result *dnsoverhttps.DuplicateResult
+			dx.ObserveDuplicate = func(r *dnsoverhttps.DuplicateResult) {
+				result = r
+			}
+
+			resp, err := dx.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+			require.NotNil(t, result)
+			assert.Same(t, result.First, resp)
+			assert.Equal(t, result.FirstErr, err)
+			assert.Equal(t, tc.wantConsistent, result.Consistent)
+			assert.Equal(t, tc.wantDiff, result.Diff)
+		})
+	}
+}
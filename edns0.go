@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"slices"
+
+	"github.com/miekg/dns"
+)
+
+// ResponseEDNS0Options returns the EDNS(0) options included in a response
+// message or nil if the response does not contain an OPT RR.
+//
+// Options unknown to [dns] are returned as [*dns.EDNS0_LOCAL].
+func ResponseEDNS0Options(resp *dns.Msg) []dns.EDNS0 {
+	opt := resp.IsEdns0()
+	if opt == nil {
+		return nil
+	}
+	return opt.Option
+}
+
+// responseEDNS0Features returns the EDNS(0) UDP payload size advertised by
+// the response message, which is zero without an OPT RR, and whether the
+// response message includes the padding option (RFC 8467).
+func responseEDNS0Features(resp *dns.Msg) (udpSize uint16, padded bool) {
+	if opt := resp.IsEdns0(); opt != nil {
+		udpSize = opt.UDPSize()
+	}
+	return udpSize, hasEDNS0Option(resp, dns.EDNS0PADDING)
+}
+
+// appendEDNS0Options appends the given options to the OPT RR of the query
+// message, if any, keeping the padding option, if any, as the last one.
+func appendEDNS0Options(queryMsg *dns.Msg, options []dns.EDNS0) {
+	opt := queryMsg.IsEdns0()
+	if opt == nil || len(options) <= 0 {
+		return
+	}
+	idx := slices.IndexFunc(opt.Option, func(o dns.EDNS0) bool {
+		return o.Option() == dns.EDNS0PADDING
+	})
+	if idx < 0 {
+		idx = len(opt.Option)
+	}
+	opt.Option = slices.Insert(opt.Option, idx, options...)
+}
+
+// padQueryMsg recomputes the padding option of the query message, if any,
+// so that the message length is a multiple of 128 octets (RFC 8467).
+func padQueryMsg(queryMsg *dns.Msg) {
+	padMsg(queryMsg, 128)
+}
+
+// padResponseMsg adds the padding option to the response message when the query
+// message uses padding, so that the response message length is a multiple of 468
+// octets (RFC 8467). We add an OPT RR to the response message if needed.
+func padResponseMsg(queryMsg, respMsg *dns.Msg) {
+	queryOpt := queryMsg.IsEdns0()
+	if queryOpt == nil || !hasEDNS0Option(queryMsg, dns.EDNS0PADDING) {
+		return
+	}
+	if respMsg.IsEdns0() == nil {
+		respMsg.SetEdns0(queryOpt.UDPSize(), queryOpt.Do())
+	}
+	if !hasEDNS0Option(respMsg, dns.EDNS0PADDING) {
+		opt := respMsg.IsEdns0()
+		opt.Option = append(opt.Option, &dns.EDNS0_PADDING{})
+	}
+	padMsg(respMsg, 468)
+}
+
+// padMsg recomputes the padding option of the message, if any, so
+// that the message length is a multiple of the block size.
+func padMsg(msg *dns.Msg, blockSize uint16) {
+	opt := msg.IsEdns0()
+	if opt == nil {
+		return
+	}
+	for _, o := range opt.Option {
+		if padding, ok := o.(*dns.EDNS0_PADDING); ok {
+			padding.Padding = nil
+			remainder := (blockSize - uint16(msg.Len())%blockSize) % blockSize
+			padding.Padding = make([]byte, remainder)
+			return
+		}
+	}
+}
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExchangeEDNS0Options(t *testing.T) {
+	const experimentalCode = 65001
+	var gotQuery *dns.Msg
+	srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+		gotQuery = query
+		resp := &dns.Msg{}
+		require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+		resp.SetEdns0(dnscodec.QueryMaxResponseSizeTCP, false)
+		resp.IsEdns0().Option = append(resp.IsEdns0().Option, &dns.EDNS0_LOCAL{
+			Code: experimentalCode,
+			Data: []byte("pong"),
+		})
+		return resp
+	})
+	defer srv.Close()
+
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	dt.EDNS0Options = []dns.EDNS0{&dns.EDNS0_LOCAL{Code: experimentalCode, Data: []byte("ping")}}
+
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+	resp, err := dt.Exchange(context.Background(), query)
+	require.NoError(t, err)
+
+	// the query contains the option followed by the padding
+	require.NotNil(t, gotQuery)
+	options := gotQuery.IsEdns0().Option
+	require.Len(t, options, 2)
+	local, ok := options[0].(*dns.EDNS0_LOCAL)
+	require.True(t, ok)
+	assert.Equal(t, uint16(experimentalCode), local.Code)
+	assert.Equal(t, []byte("ping"), local.Data)
+	assert.Equal(t, uint16(dns.EDNS0PADDING), options[1].Option())
+	assert.Equal(t, 0, gotQuery.Len()%128)
+
+	// we can read back the option from the response
+	respOptions := dnsoverhttps.ResponseEDNS0Options(resp.Response)
+	require.Len(t, respOptions, 1)
+	local, ok = respOptions[0].(*dns.EDNS0_LOCAL)
+	require.True(t, ok)
+	assert.Equal(t, []byte("pong"), local.Data)
+}
+
+func TestResponseEDNS0OptionsWithoutOPT(t *testing.T) {
+	assert.Nil(t, dnsoverhttps.ResponseEDNS0Options(&dns.Msg{}))
+}
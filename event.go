@@ -0,0 +1,141 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"crypto/tls"
+	"time"
+)
+
+// ExchangeEvent describes a completed DNS-over-HTTPS exchange.
+//
+// The [*Transport] passes it to the [Transport.ObserveExchange] hook.
+type ExchangeEvent struct {
+	// URL is the server URL.
+	URL string
+
+	// QueryName is the name we were asked to resolve.
+	QueryName string
+
+	// QueryType is the query type (e.g., dns.TypeA).
+	QueryType uint16
+
+	// StartTime is when the exchange started.
+	StartTime time.Time
+
+	// JitterDelay is the delay returned by the [Transport] Jitter hook, which
+	// we waited before StartTime unless the context was done, or zero.
+	JitterDelay time.Duration
+
+	// Duration is the time elapsed since StartTime.
+	Duration time.Duration
+
+	// RawQuery is the raw DNS query or nil if we could not serialize it.
+	RawQuery []byte
+
+	// RawResponse is the raw DNS response or nil if we could not read it.
+	RawResponse []byte
+
+	// HTTPMethod is the request method (e.g., "POST") or an empty string
+	// if we could not create the request. See [Transport.Method].
+	HTTPMethod string
+
+	// HTTPProtocol is the response protocol (e.g., "HTTP/2.0") or an empty
+	// string if we did not receive a response.
+	HTTPProtocol string
+
+	// Insecure is true when we received the response without using TLS
+	// (e.g., using [NewInsecureH2CClient]), which means that the exchange
+	// was neither confidential nor authenticated.
+	Insecure bool
+
+	// TLS is the state of the TLS connection used to receive the response,
+	// including the certificate chain presented by the server, or nil when
+	// we did not receive a response or did not use TLS.
+	TLS *tls.ConnectionState
+
+	// BootstrapStartTime is when the lookup of the server hostname using
+	// the system resolver started or the zero value when no lookup occurred
+	// (e.g., the exchange reused a connection or the URL contains an IP
+	// address). Note that the HTTP/3 transport does not report lookups.
+	BootstrapStartTime time.Time
+
+	// BootstrapDuration is the duration of the server hostname lookup.
+	BootstrapDuration time.Duration
+
+	// BootstrapAddrs contains the addresses returned by the lookup.
+	BootstrapAddrs []string
+
+	// BootstrapErr is the lookup error, if any.
+	BootstrapErr error
+
+	// TLSHandshakeStartTime is when the TLS or QUIC handshake for the
+	// connection used by this exchange started or the zero value when
+	// the exchange reused an existing connection.
+	TLSHandshakeStartTime time.Time
+
+	// TLSHandshakeDuration is the duration of the TLS or QUIC handshake.
+	//
+	// Note that exchanges using HTTP/3 with POST never use 0-RTT. Use
+	// TLS.DidResume to know whether the handshake resumed a session.
+	TLSHandshakeDuration time.Duration
+
+	// TLSHandshakeErr is the TLS or QUIC handshake error, if any.
+	TLSHandshakeErr error
+
+	// AltSvc is the Alt-Svc response header (RFC 7838), if any, which
+	// servers use to advertise HTTP/3 endpoints. See [*AltSvcUpgrader].
+	AltSvc string
+
+	// HTTPDate is the parsed Date response header or the zero value when
+	// missing or invalid. A Date much older than StartTime suggests that a
+	// cache served a stale response.
+	HTTPDate time.Time
+
+	// HTTPAge is the parsed Age response header (RFC 9111), which is the
+	// time the response spent in caches, or zero when missing or invalid.
+	HTTPAge time.Duration
+
+	// HTTPCacheControl is the Cache-Control response header, if any.
+	HTTPCacheControl string
+
+	// HTTPCacheStatus is the first cache status response header among
+	// Cache-Status (RFC 9211), CF-Cache-Status, X-Cache, X-Cache-Status,
+	// and X-Proxy-Cache, if any.
+	HTTPCacheStatus string
+
+	// HTTPCacheHit is true when the response likely comes from a cache rather
+	// than from the origin, i.e., when HTTPAge is positive or HTTPCacheStatus
+	// contains the "hit" token (e.g., "HIT" or "Hit from cloudfront").
+	HTTPCacheHit bool
+
+	// ConnReused is true when the exchange reused an existing connection,
+	// which is the main source of DoH latency variance since a cold
+	// connection requires a lookup, a TCP connect, and a TLS handshake.
+	// Note that the HTTP/3 transport does not report connection reuse.
+	ConnReused bool
+
+	// ConnWasIdle is true when the reused connection was idle.
+	ConnWasIdle bool
+
+	// ConnIdleTime is for how long the reused connection was idle.
+	ConnIdleTime time.Duration
+
+	// ContentEncoding is the response Content-Encoding or an empty string
+	// when the body was not encoded. When the [Client] transparently
+	// decompressed a gzip body, this field is "gzip" anyway.
+	ContentEncoding string
+
+	// IDMismatch is true when the response ID differed from the query ID,
+	// which some servers do by rewriting the ID. Unless the [Transport]
+	// TolerateIDMismatch field is true, such exchanges fail.
+	IDMismatch bool
+
+	// Anomalies contains the anomalies we noticed in the response
+	// (e.g., [AnomalyIDMismatch]), which is the one place where
+	// analyzers record findings, or nil without a response.
+	Anomalies []string
+
+	// Err is the exchange error or nil on success.
+	Err error
+}
@@ -0,0 +1,24 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+
+	"github.com/bassosimone/dnscodec"
+)
+
+// Exchanger exchanges a [*dnscodec.Query] for a [*dnscodec.Response].
+//
+// [*Transport] and [*ReloadableTransport] implement this interface. Because
+// it only depends on [dnscodec], transports for other encrypted DNS flavors
+// (e.g., DNS-over-TLS, DNS-over-QUIC) and Do53 can implement it as well and
+// compose with [*FallbackExchanger] and [*ChainExchanger].
+type Exchanger interface {
+	Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error)
+}
+
+var (
+	_ Exchanger = &Transport{}
+	_ Exchanger = &ReloadableTransport{}
+)
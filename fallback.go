@@ -0,0 +1,84 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"errors"
+
+	"github.com/bassosimone/dnscodec"
+)
+
+// FallbackExchanger tries a primary [Exchanger] (e.g., a [*Transport]) and
+// falls back to an alternative [Exchanger] (e.g., one using the system
+// resolver) when the primary fails with a configured class of errors.
+//
+// Construct using [NewFallbackExchanger].
+type FallbackExchanger struct {
+	// Primary is the [Exchanger] to try first.
+	//
+	// Set by [NewFallbackExchanger] to the user-provided value.
+	Primary Exchanger
+
+	// Fallback is the [Exchanger] to use when the primary fails.
+	//
+	// Set by [NewFallbackExchanger] to the user-provided value.
+	Fallback Exchanger
+
+	// ShouldFallback decides whether to fall back given the primary error.
+	//
+	// Set by [NewFallbackExchanger] to [ShouldFallbackDefault].
+	ShouldFallback func(err error) bool
+
+	// ObserveFallback is an optional hook called after each exchange
+	// with whether the fallback answered and the primary error, if any.
+	ObserveFallback func(usedFallback bool, primaryErr error)
+}
+
+var _ Exchanger = &FallbackExchanger{}
+
+// NewFallbackExchanger creates a new [*FallbackExchanger].
+func NewFallbackExchanger(primary, fallback Exchanger) *FallbackExchanger {
+	return &FallbackExchanger{
+		Primary:        primary,
+		Fallback:       fallback,
+		ShouldFallback: ShouldFallbackDefault,
+	}
+}
+
+// ShouldFallbackDefault is the default [FallbackExchanger] ShouldFallback policy.
+//
+// It falls back on any error except negative answers (i.e., NXDOMAIN or
+// NODATA), which are valid answers, and context errors, which indicate
+// that the caller is not interested in the result anymore.
+func ShouldFallbackDefault(err error) bool {
+	switch {
+	case errors.Is(err, dnscodec.ErrNoName), errors.Is(err, dnscodec.ErrNoData):
+		return false
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	default:
+		return true
+	}
+}
+
+// Exchange implements [Exchanger].
+func (fx *FallbackExchanger) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	// 1. try with the primary exchanger first
+	resp, err := fx.Primary.Exchange(ctx, query)
+	if err == nil || ctx.Err() != nil || !fx.ShouldFallback(err) {
+		fx.observe(false, err)
+		return resp, err
+	}
+
+	// 2. fall back to the alternative exchanger
+	fx.observe(true, err)
+	return fx.Fallback.Exchange(ctx, query)
+}
+
+// observe calls ObserveFallback if it is not nil.
+func (fx *FallbackExchanger) observe(usedFallback bool, primaryErr error) {
+	if fx.ObserveFallback != nil {
+		fx.ObserveFallback(usedFallback, primaryErr)
+	}
+}
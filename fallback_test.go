@@ -0,0 +1,121 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// funcExchanger is a [dnsoverhttps.Exchanger] calling a function.
+type funcExchanger func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error)
+
+func (fx funcExchanger) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	return fx(ctx, query)
+}
+
+func TestFallbackExchanger(t *testing.T) {
+	primaryResp := &dnscodec.Response{}
+	fallbackResp := &dnscodec.Response{}
+
+	type testCase struct {
+		// name is the name of the test case.
+		name string
+
+		// primaryErr is the error returned by the primary exchanger.
+		primaryErr error
+
+		// wantResp is the expected response.
+		wantResp *dnscodec.Response
+
+		// wantErr is the expected error.
+		wantErr error
+
+		// wantFallback indicates whether we expect to use the fallback.
+		wantFallback bool
+	}
+
+	mockedErr := errors.New("mocked error")
+	cases := []testCase{{
+		name:         "primary succeeds",
+		primaryErr:   nil,
+		wantResp:     primaryResp,
+		wantFallback: false,
+	}, {
+		name:         "primary fails with network error",
+		primaryErr:   mockedErr,
+		wantResp:     fallbackResp,
+		wantFallback: true,
+	}, {
+		name:         "primary returns NXDOMAIN",
+		primaryErr:   dnscodec.ErrNoName,
+		wantErr:      dnscodec.ErrNoName,
+		wantFallback: false,
+	}, {
+		name:         "primary returns NODATA",
+		primaryErr:   dnscodec.ErrNoData,
+		wantErr:      dnscodec.ErrNoData,
+		wantFallback: false,
+	}, {
+		name:         "primary times out",
+		primaryErr:   context.DeadlineExceeded,
+		wantErr:      context.DeadlineExceeded,
+		wantFallback: false,
+	}}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			primary := funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+				if tc.primaryErr != nil {
+					return nil, tc.primaryErr
+				}
+				return primaryResp, nil
+			})
+			fallback := funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+				return fallbackResp, nil
+			})
+
+			fx := dnsoverhttps.NewFallbackExchanger(primary, fallback)
+			var gotFallback bool
+			var gotPrimaryErr error
+			fx.ObserveFallback = func(usedFallback bool, primaryErr error) {
+				gotFallback, gotPrimaryErr = usedFallback, primaryErr
+			}
+
+			query := dnscodec.NewQuery("dns.google", dns.TypeA)
+			resp, err := fx.Exchange(context.Background(), query)
+			if tc.wantErr != nil {
+				require.ErrorIs(t, err, tc.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Same(t, tc.wantResp, resp)
+			assert.Equal(t, tc.wantFallback, gotFallback)
+			assert.Equal(t, tc.primaryErr, gotPrimaryErr)
+		})
+	}
+}
+
+func TestFallbackExchangerCustomPolicy(t *testing.T) {
+	mockedErr := errors.New("mocked error")
+	primary := funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		return nil, mockedErr
+	})
+	fallback := funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		t.Fatal("should not be called")
+		return nil, nil
+	})
+
+	fx := dnsoverhttps.NewFallbackExchanger(primary, fallback)
+	fx.ShouldFallback = func(err error) bool { return false }
+
+	_, err := fx.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+	require.ErrorIs(t, err, mockedErr)
+}
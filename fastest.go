@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+)
+
+// FastestRankEvent describes a re-ranking performed by a [*FastestExchanger].
+type FastestRankEvent struct {
+	// Best is the index of the best exchanger.
+	Best int
+
+	// Scores contains the scores we used for ranking indexed by exchanger.
+	Scores []EndpointScore
+}
+
+// FastestSelectEvent describes the exchanger selected by a [*FastestExchanger].
+type FastestSelectEvent struct {
+	// Index is the index of the selected exchanger.
+	Index int
+
+	// Sampling is true when we selected another exchanger than the best one
+	// for sampling it and false when we selected the best exchanger.
+	Sampling bool
+}
+
+// FastestExchanger selects among a list of [Exchanger] (e.g., a [*Transport] for
+// each endpoint) the fastest one: it scores each exchange using a [*ScoreTracker],
+// re-ranks the exchangers every RerankInterval, routes most exchanges to the best
+// exchanger, and samples the others with probability SampleRate, so that their
+// scores remain fresh and we notice when another exchanger becomes the fastest.
+//
+// We rank using [EndpointScore.Better], which accounts for failures before latency,
+// so that failing exchangers do not win because they fail fast.
+//
+// Construct using [NewFastestExchanger].
+type FastestExchanger struct {
+	// Exchangers contains the exchangers to select from.
+	//
+	// Set by [NewFastestExchanger] to the user-provided value.
+	Exchangers []Exchanger
+
+	// Scores tracks the score of each exchanger.
+	//
+	// Set by [NewFastestExchanger] to a new [*ScoreTracker].
+	Scores *ScoreTracker
+
+	// RerankInterval is the interval between re-rankings. When zero
+	// or negative, we re-rank before each exchange.
+	//
+	// Set by [NewFastestExchanger] to 1 minute.
+	RerankInterval time.Duration
+
+	// SampleRate is the probability in [0, 1] of sampling another exchanger.
+	//
+	// Set by [NewFastestExchanger] to 0.05.
+	SampleRate float64
+
+	// ObserveRank is an optional hook called after each re-ranking.
+	ObserveRank func(*FastestRankEvent)
+
+	// ObserveSelect is an optional hook called before each exchange.
+	ObserveSelect func(*FastestSelectEvent)
+
+	// best is the index of the best exchanger.
+	best int
+
+	// mu protects best and rankedAt.
+	mu sync.Mutex
+
+	// rankedAt is when we last ranked the exchangers.
+	rankedAt time.Time
+}
+
+var _ Exchanger = &FastestExchanger{}
+
+// NewFastestExchanger creates a new [*FastestExchanger].
+func NewFastestExchanger(exchangers ...Exchanger) *FastestExchanger {
+	return &FastestExchanger{
+		Exchangers:     exchangers,
+		Scores:         NewScoreTracker(),
+		RerankInterval: time.Minute,
+		SampleRate:     0.05,
+	}
+}
+
+// Exchange implements [Exchanger].
+func (fx *FastestExchanger) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	// 1. select the exchanger, re-ranking if needed
+	if len(fx.Exchangers) <= 0 {
+		return nil, ErrNoExchangers
+	}
+	ev := &FastestSelectEvent{Index: fx.Best()}
+	if len(fx.Exchangers) > 1 && rand.Float64() < fx.SampleRate {
+		ev.Index = (ev.Index + 1 + rand.IntN(len(fx.Exchangers)-1)) % len(fx.Exchangers)
+		ev.Sampling = true
+	}
+	if fx.ObserveSelect != nil {
+		fx.ObserveSelect(ev)
+	}
+
+	// 2. perform the exchange and score it
+	//
+	// We do not score the exchanges interrupted by the context being done,
+	// since they do not tell anything about the quality of the exchanger.
+	t0 := time.Now()
+	resp, err := fx.Exchangers[ev.Index].Exchange(ctx, query)
+	if ctx.Err() == nil {
+		fx.Scores.record(ev.Index, t0, err)
+	}
+	return resp, err
+}
+
+// Best returns the index of the best exchanger, re-ranking the exchangers
+// when RerankInterval has elapsed since the previous ranking.
+//
+// This method is safe to call from multiple goroutines.
+func (fx *FastestExchanger) Best() int {
+	// 1. return the current best exchanger unless it is time to re-rank
+	fx.mu.Lock()
+	if !fx.rankedAt.IsZero() && time.Since(fx.rankedAt) < fx.RerankInterval {
+		defer fx.mu.Unlock()
+		return fx.best
+	}
+
+	// 2. re-rank, keeping the first exchanger on ties
+	ev := &FastestRankEvent{Scores: fx.Scores.Scores()}
+	ev.Scores = append(ev.Scores, make([]EndpointScore, max(len(fx.Exchangers)-len(ev.Scores), 0))...)
+	for idx := range fx.Exchangers {
+		if ev.Scores[idx].Better(ev.Scores[ev.Best]) {
+			ev.Best = idx
+		}
+	}
+	fx.best, fx.rankedAt = ev.Best, time.Now()
+	fx.mu.Unlock()
+
+	// 3. observe the ranking outside of the lock
+	if fx.ObserveRank != nil {
+		fx.ObserveRank(ev)
+	}
+	return ev.Best
+}
@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFastestExchanger(t *testing.T) {
+	errFailed := errors.New("mocked failure")
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+
+	t.Run("we route to the fastest exchanger", func(t *testing.T) {
+		first, _, firstCount := newToggleExchanger(errFailed)
+		second, _, secondCount := newToggleExchanger(errFailed)
+		third, _, thirdCount := newToggleExchanger(errFailed)
+		fx := dnsoverhttps.NewFastestExchanger(first, second, third)
+		fx.SampleRate = 0
+		fx.Scores.Record(0, 300*time.Millisecond, nil)
+		fx.Scores.Record(1, 100*time.Millisecond, nil)
+		fx.Scores.Record(2, time.Millisecond, errFailed)
+		var ranks []*dnsoverhttps.FastestRankEvent
+		fx.ObserveRank = func(ev *dnsoverhttps.FastestRankEvent) {
+			ranks = append(ranks, ev)
+		}
+		var selects []*dnsoverhttps.FastestSelectEvent
+		fx.ObserveSelect = func(ev *dnsoverhttps.FastestSelectEvent) {
+			selects = append(selects, ev)
+		}
+
+		for range 3 {
+			_, err := fx.Exchange(context.Background(), query)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, int64(0), firstCount.Load())
+		assert.Equal(t, int64(3), secondCount.Load())
+		assert.Equal(t, int64(0), thirdCount.Load())
+
+		// we rank once per RerankInterval and observe each selection
+		require.Len(t, ranks, 1)
+		assert.Equal(t, 1, ranks[0].Best)
+		require.Len(t, ranks[0].Scores, 3)
+		require.Len(t, selects, 3)
+		for _, ev := range selects {
+			assert.Equal(t, &dnsoverhttps.FastestSelectEvent{Index: 1}, ev)
+		}
+		assert.Equal(t, 4, fx.Scores.Scores()[1].Samples)
+	})
+
+	t.Run("we re-rank as the scores change", func(t *testing.T) {
+		first, firstFailing, _ := newToggleExchanger(errFailed)
+		second, _, _ := newToggleExchanger(errFailed)
+		fx := dnsoverhttps.NewFastestExchanger(first, second)
+		fx.SampleRate = 0
+		fx.RerankInterval = 0
+
+		// the first exchanger fails, which makes the second one the best
+		firstFailing.Store(true)
+		_, err := fx.Exchange(context.Background(), query)
+		require.ErrorIs(t, err, errFailed)
+		assert.Equal(t, 1, fx.Best())
+	})
+
+	t.Run("we sample the other exchangers", func(t *testing.T) {
+		first, _, firstCount := newToggleExchanger(errFailed)
+		second, _, secondCount := newToggleExchanger(errFailed)
+		fx := dnsoverhttps.NewFastestExchanger(first, second)
+		fx.SampleRate = 1
+		var selects []*dnsoverhttps.FastestSelectEvent
+		fx.ObserveSelect = func(ev *dnsoverhttps.FastestSelectEvent) {
+			selects = append(selects, ev)
+		}
+
+		_, err := fx.Exchange(context.Background(), query)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), firstCount.Load())
+		assert.Equal(t, int64(1), secondCount.Load())
+		require.Len(t, selects, 1)
+		assert.Equal(t, &dnsoverhttps.FastestSelectEvent{Index: 1, Sampling: true}, selects[0])
+	})
+
+	t.Run("without exchangers", func(t *testing.T) {
+		fx := dnsoverhttps.NewFastestExchanger()
+		_, err := fx.Exchange(context.Background(), query)
+		require.ErrorIs(t, err, dnsoverhttps.ErrNoExchangers)
+	})
+}
@@ -0,0 +1,216 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// FingerprintReport identifies the provider or CDN hosting a DoH endpoint.
+type FingerprintReport struct {
+	// URL is the server URL.
+	URL string
+
+	// Provider is the provider with the most matching signals (e.g., "cloudflare",
+	// "google", "quad9", "akamai", "fastly", or "cloudfront") or an empty string
+	// when no signal matched.
+	Provider string
+
+	// Evidence contains the signals matching the Provider (e.g., "header:CF-Ray",
+	// "server:cloudflare", or "cert-name:cloudflare-dns.com").
+	Evidence []string
+
+	// Server is the Server response header, if any.
+	Server string
+
+	// CertSubjectOrg contains the organizations of the leaf certificate subject.
+	CertSubjectOrg []string
+
+	// CertIssuerOrg contains the organizations of the leaf certificate issuer.
+	CertIssuerOrg []string
+
+	// CertDNSNames contains the DNS names of the leaf certificate.
+	CertDNSNames []string
+
+	// HTTPProtocol is the response protocol (e.g., "HTTP/2.0").
+	HTTPProtocol string
+
+	// PaddedResponses is true when the response included the EDNS(0)
+	// padding option (RFC 8467).
+	PaddedResponses bool
+
+	// EDNS0UDPSize is the EDNS(0) UDP payload size (RFC 6891) advertised
+	// by the response or zero when the response does not include EDNS(0).
+	EDNS0UDPSize uint16
+
+	// Err is the error that occurred, if any. We classify the provider even when
+	// the DNS response is invalid, as long as we received the HTTP response.
+	Err error
+}
+
+// fingerprintSignature contains the signals identifying a provider.
+type fingerprintSignature struct {
+	// provider is the provider name.
+	provider string
+
+	// headers contains the names of the response headers set by the provider.
+	headers []string
+
+	// servers contains lowercase substrings of the Server header.
+	servers []string
+
+	// certNames contains the suffixes of the certificate DNS names.
+	certNames []string
+
+	// certOrgs contains lowercase substrings of the certificate subject organizations.
+	certOrgs []string
+}
+
+// fingerprintSignatures contains the known provider signatures.
+var fingerprintSignatures = []*fingerprintSignature{
+	{
+		provider:  "cloudflare",
+		headers:   []string{"CF-Ray", "CF-Cache-Status"},
+		servers:   []string{"cloudflare"},
+		certNames: []string{"cloudflare-dns.com", "cloudflare.com"},
+		certOrgs:  []string{"cloudflare"},
+	},
+	{
+		provider:  "google",
+		servers:   []string{"http server (unknown)", "gws", "scaffolding on httpserver2"},
+		certNames: []string{"dns.google", "google.com"},
+		certOrgs:  []string{"google"},
+	},
+	{
+		provider:  "quad9",
+		certNames: []string{"quad9.net"},
+		certOrgs:  []string{"quad9"},
+	},
+	{
+		provider:  "akamai",
+		headers:   []string{"Akamai-GRN", "X-Akamai-Transformed"},
+		servers:   []string{"akamaighost", "akamainetstorage"},
+		certNames: []string{"akamai.net", "akamaiedge.net"},
+		certOrgs:  []string{"akamai"},
+	},
+	{
+		provider: "fastly",
+		headers:  []string{"X-Fastly-Request-ID", "Fastly-Debug-Digest"},
+		certOrgs: []string{"fastly"},
+	},
+	{
+		provider:  "cloudfront",
+		headers:   []string{"X-Amz-Cf-Id", "X-Amz-Cf-Pop"},
+		servers:   []string{"cloudfront"},
+		certNames: []string{"cloudfront.net"},
+		certOrgs:  []string{"amazon"},
+	},
+	{
+		provider:  "nextdns",
+		certNames: []string{"nextdns.io"},
+	},
+	{
+		provider:  "adguard",
+		certNames: []string{"adguard-dns.com", "adguard.com"},
+	},
+}
+
+// Fingerprint sends a query for the QueryName to the server at the given URL
+// and classifies the provider hosting the server using the response headers and
+// the leaf certificate, which is useful when cataloguing resolvers (e.g., to
+// notice that several resolvers share the same CDN). The classification is
+// heuristic, since any server can mimic the signals of a provider and CDNs can
+// front servers run by other operators.
+//
+// We also report the EDNS(0) features of the response, which do not contribute
+// to the classification, since they depend on the resolver software and its
+// configuration rather than on the provider.
+func (p *Prober) Fingerprint(ctx context.Context, URL string) *FingerprintReport {
+	// 1. Build the query message and the request
+	report := &FingerprintReport{URL: URL}
+	httpReq, queryMsg, err := NewRequest(ctx, dnscodec.NewQuery(p.QueryName, dns.TypeA), URL)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+
+	// 2. Perform the round trip and save the HTTP signals
+	httpResp, err := p.Client.Do(httpReq)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+	report.Server = httpResp.Header.Get("Server")
+	report.HTTPProtocol = httpResp.Proto
+	if httpResp.TLS != nil && len(httpResp.TLS.PeerCertificates) > 0 {
+		leaf := httpResp.TLS.PeerCertificates[0]
+		report.CertSubjectOrg = leaf.Subject.Organization
+		report.CertIssuerOrg = leaf.Issuer.Organization
+		report.CertDNSNames = leaf.DNSNames
+	}
+	report.Provider, report.Evidence = classifyProvider(report, httpResp.Header)
+
+	// 3. Inspect the EDNS(0) features of the response, which we only report
+	resp, err := ReadResponse(ctx, httpResp, queryMsg)
+	if err != nil {
+		report.Err = err
+		return report
+	}
+	report.EDNS0UDPSize, report.PaddedResponses = responseEDNS0Features(resp.Response)
+	return report
+}
+
+// classifyProvider returns the provider with the most matching signals, preferring
+// the first signature on ties, along with the matching signals.
+func classifyProvider(report *FingerprintReport, header http.Header) (string, []string) {
+	var (
+		bestProvider string
+		bestEvidence []string
+	)
+	for _, sig := range fingerprintSignatures {
+		evidence := sig.match(report, header)
+		if len(evidence) > len(bestEvidence) {
+			bestProvider, bestEvidence = sig.provider, evidence
+		}
+	}
+	return bestProvider, bestEvidence
+}
+
+// match returns the signals of the signature matching the report and the headers.
+func (sig *fingerprintSignature) match(report *FingerprintReport, header http.Header) []string {
+	var evidence []string
+	for _, name := range sig.headers {
+		if header.Get(name) != "" {
+			evidence = append(evidence, "header:"+name)
+		}
+	}
+	server := strings.ToLower(report.Server)
+	for _, value := range sig.servers {
+		if strings.Contains(server, value) {
+			evidence = append(evidence, "server:"+value)
+		}
+	}
+	for _, suffix := range sig.certNames {
+		for _, name := range report.CertDNSNames {
+			name = strings.TrimPrefix(strings.ToLower(name), "*.")
+			if name == suffix || strings.HasSuffix(name, "."+suffix) {
+				evidence = append(evidence, "cert-name:"+suffix)
+				break
+			}
+		}
+	}
+	for _, value := range sig.certOrgs {
+		for _, org := range report.CertSubjectOrg {
+			if strings.Contains(strings.ToLower(org), value) {
+				evidence = append(evidence, "cert-org:"+value)
+				break
+			}
+		}
+	}
+	return evidence
+}
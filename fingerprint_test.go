@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProberFingerprint(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// headers contains the response headers to set.
+		headers map[string]string
+
+		// status is the OPTIONAL status code to reply with instead of the DNS response.
+		status int
+
+		// wantProvider is the expected provider.
+		wantProvider string
+
+		// wantEvidence contains the expected evidence.
+		wantEvidence []string
+
+		// wantErr indicates whether we expect an error.
+		wantErr bool
+	}
+
+	testCases := []testCase{
+		{
+			name:         "cloudflare",
+			headers:      map[string]string{"Server": "cloudflare", "CF-Ray": "8f1e2d3c4b5a6978-MXP"},
+			wantProvider: "cloudflare",
+			wantEvidence: []string{"header:CF-Ray", "server:cloudflare"},
+		},
+
+		{
+			name:         "cloudfront",
+			headers:      map[string]string{"X-Amz-Cf-Id": "abc", "X-Amz-Cf-Pop": "MXP64-P1", "Via": "1.1 abc.cloudfront.net (CloudFront)"},
+			wantProvider: "cloudfront",
+			wantEvidence: []string{"header:X-Amz-Cf-Id", "header:X-Amz-Cf-Pop"},
+		},
+
+		{
+			name:         "unknown",
+			headers:      map[string]string{"Server": "nginx"},
+			wantProvider: "",
+		},
+
+		{
+			name:         "error response",
+			headers:      map[string]string{"Server": "AkamaiGHost"},
+			status:       http.StatusInternalServerError,
+			wantProvider: "akamai",
+			wantEvidence: []string{"server:akamaighost"},
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			zone := dnsoverhttps.NewStaticZone(mustNewRR(t, "example.com. 300 IN A 93.184.216.34"))
+			handler := dnsoverhttps.NewScriptedHandler(zone.Reply)
+			srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				for key, value := range tt.headers {
+					w.Header().Set(key, value)
+				}
+				if tt.status != 0 {
+					w.WriteHeader(tt.status)
+					return
+				}
+				handler.ServeHTTP(w, r)
+			}))
+			defer srv.Close()
+
+			report := dnsoverhttps.NewProber(srv.Client()).Fingerprint(context.Background(), srv.URL)
+			assert.Equal(t, srv.URL, report.URL)
+			assert.Equal(t, tt.wantProvider, report.Provider)
+			assert.Equal(t, tt.wantEvidence, report.Evidence)
+			assert.Equal(t, tt.headers["Server"], report.Server)
+			assert.Equal(t, []string{"Acme Co"}, report.CertSubjectOrg)
+			assert.Contains(t, report.CertDNSNames, "example.com")
+			if tt.wantErr {
+				require.Error(t, report.Err)
+				return
+			}
+			require.NoError(t, report.Err)
+			assert.True(t, report.PaddedResponses)
+			assert.NotZero(t, report.EDNS0UDPSize)
+		})
+	}
+}
+
+func TestProberFingerprintConnectError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	report := dnsoverhttps.NewProber(http.DefaultClient).Fingerprint(context.Background(), srv.URL)
+	require.Error(t, report.Err)
+	assert.Empty(t, report.Provider)
+}
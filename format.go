@@ -0,0 +1,39 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// FormatResponse renders an [*ExchangeEvent] in a format similar to the
+// output of dig, which is suitable for humans.
+//
+// The output contains the response message, when it can be parsed, followed
+// by a trailer with the query time, the server URL, the start time, and the
+// size of the response. On failure, the trailer also contains the error.
+func FormatResponse(ev *ExchangeEvent) string {
+	var sb strings.Builder
+	if ev.RawResponse != nil {
+		msg := &dns.Msg{}
+		if err := msg.Unpack(ev.RawResponse); err == nil {
+			sb.WriteString(";; ->>HEADER<<- ")
+			sb.WriteString(strings.TrimPrefix(msg.String(), ";; "))
+			sb.WriteString("\n")
+		}
+	}
+	fmt.Fprintf(&sb, ";; Query time: %d msec\n", ev.Duration.Milliseconds())
+	fmt.Fprintf(&sb, ";; SERVER: %s\n", ev.URL)
+	fmt.Fprintf(&sb, ";; WHEN: %s\n", ev.StartTime.Format(time.UnixDate))
+	if ev.RawResponse != nil {
+		fmt.Fprintf(&sb, ";; MSG SIZE  rcvd: %d\n", len(ev.RawResponse))
+	}
+	if ev.Err != nil {
+		fmt.Fprintf(&sb, ";; FAILURE: %s\n", ev.Err.Error())
+	}
+	return sb.String()
+}
@@ -0,0 +1,60 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatResponse(t *testing.T) {
+	t0 := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	t.Run("success", func(t *testing.T) {
+		query := &dns.Msg{}
+		query.SetQuestion("dns.google.", dns.TypeA)
+		rawResp := buildDNSResponse(t, query)
+
+		out := dnsoverhttps.FormatResponse(&dnsoverhttps.ExchangeEvent{
+			URL:         "https://dns.google/dns-query",
+			StartTime:   t0,
+			Duration:    42 * time.Millisecond,
+			RawResponse: rawResp,
+		})
+
+		assert.True(t, strings.HasPrefix(out, ";; ->>HEADER<<- opcode: QUERY, status: NOERROR"))
+		assert.Contains(t, out, ";; QUESTION SECTION:\n;dns.google.\tIN\t A\n")
+		assert.Contains(t, out, "dns.google.\t1\tIN\tA\t8.8.8.8\n")
+		assert.True(t, strings.HasSuffix(out, strings.Join([]string{
+			";; Query time: 42 msec",
+			";; SERVER: https://dns.google/dns-query",
+			";; WHEN: Fri Jan  2 03:04:05 UTC 2026",
+			";; MSG SIZE  rcvd: 54",
+			"",
+		}, "\n")))
+		assert.NotContains(t, out, "FAILURE")
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		out := dnsoverhttps.FormatResponse(&dnsoverhttps.ExchangeEvent{
+			URL:       "https://dns.google/dns-query",
+			StartTime: t0,
+			Duration:  time.Second,
+			Err:       errors.New("mocked error"),
+		})
+
+		assert.Equal(t, strings.Join([]string{
+			";; Query time: 1000 msec",
+			";; SERVER: https://dns.google/dns-query",
+			";; WHEN: Fri Jan  2 03:04:05 UTC 2026",
+			";; FAILURE: mocked error",
+			"",
+		}, "\n"), out)
+	})
+}
@@ -0,0 +1,92 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/quic-go/quic-go/http3"
+)
+
+// ErrUnsupportedScheme indicates that [NewFromURL] does not understand the URL scheme.
+var ErrUnsupportedScheme = errors.New("unsupported URL scheme")
+
+// NewFromURL creates a new [*Transport] and its [Client] from a single string,
+// which allows tools to accept any server specification. We understand:
+//
+//   - "https://" URLs, which use HTTP/2 (with fallback to HTTP/1.1);
+//
+//   - "h3://" and "doh3+https://" URLs, which use HTTP/3 with the
+//     equivalent "https://" URL;
+//
+//   - "sdns://" DoH DNS stamps, which use HTTP/2 with the stamp hostname
+//     and path, connect to the stamp address when present, and require
+//     a certificate of the verified chain matching the stamp hashes when
+//     present, after calling the VerifyConnection of the TLS config, if any.
+//
+// The OPTIONAL TLS config (e.g., to set RootCAs) is cloned. When it is
+// nil, we use the default TLS config.
+func NewFromURL(rawURL string, config *tls.Config) (*Transport, error) {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	scheme, rest, found := strings.Cut(rawURL, "://")
+	if !found {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedScheme, rawURL)
+	}
+	switch strings.ToLower(scheme) {
+	case "https":
+		return NewTransport(NewTLSClient(config), rawURL), nil
+
+	case "h3", "doh3+https":
+		client := &http.Client{Transport: &http3.Transport{TLSClientConfig: config.Clone()}}
+		return NewTransport(client, "https://"+rest), nil
+
+	case "sdns":
+		return newFromDoHStamp(rawURL, config)
+
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedScheme, scheme)
+	}
+}
+
+// newFromDoHStamp implements [NewFromURL] for DoH DNS stamps.
+func newFromDoHStamp(rawStamp string, config *tls.Config) (*Transport, error) {
+	// 1. parse the stamp
+	stamp, err := parseDoHStamp(rawStamp)
+	if err != nil {
+		return nil, err
+	}
+	URL := (&url.URL{Scheme: "https", Host: stamp.hostname, Path: stamp.path}).String()
+
+	// 2. pin the certificates, if needed, preserving the caller's verification
+	if len(stamp.hashes) > 0 {
+		config = config.Clone()
+		verifyConnection := config.VerifyConnection
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if verifyConnection != nil {
+				if err := verifyConnection(state); err != nil {
+					return err
+				}
+			}
+			return stamp.verifyHashes(state)
+		}
+	}
+	client := NewTLSClient(config)
+
+	// 3. connect to the stamp address, if needed
+	if addr := stamp.dialAddr(); addr != "" {
+		dialer := &net.Dialer{}
+		client.Transport.(*http.Transport).DialContext = func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+	}
+	return NewTransport(client, URL), nil
+}
@@ -0,0 +1,258 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDoHStamp returns an "sdns://" DoH DNS stamp with the given fields.
+func newDoHStamp(addr string, hashes [][]byte, hostname, path string) string {
+	data := []byte{0x02, 0, 0, 0, 0, 0, 0, 0, 0}
+	data = append(data, byte(len(addr)))
+	data = append(data, addr...)
+	if len(hashes) <= 0 {
+		data = append(data, 0)
+	}
+	for idx, hash := range hashes {
+		length := byte(len(hash))
+		if idx < len(hashes)-1 {
+			length |= 0x80
+		}
+		data = append(data, length)
+		data = append(data, hash...)
+	}
+	data = append(data, byte(len(hostname)))
+	data = append(data, hostname...)
+	data = append(data, byte(len(path)))
+	data = append(data, path...)
+	return "sdns://" + base64.RawURLEncoding.EncodeToString(data)
+}
+
+func TestNewFromURL(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// rawURL is the URL to parse.
+		rawURL string
+
+		// wantURL is the expected Transport URL.
+		wantURL string
+
+		// wantH3 indicates whether we expect an HTTP/3 client.
+		wantH3 bool
+
+		// wantErr is the expected error (nil on success).
+		wantErr error
+	}
+
+	testCases := []testCase{
+		{
+			name:    "https",
+			rawURL:  "https://dns.google/dns-query",
+			wantURL: "https://dns.google/dns-query",
+		},
+
+		{
+			name:    "h3",
+			rawURL:  "h3://dns.google/dns-query",
+			wantURL: "https://dns.google/dns-query",
+			wantH3:  true,
+		},
+
+		{
+			name:    "doh3+https",
+			rawURL:  "doh3+https://dns.google/dns-query",
+			wantURL: "https://dns.google/dns-query",
+			wantH3:  true,
+		},
+
+		{
+			name:    "sdns",
+			rawURL:  newDoHStamp("8.8.8.8", nil, "dns.google", "/dns-query"),
+			wantURL: "https://dns.google/dns-query",
+		},
+
+		{
+			name:    "sdns for DoT",
+			rawURL:  "sdns://AwAAAAAAAAAAAAA",
+			wantErr: dnsoverhttps.ErrInvalidStamp,
+		},
+
+		{
+			name:    "sdns without hostname",
+			rawURL:  newDoHStamp("8.8.8.8", nil, "", "/dns-query"),
+			wantErr: dnsoverhttps.ErrInvalidStamp,
+		},
+
+		{
+			name:    "truncated sdns",
+			rawURL:  newDoHStamp("8.8.8.8", nil, "dns.google", "/dns-query")[:24],
+			wantErr: dnsoverhttps.ErrInvalidStamp,
+		},
+
+		{
+			name:    "sdns with invalid base64",
+			rawURL:  "sdns://!!!",
+			wantErr: dnsoverhttps.ErrInvalidStamp,
+		},
+
+		{
+			name:    "http",
+			rawURL:  "http://dns.google/dns-query",
+			wantErr: dnsoverhttps.ErrUnsupportedScheme,
+		},
+
+		{
+			name:    "no scheme",
+			rawURL:  "dns.google",
+			wantErr: dnsoverhttps.ErrUnsupportedScheme,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			dt, err := dnsoverhttps.NewFromURL(tt.rawURL, nil)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantURL, dt.URL)
+			_, isH3 := dt.Client.(*http.Client).Transport.(*http3.Transport)
+			assert.Equal(t, tt.wantH3, isH3)
+		})
+	}
+}
+
+// newUnrelatedCertificate returns a self-signed certificate that
+// does not belong to any chain the tests trust.
+func newUnrelatedCertificate(t *testing.T) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "unrelated.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(raw)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestNewFromURLDoHStamp(t *testing.T) {
+	srv := httptest.NewUnstartedServer(dnsHandler(t))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	// the server appends an unrelated certificate to the chain it presents
+	unrelated := newUnrelatedCertificate(t)
+	chain := srv.TLS.Certificates[0].Certificate
+	srv.TLS.Certificates[0].Certificate = append(slices.Clip(chain), unrelated.Raw)
+
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	digest := sha256.Sum256(srv.Certificate().RawTBSCertificate)
+	unrelatedDigest := sha256.Sum256(unrelated.RawTBSCertificate)
+	errRejected := errors.New("rejected by the caller")
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// hashes contains the stamp hashes.
+		hashes [][]byte
+
+		// verifyConnection is the OPTIONAL caller's VerifyConnection.
+		verifyConnection func(tls.ConnectionState) error
+
+		// wantErr is the expected error, if any.
+		wantErr error
+	}
+
+	testCases := []testCase{
+		{name: "without hashes"},
+
+		{name: "with matching hash", hashes: [][]byte{make([]byte, 32), digest[:]}},
+
+		{
+			name:    "with mismatching hash",
+			hashes:  [][]byte{make([]byte, 32)},
+			wantErr: errors.New("no verified certificate matches the DNS stamp hashes"),
+		},
+
+		{
+			name:    "with hash of the unverified appended certificate",
+			hashes:  [][]byte{unrelatedDigest[:]},
+			wantErr: errors.New("no verified certificate matches the DNS stamp hashes"),
+		},
+
+		{
+			name:             "with caller's VerifyConnection accepting",
+			hashes:           [][]byte{digest[:]},
+			verifyConnection: func(tls.ConnectionState) error { return nil },
+		},
+
+		{
+			name:             "with caller's VerifyConnection rejecting",
+			hashes:           [][]byte{digest[:]},
+			verifyConnection: func(tls.ConnectionState) error { return errRejected },
+			wantErr:          errRejected,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &tls.Config{RootCAs: pool, VerifyConnection: tt.verifyConnection}
+
+			// the hostname does not resolve, so we must connect to the stamp address
+			stamp := newDoHStamp("127.0.0.1", tt.hashes, "example.com:"+port, "/dns-query")
+			dt, err := dnsoverhttps.NewFromURL(stamp, config)
+			require.NoError(t, err)
+			assert.Equal(t, "https://example.com:"+port+"/dns-query", dt.URL)
+
+			var event *dnsoverhttps.ExchangeEvent
+			dt.ObserveExchange = func(ev *dnsoverhttps.ExchangeEvent) {
+				event = ev
+			}
+			_, err = dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+			if tt.wantErr != nil {
+				require.ErrorContains(t, err, tt.wantErr.Error())
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, event)
+			assert.Equal(t, "HTTP/2.0", event.HTTPProtocol)
+		})
+	}
+}
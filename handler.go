@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"net/netip"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ForwardingHandler is a [dns.Handler] forwarding queries to a DoH server,
+// which allows to mount DoH as the upstream of [*dns.Server] and CoreDNS-like
+// servers that dispatch queries to [dns.Handler] implementations.
+//
+// Construct using [NewForwardingHandler].
+type ForwardingHandler struct {
+	// Transport is the [*Transport] to use.
+	//
+	// Set by [NewForwardingHandler] to the user-provided value.
+	Transport *Transport
+
+	// Timeout bounds each forwarded exchange. Zero or negative
+	// means that exchanges have no timeout.
+	//
+	// Set by [NewForwardingHandler] to 5 seconds.
+	Timeout time.Duration
+
+	// ObserveQuery is an OPTIONAL hook called with a [*QueryLogEntry] after
+	// we reply to each query, which allows operators to debug the forwarder.
+	// The ClientIPPolicy and DropQueryNames fields control which data about
+	// clients reaches the logs.
+	ObserveQuery func(*QueryLogEntry)
+
+	// ClientIPPolicy controls how ObserveQuery logs client IP addresses.
+	//
+	// Set by [NewForwardingHandler] to [ClientIPTruncate].
+	ClientIPPolicy ClientIPPolicy
+
+	// ClientIPSalt is the OPTIONAL salt used by [ClientIPHash].
+	ClientIPSalt []byte
+
+	// DropQueryNames OPTIONALLY omits the query names from ObserveQuery.
+	DropQueryNames bool
+}
+
+var _ dns.Handler = &ForwardingHandler{}
+
+// NewForwardingHandler creates a new [*ForwardingHandler].
+func NewForwardingHandler(dt *Transport) *ForwardingHandler {
+	return &ForwardingHandler{Transport: dt, Timeout: 5 * time.Second, ClientIPPolicy: ClientIPTruncate}
+}
+
+// ServeDNS implements [dns.Handler].
+//
+// We forward the query using [*Transport.ExchangeMsg] with a zero ID, as
+// recommended by RFC 8484, restore the client ID, and truncate responses
+// exceeding the UDP message size. On failure, we reply with SERVFAIL.
+func (h *ForwardingHandler) ServeDNS(w dns.ResponseWriter, req *dns.Msg) {
+	// 1. forward the query using a zero ID
+	t0 := time.Now()
+	ctx, cancel := context.WithCancel(context.Background())
+	if h.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, h.Timeout)
+	}
+	defer cancel()
+	query := req.Copy()
+	query.Id = 0
+	resp, err := h.Transport.ExchangeMsg(ctx, query)
+
+	// 2. reply with SERVFAIL on failure
+	if err != nil {
+		resp = &dns.Msg{}
+		resp.SetRcode(req, dns.RcodeServerFailure)
+		_ = w.WriteMsg(resp)
+		h.observeQuery(w, req, resp, t0, err)
+		return
+	}
+
+	// 3. restore the ID and truncate for UDP, if needed
+	resp.Id = req.Id
+	if w.RemoteAddr() != nil && w.RemoteAddr().Network() == "udp" {
+		size := dns.MinMsgSize
+		if opt := req.IsEdns0(); opt != nil {
+			size = max(int(opt.UDPSize()), dns.MinMsgSize)
+		}
+		resp.Truncate(size)
+	}
+	_ = w.WriteMsg(resp)
+	h.observeQuery(w, req, resp, t0, nil)
+}
+
+// observeQuery calls ObserveQuery, if not nil, applying the privacy controls.
+func (h *ForwardingHandler) observeQuery(w dns.ResponseWriter, req, resp *dns.Msg, t0 time.Time, err error) {
+	if h.ObserveQuery == nil {
+		return
+	}
+	entry := &QueryLogEntry{
+		Time:     t0,
+		Rcode:    dns.RcodeToString[resp.Rcode],
+		Duration: time.Since(t0),
+		Err:      err,
+	}
+	if w.RemoteAddr() != nil {
+		addrport, _ := netip.ParseAddrPort(w.RemoteAddr().String())
+		entry.ClientIP = h.ClientIPPolicy.apply(addrport.Addr(), h.ClientIPSalt)
+	}
+	if len(req.Question) > 0 {
+		entry.QueryType = dns.TypeToString[req.Question[0].Qtype]
+		if !h.DropQueryNames {
+			entry.QueryName = req.Question[0].Name
+		}
+	}
+	h.ObserveQuery(entry)
+}
@@ -0,0 +1,195 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startUDPServer starts a [*dns.Server] using handler and returns its address.
+func startUDPServer(t *testing.T, handler dns.Handler) string {
+	pconn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	started := make(chan struct{})
+	server := &dns.Server{PacketConn: pconn, Handler: handler, NotifyStartedFunc: func() { close(started) }}
+	go func() {
+		_ = server.ActivateAndServe()
+	}()
+	<-started
+	t.Cleanup(func() { _ = server.Shutdown() })
+	return pconn.LocalAddr().String()
+}
+
+func TestForwardingHandler(t *testing.T) {
+	var gotID uint16
+	scripted := dnsoverhttps.NewScriptedHandler(func(query *dns.Msg) *dns.Msg {
+		gotID = query.Id
+		resp := &dns.Msg{}
+		require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+		return resp
+	})
+	scripted.Script("dns.google", dnsoverhttps.ScriptStep{StatusCode: http.StatusBadGateway})
+	srv := httptest.NewServer(scripted)
+	defer srv.Close()
+
+	handler := dnsoverhttps.NewForwardingHandler(dnsoverhttps.NewTransport(srv.Client(), srv.URL))
+	addr := startUDPServer(t, handler)
+
+	query := &dns.Msg{}
+	query.SetQuestion("dns.google.", dns.TypeA)
+	client := &dns.Client{}
+
+	// the first query fails upstream
+	resp, _, err := client.Exchange(query, addr)
+	require.NoError(t, err)
+	assert.Equal(t, dns.RcodeServerFailure, resp.Rcode)
+	assert.Equal(t, query.Id, resp.Id)
+
+	// the second query succeeds
+	resp, _, err = client.Exchange(query, addr)
+	require.NoError(t, err)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.Equal(t, query.Id, resp.Id)
+	assert.NotEmpty(t, resp.Answer)
+	assert.Equal(t, uint16(0), gotID)
+}
+
+func TestForwardingHandlerZeroTimeout(t *testing.T) {
+	srv := httptest.NewServer(dnsHandler(t))
+	defer srv.Close()
+
+	handler := dnsoverhttps.NewForwardingHandler(dnsoverhttps.NewTransport(srv.Client(), srv.URL))
+	handler.Timeout = 0
+	addr := startUDPServer(t, handler)
+
+	query := &dns.Msg{}
+	query.SetQuestion("dns.google.", dns.TypeA)
+	resp, _, err := (&dns.Client{}).Exchange(query, addr)
+	require.NoError(t, err)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+}
+
+func TestForwardingHandlerObserveQuery(t *testing.T) {
+	salt := []byte("salt")
+	digest := sha256.Sum256(append(append([]byte{}, salt...), "127.0.0.1"...))
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// policy is the ClientIPPolicy.
+		policy dnsoverhttps.ClientIPPolicy
+
+		// dropNames is the DropQueryNames value.
+		dropNames bool
+
+		// wantClientIP is the expected ClientIP.
+		wantClientIP string
+
+		// wantQueryName is the expected QueryName.
+		wantQueryName string
+	}
+
+	testCases := []testCase{
+		{
+			name:          "keep",
+			policy:        dnsoverhttps.ClientIPKeep,
+			wantClientIP:  "127.0.0.1",
+			wantQueryName: "dns.google.",
+		},
+
+		{
+			name:          "truncate",
+			policy:        dnsoverhttps.ClientIPTruncate,
+			wantClientIP:  "127.0.0.0/24",
+			wantQueryName: "dns.google.",
+		},
+
+		{
+			name:          "hash",
+			policy:        dnsoverhttps.ClientIPHash,
+			wantClientIP:  hex.EncodeToString(digest[:]),
+			wantQueryName: "dns.google.",
+		},
+
+		{
+			name:      "drop everything",
+			policy:    dnsoverhttps.ClientIPDrop,
+			dropNames: true,
+		},
+	}
+
+	srv := httptest.NewServer(dnsoverhttps.NewScriptedHandler(func(query *dns.Msg) *dns.Msg {
+		resp := &dns.Msg{}
+		require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+		return resp
+	}))
+	defer srv.Close()
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := make(chan *dnsoverhttps.QueryLogEntry, 1)
+			handler := dnsoverhttps.NewForwardingHandler(dnsoverhttps.NewTransport(srv.Client(), srv.URL))
+			handler.ClientIPPolicy = tt.policy
+			handler.ClientIPSalt = salt
+			handler.DropQueryNames = tt.dropNames
+			handler.ObserveQuery = func(entry *dnsoverhttps.QueryLogEntry) {
+				entries <- entry
+			}
+			addr := startUDPServer(t, handler)
+
+			query := &dns.Msg{}
+			query.SetQuestion("dns.google.", dns.TypeA)
+			_, _, err := (&dns.Client{}).Exchange(query, addr)
+			require.NoError(t, err)
+
+			entry := <-entries
+			assert.Equal(t, tt.wantClientIP, entry.ClientIP)
+			assert.Equal(t, tt.wantQueryName, entry.QueryName)
+			assert.Equal(t, "A", entry.QueryType)
+			assert.Equal(t, "NOERROR", entry.Rcode)
+			assert.False(t, entry.Time.IsZero())
+			assert.NoError(t, entry.Err)
+		})
+	}
+}
+
+func TestForwardingHandlerObserveQueryFailure(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	entries := make(chan *dnsoverhttps.QueryLogEntry, 1)
+	handler := dnsoverhttps.NewForwardingHandler(dnsoverhttps.NewTransport(srv.Client(), srv.URL))
+	handler.ObserveQuery = func(entry *dnsoverhttps.QueryLogEntry) {
+		entries <- entry
+	}
+	addr := startUDPServer(t, handler)
+
+	query := &dns.Msg{}
+	query.SetQuestion("dns.google.", dns.TypeA)
+	_, _, err := (&dns.Client{}).Exchange(query, addr)
+	require.NoError(t, err)
+
+	entry := <-entries
+	assert.Equal(t, "127.0.0.0/24", entry.ClientIP)
+	assert.Equal(t, "SERVFAIL", entry.Rcode)
+	assert.Error(t, entry.Err)
+}
+
+func TestClientIPPolicyString(t *testing.T) {
+	assert.Equal(t, "keep", dnsoverhttps.ClientIPKeep.String())
+	assert.Equal(t, "truncate", dnsoverhttps.ClientIPTruncate.String())
+	assert.Equal(t, "hash", dnsoverhttps.ClientIPHash.String())
+	assert.Equal(t, "drop", dnsoverhttps.ClientIPDrop.String())
+	assert.Equal(t, "ClientIPPolicy(7)", dnsoverhttps.ClientIPPolicy(7).String())
+}
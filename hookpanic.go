@@ -0,0 +1,45 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// HookPanicError describes a panic inside an observer hook.
+//
+// The [*Transport] recovers from panics in ObserveRawQuery, ObserveRawResponse,
+// and ObserveExchange and passes this error to [Transport.ObserveHookPanic], so
+// that a buggy observer does not take down the exchange.
+type HookPanicError struct {
+	// Hook is the name of the hook that panicked (e.g., "ObserveExchange").
+	Hook string
+
+	// Value is the value passed to panic.
+	Value any
+
+	// Stack is the stack trace of the goroutine that panicked.
+	Stack []byte
+}
+
+var _ error = &HookPanicError{}
+
+// Error implements error.
+func (e *HookPanicError) Error() string {
+	return fmt.Sprintf("panic in %s hook: %v", e.Hook, e.Value)
+}
+
+// callHook calls hook with value and reports panics to [Transport.ObserveHookPanic]
+// or drops them when such a hook is nil. A panic inside ObserveHookPanic itself
+// is not recovered, since there would be no one left to report it to.
+func callHook[T any](dt *Transport, name string, hook func(T), value T) {
+	defer func() {
+		if r := recover(); r != nil {
+			if dt.ObserveHookPanic != nil {
+				dt.ObserveHookPanic(&HookPanicError{Hook: name, Value: r, Stack: debug.Stack()})
+			}
+		}
+	}()
+	hook(value)
+}
@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportHookPanicIsolation(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// report indicates whether to set ObserveHookPanic.
+		report bool
+	}
+
+	testCases := []testCase{
+		{
+			name:   "with ObserveHookPanic",
+			report: true,
+		},
+
+		{
+			name:   "without ObserveHookPanic",
+			report: false,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+				resp := &dns.Msg{}
+				require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+				return resp
+			})
+			defer srv.Close()
+
+			dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+			dt.ObserveRawQuery = func([]byte) { panic("raw query") }
+			dt.ObserveRawResponse = func([]byte) { panic("raw response") }
+			dt.ObserveExchange = func(*dnsoverhttps.ExchangeEvent) { panic("exchange") }
+			var panics []*dnsoverhttps.HookPanicError
+			if tt.report {
+				dt.ObserveHookPanic = func(err *dnsoverhttps.HookPanicError) {
+					panics = append(panics, err)
+				}
+			}
+
+			resp, err := dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+			require.NoError(t, err)
+			require.NotNil(t, resp)
+
+			if !tt.report {
+				assert.Empty(t, panics)
+				return
+			}
+			require.Len(t, panics, 3)
+			assert.Equal(t, "ObserveRawQuery", panics[0].Hook)
+			assert.Equal(t, "ObserveRawResponse", panics[1].Hook)
+			assert.Equal(t, "ObserveExchange", panics[2].Hook)
+			assert.Equal(t, "panic in ObserveExchange hook: exchange", panics[2].Error())
+			assert.NotEmpty(t, panics[2].Stack)
+		})
+	}
+}
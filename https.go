@@ -10,7 +10,12 @@ package dnsoverhttps
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"net/http"
+	"net/netip"
+	"runtime/pprof"
+	"runtime/trace"
+	"time"
 
 	"github.com/bassosimone/dnscodec"
 	"github.com/bassosimone/iox"
@@ -36,11 +41,114 @@ type Transport struct {
 	// Set by [NewTransport] to the user-provided value.
 	URL string
 
+	// AcceptEncoding is the OPTIONAL Accept-Encoding header value.
+	//
+	// When empty, the [Client] decides. For example, [*http.Client] asks for
+	// gzip and transparently decompresses the body. Setting "identity" asks
+	// for an uncompressed body. Setting any value also disables transparent
+	// decompression, therefore a compressed body fails to parse.
+	//
+	// The [*ExchangeEvent] ContentEncoding field records the encoding used
+	// by the server, which allows to measure whether servers compress.
+	AcceptEncoding string
+
+	// TolerateIDMismatch OPTIONALLY accepts responses whose ID differs
+	// from the query ID, which some servers rewrite. The [*ExchangeEvent]
+	// IDMismatch field records when this happens. Without this option,
+	// such responses fail with [dnscodec.ErrInvalidResponse].
+	TolerateIDMismatch bool
+
+	// EDNS0Options contains OPTIONAL additional EDNS(0) options to include
+	// in each query besides padding and DNSSEC OK, which allows to test
+	// experimental options. Use [ResponseEDNS0Options] to read the options
+	// included in the response.
+	EDNS0Options []dns.EDNS0
+
+	// CheckingDisabled OPTIONALLY sets the CD flag in each query, which asks
+	// the resolver not to perform DNSSEC validation (RFC 4035).
+	//
+	// Comparing the answers obtained with and without this flag allows to
+	// probe the DNSSEC-failure behavior of resolvers. To vary the flags per
+	// query, use distinct [*Transport] sharing the same [Client].
+	CheckingDisabled bool
+
+	// AuthenticatedData OPTIONALLY sets the AD flag in each query, which
+	// signals that we understand the AD flag in responses (RFC 6840).
+	AuthenticatedData bool
+
+	// NoRecursion OPTIONALLY clears the RD flag in each query, which asks
+	// the resolver to only answer using its cache or authoritative data.
+	NoRecursion bool
+
+	// ResponseBodyTimeout OPTIONALLY bounds reading the response body once
+	// we have received the response headers. When it expires, the exchange
+	// fails with [ErrResponseBodyTimeout]. Use [*TimeoutPolicy] to bound the
+	// phases before receiving the response headers.
+	ResponseBodyTimeout time.Duration
+
+	// Jitter is an OPTIONAL hook returning the delay to wait before each exchange
+	// (e.g., [UniformJitter] or [ExponentialJitter]), which allows to build more
+	// realistic measurement schedules without pacing each call. We record the
+	// delay into the ExchangeEvent JitterDelay and the StartTime is when the
+	// delay expired. A done context interrupts the delay.
+	Jitter func() time.Duration
+
+	// TransformQuery is an OPTIONAL hook called with the query message after
+	// the standard mutations and before serialization, which allows experiments
+	// to tweak header bits, add options, or introduce malformations. Note that
+	// we do not fix the padding after calling this hook. When this hook returns
+	// an error, the exchange fails with such an error.
+	TransformQuery func(*dns.Msg) error
+
+	// TransformResponse is an OPTIONAL hook called with the unpacked response
+	// message before validation, which allows to implement custom validation
+	// policies, to extract fields the standard validation discards, and to
+	// modify the response. When this hook returns an error, the exchange
+	// fails with such an error.
+	TransformResponse func(*dns.Msg) error
+
+	// BogonPrefixes OPTIONALLY contains the prefixes used to annotate
+	// the [AnomalyBogonAnswer] anomaly (see [FindBogons]). When nil, we
+	// use [DefaultBogonPrefixes]. Use an empty slice to disable the check.
+	BogonPrefixes []netip.Prefix
+
+	// BlockpageMatcher is the OPTIONAL [AddrMatcher] used to annotate the
+	// [AnomalyBlockpageAnswer] anomaly (see [FindBlockpages]) using, e.g.,
+	// an [*AddrList] containing user-provided blockpage or sinkhole addresses.
+	BlockpageMatcher AddrMatcher
+
+	// TTLAnalyzer is the OPTIONAL [*TTLAnalyzer] used to annotate TTL
+	// anomalies (e.g., [AnomalyZeroTTL]).
+	TTLAnalyzer *TTLAnalyzer
+
+	// Method is the OPTIONAL [RequestMethod] to use, which also applies
+	// to [*Transport.ExchangeRaw]. The zero value is [RequestMethodPOST].
+	Method RequestMethod
+
+	// MaxGETURLLength is the OPTIONAL URL length budget for [RequestMethodAuto].
+	// When zero, we use [DefaultMaxGETURLLength].
+	MaxGETURLLength int
+
+	// ProfileLabels OPTIONALLY attaches the "dnsoverhttps.url" and
+	// "dnsoverhttps.qtype" pprof labels to the goroutine running each
+	// exchange, which allows to break down CPU and goroutine profiles
+	// by server and query type. See [pprof.Do].
+	ProfileLabels bool
+
 	// ObserveRawQuery is an optional hook called with a copy of the raw DNS query.
 	ObserveRawQuery func([]byte)
 
 	// ObserveRawResponse is an optional hook called with a copy of the raw DNS response.
 	ObserveRawResponse func([]byte)
+
+	// ObserveExchange is an optional hook called with an [*ExchangeEvent]
+	// describing each exchange once it has completed.
+	ObserveExchange func(*ExchangeEvent)
+
+	// ObserveHookPanic is an optional hook called with a [*HookPanicError] when
+	// any of the above Observe hooks panics. We recover from such panics, so they
+	// do not fail the exchange, and drop them when this hook is nil.
+	ObserveHookPanic func(*HookPanicError)
 }
 
 // NewTransport creates a new [*Transport].
@@ -60,6 +168,13 @@ func NewRequest(ctx context.Context, query *dnscodec.Query, URL string) (*http.R
 // of the raw DNS query after serialization. If observeHook is nil, it is not called.
 func NewRequestWithHook(ctx context.Context,
 	query *dnscodec.Query, URL string, observeHook func([]byte)) (*http.Request, *dns.Msg, error) {
+	return newRequest(ctx, query, URL, observeHook, nil)
+}
+
+// newRequest implements [NewRequestWithHook] and, when mutate is not nil,
+// calls it to modify the query message before serialization.
+func newRequest(ctx context.Context, query *dnscodec.Query,
+	URL string, observeHook func([]byte), mutate func(*dns.Msg) error) (*http.Request, *dns.Msg, error) {
 	// 1. Mutate and serialize the query
 	//
 	// For DoH, by default we leave the query ID to zero, which
@@ -72,6 +187,11 @@ func NewRequestWithHook(ctx context.Context,
 	if err != nil {
 		return nil, nil, err
 	}
+	if mutate != nil {
+		if err := mutate(queryMsg); err != nil {
+			return nil, nil, err
+		}
+	}
 	rawQuery, err := queryMsg.Pack()
 	if err != nil {
 		return nil, nil, err
@@ -90,27 +210,171 @@ func NewRequestWithHook(ctx context.Context,
 }
 
 // Exchange sends a [*dnscodec.Query] and receives a [*dnscodec.Response].
-func (dt *Transport) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+func (dt *Transport) Exchange(ctx context.Context, query *dnscodec.Query) (resp *dnscodec.Response, err error) {
+	if !dt.ProfileLabels {
+		return dt.observedExchange(ctx, query)
+	}
+	labels := pprof.Labels(
+		"dnsoverhttps.url", dt.URL,
+		"dnsoverhttps.qtype", dns.TypeToString[query.Type],
+	)
+	pprof.Do(ctx, labels, func(ctx context.Context) {
+		resp, err = dt.observedExchange(ctx, query)
+	})
+	return
+}
+
+// observedExchange implements [*Transport.Exchange] and calls ObserveExchange.
+//
+// When the execution tracer is enabled, each exchange is a [trace.Task] with
+// the "jitter", "serialize", "roundtrip", "read", and "parse" regions.
+func (dt *Transport) observedExchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	if trace.IsEnabled() {
+		var task *trace.Task
+		ctx, task = trace.NewTask(ctx, "dnsoverhttps.Exchange")
+		defer task.End()
+	}
+	jitter := dt.sleepJitter(ctx)
+	ev := &ExchangeEvent{
+		URL:         dt.URL,
+		QueryName:   query.Name,
+		QueryType:   query.Type,
+		StartTime:   time.Now(),
+		JitterDelay: jitter,
+	}
+	if dt.ObserveExchange == nil {
+		resp, err := dt.exchange(ctx, query, ev)
+		return resp, withContextCause(ctx, err)
+	}
+	ctx, tracer := withExchangeTracer(ctx, ev)
+	resp, err := dt.exchange(ctx, query, ev)
+	err = withContextCause(ctx, err)
+	tracer.finish()
+	ev.Duration = time.Since(ev.StartTime)
+	ev.Err = err
+	ev.Anomalies = dt.anomalies(ev.RawQuery, ev.RawResponse, resp)
+	callHook(dt, "ObserveExchange", dt.ObserveExchange, ev)
+	return resp, err
+}
+
+// anomalies returns the anomalies of an exchange using the [*Transport] settings.
+func (dt *Transport) anomalies(rawQuery, rawResp []byte, resp *dnscodec.Response) []string {
+	return rawAnomalies(rawQuery, rawResp, resp, &anomalyConfig{
+		bogons:     dt.BogonPrefixes,
+		blockpages: dt.BlockpageMatcher,
+		ttls:       dt.TTLAnalyzer,
+	})
+}
+
+// sleepJitter waits for the delay returned by the Jitter hook, if any, and
+// returns the delay. When the context is done, the exchange will fail.
+func (dt *Transport) sleepJitter(ctx context.Context) time.Duration {
+	if dt.Jitter == nil {
+		return 0
+	}
+	delay := max(dt.Jitter(), 0)
+	defer trace.StartRegion(ctx, "jitter").End()
+	sleepContext(ctx, delay)
+	return delay
+}
+
+// exchange implements [*Transport.Exchange] and records into ev.
+func (dt *Transport) exchange(ctx context.Context, query *dnscodec.Query, ev *ExchangeEvent) (*dnscodec.Response, error) {
 	// 1. Prepare for exchanging
-	httpReq, queryMsg, err := NewRequestWithHook(ctx, query, dt.URL, dt.ObserveRawQuery)
+	region := trace.StartRegion(ctx, "serialize")
+	httpReq, queryMsg, err := newRequest(ctx, query, dt.URL, func(rawQuery []byte) {
+		ev.RawQuery = rawQuery
+		if dt.ObserveRawQuery != nil {
+			callHook(dt, "ObserveRawQuery", dt.ObserveRawQuery, bytes.Clone(rawQuery))
+		}
+	}, dt.mutateQuery)
+	if err == nil {
+		httpReq, err = dt.maybeGETRequest(ctx, httpReq, ev.RawQuery)
+	}
+	region.End()
 	if err != nil {
 		return nil, err
 	}
+	ev.HTTPMethod = httpReq.Method
+	if dt.AcceptEncoding != "" {
+		httpReq.Header.Set("Accept-Encoding", dt.AcceptEncoding)
+	}
 
 	// 2. Do the HTTP round trip
+	region = trace.StartRegion(ctx, "roundtrip")
 	httpResp, err := dt.Client.Do(httpReq)
+	region.End()
 	if err != nil {
 		return nil, err
 	}
+	ev.HTTPProtocol = httpResp.Proto
+	ev.Insecure = httpResp.TLS == nil
+	ev.TLS = httpResp.TLS
+	ev.AltSvc = httpResp.Header.Get("Alt-Svc")
+	recordCacheHeaders(ev, httpResp.Header)
+	ev.ContentEncoding = httpResp.Header.Get("Content-Encoding")
+	if httpResp.Uncompressed {
+		ev.ContentEncoding = "gzip"
+	}
 
-	// 3. Parse the results
-	return ReadResponseWithHook(ctx, httpResp, queryMsg, dt.ObserveRawResponse)
+	// 3. Bound the time to read the body, if needed
+	bodyCtx := ctx
+	if dt.ResponseBodyTimeout > 0 {
+		var cancel context.CancelFunc
+		bodyCtx, cancel = context.WithTimeout(ctx, dt.ResponseBodyTimeout)
+		defer cancel()
+	}
+
+	// 4. Parse the results
+	//
+	// - The hook runs before validation, so it can adapt the query ID
+	//
+	// - Distinguish the body timeout from the parent context expiring
+	resp, err := readResponse(bodyCtx, httpResp, queryMsg, func(rawResp []byte) {
+		ev.RawResponse = rawResp
+		if len(rawResp) >= 2 {
+			if id := binary.BigEndian.Uint16(rawResp); id != queryMsg.Id {
+				ev.IDMismatch = true
+				if dt.TolerateIDMismatch {
+					queryMsg.Id = id
+				}
+			}
+		}
+		if dt.ObserveRawResponse != nil {
+			callHook(dt, "ObserveRawResponse", dt.ObserveRawResponse, bytes.Clone(rawResp))
+		}
+	}, dt.TransformResponse)
+	if err != nil && bodyCtx.Err() != nil && ctx.Err() == nil {
+		return nil, ErrResponseBodyTimeout
+	}
+	return resp, err
+}
+
+// mutateQuery applies the [*Transport] settings to the query message, fixes
+// the padding, and finally calls TransformQuery, if not nil.
+func (dt *Transport) mutateQuery(queryMsg *dns.Msg) error {
+	queryMsg.CheckingDisabled = dt.CheckingDisabled
+	queryMsg.AuthenticatedData = dt.AuthenticatedData
+	queryMsg.RecursionDesired = !dt.NoRecursion
+	appendEDNS0Options(queryMsg, dt.EDNS0Options)
+	padQueryMsg(queryMsg)
+	if dt.TransformQuery != nil {
+		return dt.TransformQuery(queryMsg)
+	}
+	return nil
 }
 
 // ReadResponseWithHook is like [ReadResponse] but calls observeHook with a copy
 // of the raw DNS response after reading. If observeHook is nil, it is not called.
 func ReadResponseWithHook(ctx context.Context,
 	httpResp *http.Response, queryMsg *dns.Msg, observeHook func([]byte)) (*dnscodec.Response, error) {
+	return readResponse(ctx, httpResp, queryMsg, observeHook, nil)
+}
+
+// readResponse implements [ReadResponseWithHook] and, when transform is not nil,
+// calls it with the response message before validating the response.
+func readResponse(ctx context.Context, httpResp *http.Response,
+	queryMsg *dns.Msg, observeHook func([]byte), transform func(*dns.Msg) error) (*dnscodec.Response, error) {
 	// 1. make sure we eventually close the body
 	defer httpResp.Body.Close()
 
@@ -123,8 +387,25 @@ func ReadResponseWithHook(ctx context.Context,
 	}
 
 	// 3. Limit response body to a reasonable size and read it
-	//
-	// - When the error is caused by the context, avoid ErrServerMisbehaving
+	region := trace.StartRegion(ctx, "read")
+	rawResp, err := readRawResponse(ctx, httpResp)
+	region.End()
+	if err != nil {
+		return nil, err
+	}
+	if observeHook != nil {
+		observeHook(bytes.Clone(rawResp))
+	}
+
+	// 4. Parse and validate the raw response
+	defer trace.StartRegion(ctx, "parse").End()
+	return parseRawResponse(queryMsg, rawResp, transform)
+}
+
+// readRawResponse reads a limited amount of bytes from the response body.
+//
+// When the error is caused by the context, it avoids ErrServerMisbehaving.
+func readRawResponse(ctx context.Context, httpResp *http.Response) ([]byte, error) {
 	buff := &bytes.Buffer{}
 	lockedWriter := iox.NewLockedWriteCloser(iox.NopWriteCloser(buff))
 	reader := iox.LimitReadCloser(httpResp.Body, dnscodec.QueryMaxResponseSizeTCP)
@@ -134,19 +415,32 @@ func ReadResponseWithHook(ctx context.Context,
 		}
 		return nil, dnscodec.ErrServerMisbehaving
 	}
-	rawResp := buff.Bytes()
-	if observeHook != nil {
-		observeHook(bytes.Clone(rawResp))
-	}
+	return buff.Bytes(), nil
+}
 
-	// 4. Attempt to parse the raw response body
+// parseRawResponse parses and validates a raw response for the given query.
+//
+// When transform is not nil, we call it before validating the response.
+func parseRawResponse(queryMsg *dns.Msg, rawResp []byte, transform func(*dns.Msg) error) (*dnscodec.Response, error) {
+	// 1. Attempt to parse the raw response body
 	respMsg := &dns.Msg{}
 	if err := respMsg.Unpack(rawResp); err != nil {
 		return nil, dnscodec.ErrServerMisbehaving
 	}
+	if transform != nil {
+		if err := transform(respMsg); err != nil {
+			return nil, err
+		}
+	}
 
-	// 5. Parse the response and return the parsing result
-	return dnscodec.ParseResponse(queryMsg, respMsg)
+	// 2. Parse the response and return the parsing result
+	//
+	// - For negative answers, preserve the authority section SOA
+	resp, err := dnscodec.ParseResponse(queryMsg, respMsg)
+	if err != nil {
+		return nil, newNegativeAnswerError(err, respMsg)
+	}
+	return resp, nil
 }
 
 // ReadResponse reads and validates a DNS response as the response for the given query.
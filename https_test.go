@@ -3,11 +3,16 @@
 package dnsoverhttps_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"runtime/pprof"
+	"runtime/trace"
 	"slices"
 	"strings"
 	"sync"
@@ -503,3 +508,422 @@ func TestReadResponseContextCanceled(t *testing.T) {
 	require.Nil(t, parsed)
 	require.True(t, closed.Load())
 }
+
+func TestExchangeObserveExchange(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+			resp := &dns.Msg{}
+			require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+			return resp
+		})
+		defer srv.Close()
+
+		var events []*dnsoverhttps.ExchangeEvent
+		dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+		dt.ObserveExchange = func(ev *dnsoverhttps.ExchangeEvent) {
+			events = append(events, ev)
+		}
+
+		query := dnscodec.NewQuery("dns.google", dns.TypeA)
+		resp, err := dt.Exchange(context.Background(), query)
+		require.NoError(t, err)
+
+		require.Len(t, events, 1)
+		ev := events[0]
+		assert.Equal(t, srv.URL, ev.URL)
+		assert.Equal(t, "dns.google", ev.QueryName)
+		assert.Equal(t, dns.TypeA, ev.QueryType)
+		assert.False(t, ev.StartTime.IsZero())
+		assert.True(t, ev.Duration > 0)
+		assert.NotEmpty(t, ev.RawQuery)
+		rawResp, err := resp.Response.Pack()
+		require.NoError(t, err)
+		assert.Equal(t, rawResp, ev.RawResponse)
+		assert.NoError(t, ev.Err)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		wantErr := errors.New("mocked error")
+		client := &httptestx.FuncClient{DoFunc: func(*http.Request) (*http.Response, error) {
+			return nil, wantErr
+		}}
+
+		var events []*dnsoverhttps.ExchangeEvent
+		dt := dnsoverhttps.NewTransport(client, "https://example.com/dns-query")
+		dt.ObserveExchange = func(ev *dnsoverhttps.ExchangeEvent) {
+			events = append(events, ev)
+		}
+
+		query := dnscodec.NewQuery("dns.google", dns.TypeA)
+		_, err := dt.Exchange(context.Background(), query)
+		require.ErrorIs(t, err, wantErr)
+
+		require.Len(t, events, 1)
+		assert.NotEmpty(t, events[0].RawQuery)
+		assert.Nil(t, events[0].RawResponse)
+		assert.ErrorIs(t, events[0].Err, wantErr)
+	})
+}
+
+func TestExchangeAcceptEncoding(t *testing.T) {
+	// newServer returns a server that compresses responses when the client accepts gzip.
+	newServer := func(t *testing.T, gotAcceptEncoding *string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rawQuery, err := io.ReadAll(r.Body)
+			require.NoError(t, err)
+			queryMsg := &dns.Msg{}
+			require.NoError(t, queryMsg.Unpack(rawQuery))
+			rawResp := buildDNSResponse(t, queryMsg)
+
+			*gotAcceptEncoding = r.Header.Get("Accept-Encoding")
+			w.Header().Set("Content-Type", "application/dns-message")
+			if !strings.Contains(*gotAcceptEncoding, "gzip") {
+				_, err = w.Write(rawResp)
+				require.NoError(t, err)
+				return
+			}
+			w.Header().Set("Content-Encoding", "gzip")
+			gzw := gzip.NewWriter(w)
+			_, err = gzw.Write(rawResp)
+			require.NoError(t, err)
+			require.NoError(t, gzw.Close())
+		}))
+	}
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// acceptEncoding is the Transport AcceptEncoding value.
+		acceptEncoding string
+
+		// wantAcceptEncoding is the Accept-Encoding the server should see.
+		wantAcceptEncoding string
+
+		// wantContentEncoding is the expected ExchangeEvent ContentEncoding.
+		wantContentEncoding string
+
+		// wantErr is the expected error (nil on success).
+		wantErr error
+	}
+
+	testCases := []testCase{
+		{
+			name:                "default transparent decompression",
+			acceptEncoding:      "",
+			wantAcceptEncoding:  "gzip",
+			wantContentEncoding: "gzip",
+		},
+
+		{
+			name:                "forced identity encoding",
+			acceptEncoding:      "identity",
+			wantAcceptEncoding:  "identity",
+			wantContentEncoding: "",
+		},
+
+		{
+			name:                "explicit gzip disables decompression",
+			acceptEncoding:      "gzip",
+			wantAcceptEncoding:  "gzip",
+			wantContentEncoding: "gzip",
+			wantErr:             dnscodec.ErrServerMisbehaving,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotAcceptEncoding string
+			srv := newServer(t, &gotAcceptEncoding)
+			defer srv.Close()
+
+			var ev *dnsoverhttps.ExchangeEvent
+			dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+			dt.AcceptEncoding = tt.acceptEncoding
+			dt.ObserveExchange = func(e *dnsoverhttps.ExchangeEvent) {
+				ev = e
+			}
+
+			query := dnscodec.NewQuery("dns.google", dns.TypeA)
+			_, err := dt.Exchange(context.Background(), query)
+
+			require.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.wantAcceptEncoding, gotAcceptEncoding)
+			require.NotNil(t, ev)
+			assert.Equal(t, tt.wantContentEncoding, ev.ContentEncoding)
+		})
+	}
+}
+
+func TestExchangeTolerateIDMismatch(t *testing.T) {
+	srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+		resp := &dns.Msg{}
+		require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+		resp.Id = 0x1234
+		return resp
+	})
+	defer srv.Close()
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// tolerate is the Transport TolerateIDMismatch value.
+		tolerate bool
+
+		// wantErr is the expected error (nil on success).
+		wantErr error
+	}
+
+	testCases := []testCase{
+		{name: "strict", tolerate: false, wantErr: dnscodec.ErrInvalidResponse},
+		{name: "tolerant", tolerate: true, wantErr: nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var event *dnsoverhttps.ExchangeEvent
+			dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+			dt.TolerateIDMismatch = tc.tolerate
+			dt.ObserveExchange = func(ev *dnsoverhttps.ExchangeEvent) {
+				event = ev
+			}
+
+			query := dnscodec.NewQuery("dns.google", dns.TypeA)
+			resp, err := dt.Exchange(context.Background(), query)
+			require.ErrorIs(t, err, tc.wantErr)
+			if tc.wantErr == nil {
+				require.NotEmpty(t, resp.ValidRRs)
+			}
+			require.NotNil(t, event)
+			assert.True(t, event.IDMismatch)
+			assert.Contains(t, event.Anomalies, dnsoverhttps.AnomalyIDMismatch)
+		})
+	}
+}
+
+func TestExchangeQueryFlags(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// configure configures the transport.
+		configure func(dt *dnsoverhttps.Transport)
+
+		// wantCD is the expected CD flag.
+		wantCD bool
+
+		// wantAD is the expected AD flag.
+		wantAD bool
+
+		// wantRD is the expected RD flag.
+		wantRD bool
+	}
+
+	testCases := []testCase{
+		{
+			name:      "defaults",
+			configure: func(dt *dnsoverhttps.Transport) {},
+			wantRD:    true,
+		},
+
+		{
+			name:      "checking disabled",
+			configure: func(dt *dnsoverhttps.Transport) { dt.CheckingDisabled = true },
+			wantCD:    true,
+			wantRD:    true,
+		},
+
+		{
+			name:      "authenticated data",
+			configure: func(dt *dnsoverhttps.Transport) { dt.AuthenticatedData = true },
+			wantAD:    true,
+			wantRD:    true,
+		},
+
+		{
+			name:      "no recursion",
+			configure: func(dt *dnsoverhttps.Transport) { dt.NoRecursion = true },
+			wantRD:    false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var gotQuery *dns.Msg
+			srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+				gotQuery = query
+				resp := &dns.Msg{}
+				require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+				return resp
+			})
+			defer srv.Close()
+
+			dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+			tc.configure(dt)
+			_, err := dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+			require.NoError(t, err)
+
+			require.NotNil(t, gotQuery)
+			assert.Equal(t, tc.wantCD, gotQuery.CheckingDisabled)
+			assert.Equal(t, tc.wantAD, gotQuery.AuthenticatedData)
+			assert.Equal(t, tc.wantRD, gotQuery.RecursionDesired)
+		})
+	}
+}
+
+func TestExchangeContextCause(t *testing.T) {
+	client := &httptestx.FuncClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		return nil, req.Context().Err()
+	}}
+	dt := dnsoverhttps.NewTransport(client, "https://example.com/dns-query")
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+
+	t.Run("with cause", func(t *testing.T) {
+		cause := errors.New("retry budget exhausted")
+		ctx, cancel := context.WithCancelCause(context.Background())
+		cancel(cause)
+
+		var observed error
+		dt := *dt
+		dt.ObserveExchange = func(ev *dnsoverhttps.ExchangeEvent) {
+			observed = ev.Err
+		}
+
+		_, err := dt.Exchange(ctx, query)
+		require.ErrorIs(t, err, cause)
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, "retry budget exhausted: context canceled", err.Error())
+		assert.Equal(t, err, observed)
+	})
+
+	t.Run("without cause", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		_, err := dt.Exchange(ctx, query)
+		require.Equal(t, context.Canceled, err)
+	})
+}
+
+func TestExchangeTransformQuery(t *testing.T) {
+	t.Run("the transform runs after the standard mutations", func(t *testing.T) {
+		var gotQuery *dns.Msg
+		srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+			gotQuery = query
+			resp := &dns.Msg{}
+			require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+			return resp
+		})
+		defer srv.Close()
+
+		dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+		dt.NoRecursion = true
+		dt.TransformQuery = func(msg *dns.Msg) error {
+			assert.False(t, msg.RecursionDesired)
+			assert.True(t, hasPaddingOption(msg))
+			msg.Zero = true
+			return nil
+		}
+
+		_, err := dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+		require.NoError(t, err)
+		require.NotNil(t, gotQuery)
+		assert.True(t, gotQuery.Zero)
+	})
+
+	t.Run("the transform error fails the exchange", func(t *testing.T) {
+		wantErr := errors.New("mocked error")
+		client := &httptestx.FuncClient{DoFunc: func(*http.Request) (*http.Response, error) {
+			panic("should not be called")
+		}}
+		dt := dnsoverhttps.NewTransport(client, "https://example.com/dns-query")
+		dt.TransformQuery = func(msg *dns.Msg) error {
+			return wantErr
+		}
+
+		_, err := dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+		require.ErrorIs(t, err, wantErr)
+	})
+}
+
+func TestExchangeTransformResponse(t *testing.T) {
+	srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+		resp := &dns.Msg{}
+		require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+		resp.Authoritative = true
+		return resp
+	})
+	defer srv.Close()
+
+	t.Run("the transform sees the response before validation", func(t *testing.T) {
+		dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+		var authoritative bool
+		dt.TransformResponse = func(msg *dns.Msg) error {
+			authoritative = msg.Authoritative
+			msg.Answer = nil // makes the response fail validation
+			return nil
+		}
+
+		_, err := dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+		require.ErrorIs(t, err, dnscodec.ErrNoData)
+		assert.True(t, authoritative)
+	})
+
+	t.Run("the transform error fails the exchange", func(t *testing.T) {
+		wantErr := errors.New("mocked error")
+		dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+		dt.TransformResponse = func(msg *dns.Msg) error {
+			return wantErr
+		}
+
+		_, err := dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+		require.ErrorIs(t, err, wantErr)
+	})
+}
+
+func TestExchangeProfileLabels(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("enabled=%v", enabled), func(t *testing.T) {
+			var gotURL, gotQType string
+			var foundURL, foundQType bool
+			client := &httptestx.FuncClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+				gotURL, foundURL = pprof.Label(req.Context(), "dnsoverhttps.url")
+				gotQType, foundQType = pprof.Label(req.Context(), "dnsoverhttps.qtype")
+				return nil, errors.New("mocked error")
+			}}
+			dt := dnsoverhttps.NewTransport(client, "https://example.com/dns-query")
+			dt.ProfileLabels = enabled
+
+			_, err := dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeAAAA))
+			require.Error(t, err)
+			assert.Equal(t, enabled, foundURL)
+			assert.Equal(t, enabled, foundQType)
+			if enabled {
+				assert.Equal(t, "https://example.com/dns-query", gotURL)
+				assert.Equal(t, "AAAA", gotQType)
+			}
+		})
+	}
+}
+
+func TestExchangeRuntimeTrace(t *testing.T) {
+	srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+		resp := &dns.Msg{}
+		require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+		return resp
+	})
+	defer srv.Close()
+
+	buff := &bytes.Buffer{}
+	require.NoError(t, trace.Start(buff))
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	_, err := dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+	trace.Stop()
+	require.NoError(t, err)
+
+	// the trace contains the task and region names as strings
+	for _, name := range []string{"dnsoverhttps.Exchange", "serialize", "roundtrip", "read", "parse"} {
+		assert.True(t, bytes.Contains(buff.Bytes(), []byte(name)), name)
+	}
+}
@@ -0,0 +1,30 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// UniformJitter returns a [Transport] Jitter hook returning delays uniformly
+// distributed between lo (inclusive) and hi (exclusive). When hi is not
+// greater than lo, the hook always returns lo.
+func UniformJitter(lo, hi time.Duration) func() time.Duration {
+	return func() time.Duration {
+		if hi <= lo {
+			return lo
+		}
+		return lo + rand.N(hi-lo)
+	}
+}
+
+// ExponentialJitter returns a [Transport] Jitter hook returning exponentially
+// distributed delays with the given mean, such that, with sequential exchanges,
+// the exchanges approximately follow a Poisson process, which is a common
+// model of the queries sent by real users.
+func ExponentialJitter(mean time.Duration) func() time.Duration {
+	return func() time.Duration {
+		return time.Duration(rand.ExpFloat64() * float64(mean))
+	}
+}
@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUniformJitter(t *testing.T) {
+	jitter := dnsoverhttps.UniformJitter(10*time.Millisecond, 20*time.Millisecond)
+	for range 100 {
+		delay := jitter()
+		assert.GreaterOrEqual(t, delay, 10*time.Millisecond)
+		assert.Less(t, delay, 20*time.Millisecond)
+	}
+	assert.Equal(t, time.Second, dnsoverhttps.UniformJitter(time.Second, 0)())
+}
+
+func TestExponentialJitter(t *testing.T) {
+	jitter := dnsoverhttps.ExponentialJitter(time.Millisecond)
+	for range 100 {
+		assert.GreaterOrEqual(t, jitter(), time.Duration(0))
+	}
+	assert.Equal(t, time.Duration(0), dnsoverhttps.ExponentialJitter(0)())
+}
+
+func TestTransportJitter(t *testing.T) {
+	srv := httptest.NewServer(dnsHandler(t))
+	defer srv.Close()
+
+	var events []*dnsoverhttps.ExchangeEvent
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	dt.Jitter = func() time.Duration { return 20 * time.Millisecond }
+	dt.ObserveExchange = func(ev *dnsoverhttps.ExchangeEvent) {
+		events = append(events, ev)
+	}
+
+	t0 := time.Now()
+	_, err := dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, 20*time.Millisecond, events[0].JitterDelay)
+	assert.GreaterOrEqual(t, events[0].StartTime.Sub(t0), 20*time.Millisecond)
+	assert.Equal(t, 0.02, dnsoverhttps.NewExchangeRecord(events[0]).Jitter)
+
+	// a done context interrupts the delay and fails the exchange
+	dt.Jitter = func() time.Duration { return time.Hour }
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = dt.Exchange(ctx, dnscodec.NewQuery("dns.google", dns.TypeA))
+	require.ErrorIs(t, err, context.Canceled)
+	require.Len(t, events, 2)
+	assert.Equal(t, time.Hour, events[1].JitterDelay)
+}
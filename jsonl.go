@@ -0,0 +1,35 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import "io"
+
+// JSONLWriter writes each [*ExchangeEvent] as a JSON Lines record.
+//
+// Each line is an [*ExchangeRecord] serialized using [*JSONSink].
+//
+// Set [*JSONLWriter.ObserveExchange] as the [Transport.ObserveExchange] hook.
+//
+// Construct using [NewJSONLWriter].
+type JSONLWriter struct {
+	obs *SinkObserver
+}
+
+// NewJSONLWriter creates a new [*JSONLWriter] writing to w.
+func NewJSONLWriter(w io.Writer) *JSONLWriter {
+	return &JSONLWriter{obs: NewSinkObserver(NewJSONSink(w))}
+}
+
+// ObserveExchange writes the event as a JSON Lines record.
+//
+// This method is safe to call from multiple goroutines.
+func (w *JSONLWriter) ObserveExchange(ev *ExchangeEvent) {
+	w.obs.ObserveExchange(ev)
+}
+
+// Err returns the first error that occurred writing records, if any.
+//
+// After a write error, the [*JSONLWriter] stops writing records.
+func (w *JSONLWriter) Err() error {
+	return w.obs.Err()
+}
@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/bassosimone/iotest"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONLWriter(t *testing.T) {
+	buff := &bytes.Buffer{}
+	w := dnsoverhttps.NewJSONLWriter(buff)
+
+	t0 := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+	w.ObserveExchange(&dnsoverhttps.ExchangeEvent{
+		URL:         "https://example.com/dns-query",
+		QueryName:   "dns.google",
+		QueryType:   dns.TypeA,
+		StartTime:   t0,
+		Duration:    1500 * time.Millisecond,
+		RawQuery:    []byte{0x01, 0x02},
+		RawResponse: []byte{0x03, 0x04},
+	})
+	w.ObserveExchange(&dnsoverhttps.ExchangeEvent{
+		URL:       "https://example.com/dns-query",
+		QueryName: "dns.google",
+		QueryType: dns.TypeAAAA,
+		StartTime: t0,
+		Err:       errors.New("mocked error"),
+	})
+	require.NoError(t, w.Err())
+
+	lines := strings.Split(strings.TrimSpace(buff.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var first map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	assert.Equal(t, map[string]any{
+		"url":                   "https://example.com/dns-query",
+		"query_name":            "dns.google",
+		"query_type":            "A",
+		"t0":                    "2026-01-02T03:04:05.000000006Z",
+		"t":                     1.5,
+		"jitter":                0.0,
+		"raw_query":             "AQI=",
+		"raw_response":          "AwQ=",
+		"http_method":           "",
+		"http_protocol":         "",
+		"insecure":              false,
+		"content_encoding":      "",
+		"id_mismatch":           false,
+		"anomalies":             []any{},
+		"tls":                   nil,
+		"bootstrap_t0":          nil,
+		"bootstrap_t":           nil,
+		"bootstrap_addrs":       []any{},
+		"bootstrap_failure":     nil,
+		"tls_handshake_t0":      nil,
+		"tls_handshake_t":       nil,
+		"tls_handshake_failure": nil,
+		"alt_svc":               "",
+		"http_date":             nil,
+		"http_age":              0.0,
+		"http_cache_control":    "",
+		"http_cache_status":     "",
+		"http_cache_hit":        false,
+		"conn_reused":           false,
+		"conn_was_idle":         false,
+		"conn_idle_time":        float64(0),
+		"failure":               nil,
+	}, first)
+
+	var second map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &second))
+	assert.Equal(t, "AAAA", second["query_type"])
+	assert.Nil(t, second["raw_query"])
+	assert.Nil(t, second["raw_response"])
+	assert.Equal(t, "mocked error", second["failure"])
+}
+
+func TestJSONLWriterWriteError(t *testing.T) {
+	wantErr := errors.New("mocked error")
+	count := 0
+	w := dnsoverhttps.NewJSONLWriter(&iotest.FuncWriter{WriteFunc: func(p []byte) (int, error) {
+		count++
+		return 0, wantErr
+	}})
+
+	ev := &dnsoverhttps.ExchangeEvent{QueryType: dns.TypeA}
+	w.ObserveExchange(ev)
+	w.ObserveExchange(ev)
+
+	require.ErrorIs(t, w.Err(), wantErr)
+	assert.Equal(t, 1, count)
+}
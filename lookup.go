@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// ErrUnsupportedRRType indicates that [Lookup] cannot map the RR type to a query type.
+var ErrUnsupportedRRType = errors.New("unsupported RR type")
+
+// Lookup issues a query for the given name using the query type matching
+// the RR type T (e.g., dns.TypeMX for *dns.MX) and returns the valid RRs
+// of type T, skipping the CNAME chain (unless T is *dns.CNAME).
+//
+// T must be a concrete type: using an interface type such as dns.RR
+// fails with [ErrUnsupportedRRType]. For example:
+//
+//	mxs, err := dnsoverhttps.Lookup[*dns.MX](ctx, dt, "example.com")
+//
+// Returns [dnscodec.ErrNoData] when the answer contains no RRs of type T.
+func Lookup[T dns.RR](ctx context.Context, exchanger Exchanger, name string) ([]T, error) {
+	// 1. map T to the query type
+	qtype, found := lookupType[T]()
+	if !found {
+		return nil, ErrUnsupportedRRType
+	}
+
+	// 2. perform the exchange
+	resp, err := exchanger.Exchange(ctx, dnscodec.NewQuery(name, qtype))
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. extract the typed RRs
+	var out []T
+	for _, rr := range resp.ValidRRs {
+		if typed, ok := rr.(T); ok {
+			out = append(out, typed)
+		}
+	}
+	if len(out) <= 0 {
+		return nil, dnscodec.ErrNoData
+	}
+	return out, nil
+}
+
+// lookupTypes maps the concrete RR types to the matching query types.
+var lookupTypes = func() map[reflect.Type]uint16 {
+	out := make(map[reflect.Type]uint16, len(dns.TypeToRR))
+	for qtype, newRR := range dns.TypeToRR {
+		out[reflect.TypeOf(newRR())] = qtype
+	}
+	return out
+}()
+
+// lookupType returns the query type matching the RR type T, which
+// must be a concrete type (e.g., *dns.MX rather than dns.RR).
+func lookupType[T dns.RR]() (uint16, bool) {
+	qtype, found := lookupTypes[reflect.TypeFor[T]()]
+	return qtype, found
+}
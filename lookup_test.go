@@ -0,0 +1,68 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMXServerExchanger returns an exchanger backed by a server answering
+// MX queries through a CNAME and every other query with NODATA.
+func newMXServerExchanger(t *testing.T) dnsoverhttps.Exchanger {
+	srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+		resp := &dns.Msg{}
+		resp.SetReply(query)
+		resp.RecursionAvailable = true
+		q0 := query.Question[0]
+		if q0.Qtype != dns.TypeMX {
+			return resp
+		}
+		resp.Answer = append(resp.Answer,
+			&dns.CNAME{
+				Hdr:    dns.RR_Header{Name: q0.Name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: 300},
+				Target: "mail.example.com.",
+			},
+			&dns.MX{
+				Hdr:        dns.RR_Header{Name: "mail.example.com.", Rrtype: dns.TypeMX, Class: dns.ClassINET, Ttl: 300},
+				Preference: 10,
+				Mx:         "mx.example.com.",
+			})
+		return resp
+	})
+	t.Cleanup(srv.Close)
+	return dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+}
+
+func TestLookup(t *testing.T) {
+	dt := newMXServerExchanger(t)
+
+	t.Run("typed records skipping the CNAME chain", func(t *testing.T) {
+		mxs, err := dnsoverhttps.Lookup[*dns.MX](context.Background(), dt, "example.com")
+		require.NoError(t, err)
+		require.Len(t, mxs, 1)
+		assert.Equal(t, "mx.example.com.", mxs[0].Mx)
+		assert.Equal(t, uint16(10), mxs[0].Preference)
+	})
+
+	t.Run("no data", func(t *testing.T) {
+		_, err := dnsoverhttps.Lookup[*dns.TXT](context.Background(), dt, "example.com")
+		require.ErrorIs(t, err, dnscodec.ErrNoData)
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		_, err := dnsoverhttps.Lookup[*dns.RFC3597](context.Background(), dt, "example.com")
+		require.ErrorIs(t, err, dnsoverhttps.ErrUnsupportedRRType)
+	})
+
+	t.Run("interface type", func(t *testing.T) {
+		_, err := dnsoverhttps.Lookup[dns.RR](context.Background(), dt, "example.com")
+		require.ErrorIs(t, err, dnsoverhttps.ErrUnsupportedRRType)
+	})
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+)
+
+// RequestMethod controls the HTTP method used by the [*Transport].
+type RequestMethod uint8
+
+const (
+	// RequestMethodPOST always uses POST, which is the default.
+	RequestMethodPOST RequestMethod = iota
+
+	// RequestMethodGET always uses GET with the base64url-encoded
+	// query in the "dns" URL parameter (RFC 8484 Section 4.1).
+	RequestMethodGET
+
+	// RequestMethodAuto uses GET when the resulting URL fits within the
+	// [Transport] MaxGETURLLength budget and POST otherwise, which is
+	// what browsers and some stub resolvers do.
+	RequestMethodAuto
+)
+
+// DefaultMaxGETURLLength is the URL length budget used by [RequestMethodAuto]
+// when the [Transport] MaxGETURLLength field is zero.
+const DefaultMaxGETURLLength = 2048
+
+// String implements [fmt.Stringer].
+func (m RequestMethod) String() string {
+	switch m {
+	case RequestMethodPOST:
+		return "POST"
+	case RequestMethodGET:
+		return "GET"
+	case RequestMethodAuto:
+		return "auto"
+	default:
+		return fmt.Sprintf("RequestMethod(%d)", uint8(m))
+	}
+}
+
+// maybeGETRequest returns a GET request for the raw query if the [RequestMethod]
+// requires so or the POST request otherwise.
+func (dt *Transport) maybeGETRequest(ctx context.Context, postReq *http.Request, rawQuery []byte) (*http.Request, error) {
+	if dt.Method != RequestMethodGET && dt.Method != RequestMethodAuto {
+		return postReq, nil
+	}
+	getReq, err := newGETRequest(ctx, dt.URL, base64.RawURLEncoding.EncodeToString(rawQuery))
+	if err != nil {
+		return nil, err
+	}
+	budget := dt.MaxGETURLLength
+	if budget <= 0 {
+		budget = DefaultMaxGETURLLength
+	}
+	if dt.Method == RequestMethodAuto && len(getReq.URL.String()) > budget {
+		return postReq, nil
+	}
+	return getReq, nil
+}
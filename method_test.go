@@ -0,0 +1,153 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newMethodServer returns a server accepting both GET and POST queries
+// and recording the method of each request.
+func newMethodServer(t *testing.T, methods *[]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*methods = append(*methods, r.Method)
+		var (
+			rawQuery []byte
+			err      error
+		)
+		switch r.Method {
+		case http.MethodGet:
+			rawQuery, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		default:
+			rawQuery, err = io.ReadAll(r.Body)
+		}
+		require.NoError(t, err)
+		query := &dns.Msg{}
+		require.NoError(t, query.Unpack(rawQuery))
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(buildDNSResponse(t, query))
+	}))
+}
+
+func TestExchangeRequestMethod(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// method is the Transport Method.
+		method dnsoverhttps.RequestMethod
+
+		// budget is the Transport MaxGETURLLength.
+		budget int
+
+		// wantMethod is the expected HTTP method.
+		wantMethod string
+	}
+
+	testCases := []testCase{
+		{name: "default", method: dnsoverhttps.RequestMethodPOST, wantMethod: "POST"},
+		{name: "GET", method: dnsoverhttps.RequestMethodGET, wantMethod: "GET"},
+		{name: "auto with default budget", method: dnsoverhttps.RequestMethodAuto, wantMethod: "GET"},
+		{name: "auto with small budget", method: dnsoverhttps.RequestMethodAuto, budget: 64, wantMethod: "POST"},
+		{name: "GET ignores budget", method: dnsoverhttps.RequestMethodGET, budget: 64, wantMethod: "GET"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var methods []string
+			srv := newMethodServer(t, &methods)
+			defer srv.Close()
+
+			var event *dnsoverhttps.ExchangeEvent
+			dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL+"/dns-query")
+			dt.Method = tt.method
+			dt.MaxGETURLLength = tt.budget
+			dt.ObserveExchange = func(ev *dnsoverhttps.ExchangeEvent) {
+				event = ev
+			}
+
+			resp, err := dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+			require.NoError(t, err)
+			require.NotEmpty(t, resp.ValidRRs)
+			assert.Equal(t, []string{tt.wantMethod}, methods)
+			require.NotNil(t, event)
+			assert.Equal(t, tt.wantMethod, event.HTTPMethod)
+		})
+	}
+}
+
+func TestExchangeRawRequestMethod(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// method is the Transport Method.
+		method dnsoverhttps.RequestMethod
+
+		// budget is the Transport MaxGETURLLength.
+		budget int
+
+		// wantMethod is the expected HTTP method.
+		wantMethod string
+	}
+
+	testCases := []testCase{
+		{name: "default", method: dnsoverhttps.RequestMethodPOST, wantMethod: "POST"},
+		{name: "GET", method: dnsoverhttps.RequestMethodGET, wantMethod: "GET"},
+		{name: "auto with default budget", method: dnsoverhttps.RequestMethodAuto, wantMethod: "GET"},
+		{name: "auto with small budget", method: dnsoverhttps.RequestMethodAuto, budget: 64, wantMethod: "POST"},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var methods []string
+			srv := newMethodServer(t, &methods)
+			defer srv.Close()
+
+			dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL+"/dns-query")
+			dt.Method = tt.method
+			dt.MaxGETURLLength = tt.budget
+
+			query := new(dns.Msg).SetQuestion("dns.google.", dns.TypeA)
+			resp, err := dt.ExchangeMsg(context.Background(), query)
+			require.NoError(t, err)
+			assert.Equal(t, query.Id, resp.Id)
+			assert.Equal(t, []string{tt.wantMethod}, methods)
+		})
+	}
+}
+
+func TestExchangeRequestMethodGETPreservesURLQuery(t *testing.T) {
+	var rawQuery string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawQuery = r.URL.RawQuery
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL+"/dns-query?token=abc")
+	dt.Method = dnsoverhttps.RequestMethodGET
+	_, err := dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+	require.ErrorIs(t, err, dnscodec.ErrServerMisbehaving)
+	assert.True(t, strings.HasPrefix(rawQuery, "dns="))
+	assert.Contains(t, rawQuery, "token=abc")
+}
+
+func TestRequestMethodString(t *testing.T) {
+	assert.Equal(t, "POST", dnsoverhttps.RequestMethodPOST.String())
+	assert.Equal(t, "GET", dnsoverhttps.RequestMethodGET.String())
+	assert.Equal(t, "auto", dnsoverhttps.RequestMethodAuto.String())
+	assert.Equal(t, "RequestMethod(7)", dnsoverhttps.RequestMethod(7).String())
+}
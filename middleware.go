@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/bassosimone/dnscodec"
+)
+
+// ErrUnknownMiddleware indicates that a [LayerConfig] uses an unregistered name.
+var ErrUnknownMiddleware = errors.New("unknown middleware")
+
+// Middleware wraps an [Exchanger] to add behavior (e.g., caching or metrics).
+type Middleware func(next Exchanger) Exchanger
+
+// MiddlewareFactory creates a [Middleware] given its configuration options.
+type MiddlewareFactory func(options map[string]string) (Middleware, error)
+
+// LayerConfig configures a layer of a [*Stack].
+type LayerConfig struct {
+	// Name is the name used to register the [MiddlewareFactory].
+	Name string `json:"name"`
+
+	// Options contains the OPTIONAL middleware-specific options.
+	Options map[string]string `json:"options"`
+}
+
+// MiddlewareRegistry maps names to [MiddlewareFactory], which allows tools
+// to assemble their [Exchanger] stack declaratively from configuration.
+//
+// Construct using [NewMiddlewareRegistry].
+type MiddlewareRegistry struct {
+	// factories maps names to factories.
+	factories map[string]MiddlewareFactory
+
+	// mu protects factories.
+	mu sync.Mutex
+}
+
+// NewMiddlewareRegistry creates a new, empty [*MiddlewareRegistry].
+func NewMiddlewareRegistry() *MiddlewareRegistry {
+	return &MiddlewareRegistry{factories: make(map[string]MiddlewareFactory)}
+}
+
+// Register registers a [MiddlewareFactory] with the given name, replacing
+// any factory previously registered with the same name.
+func (r *MiddlewareRegistry) Register(name string, factory MiddlewareFactory) {
+	r.mu.Lock()
+	r.factories[name] = factory
+	r.mu.Unlock()
+}
+
+// Names returns the sorted names of the registered factories.
+func (r *MiddlewareRegistry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []string
+	for name := range r.factories {
+		out = append(out, name)
+	}
+	slices.Sort(out)
+	return out
+}
+
+// Build assembles a [*Stack] wrapping base with the given layers, where the
+// first layer is the outermost one. For example, using the cache, retry, and
+// metrics layers, in this order, yields cache → retry → metrics → base.
+func (r *MiddlewareRegistry) Build(base Exchanger, layers ...LayerConfig) (*Stack, error) {
+	// 1. create the middlewares in order
+	middlewares := make([]Middleware, 0, len(layers))
+	names := make([]string, 0, len(layers))
+	for _, layer := range layers {
+		r.mu.Lock()
+		factory, found := r.factories[layer.Name]
+		r.mu.Unlock()
+		if !found {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownMiddleware, layer.Name)
+		}
+		middleware, err := factory(layer.Options)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create middleware %q: %w", layer.Name, err)
+		}
+		middlewares = append(middlewares, middleware)
+		names = append(names, layer.Name)
+	}
+
+	// 2. wrap starting from the innermost layer
+	exchanger := base
+	for _, middleware := range slices.Backward(middlewares) {
+		exchanger = middleware(exchanger)
+	}
+	return &Stack{exchanger: exchanger, layers: names}, nil
+}
+
+// Stack is an [Exchanger] assembled by [*MiddlewareRegistry.Build].
+type Stack struct {
+	// exchanger is the outermost exchanger.
+	exchanger Exchanger
+
+	// layers contains the layer names, outermost first.
+	layers []string
+}
+
+var _ Exchanger = &Stack{}
+
+// Exchange implements [Exchanger].
+func (s *Stack) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	return s.exchanger.Exchange(ctx, query)
+}
+
+// Layers returns the names of the layers, outermost first.
+func (s *Stack) Layers() []string {
+	return slices.Clone(s.layers)
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTracingFactory returns a factory whose middleware appends its name
+// and the "tag" option to calls before invoking the next exchanger.
+func newTracingFactory(name string, calls *[]string) dnsoverhttps.MiddlewareFactory {
+	return func(options map[string]string) (dnsoverhttps.Middleware, error) {
+		return func(next dnsoverhttps.Exchanger) dnsoverhttps.Exchanger {
+			return funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+				*calls = append(*calls, name+options["tag"])
+				return next.Exchange(ctx, query)
+			})
+		}, nil
+	}
+}
+
+func TestMiddlewareRegistryBuild(t *testing.T) {
+	var calls []string
+	registry := dnsoverhttps.NewMiddlewareRegistry()
+	registry.Register("cache", newTracingFactory("cache", &calls))
+	registry.Register("metrics", newTracingFactory("metrics", &calls))
+	assert.Equal(t, []string{"cache", "metrics"}, registry.Names())
+
+	base := funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		calls = append(calls, "transport")
+		return &dnscodec.Response{}, nil
+	})
+	stack, err := registry.Build(base,
+		dnsoverhttps.LayerConfig{Name: "cache"},
+		dnsoverhttps.LayerConfig{Name: "metrics", Options: map[string]string{"tag": "/v1"}},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cache", "metrics"}, stack.Layers())
+
+	_, err = stack.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cache", "metrics/v1", "transport"}, calls)
+}
+
+func TestMiddlewareRegistryBuildErrors(t *testing.T) {
+	wantErr := errors.New("mocked error")
+	registry := dnsoverhttps.NewMiddlewareRegistry()
+	registry.Register("broken", func(map[string]string) (dnsoverhttps.Middleware, error) {
+		return nil, wantErr
+	})
+
+	_, err := registry.Build(nil, dnsoverhttps.LayerConfig{Name: "nonexistent"})
+	require.ErrorIs(t, err, dnsoverhttps.ErrUnknownMiddleware)
+
+	_, err = registry.Build(nil, dnsoverhttps.LayerConfig{Name: "broken"})
+	require.ErrorIs(t, err, wantErr)
+}
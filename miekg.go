@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// MiekgClient adapts DNS-over-HTTPS to the [*dns.Client] exchange semantics,
+// such that code written against [*dns.Client] switches to DoH by replacing
+// the client and using the server URL as the address.
+//
+// Construct using [NewMiekgClient].
+type MiekgClient struct {
+	// Client is the [Client] to use.
+	//
+	// Set by [NewMiekgClient] to the user-provided value.
+	Client Client
+
+	// Timeout OPTIONALLY bounds each exchange started using [*MiekgClient.Exchange].
+	Timeout time.Duration
+}
+
+// NewMiekgClient creates a new [*MiekgClient].
+func NewMiekgClient(client Client) *MiekgClient {
+	return &MiekgClient{Client: client}
+}
+
+// Exchange is like [*dns.Client.Exchange] but uses DoH with the server URL.
+func (c *MiekgClient) Exchange(msg *dns.Msg, URL string) (*dns.Msg, time.Duration, error) {
+	ctx := context.Background()
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	return c.ExchangeContext(ctx, msg, URL)
+}
+
+// ExchangeContext is like [*dns.Client.ExchangeContext] but uses DoH with the server URL.
+//
+// We send the message as is, using [*Transport.ExchangeMsg], and return the
+// response along with the round trip time. Like [*dns.Client], we do not map
+// the response RCODE to an error.
+func (c *MiekgClient) ExchangeContext(ctx context.Context, msg *dns.Msg, URL string) (*dns.Msg, time.Duration, error) {
+	t0 := time.Now()
+	resp, err := NewTransport(c.Client, URL).ExchangeMsg(ctx, msg)
+	return resp, time.Since(t0), err
+}
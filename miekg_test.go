@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiekgClientExchange(t *testing.T) {
+	handler := dnsoverhttps.NewScriptedHandler(nil)
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	client := dnsoverhttps.NewMiekgClient(srv.Client())
+	msg := &dns.Msg{}
+	msg.SetQuestion("dns.google.", dns.TypeA)
+
+	resp, rtt, err := client.Exchange(msg, srv.URL)
+	require.NoError(t, err)
+	assert.Equal(t, msg.Id, resp.Id)
+	assert.Equal(t, dns.RcodeSuccess, resp.Rcode)
+	assert.True(t, rtt > 0)
+}
+
+func TestMiekgClientTimeout(t *testing.T) {
+	handler := dnsoverhttps.NewScriptedHandler(nil)
+	handler.Script("dns.google", dnsoverhttps.ScriptStep{Delay: time.Second})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	client := dnsoverhttps.NewMiekgClient(srv.Client())
+	client.Timeout = 10 * time.Millisecond
+	msg := &dns.Msg{}
+	msg.SetQuestion("dns.google.", dns.TypeA)
+
+	_, _, err := client.Exchange(msg, srv.URL)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
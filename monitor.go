@@ -0,0 +1,223 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// MonitorSample is a probe query performed by a [*Monitor].
+type MonitorSample struct {
+	// Cold is true when the probe used a fresh connection.
+	Cold bool
+
+	// StartTime is when the probe started.
+	StartTime time.Time
+
+	// Duration is the probe duration.
+	Duration time.Duration
+
+	// Err is the probe error or nil on success.
+	Err error
+}
+
+// MonitorStats contains the rolling statistics maintained by a [*Monitor].
+type MonitorStats struct {
+	// Samples is the number of samples in the window.
+	Samples int
+
+	// Failures is the number of failed samples in the window. Negative
+	// answers (e.g., NXDOMAIN) are not failures, since the server answered.
+	Failures int
+
+	// LossRate is the ratio between Failures and Samples.
+	LossRate float64
+
+	// MeanLatency is the mean latency of the non-failed samples.
+	MeanLatency time.Duration
+
+	// MaxLatency is the maximum latency of the non-failed samples.
+	MaxLatency time.Duration
+}
+
+// Monitor periodically issues a probe query using warm and, optionally, cold
+// connections, maintains rolling latency and loss statistics, and invokes a
+// callback when the statistics cross the configured thresholds.
+//
+// Construct using [NewMonitor].
+type Monitor struct {
+	// Warm is the [Exchanger] used for warm probes, which should
+	// reuse connections (e.g., a long-lived [*Transport]).
+	//
+	// Set by [NewMonitor] to the user-provided value.
+	Warm Exchanger
+
+	// NewCold OPTIONALLY creates an [Exchanger] using fresh connections
+	// for cold probes. When nil, we only perform warm probes.
+	NewCold func() Exchanger
+
+	// QueryName is the name to query.
+	//
+	// Set by [NewMonitor] to the user-provided value.
+	QueryName string
+
+	// Interval is the interval between probes. When zero or
+	// negative, we use [DefaultMonitorInterval].
+	//
+	// Set by [NewMonitor] to [DefaultMonitorInterval].
+	Interval time.Duration
+
+	// Window is the number of samples in the rolling window. When
+	// zero or negative, we use [DefaultMonitorWindow].
+	//
+	// Set by [NewMonitor] to [DefaultMonitorWindow].
+	Window int
+
+	// LatencyThreshold OPTIONALLY is the maximum acceptable mean latency.
+	LatencyThreshold time.Duration
+
+	// LossThreshold OPTIONALLY is the maximum acceptable loss rate.
+	LossThreshold float64
+
+	// ObserveSample is an optional hook called after each probe.
+	ObserveSample func(*MonitorSample)
+
+	// OnThreshold is an optional hook called when the statistics for warm
+	// or cold probes start exceeding or stop exceeding the thresholds.
+	OnThreshold func(cold bool, stats MonitorStats, exceeded bool)
+
+	// mu protects the fields below.
+	mu sync.Mutex
+
+	// samples contains the rolling windows indexed by coldness.
+	samples [2][]*MonitorSample
+
+	// exceeded tracks the threshold state indexed by coldness.
+	exceeded [2]bool
+}
+
+// DefaultMonitorWindow is the default [*Monitor] Window.
+const DefaultMonitorWindow = 60
+
+// DefaultMonitorInterval is the default [*Monitor] Interval.
+const DefaultMonitorInterval = time.Minute
+
+// NewMonitor creates a new [*Monitor].
+func NewMonitor(warm Exchanger, queryName string) *Monitor {
+	return &Monitor{
+		Warm:      warm,
+		QueryName: queryName,
+		Interval:  DefaultMonitorInterval,
+		Window:    DefaultMonitorWindow,
+	}
+}
+
+// Run probes immediately and then at each Interval until the context is done.
+//
+// Returns the context error.
+func (m *Monitor) Run(ctx context.Context) error {
+	interval := m.Interval
+	if interval <= 0 {
+		interval = DefaultMonitorInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		m.ProbeOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProbeOnce performs a warm probe and, if configured, a cold probe.
+func (m *Monitor) ProbeOnce(ctx context.Context) {
+	m.probe(ctx, m.Warm, false)
+	if m.NewCold != nil {
+		m.probe(ctx, m.NewCold(), true)
+	}
+}
+
+// Stats returns the rolling statistics for warm or cold probes.
+func (m *Monitor) Stats(cold bool) MonitorStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats(cold)
+}
+
+// probe performs a single probe and updates the statistics.
+//
+// We neither observe nor record the probes interrupted by the context being done
+// (e.g., at shutdown), since they do not tell anything about the server.
+func (m *Monitor) probe(ctx context.Context, exchanger Exchanger, cold bool) {
+	// 1. perform the probe
+	sample := &MonitorSample{Cold: cold, StartTime: time.Now()}
+	_, sample.Err = exchanger.Exchange(ctx, dnscodec.NewQuery(m.QueryName, dns.TypeA))
+	sample.Duration = time.Since(sample.StartTime)
+	if ctx.Err() != nil {
+		return
+	}
+	if m.ObserveSample != nil {
+		m.ObserveSample(sample)
+	}
+
+	// 2. update the window and the threshold state
+	m.mu.Lock()
+	idx := monitorIndex(cold)
+	m.samples[idx] = append(m.samples[idx], sample)
+	window := m.Window
+	if window <= 0 {
+		window = DefaultMonitorWindow
+	}
+	if excess := len(m.samples[idx]) - window; excess > 0 {
+		m.samples[idx] = m.samples[idx][excess:]
+	}
+	stats := m.stats(cold)
+	exceeded := (m.LatencyThreshold > 0 && stats.MeanLatency > m.LatencyThreshold) ||
+		(m.LossThreshold > 0 && stats.LossRate > m.LossThreshold)
+	changed := exceeded != m.exceeded[idx]
+	m.exceeded[idx] = exceeded
+	m.mu.Unlock()
+
+	// 3. invoke the callback outside of the lock on crossings
+	if changed && m.OnThreshold != nil {
+		m.OnThreshold(cold, stats, exceeded)
+	}
+}
+
+// stats computes the statistics assuming the caller holds the mutex.
+func (m *Monitor) stats(cold bool) MonitorStats {
+	var stats MonitorStats
+	var total time.Duration
+	for _, sample := range m.samples[monitorIndex(cold)] {
+		stats.Samples++
+		if !isAnswered(sample.Err) {
+			stats.Failures++
+			continue
+		}
+		total += sample.Duration
+		stats.MaxLatency = max(stats.MaxLatency, sample.Duration)
+	}
+	if stats.Samples > 0 {
+		stats.LossRate = float64(stats.Failures) / float64(stats.Samples)
+	}
+	if successes := stats.Samples - stats.Failures; successes > 0 {
+		stats.MeanLatency = total / time.Duration(successes)
+	}
+	return stats
+}
+
+// monitorIndex maps coldness to an index.
+func monitorIndex(cold bool) int {
+	if cold {
+		return 1
+	}
+	return 0
+}
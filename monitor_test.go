@@ -0,0 +1,123 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMonitorStatsAndThresholds(t *testing.T) {
+	// the warm exchanger fails on the second and third probes
+	var count atomic.Int64
+	warm := funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		if n := count.Add(1); n == 2 || n == 3 {
+			return nil, errors.New("mocked error")
+		}
+		return &dnscodec.Response{}, nil
+	})
+	var coldCreated int
+	mon := dnsoverhttps.NewMonitor(warm, "example.com")
+	mon.Window = 3
+	mon.LossThreshold = 0.5
+	mon.NewCold = func() dnsoverhttps.Exchanger {
+		coldCreated++
+		return funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+			return &dnscodec.Response{}, nil
+		})
+	}
+
+	type crossing struct {
+		cold     bool
+		exceeded bool
+	}
+	var crossings []crossing
+	mon.OnThreshold = func(cold bool, stats dnsoverhttps.MonitorStats, exceeded bool) {
+		crossings = append(crossings, crossing{cold, exceeded})
+	}
+	var samples []*dnsoverhttps.MonitorSample
+	mon.ObserveSample = func(sample *dnsoverhttps.MonitorSample) {
+		samples = append(samples, sample)
+	}
+
+	// probe five times: the window is [ok, fail, fail] after three probes and [fail, ok, ok] after five
+	for range 5 {
+		mon.ProbeOnce(context.Background())
+	}
+
+	assert.Equal(t, 5, coldCreated)
+	assert.Len(t, samples, 10)
+	assert.Equal(t, []crossing{{false, true}, {false, false}}, crossings)
+
+	warmStats := mon.Stats(false)
+	assert.Equal(t, 3, warmStats.Samples)
+	assert.Equal(t, 1, warmStats.Failures)
+	assert.InDelta(t, 1.0/3, warmStats.LossRate, 1e-9)
+
+	coldStats := mon.Stats(true)
+	assert.Equal(t, 3, coldStats.Samples)
+	assert.Zero(t, coldStats.Failures)
+}
+
+func TestMonitorNegativeAnswersAndDefaultWindow(t *testing.T) {
+	// the warm exchanger cycles through NXDOMAIN, NODATA, and failure
+	errs := []error{dnscodec.ErrNoName, dnscodec.ErrNoData, errors.New("mocked error")}
+	var count atomic.Int64
+	warm := funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		return nil, errs[(count.Add(1)-1)%int64(len(errs))]
+	})
+	mon := dnsoverhttps.NewMonitor(warm, "example.com")
+	mon.Window = 0
+	for range dnsoverhttps.DefaultMonitorWindow + len(errs) {
+		mon.ProbeOnce(context.Background())
+	}
+
+	// the window is the default one and only failures count as losses
+	stats := mon.Stats(false)
+	assert.Equal(t, dnsoverhttps.DefaultMonitorWindow, stats.Samples)
+	assert.Equal(t, dnsoverhttps.DefaultMonitorWindow/len(errs), stats.Failures)
+	assert.InDelta(t, 1.0/3, stats.LossRate, 1e-9)
+}
+
+func TestMonitorRun(t *testing.T) {
+	var count atomic.Int64
+	warm := funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		count.Add(1)
+		return &dnscodec.Response{}, nil
+	})
+	mon := dnsoverhttps.NewMonitor(warm, "example.com")
+	mon.Interval = time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := mon.Run(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, count.Load() >= 2)
+}
+
+func TestMonitorZeroValueAndCancelledProbes(t *testing.T) {
+	// the exchange fails only because the context is done
+	warm := funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	mon := &dnsoverhttps.Monitor{Warm: warm, QueryName: "example.com", LossThreshold: 0.1}
+	var crossings int
+	mon.OnThreshold = func(cold bool, stats dnsoverhttps.MonitorStats, exceeded bool) {
+		crossings++
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, mon.Run(ctx), context.DeadlineExceeded)
+	assert.Zero(t, mon.Stats(false).Samples)
+	assert.Zero(t, crossings)
+}
@@ -0,0 +1,70 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"errors"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// NegativeAnswerError is the error returned when the response is a valid
+// negative answer (i.e., NXDOMAIN or NODATA).
+//
+// It wraps either [dnscodec.ErrNoName] or [dnscodec.ErrNoData], so callers
+// can keep using [errors.Is] to classify the failure, and additionally
+// carries the SOA record from the authority section, if any.
+type NegativeAnswerError struct {
+	// Err is the underlying [dnscodec.ErrNoName] or [dnscodec.ErrNoData] error.
+	Err error
+
+	// Response is the response message containing the negative answer.
+	Response *dns.Msg
+
+	// SOA is the first SOA record in the authority section or nil
+	// when the server did not include any SOA record.
+	SOA *dns.SOA
+}
+
+// Error implements error.
+func (e *NegativeAnswerError) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *NegativeAnswerError) Unwrap() error {
+	return e.Err
+}
+
+// Authoritative returns whether the response has the AA bit set.
+func (e *NegativeAnswerError) Authoritative() bool {
+	return e.Response.Authoritative
+}
+
+// NegativeTTL returns the TTL for caching the negative answer computed as
+// the minimum between the SOA TTL and the SOA MINIMUM field per RFC 2308.
+//
+// The boolean is false when the response did not contain a SOA record.
+func (e *NegativeAnswerError) NegativeTTL() (uint32, bool) {
+	if e.SOA == nil {
+		return 0, false
+	}
+	return min(e.SOA.Hdr.Ttl, e.SOA.Minttl), true
+}
+
+// newNegativeAnswerError wraps err into a [*NegativeAnswerError] when err
+// indicates a negative answer and otherwise returns err unchanged.
+func newNegativeAnswerError(err error, resp *dns.Msg) error {
+	if !errors.Is(err, dnscodec.ErrNoName) && !errors.Is(err, dnscodec.ErrNoData) {
+		return err
+	}
+	nae := &NegativeAnswerError{Err: err, Response: resp}
+	for _, rr := range resp.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			nae.SOA = soa
+			break
+		}
+	}
+	return nae
+}
@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newStaticServer returns a server replying to each query with the
+// message produced by the given function.
+func newStaticServer(t *testing.T, reply func(query *dns.Msg) *dns.Msg) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rawQuery, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		query := &dns.Msg{}
+		require.NoError(t, query.Unpack(rawQuery))
+		rawResp, err := reply(query).Pack()
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, err = w.Write(rawResp)
+		require.NoError(t, err)
+	}))
+}
+
+func TestExchangeNegativeAnswerNXDOMAIN(t *testing.T) {
+	srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+		resp := &dns.Msg{}
+		resp.SetRcode(query, dns.RcodeNameError)
+		resp.Authoritative = true
+		resp.Ns = append(resp.Ns, &dns.SOA{
+			Hdr: dns.RR_Header{
+				Name:   "example.com.",
+				Rrtype: dns.TypeSOA,
+				Class:  dns.ClassINET,
+				Ttl:    3600,
+			},
+			Ns:     "ns.example.com.",
+			Mbox:   "hostmaster.example.com.",
+			Minttl: 300,
+		})
+		return resp
+	})
+	defer srv.Close()
+
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	query := dnscodec.NewQuery("nonexistent.example.com", dns.TypeA)
+	resp, err := dt.Exchange(context.Background(), query)
+
+	require.ErrorIs(t, err, dnscodec.ErrNoName)
+	require.Nil(t, resp)
+	var nae *dnsoverhttps.NegativeAnswerError
+	require.True(t, errors.As(err, &nae))
+	require.NotNil(t, nae.SOA)
+	assert.Equal(t, "example.com.", nae.SOA.Hdr.Name)
+	assert.True(t, nae.Authoritative())
+	ttl, ok := nae.NegativeTTL()
+	assert.True(t, ok)
+	assert.Equal(t, uint32(300), ttl)
+}
+
+func TestExchangeNegativeAnswerNODATAWithoutSOA(t *testing.T) {
+	srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+		resp := &dns.Msg{}
+		resp.SetReply(query)
+		resp.RecursionAvailable = true
+		return resp
+	})
+	defer srv.Close()
+
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	query := dnscodec.NewQuery("example.com", dns.TypeAAAA)
+	resp, err := dt.Exchange(context.Background(), query)
+
+	require.ErrorIs(t, err, dnscodec.ErrNoData)
+	require.Nil(t, resp)
+	var nae *dnsoverhttps.NegativeAnswerError
+	require.True(t, errors.As(err, &nae))
+	assert.Nil(t, nae.SOA)
+	assert.False(t, nae.Authoritative())
+	_, ok := nae.NegativeTTL()
+	assert.False(t, ok)
+}
+
+func TestExchangeServfailIsNotNegativeAnswer(t *testing.T) {
+	srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+		resp := &dns.Msg{}
+		resp.SetRcode(query, dns.RcodeServerFailure)
+		return resp
+	})
+	defer srv.Close()
+
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	query := dnscodec.NewQuery("example.com", dns.TypeA)
+	_, err := dt.Exchange(context.Background(), query)
+
+	require.ErrorIs(t, err, dnscodec.ErrServerTemporarilyMisbehaving)
+	var nae *dnsoverhttps.NegativeAnswerError
+	assert.False(t, errors.As(err, &nae))
+}
@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// NXDOMAINHijackResult is the result of [*Transport.DetectNXDOMAINHijack].
+type NXDOMAINHijackResult struct {
+	// QueryName is the random nonexistent name we queried.
+	QueryName string
+
+	// Hijacked is true when the server answered positively for the
+	// nonexistent name, which indicates that it rewrites NXDOMAIN
+	// responses (e.g., to redirect users to ads or search pages).
+	Hijacked bool
+
+	// Addrs contains the addresses returned for the nonexistent name.
+	Addrs []string
+}
+
+// DetectNXDOMAINHijack queries for the A record of a random nonexistent name
+// within the given zone and flags any positive answer as NXDOMAIN hijacking.
+//
+// The zone MUST NOT contain wildcard records (e.g., "example.com"), otherwise
+// we would flag legitimate answers. The returned error is nil when the server
+// returned NXDOMAIN or NODATA. Like [*Transport.Exchange], this method calls
+// the observation hooks and uses the [Client] of the [*Transport], thus
+// reusing its connections.
+func (dt *Transport) DetectNXDOMAINHijack(ctx context.Context, zone string) (*NXDOMAINHijackResult, error) {
+	// 1. query for a random name within the zone
+	result := &NXDOMAINHijackResult{
+		QueryName: strings.ToLower(rand.Text()) + "." + dns.Fqdn(zone),
+	}
+	resp, err := dt.Exchange(ctx, dnscodec.NewQuery(result.QueryName, dns.TypeA))
+
+	// 2. classify the result
+	switch {
+	case errors.Is(err, dnscodec.ErrNoName), errors.Is(err, dnscodec.ErrNoData):
+		return result, nil
+
+	case err != nil:
+		return nil, err
+
+	default:
+		result.Hijacked = true
+		result.Addrs = answerAddrStrings(resp.ValidRRs)
+		return result, nil
+	}
+}
@@ -0,0 +1,97 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportDetectNXDOMAINHijack(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// rcode is the response RCODE.
+		rcode int
+
+		// answer indicates whether to include an answer.
+		answer bool
+
+		// wantHijacked is the expected Hijacked value.
+		wantHijacked bool
+
+		// wantAddrs contains the expected addresses.
+		wantAddrs []string
+
+		// wantErr is the expected error (nil on success).
+		wantErr error
+	}
+
+	testCases := []testCase{
+		{
+			name:  "NXDOMAIN",
+			rcode: dns.RcodeNameError,
+		},
+
+		{
+			name:  "NODATA",
+			rcode: dns.RcodeSuccess,
+		},
+
+		{
+			name:         "hijacked",
+			rcode:        dns.RcodeSuccess,
+			answer:       true,
+			wantHijacked: true,
+			wantAddrs:    []string{"8.8.8.8"},
+		},
+
+		{
+			name:    "SERVFAIL",
+			rcode:   dns.RcodeServerFailure,
+			wantErr: dnscodec.ErrServerTemporarilyMisbehaving,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+				names = append(names, query.Question[0].Name)
+				resp := &dns.Msg{}
+				require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+				resp.Rcode = tt.rcode
+				if !tt.answer {
+					resp.Answer = nil
+				}
+				return resp
+			})
+			defer srv.Close()
+
+			dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+			for range 2 {
+				result, err := dt.DetectNXDOMAINHijack(context.Background(), "example.com")
+				require.ErrorIs(t, err, tt.wantErr)
+				if tt.wantErr != nil {
+					require.Nil(t, result)
+					continue
+				}
+				assert.Equal(t, tt.wantHijacked, result.Hijacked)
+				assert.Equal(t, tt.wantAddrs, result.Addrs)
+				assert.True(t, strings.HasSuffix(result.QueryName, ".example.com."))
+			}
+
+			// each detection uses a different random name
+			require.Len(t, names, 2)
+			assert.NotEqual(t, names[0], names[1])
+		})
+	}
+}
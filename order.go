@@ -0,0 +1,117 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// AnswerOrder controls the order of the address records returned by [*AnswerOrderer].
+type AnswerOrder uint8
+
+const (
+	// AnswerOrderPreserve preserves the wire order.
+	AnswerOrderPreserve AnswerOrder = iota
+
+	// AnswerOrderSort sorts the addresses, which is useful to write
+	// deterministic tests and to compare answers across resolvers.
+	AnswerOrderSort
+
+	// AnswerOrderShuffle shuffles the addresses, which distributes the load
+	// across the addresses regardless of the resolver ordering.
+	AnswerOrderShuffle
+)
+
+// String implements [fmt.Stringer].
+func (o AnswerOrder) String() string {
+	switch o {
+	case AnswerOrderPreserve:
+		return "preserve"
+	case AnswerOrderSort:
+		return "sort"
+	case AnswerOrderShuffle:
+		return "shuffle"
+	default:
+		return fmt.Sprintf("AnswerOrder(%d)", uint8(o))
+	}
+}
+
+// AnswerOrderer is an [Exchanger] reordering the A and AAAA records in the
+// ValidRRs of the responses returned by another [Exchanger].
+//
+// We only move the address records among the positions they occupy, so the CNAME
+// chain stays in place. Because [Lookup], [LookupAddrs], and the dnscodec
+// Records methods read the ValidRRs, wrapping an [Exchanger] applies the same
+// policy to all of them. We do not reorder the raw response message.
+//
+// Construct using [NewAnswerOrderer].
+type AnswerOrderer struct {
+	// Exchanger is the [Exchanger] to use.
+	//
+	// Set by [NewAnswerOrderer] to the user-provided value.
+	Exchanger Exchanger
+
+	// Order is the ordering policy.
+	//
+	// Set by [NewAnswerOrderer] to the user-provided value.
+	Order AnswerOrder
+}
+
+var _ Exchanger = &AnswerOrderer{}
+
+// NewAnswerOrderer creates a new [*AnswerOrderer].
+func NewAnswerOrderer(exchanger Exchanger, order AnswerOrder) *AnswerOrderer {
+	return &AnswerOrderer{Exchanger: exchanger, Order: order}
+}
+
+// Exchange implements [Exchanger].
+func (ao *AnswerOrderer) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	resp, err := ao.Exchanger.Exchange(ctx, query)
+	if err != nil || ao.Order == AnswerOrderPreserve {
+		return resp, err
+	}
+	resp.ValidRRs = ao.reorder(resp.ValidRRs)
+	return resp, nil
+}
+
+// reorder returns a copy of the records where the address records are reordered.
+func (ao *AnswerOrderer) reorder(rrs []dns.RR) []dns.RR {
+	// 1. collect the positions of the address records
+	rrs = slices.Clone(rrs)
+	var (
+		positions []int
+		addrRRs   []dns.RR
+	)
+	for idx, rr := range rrs {
+		if _, ok := rrAddr(rr); ok {
+			positions = append(positions, idx)
+			addrRRs = append(addrRRs, rr)
+		}
+	}
+
+	// 2. reorder the address records
+	switch ao.Order {
+	case AnswerOrderSort:
+		slices.SortStableFunc(addrRRs, func(x, y dns.RR) int {
+			ax, _ := rrAddr(x)
+			ay, _ := rrAddr(y)
+			return ax.Compare(ay)
+		})
+	case AnswerOrderShuffle:
+		rand.Shuffle(len(addrRRs), func(i, j int) {
+			addrRRs[i], addrRRs[j] = addrRRs[j], addrRRs[i]
+		})
+	}
+
+	// 3. put the address records back in place
+	for idx, pos := range positions {
+		rrs[pos] = addrRRs[idx]
+	}
+	return rrs
+}
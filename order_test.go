@@ -0,0 +1,87 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// orderZoneFile is the zone file used by the [*dnsoverhttps.AnswerOrderer] tests.
+const orderZoneFile = `
+$TTL 300
+@       IN SOA ns.example.com. admin.example.com. 1 7200 3600 1209600 300
+www     IN CNAME web
+web     IN A    192.0.2.3
+web     IN A    192.0.2.1
+web     IN A    192.0.2.2
+`
+
+func TestAnswerOrderer(t *testing.T) {
+	zone, err := dnsoverhttps.ParseStaticZone(strings.NewReader(orderZoneFile), "example.com")
+	require.NoError(t, err)
+	srv := httptest.NewServer(dnsoverhttps.NewScriptedHandler(zone.Reply))
+	defer srv.Close()
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+
+	type testCase struct {
+		// order is the ordering policy.
+		order dnsoverhttps.AnswerOrder
+
+		// want contains the expected addresses or nil when the order is random.
+		want []string
+	}
+
+	testCases := []testCase{
+		{order: dnsoverhttps.AnswerOrderPreserve, want: []string{"192.0.2.3", "192.0.2.1", "192.0.2.2"}},
+		{order: dnsoverhttps.AnswerOrderSort, want: []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}},
+		{order: dnsoverhttps.AnswerOrderShuffle},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.order.String(), func(t *testing.T) {
+			ao := dnsoverhttps.NewAnswerOrderer(dt, tt.order)
+			resp, err := ao.Exchange(context.Background(), dnscodec.NewQuery("www.example.com", dns.TypeA))
+			require.NoError(t, err)
+			require.Len(t, resp.ValidRRs, 4)
+			assert.IsType(t, &dns.CNAME{}, resp.ValidRRs[0])
+			addrs, err := resp.RecordsA()
+			require.NoError(t, err)
+			if tt.want == nil {
+				assert.ElementsMatch(t, []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}, addrs)
+			} else {
+				assert.Equal(t, tt.want, addrs)
+			}
+
+			// the lookup helpers see the same order
+			if tt.want != nil {
+				addrs, err := dnsoverhttps.LookupAddrs(context.Background(), ao, "www.example.com", nil)
+				require.NoError(t, err)
+				var got []string
+				for _, addr := range addrs {
+					got = append(got, addr.String())
+				}
+				assert.Equal(t, tt.want, got)
+			}
+		})
+	}
+
+	ao := dnsoverhttps.NewAnswerOrderer(dt, dnsoverhttps.AnswerOrderSort)
+	_, err = ao.Exchange(context.Background(), dnscodec.NewQuery("nonexistent.example.com", dns.TypeA))
+	require.ErrorIs(t, err, dnscodec.ErrNoName)
+}
+
+func TestAnswerOrderString(t *testing.T) {
+	assert.Equal(t, "preserve", dnsoverhttps.AnswerOrderPreserve.String())
+	assert.Equal(t, "sort", dnsoverhttps.AnswerOrderSort.String())
+	assert.Equal(t, "shuffle", dnsoverhttps.AnswerOrderShuffle.String())
+	assert.Equal(t, "AnswerOrder(7)", dnsoverhttps.AnswerOrder(7).String())
+}
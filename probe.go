@@ -0,0 +1,273 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/iox"
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// ProbeReport describes the capabilities of a DoH server.
+type ProbeReport struct {
+	// URL is the server URL.
+	URL string
+
+	// POST is true when the server answers RFC 8484 POST requests.
+	POST bool
+
+	// POSTErr is the error that occurred using POST, if any.
+	POSTErr error
+
+	// GET is true when the server answers RFC 8484 GET requests.
+	GET bool
+
+	// GETErr is the error that occurred using GET, if any.
+	GETErr error
+
+	// JSON is true when the server answers JSON API requests (i.e.,
+	// GET requests using the name and type parameters).
+	JSON bool
+
+	// JSONErr is the error that occurred using the JSON API, if any.
+	JSONErr error
+
+	// HTTPProtocol is the protocol negotiated by the [*Prober] Client for the
+	// POST exchange (e.g., "HTTP/2.0"). Since it depends on the Client config,
+	// it does not tell which other HTTP versions the server supports.
+	HTTPProtocol string
+
+	// HTTPVersions contains the HTTP versions (e.g., "HTTP/2.0") that the server
+	// answered using the matching [*Prober] HTTPVersionClients, sorted.
+	HTTPVersions []string
+
+	// HTTPVersionErrs maps the HTTP versions the server did not answer
+	// using the matching [*Prober] HTTPVersionClients to the errors.
+	HTTPVersionErrs map[string]error
+
+	// PaddedResponses is true when the POST response included the
+	// EDNS(0) padding option (RFC 8467).
+	PaddedResponses bool
+
+	// EDNS0UDPSize is the EDNS(0) UDP payload size (RFC 6891) advertised by
+	// the POST response or zero when the response does not include EDNS(0).
+	// Since DoH does not use UDP, this field only hints at the server software.
+	EDNS0UDPSize uint16
+
+	// ExtendedErrors contains the extended DNS error (RFC 8914) info codes
+	// included in the response to the query for the [*Prober] EDEQueryName.
+	ExtendedErrors []uint16
+}
+
+// Prober tests the support matrix of DoH servers.
+//
+// Construct using [NewProber].
+type Prober struct {
+	// Client is the [Client] to use.
+	//
+	// Set by [NewProber] to the user-provided value.
+	Client Client
+
+	// QueryName is the name to query for testing the support matrix.
+	//
+	// Set by [NewProber] to "example.com".
+	QueryName string
+
+	// EDEQueryName is a name for which validating resolvers should return
+	// an extended DNS error (RFC 8914) because of broken DNSSEC.
+	//
+	// Set by [NewProber] to "dnssec-failed.org".
+	EDEQueryName string
+
+	// HTTPVersionClients OPTIONALLY maps HTTP versions (e.g., "HTTP/1.1") to
+	// clients only speaking that version, which we use to test whether the
+	// server supports each version. When nil, we do not test HTTP versions.
+	//
+	// Set by [NewProber] to nil. Use [NewHTTPVersionClients] to create the clients.
+	HTTPVersionClients map[string]Client
+}
+
+// NewHTTPVersionClients returns clients for testing the HTTP versions using
+// [*Prober] HTTPVersionClients, using a clone of the given OPTIONAL TLS config.
+// That is, an HTTP/1.1 client and an HTTP/2 client respectively offering only
+// "http/1.1" and "h2" using ALPN, and an HTTP/3 client.
+func NewHTTPVersionClients(config *tls.Config) map[string]Client {
+	if config == nil {
+		config = &tls.Config{}
+	}
+	http1Config := config.Clone()
+	http1Config.NextProtos = []string{"http/1.1"}
+	http2Config := config.Clone()
+	http2Config.NextProtos = []string{"h2"}
+	return map[string]Client{
+		"HTTP/1.1": NewTLSClient(http1Config),
+		"HTTP/2.0": NewTLSClient(http2Config),
+		"HTTP/3.0": &http.Client{Transport: &http3.Transport{TLSClientConfig: config.Clone()}},
+	}
+}
+
+// NewProber creates a new [*Prober].
+func NewProber(client Client) *Prober {
+	return &Prober{
+		Client:       client,
+		QueryName:    "example.com",
+		EDEQueryName: "dnssec-failed.org",
+	}
+}
+
+// Probe tests the capabilities of the server at the given URL and returns a
+// [*ProbeReport]. The probes run in sequence and each one records its outcome
+// in the report, therefore this method does not return an error.
+func (p *Prober) Probe(ctx context.Context, URL string) *ProbeReport {
+	report := &ProbeReport{URL: URL}
+	p.probePOST(ctx, report)
+	p.probeGET(ctx, report)
+	p.probeJSON(ctx, report)
+	p.probeEDE(ctx, report)
+	p.probeHTTPVersions(ctx, report)
+	return report
+}
+
+// probePOST tests POST requests as well as the response features.
+func (p *Prober) probePOST(ctx context.Context, report *ProbeReport) {
+	// 1. Perform the exchange observing the negotiated HTTP protocol
+	dt := NewTransport(p.Client, report.URL)
+	dt.ObserveExchange = func(ev *ExchangeEvent) {
+		report.HTTPProtocol = ev.HTTPProtocol
+	}
+	result, err := dt.ExchangeWithRaw(ctx, dnscodec.NewQuery(p.QueryName, dns.TypeA))
+	if err != nil {
+		report.POSTErr = err
+		return
+	}
+	report.POST = true
+
+	// 2. Inspect the EDNS(0) features of the response
+	report.EDNS0UDPSize, report.PaddedResponses = responseEDNS0Features(result.Response.Response)
+}
+
+// probeHTTPVersions tests the HTTP versions using the HTTPVersionClients.
+func (p *Prober) probeHTTPVersions(ctx context.Context, report *ProbeReport) {
+	for _, version := range slices.Sorted(maps.Keys(p.HTTPVersionClients)) {
+		// 1. Perform the exchange observing the negotiated HTTP protocol
+		var protocol string
+		dt := NewTransport(p.HTTPVersionClients[version], report.URL)
+		dt.ObserveExchange = func(ev *ExchangeEvent) {
+			protocol = ev.HTTPProtocol
+		}
+		_, err := dt.Exchange(ctx, dnscodec.NewQuery(p.QueryName, dns.TypeA))
+
+		// 2. Make sure the client did not fall back to another version
+		if err == nil && protocol != version {
+			err = fmt.Errorf("expected %s but negotiated %s", version, protocol)
+		}
+		if err != nil {
+			if report.HTTPVersionErrs == nil {
+				report.HTTPVersionErrs = make(map[string]error)
+			}
+			report.HTTPVersionErrs[version] = err
+			continue
+		}
+		report.HTTPVersions = append(report.HTTPVersions, version)
+	}
+}
+
+// probeGET tests RFC 8484 GET requests.
+func (p *Prober) probeGET(ctx context.Context, report *ProbeReport) {
+	dt := NewTransport(p.Client, report.URL)
+	dt.Method = RequestMethodGET
+	if _, err := dt.Exchange(ctx, dnscodec.NewQuery(p.QueryName, dns.TypeA)); err != nil {
+		report.GETErr = err
+		return
+	}
+	report.GET = true
+}
+
+// probeJSON tests the JSON API popularized by Google and Cloudflare.
+func (p *Prober) probeJSON(ctx context.Context, report *ProbeReport) {
+	// 1. Build the GET request
+	URL, err := url.Parse(report.URL)
+	if err != nil {
+		report.JSONErr = err
+		return
+	}
+	values := URL.Query()
+	values.Set("name", p.QueryName)
+	values.Set("type", "A")
+	URL.RawQuery = values.Encode()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, URL.String(), nil)
+	if err != nil {
+		report.JSONErr = err
+		return
+	}
+	httpReq.Header.Set("Accept", "application/dns-json")
+
+	// 2. Perform the round trip
+	httpResp, err := p.Client.Do(httpReq)
+	if err != nil {
+		report.JSONErr = err
+		return
+	}
+	defer httpResp.Body.Close()
+
+	// 3. Ensure that we received a JSON object with a "Status" field
+	mediaType, _, _ := mime.ParseMediaType(httpResp.Header.Get("Content-Type"))
+	if httpResp.StatusCode != 200 || (mediaType != "application/dns-json" && mediaType != "application/json") {
+		report.JSONErr = dnscodec.ErrServerMisbehaving
+		return
+	}
+	var body struct {
+		Status *int
+	}
+	reader := io.Reader(iox.LimitReadCloser(httpResp.Body, 1<<16))
+	if err := json.NewDecoder(reader).Decode(&body); err != nil || body.Status == nil {
+		report.JSONErr = dnscodec.ErrServerMisbehaving
+		return
+	}
+	report.JSON = true
+}
+
+// probeEDE tests whether the server returns extended DNS errors.
+func (p *Prober) probeEDE(ctx context.Context, report *ProbeReport) {
+	// The exchange most likely fails with SERVFAIL, so we ignore the error
+	dt := NewTransport(p.Client, report.URL)
+	_, _, rawResp, _ := dt.exchangeSavingRaw(ctx, dnscodec.NewQuery(p.EDEQueryName, dns.TypeA))
+	msg := &dns.Msg{}
+	if err := msg.Unpack(rawResp); err != nil {
+		return
+	}
+	for _, option := range ResponseEDNS0Options(msg) {
+		if ede, ok := option.(*dns.EDNS0_EDE); ok {
+			report.ExtendedErrors = append(report.ExtendedErrors, ede.InfoCode)
+		}
+	}
+}
+
+// newGETRequest creates an RFC 8484 GET request using the given dns parameter.
+func newGETRequest(ctx context.Context, URL, dnsParam string) (*http.Request, error) {
+	parsed, err := url.Parse(URL)
+	if err != nil {
+		return nil, err
+	}
+	values := parsed.Query()
+	values.Set("dns", dnsParam)
+	parsed.RawQuery = values.Encode()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, parsed.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Accept", "application/dns-message")
+	return httpReq, nil
+}
@@ -0,0 +1,173 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newProbeServer returns a server supporting POST and, optionally, GET, the
+// JSON API, padding, and extended DNS errors for dnssec-failed.org.
+func newProbeServer(t *testing.T, full bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 1. obtain the raw query depending on the method
+		var rawQuery []byte
+		var err error
+		switch {
+		case r.Method == http.MethodPost:
+			rawQuery, err = io.ReadAll(r.Body)
+			require.NoError(t, err)
+		case full && r.URL.Query().Get("name") != "":
+			w.Header().Set("Content-Type", "application/dns-json")
+			_, err := w.Write([]byte(`{"Status": 0, "Answer": []}`))
+			require.NoError(t, err)
+			return
+		case full && r.URL.Query().Get("dns") != "":
+			rawQuery, err = base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+			require.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		// 2. build the response
+		query := &dns.Msg{}
+		require.NoError(t, query.Unpack(rawQuery))
+		resp := &dns.Msg{}
+		if query.Question[0].Name == "dnssec-failed.org." {
+			resp.SetRcode(query, dns.RcodeServerFailure)
+		} else {
+			require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+		}
+		if full {
+			resp.SetEdns0(1232, false)
+			opt := resp.IsEdns0()
+			if query.Question[0].Name == "dnssec-failed.org." {
+				opt.Option = append(opt.Option, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeDNSBogus})
+			}
+			opt.Option = append(opt.Option, &dns.EDNS0_PADDING{Padding: make([]byte, 16)})
+		}
+		rawResp, err := resp.Pack()
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, err = w.Write(rawResp)
+		require.NoError(t, err)
+	}))
+}
+
+func TestProberFullSupport(t *testing.T) {
+	srv := newProbeServer(t, true)
+	defer srv.Close()
+
+	report := dnsoverhttps.NewProber(srv.Client()).Probe(context.Background(), srv.URL)
+	assert.Equal(t, srv.URL, report.URL)
+	assert.True(t, report.POST)
+	assert.NoError(t, report.POSTErr)
+	assert.True(t, report.GET)
+	assert.NoError(t, report.GETErr)
+	assert.True(t, report.JSON)
+	assert.NoError(t, report.JSONErr)
+	assert.Equal(t, "HTTP/1.1", report.HTTPProtocol)
+	assert.True(t, report.PaddedResponses)
+	assert.Equal(t, uint16(1232), report.EDNS0UDPSize)
+	assert.Equal(t, []uint16{dns.ExtendedErrorCodeDNSBogus}, report.ExtendedErrors)
+}
+
+func TestProberPOSTOnly(t *testing.T) {
+	srv := newProbeServer(t, false)
+	defer srv.Close()
+
+	report := dnsoverhttps.NewProber(srv.Client()).Probe(context.Background(), srv.URL)
+	assert.True(t, report.POST)
+	assert.False(t, report.GET)
+	assert.Error(t, report.GETErr)
+	assert.False(t, report.JSON)
+	assert.Error(t, report.JSONErr)
+	assert.False(t, report.PaddedResponses)
+	assert.Zero(t, report.EDNS0UDPSize)
+	assert.Empty(t, report.ExtendedErrors)
+}
+
+func TestProberHTTPVersions(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// http2 indicates whether the server supports HTTP/2.
+		http2 bool
+
+		// http3 indicates whether the server supports HTTP/3.
+		http3 bool
+
+		// wantVersions contains the expected supported versions.
+		wantVersions []string
+
+		// wantErrVersions contains the expected unsupported versions.
+		wantErrVersions []string
+	}
+
+	testCases := []testCase{
+		{
+			name:         "all versions",
+			http2:        true,
+			http3:        true,
+			wantVersions: []string{"HTTP/1.1", "HTTP/2.0", "HTTP/3.0"},
+		},
+
+		{
+			name:            "only HTTP/1.1",
+			wantVersions:    []string{"HTTP/1.1"},
+			wantErrVersions: []string{"HTTP/2.0"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			zone := dnsoverhttps.NewStaticZone(mustNewRR(t, "example.com. 300 IN A 93.184.216.34"))
+			handler := dnsoverhttps.NewScriptedHandler(zone.Reply)
+			srv := httptest.NewUnstartedServer(handler)
+			srv.EnableHTTP2 = tt.http2
+			srv.StartTLS()
+			defer srv.Close()
+			pool := x509.NewCertPool()
+			pool.AddCert(srv.Certificate())
+			clients := dnsoverhttps.NewHTTPVersionClients(&tls.Config{RootCAs: pool})
+
+			// serve HTTP/3 using the same port or avoid waiting for the QUIC handshake
+			if tt.http3 {
+				conn, err := net.ListenPacket("udp", srv.Listener.Addr().String())
+				require.NoError(t, err)
+				h3srv := &http3.Server{Handler: handler, TLSConfig: http3.ConfigureTLSConfig(srv.TLS.Clone())}
+				go h3srv.Serve(conn)
+				defer h3srv.Close()
+			} else {
+				delete(clients, "HTTP/3.0")
+			}
+
+			prober := dnsoverhttps.NewProber(srv.Client())
+			prober.HTTPVersionClients = clients
+			report := prober.Probe(context.Background(), srv.URL)
+			assert.Equal(t, tt.wantVersions, report.HTTPVersions)
+			var errVersions []string
+			for version, err := range report.HTTPVersionErrs {
+				require.Error(t, err)
+				errVersions = append(errVersions, version)
+			}
+			assert.Equal(t, tt.wantErrVersions, errVersions)
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"time"
+)
+
+// ClientIPPolicy controls how [*ForwardingHandler] logs client IP addresses.
+type ClientIPPolicy uint8
+
+const (
+	// ClientIPKeep logs the full client IP address.
+	ClientIPKeep ClientIPPolicy = iota
+
+	// ClientIPTruncate logs the /24 (IPv4) or /48 (IPv6) network of the
+	// client IP address, which is enough to debug most routing issues.
+	ClientIPTruncate
+
+	// ClientIPHash logs the hex-encoded SHA-256 digest of the salt followed
+	// by the client IP address, which allows to correlate the queries of a
+	// client without knowing who the client is.
+	ClientIPHash
+
+	// ClientIPDrop does not log the client IP address.
+	ClientIPDrop
+)
+
+// String implements [fmt.Stringer].
+func (p ClientIPPolicy) String() string {
+	switch p {
+	case ClientIPKeep:
+		return "keep"
+	case ClientIPTruncate:
+		return "truncate"
+	case ClientIPHash:
+		return "hash"
+	case ClientIPDrop:
+		return "drop"
+	default:
+		return fmt.Sprintf("ClientIPPolicy(%d)", uint8(p))
+	}
+}
+
+// apply returns the client IP address to log according to the policy.
+func (p ClientIPPolicy) apply(addr netip.Addr, salt []byte) string {
+	if !addr.IsValid() {
+		return ""
+	}
+	addr = addr.Unmap()
+	switch p {
+	case ClientIPKeep:
+		return addr.String()
+	case ClientIPTruncate:
+		bits := 48
+		if addr.Is4() {
+			bits = 24
+		}
+		prefix, _ := addr.Prefix(bits)
+		return prefix.String()
+	case ClientIPHash:
+		digest := sha256.Sum256(append(append([]byte{}, salt...), addr.String()...))
+		return hex.EncodeToString(digest[:])
+	default:
+		return ""
+	}
+}
+
+// QueryLogEntry describes a query processed by [*ForwardingHandler].
+type QueryLogEntry struct {
+	// Time is when we received the query.
+	Time time.Time
+
+	// ClientIP is the client IP address processed according to the
+	// [ClientIPPolicy] or an empty string when dropped.
+	ClientIP string
+
+	// QueryName is the query name or an empty string when dropped.
+	QueryName string
+
+	// QueryType is the query type (e.g., "A").
+	QueryType string
+
+	// Rcode is the response RCODE (e.g., "NOERROR").
+	Rcode string
+
+	// Duration is the time it took to forward the query.
+	Duration time.Duration
+
+	// Err is the forwarding error or nil on success.
+	Err error
+}
@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxRateBuckets is the number of client buckets after which
+// [*rateLimiter] forgets the clients whose bucket is full.
+const maxRateBuckets = 4096
+
+// rateBucket is the token bucket of a client.
+type rateBucket struct {
+	// tokens is the number of available tokens.
+	tokens float64
+
+	// last is when we last updated tokens.
+	last time.Time
+}
+
+// rateLimiter implements per-client token-bucket rate limiting.
+//
+// The zero value is ready to use.
+type rateLimiter struct {
+	// buckets maps client IP addresses to their bucket.
+	buckets map[string]*rateBucket
+
+	// mu protects buckets.
+	mu sync.Mutex
+}
+
+// allow consumes a token of the given client's bucket, which refills at rate
+// tokens per second up to burst tokens, and returns whether the client may
+// proceed or, otherwise, after how long a token becomes available.
+func (rl *rateLimiter) allow(client string, rate float64, burst int, now time.Time) (bool, time.Duration) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	capacity := float64(max(burst, 1))
+	if rl.buckets == nil {
+		rl.buckets = make(map[string]*rateBucket)
+	}
+	if len(rl.buckets) >= maxRateBuckets {
+		rl.prune(rate, capacity, now)
+	}
+	bucket := rl.buckets[client]
+	if bucket == nil {
+		bucket = &rateBucket{tokens: capacity, last: now}
+		rl.buckets[client] = bucket
+	}
+	bucket.tokens = min(capacity, bucket.tokens+now.Sub(bucket.last).Seconds()*rate)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// prune forgets the clients whose bucket would be full by now.
+func (rl *rateLimiter) prune(rate, capacity float64, now time.Time) {
+	for client, bucket := range rl.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*rate >= capacity {
+			delete(rl.buckets, client)
+		}
+	}
+}
+
+// clientIP returns the IP address of the client sending the request.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// writeTooManyRequests replies with 429 and a Retry-After header
+// containing the delay rounded up to the next second.
+func writeTooManyRequests(w http.ResponseWriter, delay time.Duration) {
+	seconds := max(int(math.Ceil(delay.Seconds())), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	w.WriteHeader(http.StatusTooManyRequests)
+}
@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// ExchangeRaw sends a raw DNS message and returns the raw DNS response.
+//
+// Unlike [*Transport.Exchange], this method sends the message as is, without
+// adding padding or EDNS(0) options, and only checks the HTTP status code and
+// content type. This allows to send messages with arbitrary opcodes (e.g.,
+// DNS UPDATE) to investigate how servers handle unusual messages.
+//
+// Like [*Transport.Exchange], this method honors the Method and MaxGETURLLength
+// fields. This method does not call the Transport observation hooks.
+func (dt *Transport) ExchangeRaw(ctx context.Context, rawQuery []byte) ([]byte, error) {
+	// 1. Create the HTTP request
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, dt.URL, bytes.NewReader(rawQuery))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/dns-message")
+	if httpReq, err = dt.maybeGETRequest(ctx, httpReq, rawQuery); err != nil {
+		return nil, err
+	}
+	if dt.AcceptEncoding != "" {
+		httpReq.Header.Set("Accept-Encoding", dt.AcceptEncoding)
+	}
+
+	// 2. Do the HTTP round trip
+	httpResp, err := dt.Client.Do(httpReq)
+	if err != nil {
+		return nil, withContextCause(ctx, err)
+	}
+	defer httpResp.Body.Close()
+
+	// 3. Ensure that the response makes sense
+	if httpResp.StatusCode != 200 {
+		return nil, dnscodec.ErrServerMisbehaving
+	}
+	if httpResp.Header.Get("content-type") != "application/dns-message" {
+		return nil, dnscodec.ErrServerMisbehaving
+	}
+
+	// 4. Read the raw response
+	rawResp, err := readRawResponse(ctx, httpResp)
+	return rawResp, withContextCause(ctx, err)
+}
+
+// ExchangeMsg is like [*Transport.ExchangeRaw] but takes and returns a [*dns.Msg].
+//
+// The validation is relaxed compared to [*Transport.Exchange]: we only require the
+// response to be a response with the same ID and opcode as the query, which allows
+// to use opcodes other than QUERY. Otherwise, we return [dnscodec.ErrInvalidResponse].
+// Note that we do not map the response RCODE to an error.
+func (dt *Transport) ExchangeMsg(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	// 1. Serialize the query
+	rawQuery, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Perform the exchange
+	rawResp, err := dt.ExchangeRaw(ctx, rawQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	// 3. Parse and validate the response
+	resp := &dns.Msg{}
+	if err := resp.Unpack(rawResp); err != nil {
+		return nil, dnscodec.ErrServerMisbehaving
+	}
+	if !resp.Response || resp.Id != query.Id || resp.Opcode != query.Opcode {
+		return nil, dnscodec.ErrInvalidResponse
+	}
+	return resp, nil
+}
@@ -0,0 +1,90 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newUpdateMsg returns a DNS UPDATE message for example.com.
+func newUpdateMsg() *dns.Msg {
+	msg := &dns.Msg{}
+	msg.SetUpdate("example.com.")
+	return msg
+}
+
+func TestExchangeMsgUpdate(t *testing.T) {
+	var gotQuery *dns.Msg
+	srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+		gotQuery = query
+		resp := &dns.Msg{}
+		resp.SetRcode(query, dns.RcodeNotImplemented)
+		return resp
+	})
+	defer srv.Close()
+
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	query := newUpdateMsg()
+	resp, err := dt.ExchangeMsg(context.Background(), query)
+	require.NoError(t, err)
+
+	require.NotNil(t, gotQuery)
+	assert.Equal(t, dns.OpcodeUpdate, gotQuery.Opcode)
+	assert.Nil(t, gotQuery.IsEdns0())
+	assert.Equal(t, dns.OpcodeUpdate, resp.Opcode)
+	assert.Equal(t, dns.RcodeNotImplemented, resp.Rcode)
+}
+
+func TestExchangeMsgInvalidResponse(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// mutate modifies the response.
+		mutate func(resp *dns.Msg)
+	}
+
+	testCases := []testCase{
+		{name: "not a response", mutate: func(resp *dns.Msg) { resp.Response = false }},
+		{name: "ID mismatch", mutate: func(resp *dns.Msg) { resp.Id++ }},
+		{name: "opcode mismatch", mutate: func(resp *dns.Msg) { resp.Opcode = dns.OpcodeQuery }},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+				resp := &dns.Msg{}
+				resp.SetReply(query)
+				tc.mutate(resp)
+				return resp
+			})
+			defer srv.Close()
+
+			dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+			_, err := dt.ExchangeMsg(context.Background(), newUpdateMsg())
+			require.ErrorIs(t, err, dnscodec.ErrInvalidResponse)
+		})
+	}
+}
+
+func TestExchangeRawHTTPError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	rawQuery, err := newUpdateMsg().Pack()
+	require.NoError(t, err)
+	_, err = dt.ExchangeRaw(context.Background(), rawQuery)
+	require.ErrorIs(t, err, dnscodec.ErrServerMisbehaving)
+}
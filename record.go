@@ -0,0 +1,146 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ExchangeRecord is the serializable representation of an [*ExchangeEvent].
+//
+// When serialized, it is an object with these fields:
+//
+//   - "url" (string): the server URL;
+//   - "query_name" (string): the name we were asked to resolve;
+//   - "query_type" (string): the query type (e.g., "A");
+//   - "t0" (string): the start time using RFC 3339 with nanoseconds;
+//   - "t" (number): the exchange duration in seconds;
+//   - "jitter" (number): the delay waited before "t0" in seconds;
+//   - "raw_query" (bytes or null): the raw query;
+//   - "raw_response" (bytes or null): the raw response;
+//   - "http_method" (string): the request method (e.g., "POST");
+//   - "http_protocol" (string): the response protocol (e.g., "HTTP/2.0");
+//   - "insecure" (bool): whether the response was received without TLS;
+//   - "content_encoding" (string): the response Content-Encoding;
+//   - "id_mismatch" (bool): whether the response ID differed from the query ID;
+//   - "anomalies" (array of strings): the anomalies (e.g., "id_mismatch");
+//   - "tls" (object or null): the [*TLSRecord] describing the connection;
+//   - "bootstrap_t0" (number or null): the start time of the lookup of the
+//     server hostname in seconds relative to "t0" or null without a lookup;
+//   - "bootstrap_t" (number or null): the lookup duration in seconds;
+//   - "bootstrap_addrs" (array of strings): the addresses obtained by the lookup;
+//   - "bootstrap_failure" (string or null): the lookup error;
+//   - "tls_handshake_t0" (number or null): the TLS or QUIC handshake start
+//     time in seconds relative to "t0" or null without a handshake;
+//   - "tls_handshake_t" (number or null): the handshake duration in seconds;
+//   - "tls_handshake_failure" (string or null): the handshake error;
+//   - "alt_svc" (string): the Alt-Svc response header;
+//   - "http_date" (string or null): the Date response header using RFC 3339
+//     or null when missing or invalid;
+//   - "http_age" (number): the Age response header in seconds;
+//   - "http_cache_control" (string): the Cache-Control response header;
+//   - "http_cache_status" (string): the cache status response header;
+//   - "http_cache_hit" (bool): whether a cache likely served the response;
+//   - "conn_reused" (bool): whether the exchange reused a connection;
+//   - "conn_was_idle" (bool): whether the reused connection was idle;
+//   - "conn_idle_time" (number): for how long it was idle in seconds;
+//   - "failure" (string or null): the error string or null on success.
+//
+// Using JSON, bytes are base64-encoded strings.
+//
+// Construct using [NewExchangeRecord].
+type ExchangeRecord struct {
+	URL                 string     `json:"url"`
+	QueryName           string     `json:"query_name"`
+	QueryType           string     `json:"query_type"`
+	T0                  string     `json:"t0"`
+	T                   float64    `json:"t"`
+	Jitter              float64    `json:"jitter"`
+	RawQuery            []byte     `json:"raw_query"`
+	RawResponse         []byte     `json:"raw_response"`
+	HTTPMethod          string     `json:"http_method"`
+	HTTPProtocol        string     `json:"http_protocol"`
+	Insecure            bool       `json:"insecure"`
+	ContentEncoding     string     `json:"content_encoding"`
+	IDMismatch          bool       `json:"id_mismatch"`
+	Anomalies           []string   `json:"anomalies"`
+	TLS                 *TLSRecord `json:"tls"`
+	BootstrapT0         *float64   `json:"bootstrap_t0"`
+	BootstrapT          *float64   `json:"bootstrap_t"`
+	BootstrapAddrs      []string   `json:"bootstrap_addrs"`
+	BootstrapFailure    *string    `json:"bootstrap_failure"`
+	TLSHandshakeT0      *float64   `json:"tls_handshake_t0"`
+	TLSHandshakeT       *float64   `json:"tls_handshake_t"`
+	TLSHandshakeFailure *string    `json:"tls_handshake_failure"`
+	AltSvc              string     `json:"alt_svc"`
+	HTTPDate            *string    `json:"http_date"`
+	HTTPAge             float64    `json:"http_age"`
+	HTTPCacheControl    string     `json:"http_cache_control"`
+	HTTPCacheStatus     string     `json:"http_cache_status"`
+	HTTPCacheHit        bool       `json:"http_cache_hit"`
+	ConnReused          bool       `json:"conn_reused"`
+	ConnWasIdle         bool       `json:"conn_was_idle"`
+	ConnIdleTime        float64    `json:"conn_idle_time"`
+	Failure             *string    `json:"failure"`
+}
+
+// NewExchangeRecord converts an [*ExchangeEvent] to an [*ExchangeRecord].
+func NewExchangeRecord(ev *ExchangeEvent) *ExchangeRecord {
+	rec := &ExchangeRecord{
+		URL:              ev.URL,
+		QueryName:        ev.QueryName,
+		QueryType:        dns.TypeToString[ev.QueryType],
+		T0:               ev.StartTime.Format(time.RFC3339Nano),
+		T:                ev.Duration.Seconds(),
+		Jitter:           ev.JitterDelay.Seconds(),
+		RawQuery:         ev.RawQuery,
+		RawResponse:      ev.RawResponse,
+		BootstrapAddrs:   append([]string{}, ev.BootstrapAddrs...),
+		HTTPMethod:       ev.HTTPMethod,
+		HTTPProtocol:     ev.HTTPProtocol,
+		Insecure:         ev.Insecure,
+		ContentEncoding:  ev.ContentEncoding,
+		AltSvc:           ev.AltSvc,
+		HTTPAge:          ev.HTTPAge.Seconds(),
+		HTTPCacheControl: ev.HTTPCacheControl,
+		HTTPCacheStatus:  ev.HTTPCacheStatus,
+		HTTPCacheHit:     ev.HTTPCacheHit,
+		ConnReused:       ev.ConnReused,
+		ConnWasIdle:      ev.ConnWasIdle,
+		ConnIdleTime:     ev.ConnIdleTime.Seconds(),
+		IDMismatch:       ev.IDMismatch,
+		Anomalies:        append([]string{}, ev.Anomalies...),
+	}
+	if ev.TLS != nil {
+		rec.TLS = NewTLSRecord(ev.TLS)
+	}
+	if !ev.HTTPDate.IsZero() {
+		date := ev.HTTPDate.Format(time.RFC3339)
+		rec.HTTPDate = &date
+	}
+	if !ev.BootstrapStartTime.IsZero() {
+		t0 := ev.BootstrapStartTime.Sub(ev.StartTime).Seconds()
+		t := ev.BootstrapDuration.Seconds()
+		rec.BootstrapT0, rec.BootstrapT = &t0, &t
+		rec.BootstrapFailure = newFailure(ev.BootstrapErr)
+	}
+	if !ev.TLSHandshakeStartTime.IsZero() {
+		t0 := ev.TLSHandshakeStartTime.Sub(ev.StartTime).Seconds()
+		t := ev.TLSHandshakeDuration.Seconds()
+		rec.TLSHandshakeT0, rec.TLSHandshakeT = &t0, &t
+		rec.TLSHandshakeFailure = newFailure(ev.TLSHandshakeErr)
+	}
+	rec.Failure = newFailure(ev.Err)
+	return rec
+}
+
+// newFailure returns nil when err is nil and the error string otherwise.
+func newFailure(err error) *string {
+	if err == nil {
+		return nil
+	}
+	failure := err.Error()
+	return &failure
+}
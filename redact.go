@@ -0,0 +1,133 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/url"
+
+	"github.com/miekg/dns"
+)
+
+// RedactionPolicy removes privacy-sensitive data from [*ExchangeEvent].
+//
+// Use [*RedactionPolicy.Wrap] to apply the same policy to any
+// [Transport.ObserveExchange] hook (e.g., [*JSONLWriter], [*SinkObserver],
+// or [*SampledObserver]) before events reach logs or exporters.
+//
+// The zero value does not redact anything.
+type RedactionPolicy struct {
+	// HashQueryNames replaces the query name with the hex-encoded SHA-256
+	// digest of Salt followed by the name. Because raw messages embed the
+	// query name, it also drops RawQuery and RawResponse, as well as the
+	// query string of the URL embedded in a top-level [*url.Error], which
+	// contains the query when using GET (see [RequestMethod]).
+	HashQueryNames bool
+
+	// Salt is the OPTIONAL salt used by HashQueryNames.
+	Salt []byte
+
+	// DropAnswerAddrs replaces the addresses of A and AAAA records in
+	// RawResponse with the unspecified address of the same family.
+	DropAnswerAddrs bool
+
+	// DropRawMessages drops RawQuery and RawResponse.
+	DropRawMessages bool
+
+	// RedactURL removes user credentials and the query string from the
+	// URL, including the URL embedded in a top-level [*url.Error].
+	RedactURL bool
+}
+
+// Redact returns a redacted copy of ev according to the policy.
+func (p *RedactionPolicy) Redact(ev *ExchangeEvent) *ExchangeEvent {
+	out := *ev
+	if p.HashQueryNames {
+		digest := sha256.Sum256(append(append([]byte{}, p.Salt...), ev.QueryName...))
+		out.QueryName = hex.EncodeToString(digest[:])
+	}
+	if p.HashQueryNames || p.DropRawMessages {
+		out.RawQuery = nil
+		out.RawResponse = nil
+	}
+	if p.DropAnswerAddrs && out.RawResponse != nil {
+		out.RawResponse = redactAnswerAddrs(out.RawResponse)
+	}
+	if p.HashQueryNames {
+		out.Err = redactURLError(out.Err, stripURLQuery)
+	}
+	if p.RedactURL {
+		out.URL = redactURL(out.URL)
+		out.Err = redactURLError(out.Err, redactURL)
+	}
+	return &out
+}
+
+// redactURLError returns err with the URL redacted using redact when err is
+// a [*url.Error] and err otherwise.
+func redactURLError(err error, redact func(string) string) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) && urlErr == err {
+		return &url.Error{Op: urlErr.Op, URL: redact(urlErr.URL), Err: urlErr.Err}
+	}
+	return err
+}
+
+// Wrap returns a hook that redacts each event before passing it to observe.
+func (p *RedactionPolicy) Wrap(observe func(*ExchangeEvent)) func(*ExchangeEvent) {
+	return func(ev *ExchangeEvent) {
+		observe(p.Redact(ev))
+	}
+}
+
+// redactAnswerAddrs returns a copy of rawResp where A and AAAA records use
+// unspecified addresses or nil when rawResp cannot be processed.
+func redactAnswerAddrs(rawResp []byte) []byte {
+	msg := &dns.Msg{}
+	if err := msg.Unpack(rawResp); err != nil {
+		return nil
+	}
+	for _, rrs := range [][]dns.RR{msg.Answer, msg.Ns, msg.Extra} {
+		for _, rr := range rrs {
+			switch rr := rr.(type) {
+			case *dns.A:
+				rr.A = net.IPv4zero
+			case *dns.AAAA:
+				rr.AAAA = net.IPv6unspecified
+			}
+		}
+	}
+	out, err := msg.Pack()
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+// redactURL removes credentials and the query string from rawURL or returns
+// an empty string when rawURL cannot be parsed.
+func redactURL(rawURL string) string {
+	URL, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	URL.User = nil
+	URL.RawQuery = ""
+	URL.ForceQuery = false
+	return URL.String()
+}
+
+// stripURLQuery removes the query string from rawURL or returns
+// an empty string when rawURL cannot be parsed.
+func stripURLQuery(rawURL string) string {
+	URL, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	URL.RawQuery = ""
+	URL.ForceQuery = false
+	return URL.String()
+}
@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/bassosimone/dnscodec"
+)
+
+// ReloadableTransport is a DNS-over-HTTPS transport whose configuration
+// can be atomically replaced while exchanges are in flight.
+//
+// Each [*ReloadableTransport.Exchange] call uses the [*Transport] that was
+// current when the call started, so in-flight queries are not affected by
+// a concurrent [*ReloadableTransport.Reload].
+//
+// Construct using [NewReloadableTransport].
+type ReloadableTransport struct {
+	current atomic.Pointer[Transport]
+}
+
+// NewReloadableTransport creates a new [*ReloadableTransport] using dt as
+// the initial configuration.
+//
+// The caller MUST NOT modify dt after passing it to this function.
+func NewReloadableTransport(dt *Transport) *ReloadableTransport {
+	rt := &ReloadableTransport{}
+	rt.current.Store(dt)
+	return rt
+}
+
+// Reload atomically replaces the current configuration with dt.
+//
+// The caller MUST NOT modify dt after passing it to this function.
+func (rt *ReloadableTransport) Reload(dt *Transport) {
+	rt.current.Store(dt)
+}
+
+// Current returns the [*Transport] currently in use.
+//
+// The returned value MUST be treated as read-only.
+func (rt *ReloadableTransport) Current() *Transport {
+	return rt.current.Load()
+}
+
+// Exchange sends a [*dnscodec.Query] and receives a [*dnscodec.Response] using
+// the configuration that is current when the call starts.
+func (rt *ReloadableTransport) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	return rt.current.Load().Exchange(ctx, query)
+}
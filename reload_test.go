@@ -0,0 +1,73 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/bassosimone/httptestx"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReloadableTransportReload(t *testing.T) {
+	wantErr := errors.New("mocked error")
+	gotURLs := make(chan string, 2)
+	client := &httptestx.FuncClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		gotURLs <- req.URL.String()
+		return nil, wantErr
+	}}
+
+	first := dnsoverhttps.NewTransport(client, "https://a.example.com/dns-query")
+	rt := dnsoverhttps.NewReloadableTransport(first)
+	assert.Same(t, first, rt.Current())
+
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+	_, err := rt.Exchange(context.Background(), query)
+	require.ErrorIs(t, err, wantErr)
+	assert.Equal(t, "https://a.example.com/dns-query", <-gotURLs)
+
+	second := dnsoverhttps.NewTransport(client, "https://b.example.com/dns-query")
+	rt.Reload(second)
+	assert.Same(t, second, rt.Current())
+
+	_, err = rt.Exchange(context.Background(), query)
+	require.ErrorIs(t, err, wantErr)
+	assert.Equal(t, "https://b.example.com/dns-query", <-gotURLs)
+}
+
+func TestReloadableTransportInFlightUsesSnapshot(t *testing.T) {
+	wantErr := errors.New("mocked error")
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	var gotURL string
+	client := &httptestx.FuncClient{DoFunc: func(req *http.Request) (*http.Response, error) {
+		close(entered)
+		<-unblock
+		gotURL = req.URL.String()
+		return nil, wantErr
+	}}
+
+	rt := dnsoverhttps.NewReloadableTransport(
+		dnsoverhttps.NewTransport(client, "https://a.example.com/dns-query"))
+
+	done := make(chan error, 1)
+	go func() {
+		query := dnscodec.NewQuery("dns.google", dns.TypeA)
+		_, err := rt.Exchange(context.Background(), query)
+		done <- err
+	}()
+
+	<-entered
+	rt.Reload(dnsoverhttps.NewTransport(client, "https://b.example.com/dns-query"))
+	close(unblock)
+
+	require.ErrorIs(t, <-done, wantErr)
+	assert.Equal(t, "https://a.example.com/dns-query", gotURL)
+}
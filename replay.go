@@ -0,0 +1,130 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// ErrNoReplayRecord indicates that a [*ReplayExchanger] has no record for a query.
+var ErrNoReplayRecord = errors.New("no replay record for query")
+
+// ErrReplayedFailure wraps the failure of a recorded exchange without a response.
+var ErrReplayedFailure = errors.New("replayed failure")
+
+// ReplayMatching controls how a [*ReplayExchanger] matches queries to records.
+type ReplayMatching uint8
+
+const (
+	// ReplayMatchStrict matches the exact query name and type and
+	// uses each record once in the order in which we recorded them.
+	ReplayMatchStrict ReplayMatching = iota
+
+	// ReplayMatchLoose matches the query name case-insensitively, ignoring
+	// the trailing dot, and the query type, and allows to reuse records.
+	ReplayMatchLoose
+)
+
+// ReplayExchanger is an [Exchanger] serving recorded responses for recorded
+// queries, which allows to develop analysis code against real captured traffic
+// offline. We validate the recorded response against the recorded query using
+// the same pipeline used by [*Transport], hence we return the same errors.
+//
+// Construct using [NewReplayExchanger] or [LoadReplayExchanger].
+type ReplayExchanger struct {
+	// Matching is the matching policy.
+	//
+	// Set by [NewReplayExchanger] to [ReplayMatchStrict].
+	Matching ReplayMatching
+
+	// records contains the records to replay.
+	records []*ExchangeRecord
+
+	// used tracks the records used with [ReplayMatchStrict].
+	used []bool
+
+	// mu protects used.
+	mu sync.Mutex
+}
+
+var _ Exchanger = &ReplayExchanger{}
+
+// NewReplayExchanger creates a new [*ReplayExchanger] replaying records.
+func NewReplayExchanger(records []*ExchangeRecord) *ReplayExchanger {
+	return &ReplayExchanger{records: records, used: make([]bool, len(records))}
+}
+
+// LoadReplayExchanger reads all the records of an archive and creates
+// a new [*ReplayExchanger] replaying them.
+func LoadReplayExchanger(r *ArchiveReader) (*ReplayExchanger, error) {
+	var records []*ExchangeRecord
+	for {
+		rec, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return NewReplayExchanger(records), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, rec)
+	}
+}
+
+// Exchange implements [Exchanger].
+func (rx *ReplayExchanger) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	// 1. find the matching record
+	rec := rx.find(query)
+	if rec == nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoReplayRecord, query.Name, dns.TypeToString[query.Type])
+	}
+
+	// 2. replay failures without a response
+	if rec.RawResponse == nil {
+		return nil, fmt.Errorf("%w: %s", ErrReplayedFailure, *rec.Failure)
+	}
+
+	// 3. validate the recorded response for the recorded query
+	queryMsg := &dns.Msg{}
+	if err := queryMsg.Unpack(rec.RawQuery); err != nil {
+		return nil, dnscodec.ErrInvalidQuery
+	}
+	return parseRawResponse(queryMsg, rec.RawResponse, nil)
+}
+
+// find returns the record matching the query or nil.
+func (rx *ReplayExchanger) find(query *dnscodec.Query) *ExchangeRecord {
+	rx.mu.Lock()
+	defer rx.mu.Unlock()
+	qtype := dns.TypeToString[query.Type]
+	for idx, rec := range rx.records {
+		// skip records we cannot replay (e.g., redacted records)
+		if rec.RawResponse == nil && rec.Failure == nil {
+			continue
+		}
+		switch rx.Matching {
+		case ReplayMatchLoose:
+			if rec.QueryType == qtype && replayEqualName(rec.QueryName, query.Name) {
+				return rec
+			}
+		default:
+			if !rx.used[idx] && rec.QueryType == qtype && rec.QueryName == query.Name {
+				rx.used[idx] = true
+				return rec
+			}
+		}
+	}
+	return nil
+}
+
+// replayEqualName compares names case-insensitively ignoring the trailing dot.
+func replayEqualName(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
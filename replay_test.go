@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/bassosimone/httptestx"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newReplayArchive records a session containing a successful exchange, an
+// NXDOMAIN exchange, and a failed exchange and returns the archive reader.
+func newReplayArchive(t *testing.T) *dnsoverhttps.ArchiveReader {
+	srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+		resp := &dns.Msg{}
+		if query.Question[0].Name == "nonexistent.example.com." {
+			resp.SetRcode(query, dns.RcodeNameError)
+			return resp
+		}
+		require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+		return resp
+	})
+	defer srv.Close()
+
+	buff := &bytes.Buffer{}
+	aw := dnsoverhttps.NewArchiveWriter(buff, dnsoverhttps.NewArchiveHeader(nil))
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	dt.ObserveExchange = aw.ObserveExchange
+	_, _ = dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+	_, _ = dt.Exchange(context.Background(), dnscodec.NewQuery("nonexistent.example.com", dns.TypeA))
+
+	failing := dnsoverhttps.NewTransport(&httptestx.FuncClient{DoFunc: func(*http.Request) (*http.Response, error) {
+		return nil, errors.New("connection reset")
+	}}, "https://example.com/dns-query")
+	failing.ObserveExchange = aw.ObserveExchange
+	_, _ = failing.Exchange(context.Background(), dnscodec.NewQuery("reset.example.com", dns.TypeA))
+	require.NoError(t, aw.Err())
+
+	return dnsoverhttps.NewArchiveReader(buff)
+}
+
+func TestReplayExchangerStrict(t *testing.T) {
+	rx, err := dnsoverhttps.LoadReplayExchanger(newReplayArchive(t))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	// the successful exchange replays once
+	resp, err := rx.Exchange(ctx, dnscodec.NewQuery("dns.google", dns.TypeA))
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.ValidRRs)
+	_, err = rx.Exchange(ctx, dnscodec.NewQuery("dns.google", dns.TypeA))
+	require.ErrorIs(t, err, dnsoverhttps.ErrNoReplayRecord)
+
+	// strict matching does not match a different case or type
+	_, err = rx.Exchange(ctx, dnscodec.NewQuery("NONEXISTENT.example.com", dns.TypeA))
+	require.ErrorIs(t, err, dnsoverhttps.ErrNoReplayRecord)
+	_, err = rx.Exchange(ctx, dnscodec.NewQuery("nonexistent.example.com", dns.TypeAAAA))
+	require.ErrorIs(t, err, dnsoverhttps.ErrNoReplayRecord)
+
+	// negative answers replay as negative answers
+	_, err = rx.Exchange(ctx, dnscodec.NewQuery("nonexistent.example.com", dns.TypeA))
+	require.ErrorIs(t, err, dnscodec.ErrNoName)
+
+	// failures without a response replay as failures
+	_, err = rx.Exchange(ctx, dnscodec.NewQuery("reset.example.com", dns.TypeA))
+	require.ErrorIs(t, err, dnsoverhttps.ErrReplayedFailure)
+	assert.Contains(t, err.Error(), "connection reset")
+}
+
+func TestReplayExchangerLoose(t *testing.T) {
+	rx, err := dnsoverhttps.LoadReplayExchanger(newReplayArchive(t))
+	require.NoError(t, err)
+	rx.Matching = dnsoverhttps.ReplayMatchLoose
+
+	for range 2 {
+		resp, err := rx.Exchange(context.Background(), dnscodec.NewQuery("DNS.Google.", dns.TypeA))
+		require.NoError(t, err)
+		assert.NotEmpty(t, resp.ValidRRs)
+	}
+}
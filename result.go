@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/bassosimone/dnscodec"
+)
+
+// ExchangeResult is a [*dnscodec.Response] along with the raw messages.
+type ExchangeResult struct {
+	// Response is the parsed response.
+	Response *dnscodec.Response
+
+	// RawQuery is the raw query we sent.
+	RawQuery []byte
+
+	// RawResponse is the unmodified raw response body.
+	RawResponse []byte
+
+	// Anomalies contains the anomalies we noticed in the response (e.g.,
+	// [AnomalyIDMismatch]), like the [ExchangeEvent] Anomalies.
+	Anomalies []string
+}
+
+// ExchangeWithRaw is like [*Transport.Exchange] but also returns the raw
+// query and response, which is useful for archiving, without requiring to
+// register hooks, and the anomalies of the response. This method also
+// calls the configured hooks.
+func (dt *Transport) ExchangeWithRaw(ctx context.Context, query *dnscodec.Query) (*ExchangeResult, error) {
+	resp, rawQuery, rawResp, err := dt.exchangeSavingRaw(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &ExchangeResult{
+		Response:    resp,
+		RawQuery:    rawQuery,
+		RawResponse: rawResp,
+		Anomalies:   dt.anomalies(rawQuery, rawResp, resp),
+	}, nil
+}
+
+// exchangeSavingRaw is like [*Transport.Exchange] but also returns the raw
+// query and the raw response, if any, even on failure.
+func (dt *Transport) exchangeSavingRaw(ctx context.Context,
+	query *dnscodec.Query) (*dnscodec.Response, []byte, []byte, error) {
+	var rawQuery, rawResp []byte
+	child := *dt
+	child.ObserveRawQuery = func(raw []byte) {
+		rawQuery = raw
+		if dt.ObserveRawQuery != nil {
+			dt.ObserveRawQuery(bytes.Clone(raw))
+		}
+	}
+	child.ObserveRawResponse = func(raw []byte) {
+		rawResp = raw
+		if dt.ObserveRawResponse != nil {
+			dt.ObserveRawResponse(bytes.Clone(raw))
+		}
+	}
+	resp, err := child.Exchange(ctx, query)
+	return resp, rawQuery, rawResp, err
+}
@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/bassosimone/httptestx"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExchangeWithRaw(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		var wantRawResp []byte
+		srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+			wantRawResp = buildDNSResponse(t, query)
+			resp := &dns.Msg{}
+			require.NoError(t, resp.Unpack(wantRawResp))
+			return resp
+		})
+		defer srv.Close()
+
+		var observedRawQuery []byte
+		dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+		dt.ObserveRawQuery = func(raw []byte) {
+			observedRawQuery = raw
+		}
+
+		result, err := dt.ExchangeWithRaw(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+		require.NoError(t, err)
+		require.NotNil(t, result.Response)
+		assert.NotEmpty(t, result.Response.ValidRRs)
+		assert.Equal(t, observedRawQuery, result.RawQuery)
+		assert.Equal(t, wantRawResp, result.RawResponse)
+	})
+
+	t.Run("anomalies without hooks", func(t *testing.T) {
+		srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+			resp := &dns.Msg{}
+			resp.SetReply(query)
+			resp.Answer = newBogonResponse("dns.google", "10.0.0.1").Answer
+			resp.Ns = []dns.RR{mustNewRR(t, "example.net. 60 IN NS ns.example.net.")}
+			return resp
+		})
+		defer srv.Close()
+
+		dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+		result, err := dt.ExchangeWithRaw(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+		require.NoError(t, err)
+		assert.Contains(t, result.Anomalies, dnsoverhttps.AnomalyBogonAnswer)
+		assert.Contains(t, result.Anomalies, dnsoverhttps.AnomalyOutOfBailiwick)
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		wantErr := errors.New("mocked error")
+		client := &httptestx.FuncClient{DoFunc: func(*http.Request) (*http.Response, error) {
+			return nil, wantErr
+		}}
+		dt := dnsoverhttps.NewTransport(client, "https://example.com/dns-query")
+
+		result, err := dt.ExchangeWithRaw(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+		require.ErrorIs(t, err, wantErr)
+		require.Nil(t, result)
+	})
+}
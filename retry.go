@@ -0,0 +1,42 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+)
+
+// ShouldRetrySafe is the default [Campaign] ShouldRetry policy.
+//
+// It only retries when the query definitely did not reach the server, that is,
+// when we failed to resolve the server name, to connect, or to complete the TLS
+// handshake. Other errors (e.g., failing to read the response body or receiving
+// an unexpected status code) are ambiguous, since the server may have processed
+// the query, so retrying them could double-count server-side effects (e.g., the
+// queries counted by rate limiters or the cache warmed by the first query).
+//
+// Use [ShouldFallbackDefault] to retry on ambiguous errors as well.
+func ShouldRetrySafe(err error) bool {
+	var (
+		dnsErr    *net.DNSError
+		opErr     *net.OpError
+		certErr   *tls.CertificateVerificationError
+		recordErr tls.RecordHeaderError
+		alertErr  tls.AlertError
+	)
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.As(err, &dnsErr):
+		return true
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return true
+	case errors.As(err, &certErr), errors.As(err, &recordErr), errors.As(err, &alertErr):
+		return true
+	default:
+		return false
+	}
+}
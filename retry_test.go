@@ -0,0 +1,103 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShouldRetrySafe(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// err is the error to classify.
+		err error
+
+		// want is the expected result.
+		want bool
+	}
+
+	testCases := []testCase{
+		{
+			name: "DNS error",
+			err:  fmt.Errorf("Post: %w", &net.DNSError{Err: "no such host", Name: "dns.example"}),
+			want: true,
+		},
+
+		{
+			name: "connect error",
+			err:  &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")},
+			want: true,
+		},
+
+		{
+			name: "TLS alert",
+			err:  &net.OpError{Op: "remote error", Err: tls.AlertError(40)},
+			want: true,
+		},
+
+		{
+			name: "read error",
+			err:  &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")},
+			want: false,
+		},
+
+		{
+			name: "server misbehaving",
+			err:  dnscodec.ErrServerMisbehaving,
+			want: false,
+		},
+
+		{
+			name: "negative answer",
+			err:  dnscodec.ErrNoName,
+			want: false,
+		},
+
+		{
+			name: "context error",
+			err:  context.DeadlineExceeded,
+			want: false,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, dnsoverhttps.ShouldRetrySafe(tt.err))
+		})
+	}
+}
+
+func TestShouldRetrySafeWithTransport(t *testing.T) {
+	t.Run("connection refused", func(t *testing.T) {
+		srv := httptest.NewServer(dnsHandler(t))
+		srv.Close()
+		dt := dnsoverhttps.NewTransport(http.DefaultClient, srv.URL)
+		_, err := dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+		require.Error(t, err)
+		assert.True(t, dnsoverhttps.ShouldRetrySafe(err))
+	})
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		srv := httptest.NewTLSServer(dnsHandler(t))
+		defer srv.Close()
+		dt := dnsoverhttps.NewTransport(&http.Client{Transport: &http.Transport{}}, srv.URL)
+		_, err := dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+		require.Error(t, err)
+		assert.True(t, dnsoverhttps.ShouldRetrySafe(err))
+	})
+}
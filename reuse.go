@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+)
+
+// SerialExchange is the result of one exchange of [*Transport.MeasureSerialReuse].
+type SerialExchange struct {
+	// Position is the zero-based position of the exchange in the sequence.
+	Position int
+
+	// Duration is the exchange duration.
+	Duration time.Duration
+
+	// ConnReused is true when the exchange reused an existing connection.
+	ConnReused bool
+
+	// Err is the exchange error or nil on success.
+	Err error
+}
+
+// SerialReuseResult is the result of [*Transport.MeasureSerialReuse].
+type SerialReuseResult struct {
+	// Exchanges contains the exchanges in order of position.
+	Exchanges []*SerialExchange
+
+	// AllReused is true when every exchange but the first one reused
+	// a connection, i.e., the measurement did not open new connections
+	// midway and the per-position latencies are comparable.
+	AllReused bool
+}
+
+// MeasureSerialReuse issues count copies of the query strictly sequentially,
+// such that each exchange reuses the connection left idle by the previous one,
+// and reports the per-position latency. Comparing the first position with the
+// following ones isolates the cost of connection setup, while the trend across
+// the following positions exposes server-side per-stream costs.
+//
+// Because exchanges never overlap, the [Client] never races to open additional
+// connections. For meaningful results, the [Client] should not be shared with
+// concurrent users and should allow keeping idle connections. Like
+// [*Transport.Exchange], this method calls the observation hooks. We stop
+// early when the context is done.
+func (dt *Transport) MeasureSerialReuse(ctx context.Context, query *dnscodec.Query, count int) *SerialReuseResult {
+	// 1. use a copy of the transport to also observe each exchange
+	var event *ExchangeEvent
+	tx := *dt
+	tx.ObserveExchange = func(ev *ExchangeEvent) {
+		event = ev
+		if dt.ObserveExchange != nil {
+			dt.ObserveExchange(ev)
+		}
+	}
+
+	// 2. perform the exchanges one after the other
+	result := &SerialReuseResult{AllReused: true}
+	for idx := 0; idx < count && ctx.Err() == nil; idx++ {
+		event = nil
+		t0 := time.Now()
+		_, err := tx.Exchange(ctx, query)
+		ex := &SerialExchange{Position: idx, Duration: time.Since(t0), Err: err}
+		if event != nil {
+			ex.Duration = event.Duration
+			ex.ConnReused = event.ConnReused
+		}
+		if idx > 0 && !ex.ConnReused {
+			result.AllReused = false
+		}
+		result.Exchanges = append(result.Exchanges, ex)
+	}
+	return result
+}
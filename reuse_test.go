@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportMeasureSerialReuse(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		addrs = map[string]bool{}
+	)
+	handler := dnsHandler(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		addrs[r.RemoteAddr] = true
+		mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	observed := 0
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	dt.ObserveExchange = func(ev *dnsoverhttps.ExchangeEvent) {
+		observed++
+	}
+
+	result := dt.MeasureSerialReuse(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA), 4)
+	require.Len(t, result.Exchanges, 4)
+	assert.True(t, result.AllReused)
+	assert.Equal(t, 4, observed)
+	assert.Len(t, addrs, 1)
+	for idx, ex := range result.Exchanges {
+		assert.Equal(t, idx, ex.Position)
+		assert.NoError(t, ex.Err)
+		assert.Positive(t, ex.Duration)
+		assert.Equal(t, idx > 0, ex.ConnReused)
+	}
+}
+
+func TestTransportMeasureSerialReuseNewConnections(t *testing.T) {
+	srv := httptest.NewServer(dnsHandler(t))
+	defer srv.Close()
+
+	// closing each connection forces the next exchange to open a new one
+	srv.Config.SetKeepAlivesEnabled(false)
+
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	result := dt.MeasureSerialReuse(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA), 3)
+	require.Len(t, result.Exchanges, 3)
+	assert.False(t, result.AllReused)
+	for _, ex := range result.Exchanges {
+		assert.NoError(t, ex.Err)
+		assert.False(t, ex.ConnReused)
+	}
+}
+
+func TestTransportMeasureSerialReuseCanceled(t *testing.T) {
+	srv := httptest.NewServer(dnsHandler(t))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	result := dt.MeasureSerialReuse(ctx, dnscodec.NewQuery("dns.google", dns.TypeA), 3)
+	assert.Empty(t, result.Exchanges)
+	assert.True(t, result.AllReused)
+}
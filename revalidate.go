@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"net/netip"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// Anomalies annotated by [Revalidate] and in [ExchangeEvent] and [ExchangeResult] Anomalies.
+const (
+	// AnomalyIDMismatch indicates that the response ID differs from the query ID.
+	AnomalyIDMismatch = "id_mismatch"
+
+	// AnomalyTruncated indicates that the response has the TC bit set.
+	AnomalyTruncated = "truncated"
+
+	// AnomalyUnpaddedResponse indicates that the query used padding
+	// but the response did not, which violates RFC 8467.
+	AnomalyUnpaddedResponse = "unpadded_response"
+
+	// AnomalyDiscardedAnswers indicates that the answer section contains
+	// RRs that are not valid for the query and we therefore discarded.
+	AnomalyDiscardedAnswers = "discarded_answers"
+
+	// AnomalyExtendedError indicates that the response includes an
+	// extended DNS error (RFC 8914) option.
+	AnomalyExtendedError = "extended_error"
+
+	// AnomalyBogonAnswer indicates that the answer section contains private,
+	// loopback, or otherwise reserved addresses for a public name. See [FindBogons].
+	AnomalyBogonAnswer = "bogon_answer"
+
+	// AnomalyBlockpageAnswer indicates that the answer section contains addresses
+	// of known blockpages or sinkholes. See [Transport.BlockpageMatcher].
+	AnomalyBlockpageAnswer = "blockpage_answer"
+
+	// AnomalyOutOfBailiwick indicates that the authority section contains
+	// RRs for unrelated zones. See [FindOutOfBailiwick].
+	AnomalyOutOfBailiwick = "out_of_bailiwick"
+)
+
+// RevalidationResult is the result of [Revalidate].
+type RevalidationResult struct {
+	// Response is the parsed response or nil on failure.
+	Response *dnscodec.Response
+
+	// Anomalies contains the anomalies we noticed (e.g., [AnomalyIDMismatch]).
+	Anomalies []string
+
+	// Err is the validation error or nil on success.
+	Err error
+}
+
+// Revalidate runs the validation and parsing pipeline used by [*Transport.Exchange]
+// on an archived raw query and raw response (e.g., saved using the observation
+// hooks, a [*CaptureWriter], or a [*DnstapWriter]), and annotates anomalies,
+// which allows to reprocess historical measurements using newer logic.
+//
+// The validation is the same used by [*Transport] without TolerateIDMismatch
+// and we check for bogons using [DefaultBogonPrefixes].
+// We annotate anomalies even when the validation fails.
+func Revalidate(rawQuery, rawResp []byte) *RevalidationResult {
+	// 1. parse the query and the response
+	result := &RevalidationResult{}
+	queryMsg := &dns.Msg{}
+	if err := queryMsg.Unpack(rawQuery); err != nil {
+		result.Err = dnscodec.ErrInvalidQuery
+		return result
+	}
+	respMsg := &dns.Msg{}
+	if err := respMsg.Unpack(rawResp); err != nil {
+		result.Err = dnscodec.ErrServerMisbehaving
+		return result
+	}
+
+	// 2. run the validation pipeline and annotate the anomalies
+	result.Response, result.Err = parseRawResponse(queryMsg, rawResp, nil)
+	result.Anomalies = annotateAnomalies(queryMsg, respMsg, result.Response, &anomalyConfig{})
+	return result
+}
+
+// rawAnomalies is like [annotateAnomalies] but takes the raw query and
+// the raw response and returns nil if we cannot parse them.
+func rawAnomalies(rawQuery, rawResp []byte, resp *dnscodec.Response, config *anomalyConfig) []string {
+	queryMsg, respMsg := &dns.Msg{}, &dns.Msg{}
+	if queryMsg.Unpack(rawQuery) != nil || respMsg.Unpack(rawResp) != nil {
+		return nil
+	}
+	return annotateAnomalies(queryMsg, respMsg, resp, config)
+}
+
+// anomalyConfig configures the optional checks of [annotateAnomalies].
+type anomalyConfig struct {
+	// bogons contains the bogon prefixes (see [FindBogons]).
+	bogons []netip.Prefix
+
+	// blockpages is the OPTIONAL blockpage [AddrMatcher].
+	blockpages AddrMatcher
+
+	// ttls is the OPTIONAL [*TTLAnalyzer].
+	ttls *TTLAnalyzer
+}
+
+// annotateAnomalies returns the anomalies of the given query and response
+// messages and parsed response, which is nil when the validation failed.
+func annotateAnomalies(queryMsg, respMsg *dns.Msg, resp *dnscodec.Response, config *anomalyConfig) []string {
+	var anomalies []string
+	if respMsg.Id != queryMsg.Id {
+		anomalies = append(anomalies, AnomalyIDMismatch)
+	}
+	if respMsg.Truncated {
+		anomalies = append(anomalies, AnomalyTruncated)
+	}
+	if hasEDNS0Option(queryMsg, dns.EDNS0PADDING) && !hasEDNS0Option(respMsg, dns.EDNS0PADDING) {
+		anomalies = append(anomalies, AnomalyUnpaddedResponse)
+	}
+	if hasEDNS0Option(respMsg, dns.EDNS0EDE) {
+		anomalies = append(anomalies, AnomalyExtendedError)
+	}
+	if resp != nil && len(resp.ValidRRs) < len(respMsg.Answer) {
+		anomalies = append(anomalies, AnomalyDiscardedAnswers)
+	}
+	if len(FindBogons(respMsg, config.bogons)) > 0 {
+		anomalies = append(anomalies, AnomalyBogonAnswer)
+	}
+	if len(FindOutOfBailiwick(respMsg)) > 0 {
+		anomalies = append(anomalies, AnomalyOutOfBailiwick)
+	}
+	if config.blockpages != nil && len(FindBlockpages(respMsg, config.blockpages)) > 0 {
+		anomalies = append(anomalies, AnomalyBlockpageAnswer)
+	}
+	if config.ttls != nil {
+		anomalies = append(anomalies, config.ttls.Analyze(respMsg)...)
+	}
+	return anomalies
+}
+
+// hasEDNS0Option returns whether the message includes the given EDNS(0) option.
+func hasEDNS0Option(msg *dns.Msg, code uint16) bool {
+	for _, option := range ResponseEDNS0Options(msg) {
+		if option.Option() == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRevalidate(t *testing.T) {
+	// create a padded raw query like the transport does
+	_, queryMsg, err := dnsoverhttps.NewRequest(context.Background(),
+		dnscodec.NewQuery("dns.google", dns.TypeA), "https://dns.google/dns-query")
+	require.NoError(t, err)
+	rawQuery, err := queryMsg.Pack()
+	require.NoError(t, err)
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// mutate modifies the padded valid response.
+		mutate func(resp *dns.Msg)
+
+		// wantAnomalies contains the expected anomalies.
+		wantAnomalies []string
+
+		// wantErr is the expected error (nil on success).
+		wantErr error
+	}
+
+	testCases := []testCase{
+		{
+			name:   "valid",
+			mutate: func(resp *dns.Msg) {},
+		},
+
+		{
+			name:          "unpadded and truncated",
+			mutate:        func(resp *dns.Msg) { resp.Extra = nil; resp.Truncated = true },
+			wantAnomalies: []string{dnsoverhttps.AnomalyTruncated, dnsoverhttps.AnomalyUnpaddedResponse},
+		},
+
+		{
+			name: "discarded answers",
+			mutate: func(resp *dns.Msg) {
+				resp.Answer = append(resp.Answer, &dns.A{
+					Hdr: dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeA, Class: dns.ClassINET},
+					A:   net.IPv4(10, 0, 0, 1),
+				})
+			},
+			wantAnomalies: []string{dnsoverhttps.AnomalyDiscardedAnswers, dnsoverhttps.AnomalyBogonAnswer},
+		},
+
+		{
+			name: "extended error",
+			mutate: func(resp *dns.Msg) {
+				resp.IsEdns0().Option = append(resp.IsEdns0().Option, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeFiltered})
+			},
+			wantAnomalies: []string{dnsoverhttps.AnomalyExtendedError},
+		},
+
+		{
+			name:          "ID mismatch",
+			mutate:        func(resp *dns.Msg) { resp.Id = 0x1234 },
+			wantAnomalies: []string{dnsoverhttps.AnomalyIDMismatch},
+			wantErr:       dnscodec.ErrInvalidResponse,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp := &dns.Msg{}
+			require.NoError(t, resp.Unpack(buildDNSResponse(t, queryMsg)))
+			resp.SetEdns0(dnscodec.QueryMaxResponseSizeTCP, false)
+			resp.IsEdns0().Option = append(resp.IsEdns0().Option, &dns.EDNS0_PADDING{Padding: make([]byte, 8)})
+			tc.mutate(resp)
+			rawResp, err := resp.Pack()
+			require.NoError(t, err)
+
+			result := dnsoverhttps.Revalidate(rawQuery, rawResp)
+			require.ErrorIs(t, result.Err, tc.wantErr)
+			assert.Equal(t, tc.wantAnomalies, result.Anomalies)
+			assert.Equal(t, tc.wantErr == nil, result.Response != nil)
+		})
+	}
+}
+
+func TestRevalidateInvalidMessages(t *testing.T) {
+	result := dnsoverhttps.Revalidate([]byte{0x00}, nil)
+	require.ErrorIs(t, result.Err, dnscodec.ErrInvalidQuery)
+
+	rawQuery, err := (&dns.Msg{Question: []dns.Question{{Name: "dns.google.", Qtype: dns.TypeA, Qclass: dns.ClassINET}}}).Pack()
+	require.NoError(t, err)
+	result = dnsoverhttps.Revalidate(rawQuery, []byte{0x00})
+	require.ErrorIs(t, result.Err, dnscodec.ErrServerMisbehaving)
+}
@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"strings"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+	"golang.org/x/net/publicsuffix"
+)
+
+// ReverseConfirmation is the result of reverse-resolving one address.
+type ReverseConfirmation struct {
+	// Addr is the address we reverse-resolved.
+	Addr string
+
+	// PTRNames contains the canonical names returned by the PTR lookup.
+	PTRNames []string
+
+	// Consistent is true when any PTR name is consistent with the forward
+	// name, i.e., it is the forward name, a subdomain of the forward name, or
+	// a sibling of the forward name (e.g., "a.example.com" for "b.example.com")
+	// whose parent is not a public suffix (e.g., not "a.co.uk" for "b.co.uk").
+	Consistent bool
+
+	// Err is the PTR lookup error or nil on success.
+	Err error
+}
+
+// ReverseConfirmer reverse-resolves the addresses returned by an [Exchanger]
+// and checks whether the PTR names are consistent with the forward name, which
+// is a common sanity check in measurement studies.
+//
+// Note that many legitimate addresses (e.g., CDNs) lack consistent PTR names, so
+// inconsistencies are hints to combine with other evidence rather than proofs.
+//
+// Construct using [NewReverseConfirmer].
+type ReverseConfirmer struct {
+	// Exchanger is the [Exchanger] used for the forward query.
+	//
+	// Set by [NewReverseConfirmer] to the user-provided value.
+	Exchanger Exchanger
+
+	// Control is the OPTIONAL [Exchanger] used for the PTR lookups (e.g., a
+	// [*Transport] using a control server). When nil, we use Exchanger.
+	Control Exchanger
+
+	// ObserveConfirmation is an optional hook called by [*ReverseConfirmer.Exchange]
+	// with the forward name and the result of [*ReverseConfirmer.Confirm].
+	ObserveConfirmation func(name string, confirmations []*ReverseConfirmation)
+}
+
+var _ Exchanger = &ReverseConfirmer{}
+
+// NewReverseConfirmer creates a new [*ReverseConfirmer].
+func NewReverseConfirmer(exchanger Exchanger) *ReverseConfirmer {
+	return &ReverseConfirmer{Exchanger: exchanger}
+}
+
+// Exchange implements [Exchanger].
+//
+// On success, it reverse-resolves the returned addresses and calls the
+// ObserveConfirmation hook. It always returns the forward result.
+func (rc *ReverseConfirmer) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	resp, err := rc.Exchanger.Exchange(ctx, query)
+	if err == nil && rc.ObserveConfirmation != nil {
+		rc.ObserveConfirmation(query.Name, rc.Confirm(ctx, query.Name, resp))
+	}
+	return resp, err
+}
+
+// Confirm reverse-resolves the A and AAAA addresses of the response to
+// a query for the given name and checks their consistency.
+func (rc *ReverseConfirmer) Confirm(ctx context.Context, name string, resp *dnscodec.Response) []*ReverseConfirmation {
+	control := rc.Control
+	if control == nil {
+		control = rc.Exchanger
+	}
+	var confirmations []*ReverseConfirmation
+	for _, addr := range answerAddrStrings(resp.ValidRRs) {
+		conf := &ReverseConfirmation{Addr: addr}
+		confirmations = append(confirmations, conf)
+		reverse, err := dns.ReverseAddr(addr)
+		if err != nil {
+			conf.Err = err
+			continue
+		}
+		ptrs, err := Lookup[*dns.PTR](ctx, control, reverse)
+		if err != nil {
+			conf.Err = err
+			continue
+		}
+		for _, ptr := range ptrs {
+			ptrName := dns.CanonicalName(ptr.Ptr)
+			conf.PTRNames = append(conf.PTRNames, ptrName)
+			conf.Consistent = conf.Consistent || isConsistentPTRName(name, ptrName)
+		}
+	}
+	return confirmations
+}
+
+// isConsistentPTRName returns whether the PTR name is the forward name, a subdomain
+// of the forward name, or a subdomain of the forward name parent, provided that
+// such a parent is not a public suffix (e.g., "com" or "co.uk"), since names
+// sharing a public suffix may belong to unrelated operators.
+func isConsistentPTRName(name, ptrName string) bool {
+	name = dns.CanonicalName(name)
+	if dns.IsSubDomain(name, ptrName) {
+		return true
+	}
+	labels := dns.SplitDomainName(name)
+	if len(labels) < 2 {
+		return false
+	}
+	parent := strings.Join(labels[1:], ".")
+	if _, err := publicsuffix.EffectiveTLDPlusOne(parent); err != nil {
+		return false
+	}
+	return dns.IsSubDomain(parent+".", ptrName)
+}
@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newReverseExchanger returns an exchanger answering A queries with the given
+// addresses and PTR queries using the given map, returning NXDOMAIN otherwise.
+func newReverseExchanger(addrs []string, ptrs map[string]string) dnsoverhttps.Exchanger {
+	return funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		hdr := dns.RR_Header{Name: dns.Fqdn(query.Name), Rrtype: query.Type, Class: dns.ClassINET, Ttl: 60}
+		resp := &dnscodec.Response{}
+		switch query.Type {
+		case dns.TypeA:
+			for _, addr := range addrs {
+				resp.ValidRRs = append(resp.ValidRRs, &dns.A{Hdr: hdr, A: net.ParseIP(addr)})
+			}
+		case dns.TypePTR:
+			ptr, found := ptrs[query.Name]
+			if !found {
+				return nil, dnscodec.ErrNoName
+			}
+			resp.ValidRRs = append(resp.ValidRRs, &dns.PTR{Hdr: hdr, Ptr: ptr})
+		}
+		return resp, nil
+	})
+}
+
+func TestReverseConfirmer(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// forward is the forward name.
+		forward string
+
+		// ptr is the PTR name of 8.8.8.8 ("" for NXDOMAIN).
+		ptr string
+
+		// wantConsistent is the expected Consistent value.
+		wantConsistent bool
+	}
+
+	testCases := []testCase{
+		{name: "same name", forward: "dns.google", ptr: "dns.google.", wantConsistent: true},
+		{name: "case insensitive", forward: "dns.google", ptr: "DNS.Google.", wantConsistent: true},
+		{name: "subdomain", forward: "example.com", ptr: "server1.example.com.", wantConsistent: true},
+		{name: "sibling", forward: "www.example.com", ptr: "server1.example.com.", wantConsistent: true},
+		{name: "unrelated", forward: "www.example.com", ptr: "blockpage.example.org.", wantConsistent: false},
+		{name: "same TLD only", forward: "example.com", ptr: "other.com.", wantConsistent: false},
+		{name: "same public suffix only", forward: "a.co.uk", ptr: "blockpage.co.uk.", wantConsistent: false},
+		{name: "sibling below public suffix", forward: "www.example.co.uk", ptr: "server1.example.co.uk.", wantConsistent: true},
+		{name: "no PTR", forward: "www.example.com", ptr: "", wantConsistent: false},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			ptrs := map[string]string{}
+			if tt.ptr != "" {
+				ptrs["8.8.8.8.in-addr.arpa."] = tt.ptr
+			}
+			rc := dnsoverhttps.NewReverseConfirmer(newReverseExchanger([]string{"8.8.8.8"}, ptrs))
+			var (
+				gotName string
+				got     []*dnsoverhttps.ReverseConfirmation
+			)
+			rc.ObserveConfirmation = func(name string, confirmations []*dnsoverhttps.ReverseConfirmation) {
+				gotName, got = name, confirmations
+			}
+
+			resp, err := rc.Exchange(context.Background(), dnscodec.NewQuery(tt.forward, dns.TypeA))
+			require.NoError(t, err)
+			require.Len(t, resp.ValidRRs, 1)
+			assert.Equal(t, tt.forward, gotName)
+			require.Len(t, got, 1)
+			assert.Equal(t, "8.8.8.8", got[0].Addr)
+			assert.Equal(t, tt.wantConsistent, got[0].Consistent)
+			if tt.ptr == "" {
+				require.ErrorIs(t, got[0].Err, dnscodec.ErrNoName)
+				assert.Empty(t, got[0].PTRNames)
+				return
+			}
+			require.NoError(t, got[0].Err)
+			assert.Equal(t, []string{dns.CanonicalName(tt.ptr)}, got[0].PTRNames)
+		})
+	}
+}
+
+func TestReverseConfirmerControl(t *testing.T) {
+	// the forward exchanger lacks PTR records while the control has them
+	rc := dnsoverhttps.NewReverseConfirmer(newReverseExchanger([]string{"8.8.8.8"}, nil))
+	rc.Control = newReverseExchanger(nil, map[string]string{"8.8.8.8.in-addr.arpa.": "dns.google."})
+
+	resp, err := rc.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+	require.NoError(t, err)
+	confirmations := rc.Confirm(context.Background(), "dns.google", resp)
+	require.Len(t, confirmations, 1)
+	require.NoError(t, confirmations[0].Err)
+	assert.True(t, confirmations[0].Consistent)
+}
@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import "sync/atomic"
+
+// SampledObserver forwards a subset of the [*ExchangeEvent] it observes
+// to another [Transport.ObserveExchange] hook.
+//
+// Set [*SampledObserver.ObserveExchange] as the [Transport.ObserveExchange] hook.
+//
+// Construct using [NewSampledObserver].
+type SampledObserver struct {
+	// Every causes the observer to forward one event every Every
+	// events. Zero or one means forwarding all events.
+	//
+	// Set by [NewSampledObserver] to the user-provided value.
+	Every uint64
+
+	// FailuresOnly causes the observer to drop all successful events.
+	FailuresOnly bool
+
+	// AlwaysFailures causes the observer to forward all failed events
+	// regardless of Every and without counting them.
+	AlwaysFailures bool
+
+	// Observe is the hook to forward sampled events to.
+	//
+	// Set by [NewSampledObserver] to the user-provided value.
+	Observe func(*ExchangeEvent)
+
+	// count counts the events subject to sampling.
+	count atomic.Uint64
+}
+
+// NewSampledObserver creates a new [*SampledObserver] forwarding one
+// every every events to observe.
+func NewSampledObserver(observe func(*ExchangeEvent), every uint64) *SampledObserver {
+	return &SampledObserver{Every: every, Observe: observe}
+}
+
+// ObserveExchange forwards the event if it is sampled.
+//
+// This method is safe to call from multiple goroutines.
+func (s *SampledObserver) ObserveExchange(ev *ExchangeEvent) {
+	if s.sampled(ev) {
+		s.Observe(ev)
+	}
+}
+
+// sampled returns whether we should forward the event.
+func (s *SampledObserver) sampled(ev *ExchangeEvent) bool {
+	switch {
+	case ev.Err != nil && (s.FailuresOnly || s.AlwaysFailures):
+		return true
+	case ev.Err == nil && s.FailuresOnly:
+		return false
+	case s.Every <= 1:
+		return true
+	default:
+		return (s.count.Add(1)-1)%s.Every == 0
+	}
+}
@@ -0,0 +1,80 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSampledObserver(t *testing.T) {
+	success := &dnsoverhttps.ExchangeEvent{}
+	failure := &dnsoverhttps.ExchangeEvent{Err: errors.New("mocked error")}
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// configure configures the observer.
+		configure func(s *dnsoverhttps.SampledObserver)
+
+		// events are the events to observe.
+		events []*dnsoverhttps.ExchangeEvent
+
+		// want are the events we expect to be forwarded.
+		want []*dnsoverhttps.ExchangeEvent
+	}
+
+	testCases := []testCase{
+		{
+			name:      "zero forwards everything",
+			configure: func(s *dnsoverhttps.SampledObserver) { s.Every = 0 },
+			events:    []*dnsoverhttps.ExchangeEvent{success, failure, success},
+			want:      []*dnsoverhttps.ExchangeEvent{success, failure, success},
+		},
+
+		{
+			name:      "one every three",
+			configure: func(s *dnsoverhttps.SampledObserver) { s.Every = 3 },
+			events:    []*dnsoverhttps.ExchangeEvent{success, failure, success, failure, success},
+			want:      []*dnsoverhttps.ExchangeEvent{success, failure},
+		},
+
+		{
+			name: "failures only",
+			configure: func(s *dnsoverhttps.SampledObserver) {
+				s.Every = 3
+				s.FailuresOnly = true
+			},
+			events: []*dnsoverhttps.ExchangeEvent{success, failure, success, failure},
+			want:   []*dnsoverhttps.ExchangeEvent{failure, failure},
+		},
+
+		{
+			name: "always failures",
+			configure: func(s *dnsoverhttps.SampledObserver) {
+				s.Every = 2
+				s.AlwaysFailures = true
+			},
+			events: []*dnsoverhttps.ExchangeEvent{success, failure, success, failure, success},
+			want:   []*dnsoverhttps.ExchangeEvent{success, failure, failure, success},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []*dnsoverhttps.ExchangeEvent
+			s := dnsoverhttps.NewSampledObserver(func(ev *dnsoverhttps.ExchangeEvent) {
+				got = append(got, ev)
+			}, 0)
+			tt.configure(s)
+			for _, ev := range tt.events {
+				s.ObserveExchange(ev)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// EndpointScore is the quality score of an [Exchanger] within a list of exchangers.
+type EndpointScore struct {
+	// Samples is the number of exchanges we scored.
+	Samples int
+
+	// Latency is the exponentially-weighted moving average of the latency of the
+	// exchanges where the server answered, or zero if the server never answered.
+	Latency time.Duration
+
+	// FailureRate is the exponentially-weighted moving average of failures,
+	// where failures count as one and answers, including negative ones, as zero.
+	FailureRate float64
+}
+
+// ScoreTracker tracks an [EndpointScore] for each [Exchanger] in a list, which
+// allows to select exchangers depending on their quality (e.g., [*ChainExchanger]
+// and [*StickyExchanger] record into their OPTIONAL Scores field).
+//
+// Construct using [NewScoreTracker].
+type ScoreTracker struct {
+	// Alpha is the weight in (0, 1] of each new sample.
+	//
+	// Set by [NewScoreTracker] to 0.2.
+	Alpha float64
+
+	// mu protects scores.
+	mu sync.Mutex
+
+	// scores contains the scores indexed by exchanger.
+	scores []EndpointScore
+}
+
+// NewScoreTracker creates a new [*ScoreTracker].
+func NewScoreTracker() *ScoreTracker {
+	return &ScoreTracker{Alpha: 0.2}
+}
+
+// Record scores an exchange using the exchanger with the given index.
+//
+// The first sample initializes the score. We do not use the latency of
+// failed exchanges because timeouts would bias the latency.
+//
+// This method is safe to call from multiple goroutines.
+func (st *ScoreTracker) Record(idx int, latency time.Duration, err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if idx >= len(st.scores) {
+		st.scores = append(st.scores, make([]EndpointScore, idx+1-len(st.scores))...)
+	}
+	score := &st.scores[idx]
+	failure := 1.0
+	if isAnswered(err) {
+		failure = 0
+		switch score.Latency {
+		case 0:
+			score.Latency = latency
+		default:
+			score.Latency = time.Duration(st.Alpha*float64(latency) + (1-st.Alpha)*float64(score.Latency))
+		}
+	}
+	switch score.Samples {
+	case 0:
+		score.FailureRate = failure
+	default:
+		score.FailureRate = st.Alpha*failure + (1-st.Alpha)*score.FailureRate
+	}
+	score.Samples++
+}
+
+// Scores returns a copy of the scores indexed by exchanger. Exchangers with
+// an index larger than the ones we scored so far have no score.
+//
+// This method is safe to call from multiple goroutines.
+func (st *ScoreTracker) Scores() []EndpointScore {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return slices.Clone(st.scores)
+}
+
+// record calls Record if the tracker is not nil.
+func (st *ScoreTracker) record(idx int, t0 time.Time, err error) {
+	if st != nil {
+		st.Record(idx, time.Since(t0), err)
+	}
+}
+
+// Better returns whether this score is better than the other score, i.e., whether
+// it has a lower FailureRate or the same FailureRate and a lower Latency. Since
+// both are zero without samples, we optimistically prefer unscored exchangers.
+func (s EndpointScore) Better(other EndpointScore) bool {
+	if s.FailureRate != other.FailureRate {
+		return s.FailureRate < other.FailureRate
+	}
+	return s.Latency < other.Latency
+}
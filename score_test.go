@@ -0,0 +1,119 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScoreTracker(t *testing.T) {
+	errFailed := errors.New("mocked failure")
+	st := dnsoverhttps.NewScoreTracker()
+	st.Alpha = 0.5
+
+	st.Record(1, 100*time.Millisecond, nil)
+	st.Record(1, 200*time.Millisecond, dnscodec.ErrNoName)
+	st.Record(1, time.Second, errFailed)
+
+	scores := st.Scores()
+	require.Len(t, scores, 2)
+	assert.Equal(t, dnsoverhttps.EndpointScore{}, scores[0])
+	assert.Equal(t, dnsoverhttps.EndpointScore{
+		Samples:     3,
+		Latency:     150 * time.Millisecond,
+		FailureRate: 0.5,
+	}, scores[1])
+
+	// the returned scores are a copy
+	scores[1].Samples = 0
+	assert.Equal(t, 3, st.Scores()[1].Samples)
+}
+
+func TestEndpointScoreBetter(t *testing.T) {
+	type testCase struct {
+		// name is the name of the test case.
+		name string
+
+		// a is the first score.
+		a dnsoverhttps.EndpointScore
+
+		// b is the second score.
+		b dnsoverhttps.EndpointScore
+
+		// want is whether a is better than b.
+		want bool
+	}
+
+	testCases := []testCase{{
+		name: "lower failure rate wins",
+		a:    dnsoverhttps.EndpointScore{Samples: 1, FailureRate: 0.1, Latency: time.Second},
+		b:    dnsoverhttps.EndpointScore{Samples: 1, FailureRate: 0.2, Latency: time.Millisecond},
+		want: true,
+	}, {
+		name: "lower latency breaks ties",
+		a:    dnsoverhttps.EndpointScore{Samples: 1, Latency: time.Second},
+		b:    dnsoverhttps.EndpointScore{Samples: 1, Latency: time.Millisecond},
+		want: false,
+	}, {
+		name: "unscored exchangers are preferred",
+		a:    dnsoverhttps.EndpointScore{},
+		b:    dnsoverhttps.EndpointScore{Samples: 1, Latency: time.Millisecond},
+		want: true,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.a.Better(tc.b))
+		})
+	}
+}
+
+func TestChainExchangerScores(t *testing.T) {
+	errFailed := errors.New("mocked failure")
+	failing := funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		return nil, errFailed
+	})
+	succeeding := funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		return &dnscodec.Response{}, nil
+	})
+	cx := dnsoverhttps.NewChainExchanger(failing, succeeding)
+	cx.Scores = dnsoverhttps.NewScoreTracker()
+
+	_, err := cx.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+	require.NoError(t, err)
+	scores := cx.Scores.Scores()
+	require.Len(t, scores, 2)
+	assert.Equal(t, 1.0, scores[0].FailureRate)
+	assert.Equal(t, 0.0, scores[1].FailureRate)
+	assert.Equal(t, 1, scores[1].Samples)
+}
+
+func TestStickyExchangerScores(t *testing.T) {
+	errFailed := errors.New("mocked failure")
+	first, firstFailing, _ := newToggleExchanger(errFailed)
+	second, secondFailing, _ := newToggleExchanger(errFailed)
+	third, _, _ := newToggleExchanger(errFailed)
+	sx := dnsoverhttps.NewStickyExchanger(first, second, third)
+	sx.MaxFailures = 1
+	sx.Scores = dnsoverhttps.NewScoreTracker()
+	defer sx.Close()
+
+	// the second exchanger has failed in the past, so we skip it
+	sx.Scores.Record(1, time.Millisecond, errFailed)
+	sx.Scores.Record(2, time.Millisecond, nil)
+	firstFailing.Store(true)
+	secondFailing.Store(true)
+	_, err := sx.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+	require.ErrorIs(t, err, errFailed)
+	assert.Equal(t, 2, sx.Current())
+	assert.Equal(t, 1.0, sx.Scores.Scores()[0].FailureRate)
+}
@@ -0,0 +1,248 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bassosimone/iox"
+	"github.com/miekg/dns"
+)
+
+// ScriptStep is a scripted behavior of a [*ScriptedHandler] for a query.
+//
+// The zero value replies normally.
+type ScriptStep struct {
+	// Delay OPTIONALLY delays the response.
+	Delay time.Duration
+
+	// Drop OPTIONALLY aborts the response without replying.
+	Drop bool
+
+	// StatusCode OPTIONALLY replies with the given HTTP status code
+	// and an empty body when it is nonzero and not 200.
+	StatusCode int
+
+	// WrongID OPTIONALLY replies using a response ID different from the query ID.
+	WrongID bool
+
+	// TruncateBody OPTIONALLY sends only the first half of the response body
+	// while advertising the full Content-Length.
+	TruncateBody bool
+
+	// Age OPTIONALLY sets the Age header, rounded down to seconds, as if an
+	// HTTP cache had been holding the response for the given time, which allows
+	// to test how clients handle cached responses (see [ExchangeEvent] HTTPAge).
+	// Since the handler never caches, this is the only way to set Age.
+	Age time.Duration
+
+	// Unpadded OPTIONALLY replies without padding even if the query uses padding.
+	Unpadded bool
+}
+
+// ScriptedHandler is an [http.Handler] implementing a DoH server with scripted
+// behaviors per query name, such as delays, dropped responses, wrong IDs,
+// truncated bodies, and status code sequences, which allows to exercise the
+// retry and failover logic of this and downstream packages deterministically.
+//
+// The handler accepts both GET and POST queries (RFC 8484 Section 4.1) and sets
+// Cache-Control using the minimum answer TTL or, for negative responses, the SOA
+// negative caching TTL (RFC 8484 Section 5.1), which allows HTTP caches to
+// store the response. The handler does not cache, so it only sends Age when
+// a [ScriptStep] scripts it for testing.
+//
+// When the query uses padding, the handler pads the response to a multiple of
+// 468 octets, as recommended by RFC 8467, so that proxies built using it do
+// not leak the response size.
+//
+// Mount it using [net/http/httptest] to obtain a test server.
+//
+// Construct using [NewScriptedHandler].
+type ScriptedHandler struct {
+	// Reply builds the response message for a query.
+	//
+	// Set by [NewScriptedHandler] to the user-provided value.
+	Reply func(query *dns.Msg) *dns.Msg
+
+	// RateLimit OPTIONALLY limits the number of queries per second of each client
+	// IP address using a token bucket holding up to RateBurst tokens, which keeps
+	// exposed test endpoints from being trivially abused. Limited queries receive
+	// a 429 response with a Retry-After header. Zero disables rate limiting.
+	RateLimit float64
+
+	// RateBurst is the OPTIONAL size of the RateLimit token bucket. Values
+	// lower than one mean one.
+	RateBurst int
+
+	// MaxConcurrent OPTIONALLY limits the number of queries we process
+	// concurrently. Excess queries receive a 429 response with a Retry-After
+	// header. Zero disables this limit.
+	MaxConcurrent int
+
+	// inflight is the number of queries we are processing.
+	inflight atomic.Int64
+
+	// limiter implements RateLimit.
+	limiter rateLimiter
+
+	// scripts maps canonical query names to the pending steps.
+	scripts map[string][]ScriptStep
+
+	// mu protects scripts.
+	mu sync.Mutex
+}
+
+var _ http.Handler = &ScriptedHandler{}
+
+// NewScriptedHandler creates a new [*ScriptedHandler] using reply to build the
+// response messages. When reply is nil, the handler replies with empty NOERROR
+// responses having the RA bit set.
+func NewScriptedHandler(reply func(query *dns.Msg) *dns.Msg) *ScriptedHandler {
+	if reply == nil {
+		reply = func(query *dns.Msg) *dns.Msg {
+			resp := &dns.Msg{}
+			resp.SetReply(query)
+			resp.RecursionAvailable = true
+			return resp
+		}
+	}
+	return &ScriptedHandler{Reply: reply, scripts: make(map[string][]ScriptStep)}
+}
+
+// Script appends steps to the script of the given query name. Each query for
+// the name consumes the next step. Once all the steps have been consumed, the
+// handler replies normally.
+func (h *ScriptedHandler) Script(name string, steps ...ScriptStep) {
+	key := scriptedKey(name)
+	h.mu.Lock()
+	h.scripts[key] = append(h.scripts[key], steps...)
+	h.mu.Unlock()
+}
+
+// ServeHTTP implements [http.Handler].
+func (h *ScriptedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// 1. enforce the abuse controls
+	if h.RateLimit > 0 {
+		if ok, delay := h.limiter.allow(clientIP(r), h.RateLimit, h.RateBurst, time.Now()); !ok {
+			writeTooManyRequests(w, delay)
+			return
+		}
+	}
+	if h.MaxConcurrent > 0 {
+		defer h.inflight.Add(-1)
+		if h.inflight.Add(1) > int64(h.MaxConcurrent) {
+			writeTooManyRequests(w, time.Second)
+			return
+		}
+	}
+
+	// 2. read and parse the query
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	rawQuery, err := readRequestQuery(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	query := &dns.Msg{}
+	if err := query.Unpack(rawQuery); err != nil || len(query.Question) != 1 {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// 3. apply the next scripted step
+	step := h.next(query.Question[0].Name)
+	if step.Delay > 0 {
+		select {
+		case <-time.After(step.Delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if step.Drop {
+		panic(http.ErrAbortHandler)
+	}
+	if step.StatusCode != 0 && step.StatusCode != http.StatusOK {
+		w.WriteHeader(step.StatusCode)
+		return
+	}
+
+	// 4. build and send the response
+	resp := h.Reply(query)
+	if step.WrongID {
+		resp.Id = query.Id + 1
+	}
+	if !step.Unpadded {
+		padResponseMsg(query, resp)
+	}
+	rawResp, err := resp.Pack()
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/dns-message")
+	w.Header().Set("Content-Length", strconv.Itoa(len(rawResp)))
+	if maxAge, ok := cacheMaxAge(resp); ok {
+		w.Header().Set("Cache-Control", "max-age="+strconv.FormatUint(uint64(maxAge), 10))
+	}
+	if step.Age > 0 {
+		w.Header().Set("Age", strconv.FormatInt(int64(step.Age.Seconds()), 10))
+	}
+	if step.TruncateBody {
+		rawResp = rawResp[:len(rawResp)/2]
+	}
+	_, _ = w.Write(rawResp)
+}
+
+// cacheMaxAge returns the freshness lifetime of the response, which is the
+// minimum answer TTL or, for negative responses, the minimum of the SOA TTL
+// and MINIMUM fields (RFC 2308), or false when there is no suitable TTL.
+func cacheMaxAge(resp *dns.Msg) (uint32, bool) {
+	if len(resp.Answer) > 0 {
+		return minTTL(resp.Answer), true
+	}
+	for _, rr := range resp.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return min(soa.Hdr.Ttl, soa.Minttl), true
+		}
+	}
+	return 0, false
+}
+
+// readRequestQuery returns the raw query of a GET request, which is the
+// base64url-encoded "dns" URL parameter, or of a POST request, which is
+// the request body (RFC 8484 Section 4.1).
+func readRequestQuery(r *http.Request) ([]byte, error) {
+	if r.Method == http.MethodGet {
+		return base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+	}
+	return io.ReadAll(iox.LimitReadCloser(r.Body, dns.MaxMsgSize))
+}
+
+// next pops the next step for the given name or returns the zero value.
+func (h *ScriptedHandler) next(name string) ScriptStep {
+	key := scriptedKey(name)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	steps := h.scripts[key]
+	if len(steps) <= 0 {
+		return ScriptStep{}
+	}
+	h.scripts[key] = steps[1:]
+	return steps[0]
+}
+
+// scriptedKey returns the canonical name used as the scripts key.
+func scriptedKey(name string) string {
+	return strings.ToLower(dns.Fqdn(name))
+}
@@ -0,0 +1,364 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScriptedHandler(t *testing.T) {
+	handler := dnsoverhttps.NewScriptedHandler(func(query *dns.Msg) *dns.Msg {
+		resp := &dns.Msg{}
+		require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+		return resp
+	})
+	handler.Script("dns.google",
+		dnsoverhttps.ScriptStep{StatusCode: http.StatusServiceUnavailable},
+		dnsoverhttps.ScriptStep{WrongID: true},
+		dnsoverhttps.ScriptStep{TruncateBody: true},
+		dnsoverhttps.ScriptStep{Drop: true},
+		dnsoverhttps.ScriptStep{Delay: 20 * time.Millisecond},
+	)
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+	exchange := func() (time.Duration, error) {
+		t0 := time.Now()
+		_, err := dt.Exchange(context.Background(), query)
+		return time.Since(t0), err
+	}
+
+	// the status code step
+	_, err := exchange()
+	require.ErrorIs(t, err, dnscodec.ErrServerMisbehaving)
+
+	// the wrong ID step
+	_, err = exchange()
+	require.ErrorIs(t, err, dnscodec.ErrInvalidResponse)
+
+	// the truncated body step
+	_, err = exchange()
+	require.ErrorIs(t, err, dnscodec.ErrServerMisbehaving)
+
+	// the dropped response step
+	_, err = exchange()
+	require.Error(t, err)
+
+	// the delay step
+	elapsed, err := exchange()
+	require.NoError(t, err)
+	assert.True(t, elapsed >= 20*time.Millisecond)
+
+	// the script is over
+	_, err = exchange()
+	require.NoError(t, err)
+}
+
+func TestScriptedHandlerDefaultReply(t *testing.T) {
+	srv := httptest.NewServer(dnsoverhttps.NewScriptedHandler(nil))
+	defer srv.Close()
+
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	_, err := dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+	require.ErrorIs(t, err, dnscodec.ErrNoData)
+}
+
+func TestScriptedHandlerPadding(t *testing.T) {
+	handler := dnsoverhttps.NewScriptedHandler(func(query *dns.Msg) *dns.Msg {
+		resp := &dns.Msg{}
+		require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+		return resp
+	})
+	handler.Script("dns.google", dnsoverhttps.ScriptStep{}, dnsoverhttps.ScriptStep{Unpadded: true})
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	var event *dnsoverhttps.ExchangeEvent
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	dt.ObserveExchange = func(ev *dnsoverhttps.ExchangeEvent) {
+		event = ev
+	}
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+
+	// the padded response
+	_, err := dt.Exchange(context.Background(), query)
+	require.NoError(t, err)
+	assert.Zero(t, len(event.RawResponse)%468)
+	assert.NotContains(t, event.Anomalies, dnsoverhttps.AnomalyUnpaddedResponse)
+
+	// the unpadded step
+	_, err = dt.Exchange(context.Background(), query)
+	require.NoError(t, err)
+	assert.Contains(t, event.Anomalies, dnsoverhttps.AnomalyUnpaddedResponse)
+}
+
+func TestScriptedHandlerNoPaddingWithoutPaddedQuery(t *testing.T) {
+	srv := httptest.NewServer(dnsoverhttps.NewScriptedHandler(nil))
+	defer srv.Close()
+
+	query := &dns.Msg{}
+	query.SetQuestion("dns.google.", dns.TypeA)
+	resp, err := dnsoverhttps.NewTransport(srv.Client(), srv.URL).ExchangeMsg(context.Background(), query)
+	require.NoError(t, err)
+	assert.Nil(t, resp.IsEdns0())
+}
+
+// postScriptedQuery POSTs a query for the given name and returns the response.
+func postScriptedQuery(t *testing.T, URL, name string) *http.Response {
+	query := &dns.Msg{}
+	query.SetQuestion(dns.Fqdn(name), dns.TypeA)
+	rawQuery, err := query.Pack()
+	require.NoError(t, err)
+	resp, err := http.Post(URL, "application/dns-message", bytes.NewReader(rawQuery))
+	require.NoError(t, err)
+	_, _ = io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+func TestScriptedHandlerRateLimit(t *testing.T) {
+	handler := dnsoverhttps.NewScriptedHandler(nil)
+	handler.RateLimit = 0.5
+	handler.RateBurst = 2
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	for range 2 {
+		resp := postScriptedQuery(t, srv.URL, "dns.google")
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	resp := postScriptedQuery(t, srv.URL, "dns.google")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("Retry-After"))
+}
+
+func TestScriptedHandlerMaxConcurrent(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := dnsoverhttps.NewScriptedHandler(func(query *dns.Msg) *dns.Msg {
+		if query.Question[0].Name == "slow.example." {
+			close(started)
+			<-release
+		}
+		resp := &dns.Msg{}
+		resp.SetReply(query)
+		return resp
+	})
+	handler.MaxConcurrent = 1
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	done := make(chan *http.Response)
+	go func() {
+		done <- postScriptedQuery(t, srv.URL, "slow.example")
+	}()
+	<-started
+
+	resp := postScriptedQuery(t, srv.URL, "dns.google")
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+
+	close(release)
+	assert.Equal(t, http.StatusOK, (<-done).StatusCode)
+	resp = postScriptedQuery(t, srv.URL, "dns.google")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestScriptedHandlerMethods(t *testing.T) {
+	zone, err := dnsoverhttps.ParseStaticZone(strings.NewReader(staticZoneFile), "example.com")
+	require.NoError(t, err)
+	srv := httptest.NewServer(dnsoverhttps.NewScriptedHandler(zone.Reply))
+	defer srv.Close()
+
+	newRawQuery := func(name string) []byte {
+		query := &dns.Msg{}
+		query.SetQuestion(name, dns.TypeA)
+		rawQuery, err := query.Pack()
+		require.NoError(t, err)
+		return rawQuery
+	}
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// method is the HTTP method.
+		method string
+
+		// param is the "dns" URL parameter.
+		param string
+
+		// body is the request body.
+		body []byte
+
+		// wantStatus is the expected status code.
+		wantStatus int
+
+		// wantCacheControl is the expected Cache-Control header.
+		wantCacheControl string
+
+		// wantAllow is the expected Allow header.
+		wantAllow string
+	}
+
+	testCases := []testCase{
+		{
+			name:             "GET",
+			method:           http.MethodGet,
+			param:            base64.RawURLEncoding.EncodeToString(newRawQuery("example.com.")),
+			wantStatus:       http.StatusOK,
+			wantCacheControl: "max-age=300",
+		},
+
+		{
+			name:             "GET for nonexistent name",
+			method:           http.MethodGet,
+			param:            base64.RawURLEncoding.EncodeToString(newRawQuery("nonexistent.example.com.")),
+			wantStatus:       http.StatusOK,
+			wantCacheControl: "max-age=300",
+		},
+
+		{
+			name:       "GET with padded base64",
+			method:     http.MethodGet,
+			param:      base64.URLEncoding.EncodeToString(newRawQuery("example.com.")),
+			wantStatus: http.StatusBadRequest,
+		},
+
+		{
+			name:       "GET without parameter",
+			method:     http.MethodGet,
+			wantStatus: http.StatusBadRequest,
+		},
+
+		{
+			name:             "POST",
+			method:           http.MethodPost,
+			body:             newRawQuery("example.com."),
+			wantStatus:       http.StatusOK,
+			wantCacheControl: "max-age=300",
+		},
+
+		{
+			name:       "PUT",
+			method:     http.MethodPut,
+			body:       newRawQuery("example.com."),
+			wantStatus: http.StatusMethodNotAllowed,
+			wantAllow:  "GET, POST",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			URL := srv.URL + "/dns-query"
+			if tt.param != "" {
+				URL += "?dns=" + tt.param
+			}
+			req, err := http.NewRequest(tt.method, URL, bytes.NewReader(tt.body))
+			require.NoError(t, err)
+			resp, err := srv.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.wantStatus, resp.StatusCode)
+			assert.Equal(t, tt.wantCacheControl, resp.Header.Get("Cache-Control"))
+			assert.Equal(t, tt.wantAllow, resp.Header.Get("Allow"))
+		})
+	}
+}
+
+func TestScriptedHandlerWithGETTransport(t *testing.T) {
+	srv := httptest.NewServer(dnsoverhttps.NewScriptedHandler(func(query *dns.Msg) *dns.Msg {
+		resp := &dns.Msg{}
+		require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+		return resp
+	}))
+	defer srv.Close()
+
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	dt.Method = dnsoverhttps.RequestMethodGET
+	resp, err := dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.ValidRRs)
+}
+
+func TestScriptedHandlerCacheHeaders(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// records contains the zone records.
+		records []string
+
+		// step is the scripted step.
+		step dnsoverhttps.ScriptStep
+
+		// wantCacheControl is the expected Cache-Control header.
+		wantCacheControl string
+
+		// wantAge is the expected Age header.
+		wantAge string
+	}
+
+	testCases := []testCase{
+		{
+			name:             "minimum answer TTL",
+			records:          []string{"dns.google. 300 IN A 8.8.8.8", "dns.google. 60 IN A 8.8.4.4"},
+			wantCacheControl: "max-age=60",
+		},
+
+		{
+			name:             "SOA negative caching TTL",
+			records:          []string{"google. 900 IN SOA ns1.google. dns-admin.google. 1 900 900 1800 60", "google. 300 IN A 8.8.8.8"},
+			wantCacheControl: "max-age=60",
+		},
+
+		{
+			name:    "no TTL",
+			records: []string{"google. 300 IN A 8.8.8.8"},
+		},
+
+		{
+			name:             "cached response",
+			records:          []string{"dns.google. 300 IN A 8.8.8.8"},
+			step:             dnsoverhttps.ScriptStep{Age: 42500 * time.Millisecond},
+			wantCacheControl: "max-age=300",
+			wantAge:          "42",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			var records []dns.RR
+			for _, record := range tt.records {
+				rr, err := dns.NewRR(record)
+				require.NoError(t, err)
+				records = append(records, rr)
+			}
+			handler := dnsoverhttps.NewScriptedHandler(dnsoverhttps.NewStaticZone(records...).Reply)
+			handler.Script("dns.google", tt.step)
+			srv := httptest.NewServer(handler)
+			defer srv.Close()
+
+			resp := postScriptedQuery(t, srv.URL, "dns.google")
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			assert.Equal(t, tt.wantCacheControl, resp.Header.Get("Cache-Control"))
+			assert.Equal(t, tt.wantAge, resp.Header.Get("Age"))
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Sink receives serializable observations.
+//
+// Implementations MUST be safe to call from multiple goroutines.
+type Sink interface {
+	Emit(event any) error
+}
+
+// JSONSink is a [Sink] writing each event as a JSON Lines record.
+//
+// Construct using [NewJSONSink].
+type JSONSink struct {
+	// enc is the encoder writing to the underlying writer.
+	enc *json.Encoder
+
+	// mu serializes access to enc.
+	mu sync.Mutex
+}
+
+var _ Sink = &JSONSink{}
+
+// NewJSONSink creates a new [*JSONSink] writing to w.
+func NewJSONSink(w io.Writer) *JSONSink {
+	return &JSONSink{enc: json.NewEncoder(w)}
+}
+
+// Emit implements [Sink].
+func (s *JSONSink) Emit(event any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(event)
+}
+
+// CBORSink is a [Sink] writing each event as a CBOR data item, thus
+// producing a CBOR sequence as defined by RFC 8742.
+//
+// Struct fields are named after their json tags.
+//
+// Construct using [NewCBORSink].
+type CBORSink struct {
+	// enc is the encoder writing to the underlying writer.
+	enc *cbor.Encoder
+
+	// mu serializes access to enc.
+	mu sync.Mutex
+}
+
+var _ Sink = &CBORSink{}
+
+// NewCBORSink creates a new [*CBORSink] writing to w.
+func NewCBORSink(w io.Writer) *CBORSink {
+	return &CBORSink{enc: cbor.NewEncoder(w)}
+}
+
+// Emit implements [Sink].
+func (s *CBORSink) Emit(event any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(event)
+}
+
+// SinkObserver emits an [*ExchangeRecord] to a [Sink] for each [*ExchangeEvent].
+//
+// Set [*SinkObserver.ObserveExchange] as the [Transport.ObserveExchange] hook.
+//
+// Construct using [NewSinkObserver].
+type SinkObserver struct {
+	// sink is the sink to emit records to.
+	sink Sink
+
+	// err is the first emit error.
+	err error
+
+	// mu protects err.
+	mu sync.Mutex
+}
+
+// NewSinkObserver creates a new [*SinkObserver] emitting to sink.
+func NewSinkObserver(sink Sink) *SinkObserver {
+	return &SinkObserver{sink: sink}
+}
+
+// ObserveExchange emits the event as an [*ExchangeRecord].
+//
+// This method is safe to call from multiple goroutines.
+func (o *SinkObserver) ObserveExchange(ev *ExchangeEvent) {
+	rec := NewExchangeRecord(ev)
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.err == nil {
+		o.err = o.sink.Emit(rec)
+	}
+}
+
+// Err returns the first error that occurred emitting records, if any.
+//
+// After an emit error, the [*SinkObserver] stops emitting records.
+func (o *SinkObserver) Err() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.err
+}
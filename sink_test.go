@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// funcSink is a [dnsoverhttps.Sink] calling a function.
+type funcSink func(event any) error
+
+// Emit implements [dnsoverhttps.Sink].
+func (fs funcSink) Emit(event any) error {
+	return fs(event)
+}
+
+func TestJSONSink(t *testing.T) {
+	buff := &bytes.Buffer{}
+	sink := dnsoverhttps.NewJSONSink(buff)
+	require.NoError(t, sink.Emit(map[string]int{"a": 1}))
+	require.NoError(t, sink.Emit([]string{"b"}))
+	assert.Equal(t, "{\"a\":1}\n[\"b\"]\n", buff.String())
+}
+
+func TestCBORSink(t *testing.T) {
+	buff := &bytes.Buffer{}
+	sink := dnsoverhttps.NewCBORSink(buff)
+	rec := dnsoverhttps.NewExchangeRecord(&dnsoverhttps.ExchangeEvent{
+		URL:       "https://example.com/dns-query",
+		QueryName: "dns.google",
+		QueryType: dns.TypeA,
+		StartTime: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		RawQuery:  []byte{0x01, 0x02},
+	})
+	require.NoError(t, sink.Emit(rec))
+	require.NoError(t, sink.Emit(rec))
+
+	dec := cbor.NewDecoder(buff)
+	for range 2 {
+		var got map[string]any
+		require.NoError(t, dec.Decode(&got))
+		assert.Equal(t, "https://example.com/dns-query", got["url"])
+		assert.Equal(t, "A", got["query_type"])
+		assert.Equal(t, []byte{0x01, 0x02}, got["raw_query"])
+		assert.Nil(t, got["failure"])
+	}
+	assert.Equal(t, 0, buff.Len())
+}
+
+func TestSinkObserver(t *testing.T) {
+	buff := &bytes.Buffer{}
+	obs := dnsoverhttps.NewSinkObserver(dnsoverhttps.NewJSONSink(buff))
+	obs.ObserveExchange(&dnsoverhttps.ExchangeEvent{
+		QueryName: "dns.google",
+		QueryType: dns.TypeA,
+		Err:       errors.New("mocked error"),
+	})
+	require.NoError(t, obs.Err())
+
+	var got dnsoverhttps.ExchangeRecord
+	require.NoError(t, json.Unmarshal(buff.Bytes(), &got))
+	assert.Equal(t, "dns.google", got.QueryName)
+	require.NotNil(t, got.Failure)
+	assert.Equal(t, "mocked error", *got.Failure)
+}
+
+func TestSinkObserverEmitError(t *testing.T) {
+	wantErr := errors.New("mocked error")
+	count := 0
+	obs := dnsoverhttps.NewSinkObserver(funcSink(func(event any) error {
+		count++
+		return wantErr
+	}))
+
+	ev := &dnsoverhttps.ExchangeEvent{QueryType: dns.TypeA}
+	obs.ObserveExchange(ev)
+	obs.ObserveExchange(ev)
+
+	require.ErrorIs(t, obs.Err(), wantErr)
+	assert.Equal(t, 1, count)
+}
@@ -0,0 +1,156 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ErrInvalidStamp indicates that we cannot parse a DNS stamp.
+var ErrInvalidStamp = errors.New("invalid DNS stamp")
+
+// stampProtocolDoH is the DNS stamp protocol identifier for DoH.
+const stampProtocolDoH = 0x02
+
+// dohStamp contains the fields of a DoH DNS stamp we use.
+//
+// See https://dnscrypt.info/stamps-specifications.
+type dohStamp struct {
+	// addr is the OPTIONAL address to connect to.
+	addr string
+
+	// hashes contains the OPTIONAL SHA256 digests of the TBS
+	// certificates of the server certificate chain.
+	hashes [][]byte
+
+	// hostname is the hostname, possibly including a port.
+	hostname string
+
+	// path is the URL path.
+	path string
+}
+
+// parseDoHStamp parses an "sdns://" DoH DNS stamp.
+func parseDoHStamp(rawStamp string) (*dohStamp, error) {
+	// 1. decode the base64url payload
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(rawStamp, "sdns://"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidStamp, err)
+	}
+
+	// 2. make sure the stamp is for DoH and skip the properties
+	if len(data) < 9 {
+		return nil, fmt.Errorf("%w: too short", ErrInvalidStamp)
+	}
+	if data[0] != stampProtocolDoH {
+		return nil, fmt.Errorf("%w: unsupported protocol 0x%02x", ErrInvalidStamp, data[0])
+	}
+	sr := &stampReader{data: data[9:]}
+
+	// 3. read the fields
+	stamp := &dohStamp{}
+	stamp.addr = string(sr.lp())
+	stamp.hashes = sr.vlp()
+	stamp.hostname = string(sr.lp())
+	stamp.path = string(sr.lp())
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	if stamp.hostname == "" {
+		return nil, fmt.Errorf("%w: missing hostname", ErrInvalidStamp)
+	}
+	return stamp, nil
+}
+
+// dialAddr returns the address to dial or an empty string when the
+// stamp does not specify an address.
+func (s *dohStamp) dialAddr() string {
+	if s.addr == "" {
+		return ""
+	}
+	if _, _, err := net.SplitHostPort(s.addr); err == nil {
+		return s.addr
+	}
+	port := "443"
+	if _, p, err := net.SplitHostPort(s.hostname); err == nil {
+		port = p
+	}
+	return net.JoinHostPort(strings.Trim(s.addr, "[]"), port)
+}
+
+// verifyHashes returns an error unless a certificate of a verified chain has
+// a TBS certificate whose SHA256 digest matches one of the stamp hashes.
+//
+// We do not use the PeerCertificates, since the server may append arbitrary
+// certificates (e.g., a pinned intermediate) to the chain it presents.
+func (s *dohStamp) verifyHashes(state tls.ConnectionState) error {
+	for _, chain := range state.VerifiedChains {
+		for _, cert := range chain {
+			digest := sha256.Sum256(cert.RawTBSCertificate)
+			for _, hash := range s.hashes {
+				if bytes.Equal(hash, digest[:]) {
+					return nil
+				}
+			}
+		}
+	}
+	return errors.New("no verified certificate matches the DNS stamp hashes")
+}
+
+// stampReader reads length-prefixed stamp fields.
+type stampReader struct {
+	// data contains the bytes to read.
+	data []byte
+
+	// err is the first error, if any.
+	err error
+}
+
+// next returns the next n bytes or nil after setting err.
+func (sr *stampReader) next(n int) []byte {
+	if sr.err != nil {
+		return nil
+	}
+	if n > len(sr.data) {
+		sr.err = fmt.Errorf("%w: truncated", ErrInvalidStamp)
+		return nil
+	}
+	value := sr.data[:n]
+	sr.data = sr.data[n:]
+	return value
+}
+
+// lp reads a length-prefixed field.
+func (sr *stampReader) lp() []byte {
+	length := sr.next(1)
+	if length == nil {
+		return nil
+	}
+	return sr.next(int(length[0]))
+}
+
+// vlp reads a set of variable-length-prefixed fields, where the high
+// bit of the length indicates that more fields follow, skipping
+// empty fields.
+func (sr *stampReader) vlp() [][]byte {
+	var values [][]byte
+	for {
+		length := sr.next(1)
+		if length == nil {
+			return nil
+		}
+		if value := sr.next(int(length[0] & 0x7f)); len(value) > 0 {
+			values = append(values, value)
+		}
+		if length[0]&0x80 == 0 {
+			return values
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// maxStaticCNAMEHops is the maximum number of CNAME records
+// [*StaticZone.Reply] follows for a single query.
+const maxStaticCNAMEHops = 8
+
+// StaticZone answers queries using static records rather than an upstream
+// server, which allows to use [*ScriptedHandler] as a standalone DoH test
+// target. Pass [*StaticZone.Reply] to [NewScriptedHandler].
+//
+// Construct using [NewStaticZone] or [ParseStaticZone].
+type StaticZone struct {
+	// names maps canonical owner names to their records.
+	names map[string][]dns.RR
+}
+
+// NewStaticZone creates a new [*StaticZone] containing the given records.
+func NewStaticZone(records ...dns.RR) *StaticZone {
+	z := &StaticZone{names: make(map[string][]dns.RR)}
+	for _, rr := range records {
+		key := staticKey(rr.Header().Name)
+		z.names[key] = append(z.names[key], rr)
+	}
+	return z
+}
+
+// ParseStaticZone creates a new [*StaticZone] from a zone file in the
+// RFC 1035 master file format, using origin to complete relative names.
+func ParseStaticZone(r io.Reader, origin string) (*StaticZone, error) {
+	var records []dns.RR
+	zp := dns.NewZoneParser(r, dns.Fqdn(origin), "")
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		records = append(records, rr)
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+	return NewStaticZone(records...), nil
+}
+
+// Reply builds an authoritative response to the query.
+//
+// We answer with the records matching the query name and type, following CNAME
+// records within the zone, and stop following CNAME records leaving the zone. We
+// reply with NXDOMAIN when the name does not exist and with NODATA when it exists
+// without records of the query type, including the SOA record of the closest
+// enclosing zone, if any, in the authority section.
+//
+// When the query has the DO bit set, we also include the RRSIG records of the
+// zone covering the returned records and, in negative responses, the NSEC
+// records owned by the name without data, which allows to serve pre-signed
+// zones. We do not sign records and do not include the NSEC records covering
+// nonexistent names. Wildcard records are not supported.
+func (z *StaticZone) Reply(query *dns.Msg) *dns.Msg {
+	// 1. make sure there is a single question
+	resp := &dns.Msg{}
+	if len(query.Question) != 1 {
+		resp.SetRcode(query, dns.RcodeFormatError)
+		return resp
+	}
+	resp.SetReply(query)
+	resp.Authoritative = true
+
+	// 2. collect the records and add the DNSSEC records, if needed
+	negative := z.collect(resp, query.Question[0].Name, query.Question[0].Qtype)
+	if opt := query.IsEdns0(); opt != nil && opt.Do() {
+		resp.SetEdns0(opt.UDPSize(), true)
+		resp.Answer = z.withRRSIGs(resp.Answer)
+		if negative != "" {
+			resp.Ns = append(resp.Ns, z.denial(negative)...)
+		}
+		resp.Ns = z.withRRSIGs(resp.Ns)
+	}
+	return resp
+}
+
+// collect adds the records answering the query to the response, following CNAME
+// records, and returns the name that does not exist or has no data, if any.
+func (z *StaticZone) collect(resp *dns.Msg, name string, qtype uint16) string {
+	for range maxStaticCNAMEHops {
+		records, found := z.names[staticKey(name)]
+		if !found {
+			// we are not authoritative for the target of a CNAME leaving the zone
+			if soa := z.soa(name); len(resp.Answer) <= 0 || soa != nil {
+				resp.Rcode = dns.RcodeNameError
+				resp.Ns = soa
+				return name
+			}
+			return ""
+		}
+		var (
+			cname   *dns.CNAME
+			matched bool
+		)
+		for _, rr := range records {
+			switch {
+			case rr.Header().Rrtype == qtype:
+				resp.Answer = append(resp.Answer, dns.Copy(rr))
+				matched = true
+			case rr.Header().Rrtype == dns.TypeCNAME:
+				cname = rr.(*dns.CNAME)
+			}
+		}
+		if matched {
+			return ""
+		}
+		if cname == nil {
+			resp.Ns = z.soa(name)
+			return name
+		}
+		resp.Answer = append(resp.Answer, dns.Copy(cname))
+		name = cname.Target
+	}
+	return ""
+}
+
+// withRRSIGs returns the records followed by the RRSIG records covering them.
+func (z *StaticZone) withRRSIGs(rrs []dns.RR) []dns.RR {
+	out := rrs
+	seen := make(map[string]bool)
+	for _, rr := range rrs {
+		key := staticKey(rr.Header().Name)
+		setKey := fmt.Sprintf("%s/%d", key, rr.Header().Rrtype)
+		if rr.Header().Rrtype == dns.TypeRRSIG || seen[setKey] {
+			continue
+		}
+		seen[setKey] = true
+		for _, sig := range z.names[key] {
+			if sig, ok := sig.(*dns.RRSIG); ok && sig.TypeCovered == rr.Header().Rrtype {
+				out = append(out, dns.Copy(sig))
+			}
+		}
+	}
+	return out
+}
+
+// denial returns the NSEC records owned by the name.
+func (z *StaticZone) denial(name string) []dns.RR {
+	var out []dns.RR
+	for _, rr := range z.names[staticKey(name)] {
+		if rr.Header().Rrtype == dns.TypeNSEC {
+			out = append(out, dns.Copy(rr))
+		}
+	}
+	return out
+}
+
+// soa returns the SOA record of the zone closest to name, if any.
+func (z *StaticZone) soa(name string) []dns.RR {
+	key := staticKey(name)
+	for off, end := 0, false; !end; off, end = dns.NextLabel(key, off) {
+		for _, rr := range z.names[key[off:]] {
+			if rr.Header().Rrtype == dns.TypeSOA {
+				return []dns.RR{dns.Copy(rr)}
+			}
+		}
+	}
+	return nil
+}
+
+// staticKey returns the canonical name used as the names key.
+func staticKey(name string) string {
+	return strings.ToLower(dns.Fqdn(name))
+}
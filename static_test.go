@@ -0,0 +1,183 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// staticZoneFile is the zone file used by the [*dnsoverhttps.StaticZone] tests.
+const staticZoneFile = `
+$TTL 300
+@       IN SOA ns.example.com. admin.example.com. 1 7200 3600 1209600 300
+@       IN A    93.184.216.34
+@       IN AAAA 2606:2800:220:1:248:1893:25c8:1946
+www     IN CNAME example.com.
+ext     IN CNAME www.example.org.
+loop1   IN CNAME loop2
+loop2   IN CNAME loop1
+dangling IN CNAME nonexistent
+`
+
+func TestStaticZoneReply(t *testing.T) {
+	zone, err := dnsoverhttps.ParseStaticZone(strings.NewReader(staticZoneFile), "example.com")
+	require.NoError(t, err)
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// qname is the query name.
+		qname string
+
+		// qtype is the query type.
+		qtype uint16
+
+		// wantRcode is the expected RCODE.
+		wantRcode int
+
+		// wantAnswer contains the expected answer RR types.
+		wantAnswer []uint16
+
+		// wantSOA indicates whether we expect a SOA in the authority section.
+		wantSOA bool
+	}
+
+	testCases := []testCase{
+		{
+			name:       "A",
+			qname:      "example.com.",
+			qtype:      dns.TypeA,
+			wantAnswer: []uint16{dns.TypeA},
+		},
+
+		{
+			name:       "case insensitive",
+			qname:      "EXAMPLE.com.",
+			qtype:      dns.TypeAAAA,
+			wantAnswer: []uint16{dns.TypeAAAA},
+		},
+
+		{
+			name:       "CNAME chasing",
+			qname:      "www.example.com.",
+			qtype:      dns.TypeA,
+			wantAnswer: []uint16{dns.TypeCNAME, dns.TypeA},
+		},
+
+		{
+			name:       "CNAME query",
+			qname:      "www.example.com.",
+			qtype:      dns.TypeCNAME,
+			wantAnswer: []uint16{dns.TypeCNAME},
+		},
+
+		{
+			name:       "CNAME leaving the zone",
+			qname:      "ext.example.com.",
+			qtype:      dns.TypeA,
+			wantAnswer: []uint16{dns.TypeCNAME},
+		},
+
+		{
+			name:       "CNAME to nonexistent name",
+			qname:      "dangling.example.com.",
+			qtype:      dns.TypeA,
+			wantRcode:  dns.RcodeNameError,
+			wantAnswer: []uint16{dns.TypeCNAME},
+			wantSOA:    true,
+		},
+
+		{
+			name:       "CNAME loop",
+			qname:      "loop1.example.com.",
+			qtype:      dns.TypeA,
+			wantAnswer: []uint16{dns.TypeCNAME, dns.TypeCNAME, dns.TypeCNAME, dns.TypeCNAME, dns.TypeCNAME, dns.TypeCNAME, dns.TypeCNAME, dns.TypeCNAME},
+		},
+
+		{
+			name:      "NODATA",
+			qname:     "example.com.",
+			qtype:     dns.TypeMX,
+			wantSOA:   true,
+			wantRcode: dns.RcodeSuccess,
+		},
+
+		{
+			name:      "NXDOMAIN",
+			qname:     "nonexistent.example.com.",
+			qtype:     dns.TypeA,
+			wantSOA:   true,
+			wantRcode: dns.RcodeNameError,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			query := &dns.Msg{}
+			query.SetQuestion(tt.qname, tt.qtype)
+			resp := zone.Reply(query)
+			assert.True(t, resp.Authoritative)
+			assert.Equal(t, query.Id, resp.Id)
+			assert.Equal(t, tt.wantRcode, resp.Rcode)
+			var types []uint16
+			for _, rr := range resp.Answer {
+				types = append(types, rr.Header().Rrtype)
+			}
+			assert.Equal(t, tt.wantAnswer, types)
+			if tt.wantSOA {
+				require.Len(t, resp.Ns, 1)
+				assert.Equal(t, dns.TypeSOA, resp.Ns[0].Header().Rrtype)
+			} else {
+				assert.Empty(t, resp.Ns)
+			}
+		})
+	}
+}
+
+func TestStaticZoneReplyWithoutSOA(t *testing.T) {
+	rr, err := dns.NewRR("dns.google. 300 IN A 8.8.8.8")
+	require.NoError(t, err)
+	zone := dnsoverhttps.NewStaticZone(rr)
+
+	query := &dns.Msg{}
+	query.SetQuestion("nonexistent.google.", dns.TypeA)
+	resp := zone.Reply(query)
+	assert.Equal(t, dns.RcodeNameError, resp.Rcode)
+	assert.Empty(t, resp.Ns)
+
+	query.Question = nil
+	resp = zone.Reply(query)
+	assert.Equal(t, dns.RcodeFormatError, resp.Rcode)
+}
+
+func TestParseStaticZoneError(t *testing.T) {
+	_, err := dnsoverhttps.ParseStaticZone(strings.NewReader("@ IN A not-an-address\n"), "example.com")
+	require.Error(t, err)
+}
+
+func TestStaticZoneWithScriptedHandler(t *testing.T) {
+	zone, err := dnsoverhttps.ParseStaticZone(strings.NewReader(staticZoneFile), "example.com")
+	require.NoError(t, err)
+	srv := httptest.NewServer(dnsoverhttps.NewScriptedHandler(zone.Reply))
+	defer srv.Close()
+
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	resp, err := dt.Exchange(context.Background(), dnscodec.NewQuery("www.example.com", dns.TypeA))
+	require.NoError(t, err)
+	addrs, err := resp.RecordsA()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"93.184.216.34"}, addrs)
+
+	_, err = dt.Exchange(context.Background(), dnscodec.NewQuery("nonexistent.example.com", dns.TypeA))
+	require.ErrorIs(t, err, dnscodec.ErrNoName)
+}
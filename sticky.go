@@ -0,0 +1,258 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// StickyEvent describes a health change of an [Exchanger] used by a [*StickyExchanger].
+type StickyEvent struct {
+	// Index is the index of the [Exchanger] within Exchangers.
+	Index int
+
+	// Evicted is true when we evicted the [Exchanger] after MaxFailures consecutive
+	// failures and false when a background probe found it healthy again.
+	Evicted bool
+
+	// Err is the error that caused the eviction or nil.
+	Err error
+}
+
+// StickyExchanger selects among a list of [Exchanger] (e.g., a [*Transport] for
+// each endpoint) like real stub resolvers do: it keeps using the current exchanger
+// until MaxFailures consecutive failures, then evicts it, switches to the next
+// healthy exchanger, and re-probes the evicted exchanger in the background every
+// ProbeInterval until it answers again, thus becoming eligible again.
+//
+// When all the other exchangers are evicted, we keep using the current one.
+//
+// Call [*StickyExchanger.Close] when done to stop the background probes.
+//
+// Construct using [NewStickyExchanger].
+type StickyExchanger struct {
+	// Exchangers contains the exchangers to select from in order.
+	//
+	// Set by [NewStickyExchanger] to the user-provided value.
+	Exchangers []Exchanger
+
+	// MaxFailures is the number of consecutive failures after which we evict
+	// the current exchanger. When zero or negative, we evict on the first failure.
+	//
+	// Set by [NewStickyExchanger] to 3.
+	MaxFailures int
+
+	// ShouldFallback decides whether an error is a failure.
+	//
+	// Set by [NewStickyExchanger] to [ShouldFallbackDefault].
+	ShouldFallback func(err error) bool
+
+	// ProbeName is the name to query when re-probing evicted exchangers.
+	//
+	// Set by [NewStickyExchanger] to "example.com".
+	ProbeName string
+
+	// ProbeInterval is the interval between background probes, which also bounds
+	// each probe. When zero or negative, we use [DefaultStickyProbeInterval].
+	//
+	// Set by [NewStickyExchanger] to [DefaultStickyProbeInterval].
+	ProbeInterval time.Duration
+
+	// ObserveHealth is an optional hook called when we evict an exchanger or a
+	// background probe restores it. We call it from the background goroutines
+	// when restoring, so it must be safe to call from multiple goroutines.
+	ObserveHealth func(*StickyEvent)
+
+	// Scores OPTIONALLY tracks the score of each exchanger. When set, we switch
+	// to the healthy exchanger with the [EndpointScore.Better] score rather
+	// than to the next one in order.
+	Scores *ScoreTracker
+
+	// cancel cancels ctx.
+	cancel context.CancelFunc
+
+	// closed is true after Close.
+	closed bool
+
+	// ctx is the context of the background probes.
+	ctx context.Context
+
+	// current is the index of the current exchanger.
+	current int
+
+	// evicted contains the indexes of the evicted exchangers.
+	evicted map[int]bool
+
+	// failures is the number of consecutive failures of the current exchanger.
+	failures int
+
+	// mu protects closed, current, evicted, and failures.
+	mu sync.Mutex
+
+	// once creates ctx and evicted.
+	once sync.Once
+
+	// wg tracks the background probes.
+	wg sync.WaitGroup
+}
+
+var _ Exchanger = &StickyExchanger{}
+
+// DefaultStickyProbeInterval is the default [*StickyExchanger] ProbeInterval.
+const DefaultStickyProbeInterval = 30 * time.Second
+
+// NewStickyExchanger creates a new [*StickyExchanger].
+func NewStickyExchanger(exchangers ...Exchanger) *StickyExchanger {
+	return &StickyExchanger{
+		Exchangers:     exchangers,
+		MaxFailures:    3,
+		ShouldFallback: ShouldFallbackDefault,
+		ProbeName:      "example.com",
+		ProbeInterval:  DefaultStickyProbeInterval,
+	}
+}
+
+// Exchange implements [Exchanger].
+//
+// We do not retry failed exchanges using the next exchanger, which is
+// possible by wrapping the [*StickyExchanger] with a [*ChainExchanger].
+func (sx *StickyExchanger) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	// 1. select the current exchanger
+	if len(sx.Exchangers) <= 0 {
+		return nil, ErrNoExchangers
+	}
+	sx.once.Do(sx.start)
+	idx := sx.Current()
+
+	// 2. perform the exchange and account for failures
+	//
+	// We ignore the exchanges interrupted by the context being done, since
+	// they do not tell anything about the health of the exchanger.
+	t0 := time.Now()
+	resp, err := sx.Exchangers[idx].Exchange(ctx, query)
+	if ctx.Err() == nil {
+		sx.Scores.record(idx, t0, err)
+		sx.record(idx, err)
+	}
+	return resp, err
+}
+
+// Current returns the index of the current exchanger.
+//
+// This method is safe to call from multiple goroutines.
+func (sx *StickyExchanger) Current() int {
+	sx.mu.Lock()
+	defer sx.mu.Unlock()
+	return sx.current
+}
+
+// Close stops the background probes and waits for them to terminate.
+//
+// After Close, we keep selecting exchangers but we do not restore the evicted ones.
+func (sx *StickyExchanger) Close() error {
+	sx.once.Do(sx.start)
+	sx.mu.Lock()
+	sx.closed = true
+	sx.cancel()
+	sx.mu.Unlock()
+	sx.wg.Wait()
+	return nil
+}
+
+// start creates the context and the evicted set.
+func (sx *StickyExchanger) start() {
+	sx.ctx, sx.cancel = context.WithCancel(context.Background())
+	sx.evicted = make(map[int]bool)
+}
+
+// record accounts for the result of an exchange using the given exchanger.
+func (sx *StickyExchanger) record(idx int, err error) {
+	// 1. reset the failures on success and ignore results of stale exchangers
+	sx.mu.Lock()
+	if idx != sx.current {
+		sx.mu.Unlock()
+		return
+	}
+	if err == nil || !sx.ShouldFallback(err) {
+		sx.failures = 0
+		sx.mu.Unlock()
+		return
+	}
+
+	// 2. evict the exchanger after enough consecutive failures
+	sx.failures++
+	next, found := sx.nextHealthy(idx)
+	if sx.failures < sx.MaxFailures || !found {
+		sx.mu.Unlock()
+		return
+	}
+	sx.current, sx.failures, sx.evicted[idx] = next, 0, true
+
+	// 3. re-probe the exchanger in the background unless closed
+	if !sx.closed {
+		sx.wg.Add(1)
+		go sx.reprobe(idx)
+	}
+	sx.mu.Unlock()
+	sx.observe(&StickyEvent{Index: idx, Evicted: true, Err: err})
+}
+
+// nextHealthy returns the next exchanger that is not evicted, or the one with
+// the best score when tracking scores, assuming the caller holds the mutex.
+func (sx *StickyExchanger) nextHealthy(idx int) (int, bool) {
+	var scores []EndpointScore
+	if sx.Scores != nil {
+		scores = sx.Scores.Scores()
+		scores = append(scores, make([]EndpointScore, max(len(sx.Exchangers)-len(scores), 0))...)
+	}
+	best, found := 0, false
+	for offset := 1; offset < len(sx.Exchangers); offset++ {
+		next := (idx + offset) % len(sx.Exchangers)
+		switch {
+		case sx.evicted[next]:
+			continue
+		case scores == nil:
+			return next, true
+		case !found || scores[next].Better(scores[best]):
+			best, found = next, true
+		}
+	}
+	return best, found
+}
+
+// reprobe probes the evicted exchanger until it answers or we are closed.
+func (sx *StickyExchanger) reprobe(idx int) {
+	defer sx.wg.Done()
+	interval := sx.ProbeInterval
+	if interval <= 0 {
+		interval = DefaultStickyProbeInterval
+	}
+	for sleepContext(sx.ctx, interval) {
+		ctx, cancel := context.WithTimeout(sx.ctx, interval)
+		_, err := sx.Exchangers[idx].Exchange(ctx, dnscodec.NewQuery(sx.ProbeName, dns.TypeA))
+		cancel()
+		if sx.ctx.Err() != nil {
+			return
+		}
+		if err != nil && sx.ShouldFallback(err) {
+			continue
+		}
+		sx.mu.Lock()
+		delete(sx.evicted, idx)
+		sx.mu.Unlock()
+		sx.observe(&StickyEvent{Index: idx})
+		return
+	}
+}
+
+// observe calls ObserveHealth if it is not nil.
+func (sx *StickyExchanger) observe(ev *StickyEvent) {
+	if sx.ObserveHealth != nil {
+		sx.ObserveHealth(ev)
+	}
+}
@@ -0,0 +1,135 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newToggleExchanger returns an [dnsoverhttps.Exchanger] failing with
+// errFailed while the returned flag is true and counting the exchanges.
+func newToggleExchanger(errFailed error) (dnsoverhttps.Exchanger, *atomic.Bool, *atomic.Int64) {
+	failing, count := &atomic.Bool{}, &atomic.Int64{}
+	return funcExchanger(func(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+		count.Add(1)
+		if failing.Load() {
+			return nil, errFailed
+		}
+		return &dnscodec.Response{}, nil
+	}), failing, count
+}
+
+func TestStickyExchanger(t *testing.T) {
+	errFailed := errors.New("mocked failure")
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+
+	t.Run("we evict after consecutive failures and restore in the background", func(t *testing.T) {
+		first, firstFailing, _ := newToggleExchanger(errFailed)
+		second, _, secondCount := newToggleExchanger(errFailed)
+		sx := dnsoverhttps.NewStickyExchanger(first, second)
+		sx.MaxFailures = 2
+		sx.ProbeInterval = 10 * time.Millisecond
+		events := make(chan *dnsoverhttps.StickyEvent, 2)
+		sx.ObserveHealth = func(ev *dnsoverhttps.StickyEvent) {
+			events <- ev
+		}
+		defer sx.Close()
+
+		// a success in between resets the consecutive failures count
+		firstFailing.Store(true)
+		_, err := sx.Exchange(context.Background(), query)
+		require.ErrorIs(t, err, errFailed)
+		firstFailing.Store(false)
+		_, err = sx.Exchange(context.Background(), query)
+		require.NoError(t, err)
+		firstFailing.Store(true)
+		_, err = sx.Exchange(context.Background(), query)
+		require.ErrorIs(t, err, errFailed)
+		assert.Equal(t, 0, sx.Current())
+
+		// the second consecutive failure evicts the first exchanger
+		_, err = sx.Exchange(context.Background(), query)
+		require.ErrorIs(t, err, errFailed)
+		assert.Equal(t, 1, sx.Current())
+		ev := <-events
+		assert.Equal(t, &dnsoverhttps.StickyEvent{Index: 0, Evicted: true, Err: errFailed}, ev)
+
+		// we stick with the second exchanger
+		_, err = sx.Exchange(context.Background(), query)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), secondCount.Load())
+
+		// the background probe restores the first exchanger once healthy
+		firstFailing.Store(false)
+		select {
+		case ev := <-events:
+			assert.Equal(t, &dnsoverhttps.StickyEvent{Index: 0}, ev)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the first exchanger was not restored")
+		}
+		assert.Equal(t, 1, sx.Current())
+	})
+
+	t.Run("negative answers are not failures", func(t *testing.T) {
+		first, firstFailing, _ := newToggleExchanger(dnscodec.ErrNoName)
+		second, _, _ := newToggleExchanger(errFailed)
+		sx := dnsoverhttps.NewStickyExchanger(first, second)
+		sx.MaxFailures = 1
+		defer sx.Close()
+
+		firstFailing.Store(true)
+		_, err := sx.Exchange(context.Background(), query)
+		require.ErrorIs(t, err, dnscodec.ErrNoName)
+		assert.Equal(t, 0, sx.Current())
+	})
+
+	t.Run("we keep the current exchanger when the others are evicted", func(t *testing.T) {
+		first, firstFailing, _ := newToggleExchanger(errFailed)
+		second, secondFailing, _ := newToggleExchanger(errFailed)
+		sx := dnsoverhttps.NewStickyExchanger(first, second)
+		sx.MaxFailures = 1
+		defer sx.Close()
+
+		firstFailing.Store(true)
+		secondFailing.Store(true)
+		_, err := sx.Exchange(context.Background(), query)
+		require.ErrorIs(t, err, errFailed)
+		assert.Equal(t, 1, sx.Current())
+		_, err = sx.Exchange(context.Background(), query)
+		require.ErrorIs(t, err, errFailed)
+		assert.Equal(t, 1, sx.Current())
+	})
+
+	t.Run("context errors are not failures", func(t *testing.T) {
+		first, firstFailing, _ := newToggleExchanger(context.Canceled)
+		second, _, _ := newToggleExchanger(errFailed)
+		sx := dnsoverhttps.NewStickyExchanger(first, second)
+		sx.MaxFailures = 1
+		sx.ShouldFallback = func(err error) bool { return true }
+		defer sx.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		firstFailing.Store(true)
+		_, err := sx.Exchange(ctx, query)
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 0, sx.Current())
+	})
+
+	t.Run("without exchangers", func(t *testing.T) {
+		sx := dnsoverhttps.NewStickyExchanger()
+		_, err := sx.Exchange(context.Background(), query)
+		require.ErrorIs(t, err, dnsoverhttps.ErrNoExchangers)
+		require.NoError(t, sx.Close())
+	})
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ErrResponseBodyTimeout indicates that reading the response body took
+// longer than [Transport.ResponseBodyTimeout].
+var ErrResponseBodyTimeout = errors.New("timeout reading response body")
+
+// TimeoutPolicy bounds the phases of an exchange that happen inside the
+// [*http.Client] separately, so that failures are distinguishable.
+//
+// Use [Transport.ResponseBodyTimeout] to bound reading the response body.
+//
+// A zero value field means that we keep the base transport behavior for the
+// corresponding phase (e.g., [http.DefaultTransport] bounds TLS handshakes).
+type TimeoutPolicy struct {
+	// Connect bounds establishing the TCP connection.
+	Connect time.Duration
+
+	// TLSHandshake bounds the TLS handshake.
+	TLSHandshake time.Duration
+
+	// ResponseHeader bounds waiting for the response headers after
+	// writing the request.
+	ResponseHeader time.Duration
+}
+
+// NewClient creates an [*http.Client] applying the policy to a clone of base
+// or of [http.DefaultTransport] when base is nil.
+//
+// The connect timeout wraps the base DialContext, so it composes with
+// custom dialers; the other nonzero timeouts override the base values.
+func (p *TimeoutPolicy) NewClient(base *http.Transport) *http.Client {
+	if base == nil {
+		base = http.DefaultTransport.(*http.Transport)
+	}
+	txp := base.Clone()
+	if p.Connect > 0 {
+		dial := txp.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{}).DialContext
+		}
+		timeout := p.Connect
+		txp.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return dial(ctx, network, address)
+		}
+	}
+	if p.TLSHandshake > 0 {
+		txp.TLSHandshakeTimeout = p.TLSHandshake
+	}
+	if p.ResponseHeader > 0 {
+		txp.ResponseHeaderTimeout = p.ResponseHeader
+	}
+	return &http.Client{Transport: txp}
+}
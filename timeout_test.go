@@ -0,0 +1,91 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimeoutPolicyConnect(t *testing.T) {
+	base := &http.Transport{
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	}
+	policy := &dnsoverhttps.TimeoutPolicy{Connect: 10 * time.Millisecond}
+	dt := dnsoverhttps.NewTransport(policy.NewClient(base), "http://127.0.0.1:1/dns-query")
+
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+	_, err := dt.Exchange(context.Background(), query)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestTimeoutPolicyTLSHandshake(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		time.Sleep(time.Second) // never complete the handshake
+	}()
+
+	policy := &dnsoverhttps.TimeoutPolicy{TLSHandshake: 10 * time.Millisecond}
+	dt := dnsoverhttps.NewTransport(policy.NewClient(nil), "https://"+listener.Addr().String()+"/dns-query")
+
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+	_, err = dt.Exchange(context.Background(), query)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "TLS handshake timeout")
+}
+
+func TestTimeoutPolicyResponseHeader(t *testing.T) {
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer srv.Close()
+	defer close(unblock)
+
+	policy := &dnsoverhttps.TimeoutPolicy{ResponseHeader: 10 * time.Millisecond}
+	dt := dnsoverhttps.NewTransport(policy.NewClient(nil), srv.URL)
+
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+	_, err := dt.Exchange(context.Background(), query)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timeout awaiting response headers")
+}
+
+func TestExchangeResponseBodyTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-unblock
+	}))
+	defer srv.Close()
+	defer close(unblock)
+
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	dt.ResponseBodyTimeout = 10 * time.Millisecond
+
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+	_, err := dt.Exchange(context.Background(), query)
+	require.ErrorIs(t, err, dnsoverhttps.ErrResponseBodyTimeout)
+}
@@ -0,0 +1,159 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/binary"
+	"time"
+)
+
+// TLSRecord is the serializable summary of a [*tls.ConnectionState].
+//
+// When serialized, it is an object with these fields:
+//
+//   - "version" (string): the TLS version (e.g., "TLS 1.3");
+//   - "cipher_suite" (string): the cipher suite name;
+//   - "negotiated_protocol" (string): the ALPN protocol or an empty string;
+//   - "server_name" (string): the SNI sent by the client;
+//   - "did_resume" (bool): whether the handshake resumed a session;
+//   - "peer_certificates" (array): the [*CertificateRecord] presented by the
+//     server, starting with the leaf certificate;
+//   - "ocsp_response" (bytes or null): the stapled OCSP response;
+//   - "signed_certificate_timestamps" (array of bytes): the SCTs presented
+//     using the TLS extension;
+//   - "embedded_signed_certificate_timestamps" (array of bytes): the SCTs
+//     embedded in the leaf certificate (RFC 6962 Section 3.3).
+//
+// Using JSON, bytes are base64-encoded strings.
+//
+// Construct using [NewTLSRecord].
+type TLSRecord struct {
+	Version            string               `json:"version"`
+	CipherSuite        string               `json:"cipher_suite"`
+	NegotiatedProtocol string               `json:"negotiated_protocol"`
+	ServerName         string               `json:"server_name"`
+	DidResume          bool                 `json:"did_resume"`
+	PeerCertificates   []*CertificateRecord `json:"peer_certificates"`
+	OCSPResponse       []byte               `json:"ocsp_response"`
+	SCTs               [][]byte             `json:"signed_certificate_timestamps"`
+	EmbeddedSCTs       [][]byte             `json:"embedded_signed_certificate_timestamps"`
+}
+
+// NewTLSRecord converts a [*tls.ConnectionState] to a [*TLSRecord].
+func NewTLSRecord(state *tls.ConnectionState) *TLSRecord {
+	rec := &TLSRecord{
+		Version:            tls.VersionName(state.Version),
+		CipherSuite:        tls.CipherSuiteName(state.CipherSuite),
+		NegotiatedProtocol: state.NegotiatedProtocol,
+		ServerName:         state.ServerName,
+		DidResume:          state.DidResume,
+		PeerCertificates:   make([]*CertificateRecord, 0, len(state.PeerCertificates)),
+		OCSPResponse:       state.OCSPResponse,
+		SCTs:               append([][]byte{}, state.SignedCertificateTimestamps...),
+		EmbeddedSCTs:       [][]byte{},
+	}
+	for _, cert := range state.PeerCertificates {
+		rec.PeerCertificates = append(rec.PeerCertificates, NewCertificateRecord(cert))
+	}
+	if len(state.PeerCertificates) > 0 {
+		rec.EmbeddedSCTs = append(rec.EmbeddedSCTs, embeddedSCTs(state.PeerCertificates[0])...)
+	}
+	return rec
+}
+
+// oidExtensionSCTList is the OID of the X.509 extension
+// containing the embedded SCTs (RFC 6962 Section 3.3).
+var oidExtensionSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+
+// embeddedSCTs returns the SCTs embedded in the certificate, if
+// any, ignoring a malformed SCT list extension.
+func embeddedSCTs(cert *x509.Certificate) [][]byte {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidExtensionSCTList) {
+			continue
+		}
+		var list []byte
+		if rest, err := asn1.Unmarshal(ext.Value, &list); err != nil || len(rest) > 0 {
+			return nil
+		}
+		return parseSCTList(list)
+	}
+	return nil
+}
+
+// parseSCTList parses a TLS-encoded SignedCertificateTimestampList, where
+// the list and each SCT are prefixed by their uint16 length.
+func parseSCTList(list []byte) [][]byte {
+	if len(list) < 2 || int(binary.BigEndian.Uint16(list)) != len(list)-2 {
+		return nil
+	}
+	var out [][]byte
+	for list = list[2:]; len(list) > 0; {
+		if len(list) < 2 {
+			return nil
+		}
+		size := int(binary.BigEndian.Uint16(list))
+		if len(list)-2 < size {
+			return nil
+		}
+		out = append(out, list[2:2+size])
+		list = list[2+size:]
+	}
+	return out
+}
+
+// CertificateRecord is the serializable summary of a [*x509.Certificate].
+//
+// When serialized, it is an object with these fields:
+//
+//   - "der" (bytes): the raw DER-encoded certificate;
+//   - "subject" (string): the subject distinguished name;
+//   - "issuer" (string): the issuer distinguished name;
+//   - "dns_names" (array of strings): the DNS SANs;
+//   - "ip_addresses" (array of strings): the IP address SANs;
+//   - "not_before" (string): the start of validity using RFC 3339;
+//   - "not_after" (string): the end of validity using RFC 3339.
+//
+// Using JSON, bytes are base64-encoded strings.
+//
+// Construct using [NewCertificateRecord].
+type CertificateRecord struct {
+	DER         []byte   `json:"der"`
+	Subject     string   `json:"subject"`
+	Issuer      string   `json:"issuer"`
+	DNSNames    []string `json:"dns_names"`
+	IPAddresses []string `json:"ip_addresses"`
+	NotBefore   string   `json:"not_before"`
+	NotAfter    string   `json:"not_after"`
+}
+
+// HasOCSPResponse returns whether the server stapled an OCSP response.
+func (r *TLSRecord) HasOCSPResponse() bool {
+	return len(r.OCSPResponse) > 0
+}
+
+// HasSCTs returns whether the server presented SCTs using the TLS
+// extension or embedded in the leaf certificate.
+func (r *TLSRecord) HasSCTs() bool {
+	return len(r.SCTs) > 0 || len(r.EmbeddedSCTs) > 0
+}
+
+// NewCertificateRecord converts a [*x509.Certificate] to a [*CertificateRecord].
+func NewCertificateRecord(cert *x509.Certificate) *CertificateRecord {
+	rec := &CertificateRecord{
+		DER:         cert.Raw,
+		Subject:     cert.Subject.String(),
+		Issuer:      cert.Issuer.String(),
+		DNSNames:    append([]string{}, cert.DNSNames...),
+		IPAddresses: make([]string, 0, len(cert.IPAddresses)),
+		NotBefore:   cert.NotBefore.UTC().Format(time.RFC3339),
+		NotAfter:    cert.NotAfter.UTC().Format(time.RFC3339),
+	}
+	for _, addr := range cert.IPAddresses {
+		rec.IPAddresses = append(rec.IPAddresses, addr.String())
+	}
+	return rec
+}
@@ -0,0 +1,158 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExchangeEventTLSRecord(t *testing.T) {
+	srv := httptest.NewTLSServer(dnsHandler(t))
+	defer srv.Close()
+
+	var ev *dnsoverhttps.ExchangeEvent
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	dt.ObserveExchange = func(e *dnsoverhttps.ExchangeEvent) {
+		ev = e
+	}
+
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+	_, err := dt.Exchange(context.Background(), query)
+	require.NoError(t, err)
+	require.NotNil(t, ev)
+	require.NotNil(t, ev.TLS)
+
+	rec := dnsoverhttps.NewExchangeRecord(ev)
+	require.NotNil(t, rec.TLS)
+	assert.Equal(t, "TLS 1.3", rec.TLS.Version)
+	assert.NotEmpty(t, rec.TLS.CipherSuite)
+	assert.Equal(t, "", rec.TLS.NegotiatedProtocol)
+	require.Len(t, rec.TLS.PeerCertificates, 1)
+	assert.False(t, rec.TLS.HasOCSPResponse())
+	assert.False(t, rec.TLS.HasSCTs())
+
+	leaf := srv.Certificate()
+	cert := rec.TLS.PeerCertificates[0]
+	assert.Equal(t, leaf.Raw, cert.DER)
+	assert.Equal(t, leaf.Subject.String(), cert.Subject)
+	assert.Equal(t, leaf.Issuer.String(), cert.Issuer)
+	assert.Equal(t, leaf.DNSNames, cert.DNSNames)
+	assert.Contains(t, cert.IPAddresses, "127.0.0.1")
+	assert.Equal(t, leaf.NotBefore.UTC().Format(time.RFC3339), cert.NotBefore)
+	assert.Equal(t, leaf.NotAfter.UTC().Format(time.RFC3339), cert.NotAfter)
+}
+
+func TestExchangeRecordWithoutTLS(t *testing.T) {
+	rec := dnsoverhttps.NewExchangeRecord(&dnsoverhttps.ExchangeEvent{})
+	assert.Nil(t, rec.TLS)
+}
+
+func TestExchangeEventTLSRecordStapledData(t *testing.T) {
+	srv := httptest.NewUnstartedServer(dnsHandler(t))
+	srv.StartTLS()
+	defer srv.Close()
+	srv.TLS.Certificates[0].OCSPStaple = []byte("ocsp-staple")
+	srv.TLS.Certificates[0].SignedCertificateTimestamps = [][]byte{[]byte("sct-0"), []byte("sct-1")}
+
+	var ev *dnsoverhttps.ExchangeEvent
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	dt.ObserveExchange = func(e *dnsoverhttps.ExchangeEvent) {
+		ev = e
+	}
+
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+	_, err := dt.Exchange(context.Background(), query)
+	require.NoError(t, err)
+	require.NotNil(t, ev)
+	require.NotNil(t, ev.TLS)
+
+	rec := dnsoverhttps.NewTLSRecord(ev.TLS)
+	assert.True(t, rec.HasOCSPResponse())
+	assert.Equal(t, []byte("ocsp-staple"), rec.OCSPResponse)
+	assert.True(t, rec.HasSCTs())
+	assert.Equal(t, [][]byte{[]byte("sct-0"), []byte("sct-1")}, rec.SCTs)
+}
+
+// newCertificateWithSCTList returns a self-signed certificate
+// whose SCT list extension has the given TLS-encoded value.
+func newCertificateWithSCTList(t *testing.T, list []byte) *x509.Certificate {
+	value, err := asn1.Marshal(list)
+	require.NoError(t, err)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtraExtensions: []pkix.Extension{{
+			Id:    asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2},
+			Value: value,
+		}},
+	}
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(raw)
+	require.NoError(t, err)
+	return cert
+}
+
+func TestTLSRecordEmbeddedSCTs(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// list is the TLS-encoded SCT list.
+		list []byte
+
+		// want contains the expected embedded SCTs.
+		want [][]byte
+	}
+
+	testCases := []testCase{
+		{
+			name: "valid list",
+			list: []byte{0, 11, 0, 3, 's', 'c', 't', 0, 4, 's', 'c', 't', '1'},
+			want: [][]byte{[]byte("sct"), []byte("sct1")},
+		},
+
+		{
+			name: "invalid list length",
+			list: []byte{0, 12, 0, 3, 's', 'c', 't'},
+			want: [][]byte{},
+		},
+
+		{
+			name: "truncated SCT",
+			list: []byte{0, 5, 0, 4, 's', 'c', 't'},
+			want: [][]byte{},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			cert := newCertificateWithSCTList(t, tt.list)
+			rec := dnsoverhttps.NewTLSRecord(&tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}})
+			assert.Equal(t, tt.want, rec.EmbeddedSCTs)
+			assert.Empty(t, rec.SCTs)
+			assert.Equal(t, len(tt.want) > 0, rec.HasSCTs())
+		})
+	}
+}
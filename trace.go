@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// exchangeTracer records [httptrace.ClientTrace] events into an [*ExchangeEvent].
+//
+// The [*http.Transport] may invoke hooks from background goroutines, even
+// after the round trip is complete, so we synchronize access to the event
+// and ignore hooks invoked after [*exchangeTracer.finish].
+type exchangeTracer struct {
+	// ev is the event to record into.
+	ev *ExchangeEvent
+
+	// done indicates that the exchange is complete.
+	done bool
+
+	// mu protects ev and done.
+	mu sync.Mutex
+}
+
+// withExchangeTracer returns a context with a [*httptrace.ClientTrace] recording
+// into ev along with the [*exchangeTracer] to finish once the exchange is complete.
+func withExchangeTracer(ctx context.Context, ev *ExchangeEvent) (context.Context, *exchangeTracer) {
+	et := &exchangeTracer{ev: ev}
+	trace := &httptrace.ClientTrace{
+		DNSStart:          et.dnsStart,
+		DNSDone:           et.dnsDone,
+		TLSHandshakeStart: et.tlsHandshakeStart,
+		TLSHandshakeDone:  et.tlsHandshakeDone,
+		GotConn:           et.gotConn,
+	}
+	return httptrace.WithClientTrace(ctx, trace), et
+}
+
+// record calls fn with the event unless the exchange is complete.
+func (et *exchangeTracer) record(fn func(ev *ExchangeEvent)) {
+	et.mu.Lock()
+	defer et.mu.Unlock()
+	if !et.done {
+		fn(et.ev)
+	}
+}
+
+// finish marks the exchange as complete.
+func (et *exchangeTracer) finish() {
+	et.mu.Lock()
+	et.done = true
+	et.mu.Unlock()
+}
+
+// dnsStart implements [httptrace.ClientTrace.DNSStart].
+func (et *exchangeTracer) dnsStart(httptrace.DNSStartInfo) {
+	now := time.Now()
+	et.record(func(ev *ExchangeEvent) {
+		ev.BootstrapStartTime = now
+	})
+}
+
+// dnsDone implements [httptrace.ClientTrace.DNSDone].
+func (et *exchangeTracer) dnsDone(info httptrace.DNSDoneInfo) {
+	now := time.Now()
+	et.record(func(ev *ExchangeEvent) {
+		if ev.BootstrapStartTime.IsZero() {
+			return
+		}
+		ev.BootstrapDuration = now.Sub(ev.BootstrapStartTime)
+		ev.BootstrapErr = info.Err
+		for _, addr := range info.Addrs {
+			ev.BootstrapAddrs = append(ev.BootstrapAddrs, addr.IP.String())
+		}
+	})
+}
+
+// tlsHandshakeStart implements [httptrace.ClientTrace.TLSHandshakeStart].
+func (et *exchangeTracer) tlsHandshakeStart() {
+	now := time.Now()
+	et.record(func(ev *ExchangeEvent) {
+		ev.TLSHandshakeStartTime = now
+	})
+}
+
+// tlsHandshakeDone implements [httptrace.ClientTrace.TLSHandshakeDone].
+func (et *exchangeTracer) tlsHandshakeDone(_ tls.ConnectionState, err error) {
+	now := time.Now()
+	et.record(func(ev *ExchangeEvent) {
+		if !ev.TLSHandshakeStartTime.IsZero() {
+			ev.TLSHandshakeDuration = now.Sub(ev.TLSHandshakeStartTime)
+			ev.TLSHandshakeErr = err
+		}
+	})
+}
+
+// gotConn implements [httptrace.ClientTrace.GotConn].
+func (et *exchangeTracer) gotConn(info httptrace.GotConnInfo) {
+	et.record(func(ev *ExchangeEvent) {
+		ev.ConnReused = info.Reused
+		ev.ConnWasIdle = info.WasIdle
+		ev.ConnIdleTime = info.IdleTime
+	})
+}
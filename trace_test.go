@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exchangeAndObserve performs an exchange and returns the observed event.
+func exchangeAndObserve(t *testing.T, client dnsoverhttps.Client, URL string) *dnsoverhttps.ExchangeEvent {
+	t.Helper()
+	var ev *dnsoverhttps.ExchangeEvent
+	dt := dnsoverhttps.NewTransport(client, URL)
+	dt.ObserveExchange = func(e *dnsoverhttps.ExchangeEvent) {
+		ev = e
+	}
+	query := dnscodec.NewQuery("dns.google", dns.TypeA)
+	_, _ = dt.Exchange(context.Background(), query)
+	require.NotNil(t, ev)
+	return ev
+}
+
+func TestExchangeEventTLSHandshakeTiming(t *testing.T) {
+	srv := httptest.NewTLSServer(dnsHandler(t))
+	defer srv.Close()
+	client := srv.Client()
+
+	// the first exchange performs the TLS handshake
+	first := exchangeAndObserve(t, client, srv.URL)
+	require.NoError(t, first.Err)
+	assert.False(t, first.TLSHandshakeStartTime.IsZero())
+	assert.False(t, first.TLSHandshakeStartTime.Before(first.StartTime))
+	assert.True(t, first.TLSHandshakeDuration > 0)
+	assert.NoError(t, first.TLSHandshakeErr)
+
+	rec := dnsoverhttps.NewExchangeRecord(first)
+	require.NotNil(t, rec.TLSHandshakeT0)
+	require.NotNil(t, rec.TLSHandshakeT)
+	assert.Equal(t, first.TLSHandshakeDuration.Seconds(), *rec.TLSHandshakeT)
+	assert.Nil(t, rec.TLSHandshakeFailure)
+
+	// the second exchange reuses the connection
+	second := exchangeAndObserve(t, client, srv.URL)
+	require.NoError(t, second.Err)
+	assert.True(t, second.TLSHandshakeStartTime.IsZero())
+	assert.Nil(t, dnsoverhttps.NewExchangeRecord(second).TLSHandshakeT0)
+}
+
+func TestExchangeEventTLSHandshakeFailure(t *testing.T) {
+	srv := httptest.NewTLSServer(dnsHandler(t))
+	defer srv.Close()
+
+	// the client does not trust the server certificate
+	client := &http.Client{Transport: &http.Transport{}}
+	ev := exchangeAndObserve(t, client, srv.URL)
+
+	require.Error(t, ev.Err)
+	assert.False(t, ev.TLSHandshakeStartTime.IsZero())
+	require.Error(t, ev.TLSHandshakeErr)
+
+	rec := dnsoverhttps.NewExchangeRecord(ev)
+	require.NotNil(t, rec.TLSHandshakeFailure)
+	assert.Equal(t, ev.TLSHandshakeErr.Error(), *rec.TLSHandshakeFailure)
+}
+
+func TestExchangeEventBootstrap(t *testing.T) {
+	srv := httptest.NewServer(dnsHandler(t))
+	defer srv.Close()
+
+	t.Run("with hostname", func(t *testing.T) {
+		URL := strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)
+		ev := exchangeAndObserve(t, &http.Client{Transport: &http.Transport{}}, URL)
+		require.NoError(t, ev.Err)
+		assert.False(t, ev.BootstrapStartTime.IsZero())
+		assert.True(t, ev.BootstrapDuration > 0)
+		assert.Contains(t, ev.BootstrapAddrs, "127.0.0.1")
+		assert.NoError(t, ev.BootstrapErr)
+
+		rec := dnsoverhttps.NewExchangeRecord(ev)
+		require.NotNil(t, rec.BootstrapT0)
+		require.NotNil(t, rec.BootstrapT)
+		assert.Equal(t, ev.BootstrapAddrs, rec.BootstrapAddrs)
+		assert.Nil(t, rec.BootstrapFailure)
+	})
+
+	t.Run("with IP address", func(t *testing.T) {
+		ev := exchangeAndObserve(t, &http.Client{Transport: &http.Transport{}}, srv.URL)
+		require.NoError(t, ev.Err)
+		assert.True(t, ev.BootstrapStartTime.IsZero())
+		assert.Empty(t, ev.BootstrapAddrs)
+		assert.Nil(t, dnsoverhttps.NewExchangeRecord(ev).BootstrapT0)
+	})
+
+	t.Run("with lookup failure", func(t *testing.T) {
+		ev := exchangeAndObserve(t, &http.Client{Transport: &http.Transport{}}, "http://nonexistent.invalid/dns-query")
+		require.Error(t, ev.Err)
+		assert.False(t, ev.BootstrapStartTime.IsZero())
+		require.Error(t, ev.BootstrapErr)
+
+		rec := dnsoverhttps.NewExchangeRecord(ev)
+		require.NotNil(t, rec.BootstrapFailure)
+		assert.Equal(t, ev.BootstrapErr.Error(), *rec.BootstrapFailure)
+	})
+}
+
+func TestExchangeEventConnReuse(t *testing.T) {
+	srv := httptest.NewTLSServer(dnsHandler(t))
+	defer srv.Close()
+	client := srv.Client()
+
+	// the first exchange uses a cold connection
+	first := exchangeAndObserve(t, client, srv.URL)
+	require.NoError(t, first.Err)
+	assert.False(t, first.ConnReused)
+	assert.False(t, first.ConnWasIdle)
+
+	// the second exchange reuses the idle connection
+	second := exchangeAndObserve(t, client, srv.URL)
+	require.NoError(t, second.Err)
+	assert.True(t, second.ConnReused)
+	assert.True(t, second.ConnWasIdle)
+	assert.True(t, second.ConnIdleTime > 0)
+
+	rec := dnsoverhttps.NewExchangeRecord(second)
+	assert.True(t, rec.ConnReused)
+	assert.True(t, rec.ConnWasIdle)
+	assert.Equal(t, second.ConnIdleTime.Seconds(), rec.ConnIdleTime)
+}
@@ -0,0 +1,111 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// Anomalies annotated by [*TTLAnalyzer].
+const (
+	// AnomalyZeroTTL indicates that all the answer RRs have zero TTL.
+	AnomalyZeroTTL = "zero_ttl"
+
+	// AnomalyExcessiveTTL indicates that an answer RR has a TTL exceeding
+	// the [*TTLAnalyzer] MaxTTL.
+	AnomalyExcessiveTTL = "excessive_ttl"
+
+	// AnomalyRepeatedTTL indicates that the answer TTL is identical to the one
+	// of answers for unrelated names, which is typical of injected answers
+	// that use a fixed TTL. See the [*TTLAnalyzer] SameTTLNames field.
+	AnomalyRepeatedTTL = "repeated_ttl"
+)
+
+// TTLAnalyzer flags responses with suspicious TTL patterns.
+//
+// Set it as the [Transport] TTLAnalyzer to annotate the exchanges. Since it
+// remembers the TTLs it observed, share the same [*TTLAnalyzer] among the
+// transports whose answers you want to compare.
+//
+// Construct using [NewTTLAnalyzer].
+type TTLAnalyzer struct {
+	// MaxTTL is the maximum sane TTL in seconds. Zero disables the check.
+	//
+	// Set by [NewTTLAnalyzer] to 604800 (i.e., one week), which is the
+	// cap suggested by RFC 8767 Section 4.
+	MaxTTL uint32
+
+	// SameTTLNames is the number of distinct names whose answers must share
+	// the same nonzero TTL for us to flag the TTL as repeated. Zero disables
+	// the check, which is prone to false positives with small values, since
+	// many zones use round TTLs (e.g., 300 seconds).
+	//
+	// Set by [NewTTLAnalyzer] to zero.
+	SameTTLNames int
+
+	// mu protects names.
+	mu sync.Mutex
+
+	// names maps each TTL to up to SameTTLNames names having such a TTL.
+	names map[uint32]map[string]struct{}
+}
+
+// NewTTLAnalyzer creates a new [*TTLAnalyzer].
+func NewTTLAnalyzer() *TTLAnalyzer {
+	return &TTLAnalyzer{MaxTTL: 604800, SameTTLNames: 0}
+}
+
+// Analyze returns the TTL anomalies (e.g., [AnomalyZeroTTL]) of the response
+// message and, when SameTTLNames is nonzero, remembers its answer TTL.
+//
+// This method is safe to call from multiple goroutines.
+func (ta *TTLAnalyzer) Analyze(respMsg *dns.Msg) []string {
+	// 1. check the TTLs of the answer RRs
+	if len(respMsg.Answer) <= 0 || len(respMsg.Question) != 1 {
+		return nil
+	}
+	var anomalies []string
+	if maxTTL(respMsg.Answer) == 0 {
+		anomalies = append(anomalies, AnomalyZeroTTL)
+	}
+	if ta.MaxTTL > 0 && maxTTL(respMsg.Answer) > ta.MaxTTL {
+		anomalies = append(anomalies, AnomalyExcessiveTTL)
+	}
+
+	// 2. check whether unrelated names share the same TTL
+	ttl := minTTL(respMsg.Answer)
+	if ta.SameTTLNames > 0 && ttl > 0 && ta.remember(ttl, dns.CanonicalName(respMsg.Question[0].Name)) {
+		anomalies = append(anomalies, AnomalyRepeatedTTL)
+	}
+	return anomalies
+}
+
+// remember records that name had the given TTL and returns whether at
+// least SameTTLNames distinct names had the given TTL.
+func (ta *TTLAnalyzer) remember(ttl uint32, name string) bool {
+	ta.mu.Lock()
+	defer ta.mu.Unlock()
+	if ta.names == nil {
+		ta.names = make(map[uint32]map[string]struct{})
+	}
+	names := ta.names[ttl]
+	if names == nil {
+		names = make(map[string]struct{})
+		ta.names[ttl] = names
+	}
+	if len(names) < ta.SameTTLNames {
+		names[name] = struct{}{}
+	}
+	return len(names) >= ta.SameTTLNames
+}
+
+// maxTTL returns the maximum TTL of the given non-empty RRs.
+func maxTTL(rrs []dns.RR) uint32 {
+	ttl := rrs[0].Header().Ttl
+	for _, rr := range rrs[1:] {
+		ttl = max(ttl, rr.Header().Ttl)
+	}
+	return ttl
+}
@@ -0,0 +1,162 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTTLResponse returns a response for name with an A record for each TTL.
+func newTTLResponse(name string, ttls ...uint32) *dns.Msg {
+	msg := &dns.Msg{}
+	msg.SetQuestion(dns.Fqdn(name), dns.TypeA)
+	for _, ttl := range ttls {
+		msg.Answer = append(msg.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: dns.Fqdn(name), Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+			A:   net.IPv4(8, 8, 8, 8),
+		})
+	}
+	return msg
+}
+
+func TestTTLAnalyzer(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// configure configures the analyzer.
+		configure func(ta *dnsoverhttps.TTLAnalyzer)
+
+		// msgs are the messages to analyze in order.
+		msgs []*dns.Msg
+
+		// want contains the expected anomalies for the last message.
+		want []string
+	}
+
+	testCases := []testCase{
+		{
+			name:      "sane TTLs",
+			configure: func(ta *dnsoverhttps.TTLAnalyzer) {},
+			msgs:      []*dns.Msg{newTTLResponse("dns.google", 300, 200)},
+		},
+
+		{
+			name:      "no answer",
+			configure: func(ta *dnsoverhttps.TTLAnalyzer) {},
+			msgs:      []*dns.Msg{newTTLResponse("dns.google")},
+		},
+
+		{
+			name:      "all-zero TTLs",
+			configure: func(ta *dnsoverhttps.TTLAnalyzer) {},
+			msgs:      []*dns.Msg{newTTLResponse("dns.google", 0, 0)},
+			want:      []string{dnsoverhttps.AnomalyZeroTTL},
+		},
+
+		{
+			name:      "some zero TTLs",
+			configure: func(ta *dnsoverhttps.TTLAnalyzer) {},
+			msgs:      []*dns.Msg{newTTLResponse("dns.google", 0, 300)},
+		},
+
+		{
+			name:      "excessive TTL",
+			configure: func(ta *dnsoverhttps.TTLAnalyzer) {},
+			msgs:      []*dns.Msg{newTTLResponse("dns.google", 300, 2147483647)},
+			want:      []string{dnsoverhttps.AnomalyExcessiveTTL},
+		},
+
+		{
+			name:      "excessive TTL check disabled",
+			configure: func(ta *dnsoverhttps.TTLAnalyzer) { ta.MaxTTL = 0 },
+			msgs:      []*dns.Msg{newTTLResponse("dns.google", 2147483647)},
+		},
+
+		{
+			name:      "custom max TTL",
+			configure: func(ta *dnsoverhttps.TTLAnalyzer) { ta.MaxTTL = 60 },
+			msgs:      []*dns.Msg{newTTLResponse("dns.google", 61)},
+			want:      []string{dnsoverhttps.AnomalyExcessiveTTL},
+		},
+
+		{
+			name:      "repeated TTL check disabled",
+			configure: func(ta *dnsoverhttps.TTLAnalyzer) {},
+			msgs: []*dns.Msg{
+				newTTLResponse("www.example.com", 1234),
+				newTTLResponse("www.example.org", 1234),
+			},
+		},
+
+		{
+			name:      "repeated TTL across unrelated names",
+			configure: func(ta *dnsoverhttps.TTLAnalyzer) { ta.SameTTLNames = 3 },
+			msgs: []*dns.Msg{
+				newTTLResponse("www.example.com", 1234),
+				newTTLResponse("www.example.org", 1234),
+				newTTLResponse("www.example.net", 1234),
+			},
+			want: []string{dnsoverhttps.AnomalyRepeatedTTL},
+		},
+
+		{
+			name:      "same name repeated",
+			configure: func(ta *dnsoverhttps.TTLAnalyzer) { ta.SameTTLNames = 2 },
+			msgs: []*dns.Msg{
+				newTTLResponse("www.example.com", 1234),
+				newTTLResponse("WWW.example.com", 1234),
+			},
+		},
+
+		{
+			name:      "different TTLs",
+			configure: func(ta *dnsoverhttps.TTLAnalyzer) { ta.SameTTLNames = 2 },
+			msgs: []*dns.Msg{
+				newTTLResponse("www.example.com", 1234),
+				newTTLResponse("www.example.org", 1233),
+			},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			ta := dnsoverhttps.NewTTLAnalyzer()
+			tt.configure(ta)
+			var got []string
+			for _, msg := range tt.msgs {
+				got = ta.Analyze(msg)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestExchangeTTLAnalyzer(t *testing.T) {
+	srv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+		resp := newTTLResponse(query.Question[0].Name, 0)
+		resp.SetReply(query)
+		return resp
+	})
+	defer srv.Close()
+
+	var event *dnsoverhttps.ExchangeEvent
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+	dt.TTLAnalyzer = dnsoverhttps.NewTTLAnalyzer()
+	dt.ObserveExchange = func(ev *dnsoverhttps.ExchangeEvent) {
+		event = ev
+	}
+
+	_, err := dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+	require.NoError(t, err)
+	require.NotNil(t, event)
+	assert.Contains(t, event.Anomalies, dnsoverhttps.AnomalyZeroTTL)
+}
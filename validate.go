@@ -0,0 +1,616 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/miekg/dns"
+)
+
+// ErrDNSSECBogus indicates that DNSSEC validation failed.
+var ErrDNSSECBogus = errors.New("DNSSEC validation failed")
+
+// errInsecureZone indicates that the zone is provably unsigned.
+var errInsecureZone = errors.New("insecure delegation")
+
+// errNoTrustAnchor indicates that no trust anchor covers the zone.
+var errNoTrustAnchor = errors.New("no trust anchor")
+
+// maxValidationQueries bounds the number of queries [*Validator.Validate] issues
+// to build the chain of trust, such that a malicious server cannot make us
+// issue an unbounded number of queries.
+const maxValidationQueries = 32
+
+// ValidationStatus is the DNSSEC validation status (RFC 4035 Section 4.3).
+type ValidationStatus uint8
+
+const (
+	// ValidationIndeterminate indicates that we could not determine whether
+	// the data should be signed (e.g., because no trust anchor covers it).
+	ValidationIndeterminate ValidationStatus = iota
+
+	// ValidationSecure indicates that we built a chain of trust from a trust
+	// anchor to each answer RRset.
+	ValidationSecure
+
+	// ValidationInsecure indicates that we proved that the answer belongs
+	// to an unsigned zone delegated from a signed zone.
+	ValidationInsecure
+
+	// ValidationBogus indicates that the answer should be signed but we
+	// could not validate it (e.g., because a resolver stripped or forged
+	// the DNSSEC records).
+	ValidationBogus
+)
+
+// String implements [fmt.Stringer].
+func (s ValidationStatus) String() string {
+	switch s {
+	case ValidationIndeterminate:
+		return "indeterminate"
+	case ValidationSecure:
+		return "secure"
+	case ValidationInsecure:
+		return "insecure"
+	case ValidationBogus:
+		return "bogus"
+	default:
+		return fmt.Sprintf("ValidationStatus(%d)", uint8(s))
+	}
+}
+
+// ADPolicy controls whether [*Validator] trusts the AD bit set by the resolver.
+type ADPolicy uint8
+
+const (
+	// ADPolicyValidate ignores the AD bit and always validates locally.
+	ADPolicyValidate ADPolicy = iota
+
+	// ADPolicyTrust considers a response having the AD bit set (RFC 4035
+	// Section 3.2.3) as authenticated without validating it locally. We still
+	// validate locally the responses without the AD bit and the responses
+	// to queries having the CD bit set, for which the AD bit is meaningless.
+	//
+	// Use this policy only with a resolver you trust, since anyone in control
+	// of the resolver can set the AD bit on forged data.
+	ADPolicyTrust
+)
+
+// String implements [fmt.Stringer].
+func (p ADPolicy) String() string {
+	switch p {
+	case ADPolicyValidate:
+		return "validate"
+	case ADPolicyTrust:
+		return "trust"
+	default:
+		return fmt.Sprintf("ADPolicy(%d)", uint8(p))
+	}
+}
+
+// ValidationResult is the result of [*Validator.Validate].
+type ValidationResult struct {
+	// Status is the validation status.
+	Status ValidationStatus
+
+	// Err explains why the status is not [ValidationSecure] or is nil. When the
+	// status is [ValidationBogus], this error wraps [ErrDNSSECBogus].
+	Err error
+
+	// Authenticated indicates whether the resolver set the AD bit, which
+	// is useful to compare the resolver's opinion with the Status.
+	Authenticated bool
+
+	// TrustedAD indicates whether the Status is [ValidationSecure] because the
+	// [ADPolicy] allowed us to trust the AD bit, in which case we did not
+	// validate locally.
+	TrustedAD bool
+}
+
+// Validator is an [Exchanger] validating the DNSSEC signatures of the answers
+// returned by another [Exchanger], which allows to study resolvers that strip or
+// forge DNSSEC data. We fetch the DNSKEY and DS records using the same [Exchanger]
+// and validate the RRSIG records up to the configured trust anchors.
+//
+// We validate the RRsets in the answer section, including CNAME records, and
+// prove insecure delegations using NSEC or NSEC3 records. We do not validate
+// negative answers or check that wildcard expansions are legitimate. Because we
+// do not cache the chain of trust across answers, each validation may issue
+// several queries. Consider setting [Transport] CheckingDisabled such that the
+// resolver returns the data it would consider bogus.
+//
+// Construct using [NewValidator].
+type Validator struct {
+	// Exchanger is the [Exchanger] to use.
+	//
+	// Set by [NewValidator] to the user-provided value.
+	Exchanger Exchanger
+
+	// TrustAnchors contains the DS records of the trust anchors.
+	//
+	// Set by [NewValidator] to [DefaultRootTrustAnchors].
+	TrustAnchors []*dns.DS
+
+	// ADPolicy controls whether we trust the AD bit set by the resolver.
+	//
+	// Set by [NewValidator] to [ADPolicyValidate].
+	ADPolicy ADPolicy
+
+	// ObserveValidation is an optional hook called by [*Validator.Exchange]
+	// with the query name and the result of [*Validator.Validate].
+	ObserveValidation func(name string, result *ValidationResult)
+}
+
+var _ Exchanger = &Validator{}
+
+// NewValidator creates a new [*Validator].
+func NewValidator(exchanger Exchanger) *Validator {
+	return &Validator{Exchanger: exchanger, TrustAnchors: DefaultRootTrustAnchors()}
+}
+
+// DefaultRootTrustAnchors returns the DS records of the root zone KSK-2017 and KSK-2024.
+func DefaultRootTrustAnchors() []*dns.DS {
+	return []*dns.DS{
+		{
+			Hdr:        dns.RR_Header{Name: ".", Rrtype: dns.TypeDS, Class: dns.ClassINET},
+			KeyTag:     20326,
+			Algorithm:  dns.RSASHA256,
+			DigestType: dns.SHA256,
+			Digest:     "E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+		},
+		{
+			Hdr:        dns.RR_Header{Name: ".", Rrtype: dns.TypeDS, Class: dns.ClassINET},
+			KeyTag:     38696,
+			Algorithm:  dns.RSASHA256,
+			DigestType: dns.SHA256,
+			Digest:     "683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+		},
+	}
+}
+
+// Exchange implements [Exchanger].
+//
+// On success, it validates the response and calls the ObserveValidation
+// hook. It always returns the result of the wrapped [Exchanger].
+func (v *Validator) Exchange(ctx context.Context, query *dnscodec.Query) (*dnscodec.Response, error) {
+	resp, err := v.Exchanger.Exchange(ctx, query)
+	if err == nil && v.ObserveValidation != nil {
+		v.ObserveValidation(query.Name, v.Validate(ctx, resp))
+	}
+	return resp, err
+}
+
+// Validate validates the DNSSEC signatures of the answer RRsets of the response,
+// unless the [ADPolicy] allows us to trust the AD bit set by the resolver.
+//
+// The result is the worst result among the RRsets, where [ValidationBogus] is worse
+// than [ValidationIndeterminate], which is worse than [ValidationInsecure]. Thus,
+// the result is [ValidationSecure] only when all the RRsets are secure.
+func (v *Validator) Validate(ctx context.Context, resp *dnscodec.Response) *ValidationResult {
+	// 1. apply the AD bit policy
+	authenticated := resp.Response != nil && resp.Response.AuthenticatedData
+	checkingDisabled := resp.Query != nil && resp.Query.CheckingDisabled
+	if authenticated && !checkingDisabled && v.ADPolicy == ADPolicyTrust {
+		return &ValidationResult{Status: ValidationSecure, Authenticated: true, TrustedAD: true}
+	}
+
+	// 2. group the answer into RRsets, ignoring orphan RRSIG records
+	var rrsets []*rrset
+	for _, set := range groupRRsets(resp.ValidRRs) {
+		if len(set.rrs) > 0 {
+			rrsets = append(rrsets, set)
+		}
+	}
+	if len(rrsets) <= 0 {
+		return &ValidationResult{
+			Status:        ValidationIndeterminate,
+			Err:           errors.New("no answer RRsets"),
+			Authenticated: authenticated,
+		}
+	}
+
+	// 3. validate each RRset and keep the worst result
+	val := &validation{ctx: ctx, now: time.Now(), v: v, zones: make(map[string]*zoneKeys)}
+	result := &ValidationResult{Status: ValidationSecure, Authenticated: authenticated}
+	for _, set := range rrsets {
+		status, err := val.rrset(set)
+		if validationRank(status) > validationRank(result.Status) {
+			result.Status, result.Err = status, err
+		}
+	}
+	return result
+}
+
+// validationRank ranks the statuses from the best to the worst one.
+func validationRank(status ValidationStatus) int {
+	switch status {
+	case ValidationSecure:
+		return 0
+	case ValidationInsecure:
+		return 1
+	case ValidationIndeterminate:
+		return 2
+	default:
+		return 3
+	}
+}
+
+// rrset is an RRset along with the RRSIG records covering it.
+type rrset struct {
+	// name is the owner name.
+	name string
+
+	// rrtype is the RRset type.
+	rrtype uint16
+
+	// rrs contains the records.
+	rrs []dns.RR
+
+	// sigs contains the RRSIG records covering the records.
+	sigs []*dns.RRSIG
+}
+
+// groupRRsets groups the given records into RRsets, in order of appearance.
+func groupRRsets(rrs []dns.RR) []*rrset {
+	var (
+		index = make(map[string]*rrset)
+		out   []*rrset
+	)
+	lookup := func(name string, rrtype uint16) *rrset {
+		key := fmt.Sprintf("%s/%d", strings.ToLower(name), rrtype)
+		set := index[key]
+		if set == nil {
+			set = &rrset{name: name, rrtype: rrtype}
+			index[key] = set
+			out = append(out, set)
+		}
+		return set
+	}
+	for _, rr := range rrs {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			set := lookup(sig.Hdr.Name, sig.TypeCovered)
+			set.sigs = append(set.sigs, sig)
+			continue
+		}
+		set := lookup(rr.Header().Name, rr.Header().Rrtype)
+		set.rrs = append(set.rrs, rr)
+	}
+	return out
+}
+
+// zoneKeys contains the validated keys of a zone.
+type zoneKeys struct {
+	// keys contains the validated keys.
+	keys []*dns.DNSKEY
+
+	// rrs contains the validated DNSKEY RRset, including revoked keys.
+	rrs []dns.RR
+
+	// err is the validation error, if any.
+	err error
+}
+
+// validation contains the state of a single [*Validator.Validate] call.
+type validation struct {
+	// ctx is the context to use.
+	ctx context.Context
+
+	// now is the time used to check the signature validity.
+	now time.Time
+
+	// queries is the number of queries we issued.
+	queries int
+
+	// v is the [*Validator].
+	v *Validator
+
+	// zones caches the validated keys of each zone.
+	zones map[string]*zoneKeys
+}
+
+// bogus returns an error wrapping [ErrDNSSECBogus].
+func bogus(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrDNSSECBogus, fmt.Sprintf(format, args...))
+}
+
+// statusFromError maps an error to the corresponding [ValidationStatus].
+func statusFromError(err error) ValidationStatus {
+	switch {
+	case err == nil:
+		return ValidationSecure
+	case errors.Is(err, errInsecureZone):
+		return ValidationInsecure
+	case errors.Is(err, errNoTrustAnchor):
+		return ValidationIndeterminate
+	default:
+		return ValidationBogus
+	}
+}
+
+// exchange issues a query counting it against [maxValidationQueries].
+func (val *validation) exchange(name string, qtype uint16) (*dnscodec.Response, error) {
+	if val.queries >= maxValidationQueries {
+		return nil, bogus("too many queries")
+	}
+	val.queries++
+	return val.v.Exchanger.Exchange(val.ctx, dnscodec.NewQuery(name, qtype))
+}
+
+// rrset validates an RRset.
+func (val *validation) rrset(set *rrset) (ValidationStatus, error) {
+	if len(set.sigs) <= 0 {
+		return val.unsigned(set)
+	}
+	err := bogus("no valid RRSIG for %s %s", set.name, dns.TypeToString[set.rrtype])
+	for _, sig := range set.sigs {
+		if !dns.IsSubDomain(sig.SignerName, set.name) {
+			continue
+		}
+		keys, kerr := val.zoneKeys(sig.SignerName)
+		switch status := statusFromError(kerr); status {
+		case ValidationSecure:
+			if kerr = verifyRRSIG(set.rrs, sig, keys, val.now); kerr == nil {
+				return ValidationSecure, nil
+			}
+			err = kerr
+		case ValidationBogus:
+			err = kerr
+		default:
+			return status, kerr
+		}
+	}
+	return ValidationBogus, err
+}
+
+// verifyRRSIG verifies the RRSIG covering the records using the keys.
+func verifyRRSIG(rrs []dns.RR, sig *dns.RRSIG, keys []*dns.DNSKEY, now time.Time) error {
+	if !sig.ValidityPeriod(now) {
+		return bogus("RRSIG for %s outside its validity period", sig.Hdr.Name)
+	}
+	for _, key := range keys {
+		if key.KeyTag() == sig.KeyTag && key.Algorithm == sig.Algorithm && sig.Verify(key, rrs) == nil {
+			return nil
+		}
+	}
+	return bogus("RRSIG for %s does not verify", sig.Hdr.Name)
+}
+
+// zoneKeys returns the validated keys of the zone.
+func (val *validation) zoneKeys(zone string) ([]*dns.DNSKEY, error) {
+	zone = strings.ToLower(dns.Fqdn(zone))
+	if entry := val.zones[zone]; entry != nil {
+		return entry.keys, entry.err
+	}
+
+	// we preset an error to detect loops in the chain of trust
+	entry := &zoneKeys{err: bogus("loop in the chain of trust of %s", zone)}
+	val.zones[zone] = entry
+	entry.err = val.computeZoneKeys(zone, entry)
+	return entry.keys, entry.err
+}
+
+// computeZoneKeys implements zoneKeys.
+func (val *validation) computeZoneKeys(zone string, entry *zoneKeys) error {
+	// 1. obtain the trusted DS records from the anchors or the parent
+	dsset, err := val.delegation(zone)
+	if err != nil {
+		return err
+	}
+
+	// 2. fetch the DNSKEY RRset
+	resp, err := val.exchange(zone, dns.TypeDNSKEY)
+	if err != nil {
+		return bogus("cannot fetch DNSKEY for %s: %s", zone, err)
+	}
+	var (
+		keys []*dns.DNSKEY
+		sigs []*dns.RRSIG
+		rrs  []dns.RR
+	)
+	for _, rr := range resp.ValidRRs {
+		switch rr := rr.(type) {
+		case *dns.DNSKEY:
+			rrs = append(rrs, rr)
+			if rr.Flags&dns.ZONE != 0 && rr.Flags&dns.REVOKE == 0 {
+				keys = append(keys, rr)
+			}
+		case *dns.RRSIG:
+			if rr.TypeCovered == dns.TypeDNSKEY {
+				sigs = append(sigs, rr)
+			}
+		}
+	}
+
+	// 3. validate the DNSKEY RRset using a key matching a DS record
+	var trusted []*dns.DNSKEY
+	for _, key := range keys {
+		if matchesDS(key, dsset) {
+			trusted = append(trusted, key)
+		}
+	}
+	for _, sig := range sigs {
+		if verifyRRSIG(rrs, sig, trusted, val.now) == nil {
+			entry.keys, entry.rrs = keys, rrs
+			return nil
+		}
+	}
+	return bogus("no DNSKEY for %s matches a trusted DS", zone)
+}
+
+// matchesDS returns whether the key matches any DS record.
+func matchesDS(key *dns.DNSKEY, dsset []*dns.DS) bool {
+	for _, ds := range dsset {
+		if key.KeyTag() != ds.KeyTag || key.Algorithm != ds.Algorithm {
+			continue
+		}
+		if digest := key.ToDS(ds.DigestType); digest != nil && strings.EqualFold(digest.Digest, ds.Digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// anchorsFor returns the trust anchors of the zone.
+func (v *Validator) anchorsFor(zone string) []*dns.DS {
+	var anchors []*dns.DS
+	for _, ds := range v.TrustAnchors {
+		if strings.EqualFold(dns.Fqdn(ds.Hdr.Name), zone) {
+			anchors = append(anchors, ds)
+		}
+	}
+	return anchors
+}
+
+// delegation returns the trusted DS records of the zone.
+func (val *validation) delegation(zone string) ([]*dns.DS, error) {
+	// 1. use the trust anchors, if any
+	if anchors := val.v.anchorsFor(zone); len(anchors) > 0 {
+		return anchors, nil
+	}
+	if zone == "." {
+		return nil, errNoTrustAnchor
+	}
+
+	// 2. otherwise, fetch and validate the DS RRset
+	resp, err := val.exchange(zone, dns.TypeDS)
+	var nae *NegativeAnswerError
+	switch {
+	case errors.As(err, &nae):
+		status, delegation, perr := val.noDS(zone, nae.Response)
+		if status == ValidationSecure && delegation {
+			return nil, fmt.Errorf("%w: %s", errInsecureZone, zone)
+		}
+		if status == ValidationSecure {
+			return nil, bogus("missing DS for %s", zone)
+		}
+		return nil, perr
+
+	case err != nil:
+		return nil, bogus("cannot fetch DS for %s: %s", zone, err)
+	}
+	var dsset []*dns.DS
+	for _, set := range groupRRsets(resp.ValidRRs) {
+		if set.rrtype != dns.TypeDS {
+			continue
+		}
+		if !strings.EqualFold(set.name, zone) || !parentSigned(set, zone) {
+			return nil, bogus("DS for %s not signed by an ancestor", zone)
+		}
+		if status, err := val.rrset(set); status != ValidationSecure {
+			return nil, err
+		}
+		for _, rr := range set.rrs {
+			dsset = append(dsset, rr.(*dns.DS))
+		}
+	}
+	return dsset, nil
+}
+
+// parentSigned returns whether all the RRSIG records of the set are
+// signed by a proper ancestor of the zone.
+func parentSigned(set *rrset, zone string) bool {
+	for _, sig := range set.sigs {
+		if strings.EqualFold(sig.SignerName, zone) || !dns.IsSubDomain(sig.SignerName, zone) {
+			return false
+		}
+	}
+	return true
+}
+
+// noDS looks for a signed NSEC or NSEC3 record proving that name has no DS
+// records and returns [ValidationSecure] when the proof is valid along
+// with whether the name is a delegation (i.e., it has NS records).
+func (val *validation) noDS(name string, msg *dns.Msg) (ValidationStatus, bool, error) {
+	err := bogus("no proof that %s has no DS", name)
+	for _, set := range groupRRsets(msg.Ns) {
+		if len(set.rrs) <= 0 || !parentSigned(set, name) {
+			continue
+		}
+		var bitmap []uint16
+		switch rr := set.rrs[0].(type) {
+		case *dns.NSEC:
+			if !strings.EqualFold(rr.Hdr.Name, name) {
+				continue
+			}
+			bitmap = rr.TypeBitMap
+		case *dns.NSEC3:
+			if !rr.Match(name) {
+				continue
+			}
+			bitmap = rr.TypeBitMap
+		default:
+			continue
+		}
+		if containsType(bitmap, dns.TypeDS) {
+			continue
+		}
+		status, serr := val.rrset(set)
+		if status == ValidationSecure {
+			return status, containsType(bitmap, dns.TypeNS), nil
+		}
+		return status, false, serr
+	}
+	return ValidationBogus, false, err
+}
+
+// containsType returns whether the type bitmap contains the type.
+func containsType(bitmap []uint16, rrtype uint16) bool {
+	for _, t := range bitmap {
+		if t == rrtype {
+			return true
+		}
+	}
+	return false
+}
+
+// unsigned determines whether an RRset without RRSIG records is insecure, by
+// walking up the tree looking for a proof of an insecure delegation, or bogus,
+// because we reach a signed zone first.
+func (val *validation) unsigned(set *rrset) (ValidationStatus, error) {
+	for name := strings.ToLower(dns.Fqdn(set.name)); ; name = parentName(name) {
+		if len(val.v.anchorsFor(name)) > 0 {
+			return ValidationBogus, bogus("unsigned %s below the trust anchor %s", set.name, name)
+		}
+		if name == "." {
+			return ValidationIndeterminate, errNoTrustAnchor
+		}
+		_, err := val.exchange(name, dns.TypeDS)
+		var nae *NegativeAnswerError
+		switch {
+		case errors.As(err, &nae):
+			// without a proof, we keep walking up, which is safe since we can
+			// only end up finding a proof or a signed zone
+			status, delegation, perr := val.noDS(name, nae.Response)
+			if status == ValidationSecure && delegation {
+				return ValidationInsecure, fmt.Errorf("%w: %s", errInsecureZone, name)
+			}
+			if status == ValidationInsecure {
+				return status, perr
+			}
+
+		case err != nil:
+			return ValidationBogus, bogus("cannot fetch DS for %s: %s", name, err)
+
+		default:
+			if _, err := val.zoneKeys(name); statusFromError(err) != ValidationSecure {
+				return statusFromError(err), err
+			}
+			return ValidationBogus, bogus("unsigned %s in the signed zone %s", set.name, name)
+		}
+	}
+}
+
+// parentName returns the parent of the given FQDN.
+func parentName(name string) string {
+	off, end := dns.NextLabel(name, 0)
+	if end {
+		return "."
+	}
+	return name[off:]
+}
@@ -0,0 +1,355 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// signedZone is a zone signed using a single ECDSA key.
+type signedZone struct {
+	// name is the zone name.
+	name string
+
+	// key is the zone key.
+	key *dns.DNSKEY
+
+	// priv is the private key.
+	priv crypto.Signer
+}
+
+// newSignedZone creates a [*signedZone] with a fresh key.
+func newSignedZone(t *testing.T, name string) *signedZone {
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 300},
+		Flags:     dns.ZONE | dns.SEP,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	require.NoError(t, err)
+	return &signedZone{name: name, key: key, priv: priv.(crypto.Signer)}
+}
+
+// sign returns the records followed by an RRSIG valid in the given period.
+func (z *signedZone) sign(t *testing.T, inception, expiration time.Time, rrs ...dns.RR) []dns.RR {
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: rrs[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: 300},
+		Algorithm:  z.key.Algorithm,
+		SignerName: z.name,
+		KeyTag:     z.key.KeyTag(),
+		Inception:  uint32(inception.Unix()),
+		Expiration: uint32(expiration.Unix()),
+	}
+	require.NoError(t, sig.Sign(z.priv, rrs))
+	return append(rrs, sig)
+}
+
+// signNow is like sign but uses a validity period around the current time.
+func (z *signedZone) signNow(t *testing.T, rrs ...dns.RR) []dns.RR {
+	return z.sign(t, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), rrs...)
+}
+
+// keyRRset returns the signed DNSKEY RRset of the zone.
+func (z *signedZone) keyRRset(t *testing.T) []dns.RR {
+	return z.signNow(t, z.key)
+}
+
+// ds returns the DS record of the zone key.
+func (z *signedZone) ds() *dns.DS {
+	return z.key.ToDS(dns.SHA256)
+}
+
+// mustNewRR parses a record.
+func mustNewRR(t *testing.T, s string) dns.RR {
+	rr, err := dns.NewRR(s)
+	require.NoError(t, err)
+	return rr
+}
+
+// newSignedHierarchy returns a [*dnsoverhttps.StaticZone] serving a signed root,
+// the signed "test." and "secure.test." zones, and the unsigned "insecure.test."
+// zone, along with the root trust anchor.
+func newSignedHierarchy(t *testing.T) (*dnsoverhttps.StaticZone, *dns.DS) {
+	root := newSignedZone(t, ".")
+	tld := newSignedZone(t, "test.")
+	secure := newSignedZone(t, "secure.test.")
+
+	var records []dns.RR
+	add := func(rrs ...dns.RR) {
+		records = append(records, rrs...)
+	}
+
+	// the root zone
+	add(root.keyRRset(t)...)
+	add(root.signNow(t, tld.ds())...)
+
+	// the test. zone
+	add(tld.keyRRset(t)...)
+	add(tld.signNow(t, secure.ds())...)
+	add(mustNewRR(t, "insecure.test. 300 IN NS ns.insecure.test."))
+	add(tld.signNow(t, &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: "insecure.test.", Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 300},
+		NextDomain: "secure.test.",
+		TypeBitMap: []uint16{dns.TypeNS, dns.TypeRRSIG, dns.TypeNSEC},
+	})...)
+
+	// the secure.test. zone
+	add(secure.keyRRset(t)...)
+	add(secure.signNow(t, mustNewRR(t, "www.secure.test. 300 IN A 192.0.2.1"))...)
+	add(secure.signNow(t, mustNewRR(t, "alias.secure.test. 300 IN CNAME www.secure.test."))...)
+	add(mustNewRR(t, "unsigned.secure.test. 300 IN A 192.0.2.3"))
+	add(secure.sign(t, time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour),
+		mustNewRR(t, "expired.secure.test. 300 IN A 192.0.2.4"))...)
+	forged := secure.signNow(t, mustNewRR(t, "bogus.secure.test. 300 IN A 192.0.2.2"))
+	forged[0].(*dns.A).A = []byte{192, 0, 2, 66}
+	add(forged...)
+
+	// the insecure.test. zone
+	add(mustNewRR(t, "www.insecure.test. 300 IN A 192.0.2.5"))
+
+	return dnsoverhttps.NewStaticZone(records...), root.ds()
+}
+
+func TestValidatorValidate(t *testing.T) {
+	zone, anchor := newSignedHierarchy(t)
+	srv := httptest.NewServer(dnsoverhttps.NewScriptedHandler(zone.Reply))
+	defer srv.Close()
+	dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+
+	otherAnchor := newSignedZone(t, "other.").ds()
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// qname is the query name.
+		qname string
+
+		// anchors contains the trust anchors.
+		anchors []*dns.DS
+
+		// wantStatus is the expected status.
+		wantStatus dnsoverhttps.ValidationStatus
+
+		// wantBogus indicates whether the error should wrap ErrDNSSECBogus.
+		wantBogus bool
+	}
+
+	testCases := []testCase{
+		{
+			name:       "secure",
+			qname:      "www.secure.test",
+			anchors:    []*dns.DS{anchor},
+			wantStatus: dnsoverhttps.ValidationSecure,
+		},
+
+		{
+			name:       "secure CNAME chain",
+			qname:      "alias.secure.test",
+			anchors:    []*dns.DS{anchor},
+			wantStatus: dnsoverhttps.ValidationSecure,
+		},
+
+		{
+			name:       "insecure delegation",
+			qname:      "www.insecure.test",
+			anchors:    []*dns.DS{anchor},
+			wantStatus: dnsoverhttps.ValidationInsecure,
+		},
+
+		{
+			name:       "forged answer",
+			qname:      "bogus.secure.test",
+			anchors:    []*dns.DS{anchor},
+			wantStatus: dnsoverhttps.ValidationBogus,
+			wantBogus:  true,
+		},
+
+		{
+			name:       "stripped signature",
+			qname:      "unsigned.secure.test",
+			anchors:    []*dns.DS{anchor},
+			wantStatus: dnsoverhttps.ValidationBogus,
+			wantBogus:  true,
+		},
+
+		{
+			name:       "expired signature",
+			qname:      "expired.secure.test",
+			anchors:    []*dns.DS{anchor},
+			wantStatus: dnsoverhttps.ValidationBogus,
+			wantBogus:  true,
+		},
+
+		{
+			name:       "wrong trust anchor",
+			qname:      "www.secure.test",
+			anchors:    dnsoverhttps.DefaultRootTrustAnchors(),
+			wantStatus: dnsoverhttps.ValidationBogus,
+			wantBogus:  true,
+		},
+
+		{
+			name:       "no covering trust anchor",
+			qname:      "www.secure.test",
+			anchors:    []*dns.DS{otherAnchor},
+			wantStatus: dnsoverhttps.ValidationIndeterminate,
+		},
+
+		{
+			name:       "trust anchor below the root",
+			qname:      "www.secure.test",
+			anchors:    []*dns.DS{newSignedZone(t, "secure.test.").ds()},
+			wantStatus: dnsoverhttps.ValidationBogus,
+			wantBogus:  true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := dt.Exchange(context.Background(), dnscodec.NewQuery(tt.qname, dns.TypeA))
+			require.NoError(t, err)
+
+			v := dnsoverhttps.NewValidator(dt)
+			v.TrustAnchors = tt.anchors
+			result := v.Validate(context.Background(), resp)
+			assert.Equal(t, tt.wantStatus, result.Status, "%v", result.Err)
+			if tt.wantStatus == dnsoverhttps.ValidationSecure {
+				assert.NoError(t, result.Err)
+			} else {
+				assert.Error(t, result.Err)
+			}
+			assert.Equal(t, tt.wantBogus, errors.Is(result.Err, dnsoverhttps.ErrDNSSECBogus))
+		})
+	}
+}
+
+func TestValidatorExchange(t *testing.T) {
+	zone, anchor := newSignedHierarchy(t)
+	srv := httptest.NewServer(dnsoverhttps.NewScriptedHandler(zone.Reply))
+	defer srv.Close()
+
+	var (
+		names   []string
+		results []*dnsoverhttps.ValidationResult
+	)
+	v := dnsoverhttps.NewValidator(dnsoverhttps.NewTransport(srv.Client(), srv.URL))
+	v.TrustAnchors = []*dns.DS{anchor}
+	v.ObserveValidation = func(name string, result *dnsoverhttps.ValidationResult) {
+		names = append(names, name)
+		results = append(results, result)
+	}
+
+	resp, err := v.Exchange(context.Background(), dnscodec.NewQuery("www.secure.test", dns.TypeA))
+	require.NoError(t, err)
+	addrs, err := resp.RecordsA()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"192.0.2.1"}, addrs)
+
+	// failed exchanges are not validated
+	_, err = v.Exchange(context.Background(), dnscodec.NewQuery("nonexistent.secure.test", dns.TypeA))
+	require.ErrorIs(t, err, dnscodec.ErrNoName)
+
+	require.Len(t, results, 1)
+	assert.Equal(t, []string{"www.secure.test"}, names)
+	assert.Equal(t, dnsoverhttps.ValidationSecure, results[0].Status)
+}
+
+func TestValidatorADPolicy(t *testing.T) {
+	zone, anchor := newSignedHierarchy(t)
+	srv := httptest.NewServer(dnsoverhttps.NewScriptedHandler(func(query *dns.Msg) *dns.Msg {
+		resp := zone.Reply(query)
+		resp.AuthenticatedData = true
+		return resp
+	}))
+	defer srv.Close()
+
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// policy is the AD policy.
+		policy dnsoverhttps.ADPolicy
+
+		// checkingDisabled indicates whether to set the CD bit.
+		checkingDisabled bool
+
+		// wantStatus is the expected status.
+		wantStatus dnsoverhttps.ValidationStatus
+
+		// wantTrustedAD is the expected TrustedAD value.
+		wantTrustedAD bool
+	}
+
+	testCases := []testCase{
+		{
+			name:       "validate",
+			policy:     dnsoverhttps.ADPolicyValidate,
+			wantStatus: dnsoverhttps.ValidationBogus,
+		},
+
+		{
+			name:          "trust",
+			policy:        dnsoverhttps.ADPolicyTrust,
+			wantStatus:    dnsoverhttps.ValidationSecure,
+			wantTrustedAD: true,
+		},
+
+		{
+			name:             "trust with checking disabled",
+			policy:           dnsoverhttps.ADPolicyTrust,
+			checkingDisabled: true,
+			wantStatus:       dnsoverhttps.ValidationBogus,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			dt := dnsoverhttps.NewTransport(srv.Client(), srv.URL)
+			dt.CheckingDisabled = tt.checkingDisabled
+			resp, err := dt.Exchange(context.Background(), dnscodec.NewQuery("bogus.secure.test", dns.TypeA))
+			require.NoError(t, err)
+
+			v := dnsoverhttps.NewValidator(dt)
+			v.TrustAnchors = []*dns.DS{anchor}
+			v.ADPolicy = tt.policy
+			result := v.Validate(context.Background(), resp)
+			assert.Equal(t, tt.wantStatus, result.Status)
+			assert.True(t, result.Authenticated)
+			assert.Equal(t, tt.wantTrustedAD, result.TrustedAD)
+		})
+	}
+}
+
+func TestValidatorValidateWithoutAnswer(t *testing.T) {
+	v := dnsoverhttps.NewValidator(nil)
+	result := v.Validate(context.Background(), &dnscodec.Response{})
+	assert.Equal(t, dnsoverhttps.ValidationIndeterminate, result.Status)
+	assert.Error(t, result.Err)
+}
+
+func TestValidationStatusString(t *testing.T) {
+	assert.Equal(t, "indeterminate", dnsoverhttps.ValidationIndeterminate.String())
+	assert.Equal(t, "secure", dnsoverhttps.ValidationSecure.String())
+	assert.Equal(t, "insecure", dnsoverhttps.ValidationInsecure.String())
+	assert.Equal(t, "bogus", dnsoverhttps.ValidationBogus.String())
+	assert.Equal(t, "ValidationStatus(7)", dnsoverhttps.ValidationStatus(7).String())
+}
+
+func TestADPolicyString(t *testing.T) {
+	assert.Equal(t, "validate", dnsoverhttps.ADPolicyValidate.String())
+	assert.Equal(t, "trust", dnsoverhttps.ADPolicyTrust.String())
+	assert.Equal(t, "ADPolicy(7)", dnsoverhttps.ADPolicy(7).String())
+}
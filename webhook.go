@@ -0,0 +1,264 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrSinkClosed indicates that we cannot emit events to a closed [Sink].
+var ErrSinkClosed = errors.New("sink closed")
+
+// WebhookSink is a [Sink] POSTing batches of JSON Lines records to an
+// HTTP endpoint, which allows distributed probes to stream data home.
+//
+// A background goroutine delivers the batches, retrying failed deliveries. When
+// the queue is full, [*WebhookSink.Emit] blocks, thus applying backpressure.
+// Call [*WebhookSink.Close] when done to deliver the pending events, which
+// aborts the pending attempts and retries after the CloseTimeout.
+//
+// Construct using [NewWebhookSink] and configure before the first Emit.
+type WebhookSink struct {
+	// Client is the [Client] to use.
+	//
+	// Set by [NewWebhookSink] to the user-provided value.
+	Client Client
+
+	// URL is the endpoint URL.
+	//
+	// Set by [NewWebhookSink] to the user-provided value.
+	URL string
+
+	// BatchSize is the maximum number of events per batch.
+	//
+	// Set by [NewWebhookSink] to 64.
+	BatchSize int
+
+	// FlushInterval is the maximum time an event waits before delivery.
+	// Zero means that we deliver only full batches and when closing.
+	//
+	// Set by [NewWebhookSink] to 5 seconds.
+	FlushInterval time.Duration
+
+	// QueueSize is the number of events we queue before blocking.
+	//
+	// Set by [NewWebhookSink] to 1024.
+	QueueSize int
+
+	// Retries is the number of times we retry a failed delivery.
+	//
+	// Set by [NewWebhookSink] to 3.
+	Retries int
+
+	// RetryDelay is the delay before each retry.
+	//
+	// Set by [NewWebhookSink] to 1 second.
+	RetryDelay time.Duration
+
+	// Timeout is the maximum duration of each delivery attempt.
+	// Zero means that attempts have no timeout.
+	//
+	// Set by [NewWebhookSink] to 30 seconds.
+	Timeout time.Duration
+
+	// CloseTimeout is the maximum time [*WebhookSink.Close] waits for delivering
+	// the pending events, after which we abort the pending attempts and retries.
+	// Zero means that Close waits until we deliver or give up.
+	//
+	// Set by [NewWebhookSink] to 30 seconds.
+	CloseTimeout time.Duration
+
+	// cancel cancels ctx.
+	cancel context.CancelFunc
+
+	// closed is true after Close.
+	closed bool
+
+	// ctx is the context of the delivery attempts and retry delays.
+	ctx context.Context
+
+	// done is closed when the background goroutine terminates.
+	done chan struct{}
+
+	// err is the first delivery error.
+	err error
+
+	// errMu protects err.
+	errMu sync.Mutex
+
+	// mu protects closed and makes sending and closing queue mutually exclusive.
+	mu sync.RWMutex
+
+	// once starts the background goroutine.
+	once sync.Once
+
+	// queue contains the serialized events.
+	queue chan []byte
+}
+
+var _ Sink = &WebhookSink{}
+
+// NewWebhookSink creates a new [*WebhookSink] POSTing to the given URL.
+func NewWebhookSink(client Client, URL string) *WebhookSink {
+	return &WebhookSink{
+		Client:        client,
+		URL:           URL,
+		BatchSize:     64,
+		FlushInterval: 5 * time.Second,
+		QueueSize:     1024,
+		Retries:       3,
+		RetryDelay:    time.Second,
+		Timeout:       30 * time.Second,
+		CloseTimeout:  30 * time.Second,
+		done:          make(chan struct{}),
+	}
+}
+
+// Emit implements [Sink].
+//
+// Since we deliver asynchronously, the returned error is either a serialization
+// error or the first delivery error, after which [*SinkObserver] stops emitting.
+// When the queue is full, we wait for room until the CloseTimeout of a pending
+// [*WebhookSink.Close] expires, after which we return [ErrSinkClosed].
+func (s *WebhookSink) Emit(event any) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s.once.Do(s.start)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrSinkClosed
+	}
+	select {
+	case s.queue <- data:
+		return s.Err()
+	case <-s.ctx.Done():
+		return ErrSinkClosed
+	}
+}
+
+// start creates the queue and the context and starts the background goroutine.
+func (s *WebhookSink) start() {
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.queue = make(chan []byte, max(s.QueueSize, 0))
+	go s.loop()
+}
+
+// loop batches the queued events until the queue is closed.
+func (s *WebhookSink) loop() {
+	defer close(s.done)
+	var tick <-chan time.Time
+	if s.FlushInterval > 0 {
+		ticker := time.NewTicker(s.FlushInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	var batch [][]byte
+	for {
+		select {
+		case data, ok := <-s.queue:
+			if !ok {
+				s.deliver(batch)
+				return
+			}
+			batch = append(batch, data)
+			if len(batch) >= s.BatchSize {
+				s.deliver(batch)
+				batch = nil
+			}
+		case <-tick:
+			s.deliver(batch)
+			batch = nil
+		}
+	}
+}
+
+// deliver POSTs the batch, if not empty, retrying on failure.
+func (s *WebhookSink) deliver(batch [][]byte) {
+	if len(batch) <= 0 {
+		return
+	}
+	body := append(bytes.Join(batch, []byte("\n")), '\n')
+	err := s.post(body)
+	for attempt := 0; err != nil && attempt < s.Retries; attempt++ {
+		if !sleepContext(s.ctx, s.RetryDelay) {
+			break
+		}
+		err = s.post(body)
+	}
+	if err != nil {
+		s.errMu.Lock()
+		if s.err == nil {
+			s.err = err
+		}
+		s.errMu.Unlock()
+	}
+}
+
+// post performs a single delivery attempt.
+func (s *WebhookSink) post(body []byte) error {
+	ctx := s.ctx
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook delivery failed with status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Err returns the first delivery error, if any.
+func (s *WebhookSink) Err() error {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	return s.err
+}
+
+// Close stops accepting events, delivers the pending events, and returns
+// the first delivery error, if any. After the CloseTimeout, we abort the
+// pending attempts and retries, which causes delivery errors.
+//
+// This method is idempotent and safe to call from multiple goroutines.
+func (s *WebhookSink) Close() error {
+	// 1. arm the timeout before locking, since Emit may hold the read lock while
+	// waiting for room in the queue, which is bounded by the timeout
+	s.once.Do(s.start)
+	if s.CloseTimeout > 0 {
+		timer := time.AfterFunc(s.CloseTimeout, s.cancel)
+		defer timer.Stop()
+	}
+
+	// 2. close the queue and wait for delivering the pending events
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+	<-s.done
+	s.cancel()
+	return s.Err()
+}
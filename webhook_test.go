@@ -0,0 +1,231 @@
+// SPDX-License-Identifier: GPL-3.0-or-later
+
+package dnsoverhttps_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bassosimone/dnscodec"
+	"github.com/bassosimone/dnsoverhttps"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookServer records the batches it receives and fails the first failures requests.
+type webhookServer struct {
+	batches  [][]string
+	failures int
+	mu       sync.Mutex
+}
+
+func (ws *webhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if ws.failures > 0 {
+		ws.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	ws.batches = append(ws.batches, lines)
+}
+
+func TestWebhookSink(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// failures is the number of failing deliveries.
+		failures int
+
+		// wantBatches contains the expected batch sizes.
+		wantBatches []int
+
+		// wantErr indicates whether we expect an error.
+		wantErr bool
+	}
+
+	testCases := []testCase{
+		{name: "success", failures: 0, wantBatches: []int{2, 2, 1}},
+		{name: "retries", failures: 2, wantBatches: []int{2, 2, 1}},
+		{name: "failure", failures: 100, wantBatches: nil, wantErr: true},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			ws := &webhookServer{failures: tt.failures}
+			srv := httptest.NewServer(ws)
+			defer srv.Close()
+
+			sink := dnsoverhttps.NewWebhookSink(srv.Client(), srv.URL)
+			sink.BatchSize = 2
+			sink.FlushInterval = 0
+			sink.RetryDelay = time.Millisecond
+			for idx := range 5 {
+				_ = sink.Emit(map[string]int{"idx": idx})
+			}
+			err := sink.Close()
+			if tt.wantErr {
+				require.ErrorContains(t, err, "status code 503")
+			} else {
+				require.NoError(t, err)
+			}
+			require.ErrorIs(t, sink.Emit(1), dnsoverhttps.ErrSinkClosed)
+			require.Equal(t, err, sink.Close())
+
+			var sizes []int
+			for _, batch := range ws.batches {
+				sizes = append(sizes, len(batch))
+			}
+			assert.Equal(t, tt.wantBatches, sizes)
+			if !tt.wantErr {
+				assert.Equal(t, []string{`{"idx":0}`, `{"idx":1}`}, ws.batches[0])
+			}
+		})
+	}
+}
+
+func TestWebhookSinkFlushInterval(t *testing.T) {
+	ws := &webhookServer{}
+	srv := httptest.NewServer(ws)
+	defer srv.Close()
+
+	sink := dnsoverhttps.NewWebhookSink(srv.Client(), srv.URL)
+	sink.FlushInterval = 10 * time.Millisecond
+	dnsSrv := newStaticServer(t, func(query *dns.Msg) *dns.Msg {
+		resp := &dns.Msg{}
+		require.NoError(t, resp.Unpack(buildDNSResponse(t, query)))
+		return resp
+	})
+	defer dnsSrv.Close()
+	obs := dnsoverhttps.NewSinkObserver(sink)
+	dt := dnsoverhttps.NewTransport(dnsSrv.Client(), dnsSrv.URL)
+	dt.ObserveExchange = obs.ObserveExchange
+
+	_, err := dt.Exchange(context.Background(), dnscodec.NewQuery("dns.google", dns.TypeA))
+	require.NoError(t, err)
+
+	// the partial batch is delivered without closing
+	assert.Eventually(t, func() bool {
+		ws.mu.Lock()
+		defer ws.mu.Unlock()
+		return len(ws.batches) == 1 && len(ws.batches[0]) == 1
+	}, 5*time.Second, 5*time.Millisecond)
+	require.NoError(t, sink.Close())
+	require.NoError(t, obs.Err())
+}
+
+func TestWebhookSinkTimeouts(t *testing.T) {
+	type testCase struct {
+		// name is the subtest name.
+		name string
+
+		// handler is the webhook handler.
+		handler http.HandlerFunc
+
+		// timeout is the WebhookSink Timeout.
+		timeout time.Duration
+
+		// closeTimeout is the WebhookSink CloseTimeout.
+		closeTimeout time.Duration
+
+		// wantErr is the expected error substring.
+		wantErr string
+	}
+
+	testCases := []testCase{
+		{
+			name: "attempt timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.Copy(io.Discard, r.Body)
+				<-r.Context().Done()
+			},
+			timeout: 10 * time.Millisecond,
+			wantErr: "context deadline exceeded",
+		},
+
+		{
+			name: "close timeout aborts retries",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			},
+			closeTimeout: 10 * time.Millisecond,
+			wantErr:      "status code 503",
+		},
+
+		{
+			name: "close timeout aborts attempts",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.Copy(io.Discard, r.Body)
+				<-r.Context().Done()
+			},
+			closeTimeout: 10 * time.Millisecond,
+			wantErr:      "context canceled",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+
+			sink := dnsoverhttps.NewWebhookSink(srv.Client(), srv.URL)
+			sink.Retries = 100
+			sink.RetryDelay = time.Hour
+			sink.Timeout = tt.timeout
+			sink.CloseTimeout = tt.closeTimeout
+			if tt.timeout > 0 {
+				sink.Retries = 0
+			}
+			require.NoError(t, sink.Emit(1))
+
+			start := time.Now()
+			require.ErrorContains(t, sink.Close(), tt.wantErr)
+			assert.Less(t, time.Since(start), 5*time.Second)
+		})
+	}
+}
+
+func TestWebhookSinkCloseWithBlockedEmit(t *testing.T) {
+	// the endpoint never answers
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	sink := dnsoverhttps.NewWebhookSink(srv.Client(), srv.URL)
+	sink.BatchSize = 1
+	sink.QueueSize = 1
+	sink.Retries = 0
+	sink.Timeout = 0
+	sink.CloseTimeout = 10 * time.Millisecond
+
+	// the first event is being delivered, the second one fills the
+	// queue, and the third one blocks waiting for room
+	require.NoError(t, sink.Emit(0))
+	require.NoError(t, sink.Emit(1))
+	blocked := make(chan error, 1)
+	go func() {
+		blocked <- sink.Emit(2)
+	}()
+
+	start := time.Now()
+	require.ErrorContains(t, sink.Close(), "context canceled")
+	assert.Less(t, time.Since(start), 5*time.Second)
+	require.ErrorIs(t, <-blocked, dnsoverhttps.ErrSinkClosed)
+}